@@ -24,11 +24,17 @@ func main() {
 
 	command := cmd.NewDefaultVendirCmd(confUI)
 
-	err := command.Execute()
+	executedCmd, err := command.ExecuteC()
 	if err != nil {
 		confUI.ErrorLinef("Error: %v", err)
 		os.Exit(1)
 	}
 
+	// Stdout only contains summary when it is requested as JSON
+	if flag := executedCmd.Flags().Lookup("summary-json"); flag != nil && flag.Value.String() == "true" {
+		confUI.ErrorLinef("Succeeded")
+		return
+	}
+
 	confUI.PrintLinef("Succeeded")
 }
@@ -1,16 +1,24 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cppforlife/go-cli-ui/ui"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
 	ctldir "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/directory"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
 )
 
 const (
@@ -19,17 +27,66 @@ const (
 )
 
 type SyncOptions struct {
-	ui ui.UI
+	ui     ui.UI
+	stdout io.Writer
 
-	Files    []string
-	LockFile string
+	Files      []string
+	SecretDirs []string
+	LockFile   string
+	LockFormat string
+	Chdir      string
+	Strict     bool
 
-	Directories []string
-	Locked      bool
+	Directories     []string
+	Locked          bool
+	FailIfUnchanged bool
+	ContinueOnError bool
+	OfflineFallback bool
+
+	TempDir     string
+	Parallelism int
+	GroupOutput bool
+	DryRun      bool
+	LockOnly    bool
+	List        bool
+
+	Retries      int
+	RetryBackoff time.Duration
+
+	GithubRateLimitWait time.Duration
+
+	Lazy bool
+
+	CacheDir       string
+	CacheMaxSizeMB int64
+	CacheRetention int
+
+	Timeout     time.Duration
+	Diff        bool
+	SummaryJSON bool
+
+	RecordFileChecksums bool
+	ChecksumDelta       bool
+	RecordStats         bool
+
+	MinFreeSpaceMB int64
+
+	MaxDownloadRateKB int64
+
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+
+	CABundle string
+
+	DirMode  string
+	FileMode string
+
+	Dedup bool
 }
 
 func NewSyncOptions(ui ui.UI) *SyncOptions {
-	return &SyncOptions{ui: ui}
+	return &SyncOptions{ui: ui, stdout: os.Stdout}
 }
 
 func NewSyncCmd(o *SyncOptions) *cobra.Command {
@@ -39,15 +96,108 @@ func NewSyncCmd(o *SyncOptions) *cobra.Command {
 		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
 	}
 	cmd.Flags().StringSliceVarP(&o.Files, "file", "f", []string{defaultConfigName}, "Set configuration file")
+	cmd.Flags().StringSliceVar(&o.SecretDirs, "secret-dir", nil, "Set directory with secrets laid out as <dir>/<secret-name>/<key> (e.g. mounted K8s secrets) used when secret is not found in configuration")
 	cmd.Flags().StringVar(&o.LockFile, "lock-file", defaultLockName, "Set lock file")
+	cmd.Flags().StringVarP(&o.Chdir, "chdir", "C", "", "Set directory against which configuration, lock file and relative paths within configuration are resolved (defaults to current directory)")
+	cmd.Flags().BoolVar(&o.Strict, "strict", false, "Fail if configuration includes unknown fields (e.g. misspelled keys) instead of ignoring them")
+	cmd.Flags().StringVar(&o.LockFormat, "lock-format", "", "Set lock file format (yaml or json; defaults to format based on lock file extension)")
 
 	cmd.Flags().StringSliceVarP(&o.Directories, "directory", "d", nil, "Sync specific directory (format: dir/sub-dir[=local-dir])")
-	cmd.Flags().BoolVarP(&o.Locked, "locked", "l", false, "Consult lock file to pull exact references (e.g. use git sha instead of branch name)")
+	cmd.Flags().BoolVarP(&o.Locked, "locked", "l", false, "Consult lock file to pull exact references (e.g. use git sha instead of branch name) and fail if upstream has changed")
+	cmd.Flags().BoolVar(&o.FailIfUnchanged, "fail-if-unchanged", false, "Fail if resolved references of all contents within a directory match lock file")
+	cmd.Flags().BoolVar(&o.ContinueOnError, "continue-on-error", false, "Keep existing files of failed contents and continue syncing other contents (fails at the end)")
+	cmd.Flags().BoolVar(&o.OfflineFallback, "offline-fallback", false, "Keep existing files of contents (matching lock file) when their source is unreachable")
+
+	cmd.Flags().StringVar(&o.TempDir, "tmp-dir", "", "Set directory for temporary files (defaults to current directory)")
+	cmd.Flags().IntVar(&o.Parallelism, "parallelism", 1, "Set number of directory contents fetched concurrently")
+	cmd.Flags().BoolVar(&o.GroupOutput, "group-output", false, "Prefix output lines with contents path and print output of each contents at once after it is synced")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "Fetch contents and show resulting lock config without changing directories or lock file")
+	cmd.Flags().BoolVar(&o.LockOnly, "lock-only", false, "Resolve contents references and update lock file without changing directories")
+	cmd.Flags().BoolVar(&o.List, "list", false, "List versions available for git, helmChart and githubRelease contents without fetching them or changing lock file")
+
+	cmd.Flags().IntVar(&o.Retries, "retries", 0, "Set number of retries for failed network fetches")
+	cmd.Flags().DurationVar(&o.RetryBackoff, "retry-backoff", time.Second, "Set initial delay between retries (doubled after each retry)")
+	cmd.Flags().DurationVar(&o.GithubRateLimitWait, "github-rate-limit-wait", 0, "Set maximum duration to wait for GitHub API rate limit to reset before failing (0 means no waiting)")
+
+	cmd.Flags().StringVar(&o.CacheDir, "cache-dir", os.Getenv("VENDIR_CACHE_DIR"), "Set directory for caching downloaded artifacts across syncs (disabled by default)")
+	cmd.Flags().Int64Var(&o.CacheMaxSizeMB, "cache-max-size", 0, "Set maximum cache size in megabytes; least recently used entries are pruned (0 means unbounded)")
+	cmd.Flags().IntVar(&o.CacheRetention, "cache-retention", 0, "Set number of recently synced versions of each http/githubRelease contents to keep in cache (0 means all)")
+
+	cmd.Flags().BoolVar(&o.Lazy, "lazy", false, "Skip fetching contents whose configuration and files did not change since last sync")
+
+	cmd.Flags().DurationVar(&o.Timeout, "timeout", 0, "Set maximum duration of entire sync (0 means no limit)")
+	cmd.Flags().BoolVar(&o.Diff, "diff", false, "Show files added, modified or removed in each directory")
+	cmd.Flags().BoolVar(&o.SummaryJSON, "summary-json", false, "Write sync summary as JSON to stdout (other output is written to stderr)")
+	cmd.Flags().BoolVar(&o.RecordFileChecksums, "record-file-checksums", false, "Record sha256 checksum of every synced file in lock file")
+	cmd.Flags().BoolVar(&o.ChecksumDelta, "checksum-delta", false, "Show files whose checksums changed compared to checksums recorded in lock file (requires --record-file-checksums)")
+	cmd.Flags().BoolVar(&o.RecordStats, "record-stats", false, "Record transferred bytes, size and duration of every synced contents in lock file")
+	cmd.Flags().Int64Var(&o.MaxDownloadRateKB, "max-download-rate", 0, "Set maximum download rate in kilobytes per second shared by all downloads (0 means no limit; not applied to downloads by external tools such as git or imgpkg)")
+	cmd.Flags().Int64Var(&o.MinFreeSpaceMB, "min-free-space", 0, "Set free disk space in megabytes required before syncing each directory (0 disables check)")
+
+	cmd.Flags().StringVar(&o.HTTPProxy, "http-proxy", "", "Set proxy for http requests (takes precedence over HTTP_PROXY env variable)")
+	cmd.Flags().StringVar(&o.HTTPSProxy, "https-proxy", "", "Set proxy for https requests (takes precedence over HTTPS_PROXY env variable)")
+	cmd.Flags().StringVar(&o.NoProxy, "no-proxy", "", "Set comma separated hosts, domains or CIDRs accessed without proxy (takes precedence over NO_PROXY env variable)")
+	cmd.Flags().StringVar(&o.DirMode, "dir-mode", "", "Set octal permissions (e.g. 0750) of created and synced directories (default: 0700 for temporary directories, 0755 otherwise)")
+	cmd.Flags().StringVar(&o.FileMode, "file-mode", "", "Set octal permissions (e.g. 0640) of synced files; executable files stay executable where readable (default: preserve)")
+	cmd.Flags().BoolVar(&o.Dedup, "dedup", false, "Hardlink identical files across synced directories instead of storing copies (files must not be modified in place; copies are kept across filesystems)")
+	cmd.Flags().StringVar(&o.CABundle, "ca-bundle", "", "Set file path (or inline PEM) of CA certificates trusted by all HTTPS sources in addition to system CA certificates")
 	return cmd
 }
 
 func (o *SyncOptions) Run() error {
-	conf, secrets, configMaps, err := ctlconf.NewConfigFromFiles(o.Files)
+	// Keep stdout parseable by moving progress output to stderr
+	if o.SummaryJSON {
+		o.ui = ui.NewWriterUI(os.Stderr, os.Stderr, ui.NewNoopLogger())
+	}
+
+	// Values of resolved secrets are redacted from all output
+	redactor := ctldir.NewRedactor()
+	o.ui = ctldir.NewRedactingUI(o.ui, redactor)
+
+	return redactor.RedactError(o.run(redactor))
+}
+
+func (o *SyncOptions) run(redactor *ctldir.Redactor) error {
+	if o.DryRun && o.LockOnly {
+		return fmt.Errorf("Expected only one of --dry-run or --lock-only to be specified")
+	}
+	if o.Locked && o.FailIfUnchanged {
+		return fmt.Errorf("Expected only one of --locked or --fail-if-unchanged to be specified")
+	}
+	if o.List && (o.Locked || o.LockOnly || o.DryRun) {
+		return fmt.Errorf("Expected --list to not be used with --locked, --lock-only or --dry-run")
+	}
+	if o.ChecksumDelta && !o.RecordFileChecksums {
+		return fmt.Errorf("Expected --checksum-delta to be used with --record-file-checksums")
+	}
+	if o.CacheRetention < 0 {
+		return fmt.Errorf("Expected --cache-retention to not be negative")
+	}
+
+	dirMode, err := o.parseMode("--dir-mode", o.DirMode)
+	if err != nil {
+		return err
+	}
+	if dirMode != 0 && dirMode&0700 != 0700 {
+		return fmt.Errorf("Expected --dir-mode to allow owner to read, write and list directories")
+	}
+
+	fileMode, err := o.parseMode("--file-mode", o.FileMode)
+	if err != nil {
+		return err
+	}
+
+	switch o.lockFormat() {
+	case ctlconf.LockFormatYAML, ctlconf.LockFormatJSON:
+	default:
+		return fmt.Errorf("Expected --lock-format to be one of: %s, %s", ctlconf.LockFormatYAML, ctlconf.LockFormatJSON)
+	}
+
+	if len(o.Chdir) > 0 {
+		resolveFilesAgainstChdir(o.Chdir, o.Files, &o.LockFile, o.SecretDirs)
+	}
+
+	conf, secrets, configMaps, err := ctlconf.NewConfigFromFilesWithOpts(o.Files, ctlconf.ConfigLoadOpts{Strict: o.Strict})
 	if err != nil {
 		return o.configReadHintErrMsg(err, o.Files)
 	}
@@ -77,6 +227,8 @@ func (o *SyncOptions) Run() error {
 		o.ui.PrintBlock(configBs)
 	}
 
+	var lockedConfig *ctlconf.LockConfig
+
 	// If syncing against a lock file, apply lock information
 	// on top of existing config
 	if o.Locked {
@@ -85,6 +237,8 @@ func (o *SyncOptions) Run() error {
 			return err
 		}
 
+		lockedConfig = &existingLockConfig
+
 		err = conf.Lock(existingLockConfig)
 		if err != nil {
 			return err
@@ -99,20 +253,121 @@ func (o *SyncOptions) Run() error {
 		o.ui.PrintBlock(configBs)
 	}
 
+	githubAPIToken := os.Getenv("VENDIR_GITHUB_API_TOKEN")
+	redactor.Add(githubAPIToken)
+
 	syncOpts := ctldir.SyncOpts{
-		RefFetcher:     ctldir.NewNamedRefFetcher(secrets, configMaps),
-		GithubAPIToken: os.Getenv("VENDIR_GITHUB_API_TOKEN"),
-		HelmBinary:     os.Getenv("VENDIR_HELM_BINARY"),
+		RefFetcher: ctldir.NewSecretRefFetcher(ctldir.NewNamedRefFetcher(secrets, configMaps),
+			o.SecretDirs, os.Environ(), redactor),
+		GithubAPIToken:         githubAPIToken,
+		GithubRateLimitMaxWait: o.GithubRateLimitWait,
+		HelmBinary:             os.Getenv("VENDIR_HELM_BINARY"),
+		HgBinary:               os.Getenv("VENDIR_HG_BINARY"),
+		SvnBinary:              os.Getenv("VENDIR_SVN_BINARY"),
+		AwsBinary:              os.Getenv("VENDIR_AWS_BINARY"),
+		AzBinary:               os.Getenv("VENDIR_AZ_BINARY"),
+		TempDir:                o.TempDir,
+		BaseDir:                o.Chdir,
+		Parallelism:            o.Parallelism,
+		GroupOutput:            o.GroupOutput,
+		DryRun:                 o.DryRun,
+		ResolveOnly:            o.LockOnly,
+		Retries:                o.Retries,
+		RetryBackoff:           o.RetryBackoff,
+		Lazy:                   o.Lazy,
+		CacheDir:               o.CacheDir,
+		CacheMaxSize:           o.CacheMaxSizeMB * 1024 * 1024,
+		CacheRetention:         o.CacheRetention,
+		Diff:                   o.Diff,
+		RecordFileChecksums:    o.RecordFileChecksums,
+		ChecksumDelta:          o.ChecksumDelta,
+		RecordStats:            o.RecordStats,
+		MinFreeSpace:           o.MinFreeSpaceMB * 1024 * 1024,
+		MaxDownloadRate:        o.MaxDownloadRateKB * 1024,
+		Locked:                 o.Locked,
+		FailIfUnchanged:        o.FailIfUnchanged,
+		ContinueOnError:        o.ContinueOnError,
+		OfflineFallback:        o.OfflineFallback,
+		PrevLockConfig:         lockedConfig,
+		CABundle:               o.CABundle,
+		DirMode:                dirMode,
+		FileMode:               fileMode,
+		Proxy: ctlfetch.ProxyOpts{
+			HTTPProxy:  o.HTTPProxy,
+			HTTPSProxy: o.HTTPSProxy,
+			NoProxy:    o.NoProxy,
+		},
+	}
+
+	if o.Dedup {
+		syncOpts.Dedup = ctldir.NewDedup()
+	}
+
+	// Previous lock config is also used to retain lock contents of disabled contents
+	if !o.Locked {
+		existingLockConfig, err := ctlconf.NewLockConfigFromFile(o.LockFile)
+		if err == nil {
+			syncOpts.PrevLockConfig = &existingLockConfig
+		}
 	}
+
+	if o.List {
+		return o.listVersions(conf, syncOpts)
+	}
+
 	newLockConfig := ctlconf.NewLockConfig()
+	var summaries []ctldir.SyncSummary
+	var syncErrs []string
 
-	for _, dirConf := range conf.Directories {
-		dirLockConf, err := ctldir.NewDirectory(dirConf, o.ui).Sync(syncOpts)
+	deadline := time.Now().Add(o.Timeout)
+
+	// Directories referenced by other directories are synced first
+	orderedDirs, err := conf.SyncOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, dirConf := range orderedDirs {
+		if o.Timeout > 0 {
+			syncOpts.Timeout = time.Until(deadline)
+			if syncOpts.Timeout <= 0 {
+				return fmt.Errorf("Syncing directory '%s': Timed out after %s", dirConf.Path, o.Timeout)
+			}
+		}
+
+		dirLockConf, summary, err := ctldir.NewDirectory(dirConf, o.ui).Sync(syncOpts)
 		if err != nil {
-			return fmt.Errorf("Syncing directory '%s': %s", dirConf.Path, err)
+			var partialErr ctldir.PartialSyncError
+			if !errors.As(err, &partialErr) {
+				return fmt.Errorf("Syncing directory '%s': %s", dirConf.Path, err)
+			}
+			// Lock config is still saved with successfully synced contents
+			syncErrs = append(syncErrs, fmt.Sprintf("Syncing directory '%s': %s", dirConf.Path, err))
 		}
 
 		newLockConfig.Directories = append(newLockConfig.Directories, dirLockConf)
+		summaries = append(summaries, summary)
+	}
+
+	if o.SummaryJSON {
+		err = o.writeSummaryJSON(summaries, redactor)
+		if err != nil {
+			return err
+		}
+	} else {
+		o.printSummary(summaries)
+	}
+
+	if o.Diff {
+		o.printDiffs(summaries)
+	}
+
+	if o.ChecksumDelta {
+		o.printChecksumDeltas(summaries)
+	}
+
+	if o.Dedup {
+		o.printDedupSavings(summaries)
 	}
 
 	// Update only selected directories in lock file
@@ -128,9 +383,17 @@ func (o *SyncOptions) Run() error {
 		}
 
 		newLockConfig = existingLockConfig
+
+		// Directories on disk do not correspond to updated lock config
+		if !o.DryRun && !o.LockOnly {
+			err = o.updateContentSHAs(conf, newLockConfig)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	newLockConfigBs, err := newLockConfig.AsBytes()
+	newLockConfigBs, err := newLockConfig.AsBytesWithFormat(o.lockFormat())
 	if err != nil {
 		return err
 	}
@@ -138,12 +401,243 @@ func (o *SyncOptions) Run() error {
 	o.ui.PrintLinef("Lock config")
 	o.ui.PrintBlock(newLockConfigBs)
 
+	var syncErr error
+	if len(syncErrs) > 0 {
+		syncErr = fmt.Errorf("%s", strings.Join(syncErrs, "\n"))
+	}
+
 	if usesLocalDir {
 		o.ui.PrintLinef("Lock config is not saved to '%s' due to command line overrides", o.LockFile)
-		return nil
+		return syncErr
+	}
+
+	if o.DryRun {
+		o.ui.PrintLinef("Lock config is not saved to '%s' due to dry run", o.LockFile)
+		return syncErr
+	}
+
+	err = newLockConfig.WriteToFileWithFormat(o.LockFile, o.lockFormat())
+	if err != nil {
+		return err
+	}
+
+	return syncErr
+}
+
+// listVersions prints versions of contents in config like format
+// so that they can be copied into config when pinning contents
+func (o *SyncOptions) listVersions(conf ctlconf.Config, syncOpts ctldir.SyncOpts) error {
+	var result struct {
+		Directories []ctldir.DirectoryVersions `json:"directories"`
+	}
+
+	for _, dirConf := range conf.Directories {
+		dirVers, err := ctldir.NewDirectory(dirConf, o.ui).ListVersions(syncOpts)
+		if err != nil {
+			return fmt.Errorf("Listing versions of directory '%s': %s", dirConf.Path, err)
+		}
+
+		result.Directories = append(result.Directories, dirVers)
+	}
+
+	resultBs, err := yaml.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	o.ui.PrintLinef("Available versions")
+	o.ui.PrintBlock(resultBs)
+
+	return nil
+}
+
+func (o *SyncOptions) lockFormat() string {
+	if len(o.LockFormat) > 0 {
+		return o.LockFormat
+	}
+	return ctlconf.LockFormatFromPath(o.LockFile)
+}
+
+// resolveFilesAgainstChdir makes relative config, lock file and secret
+// directory paths relative to --chdir directory (stdin is left as is)
+func resolveFilesAgainstChdir(chdir string, files []string, lockFile *string, secretDirs []string) {
+	for i, file := range files {
+		if file != "-" && !filepath.IsAbs(file) {
+			files[i] = filepath.Join(chdir, file)
+		}
+	}
+	if !filepath.IsAbs(*lockFile) {
+		*lockFile = filepath.Join(chdir, *lockFile)
+	}
+	for i, dir := range secretDirs {
+		if !filepath.IsAbs(dir) {
+			secretDirs[i] = filepath.Join(chdir, dir)
+		}
+	}
+}
+
+// updateContentSHAs recalculates directory digests
+// that were reset due to partial directory update
+func (o *SyncOptions) updateContentSHAs(conf ctlconf.Config, lockConfig ctlconf.LockConfig) error {
+	for i, dir := range lockConfig.Directories {
+		if len(dir.ContentSHA) > 0 {
+			continue
+		}
+
+		dirPath := dir.Path
+		if len(o.Chdir) > 0 && !filepath.IsAbs(dirPath) {
+			dirPath = filepath.Join(o.Chdir, dirPath)
+		}
+
+		_, err := os.Stat(dirPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		// Preserved paths of directory are not part of its digest
+		dirConf := ctlconf.Directory{Path: dir.Path}
+		for _, confDir := range conf.Directories {
+			if confDir.Path == dir.Path {
+				dirConf = confDir
+			}
+		}
+
+		contentSHA, err := ctldir.NewDirectory(dirConf, o.ui).ContentSHA(dirPath)
+		if err != nil {
+			return err
+		}
+
+		lockConfig.Directories[i].ContentSHA = contentSHA
+	}
+	return nil
+}
+
+func (o *SyncOptions) printSummary(summaries []ctldir.SyncSummary) {
+	table := uitable.Table{
+		Title:   "Summary",
+		Content: "contents",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Path"),
+			uitable.NewHeader("Type"),
+			uitable.NewHeader("Version"),
+			uitable.NewHeader("Bytes"),
+			uitable.NewHeader("Duration"),
+		},
+	}
+
+	for _, summary := range summaries {
+		for _, con := range summary.Contents {
+			version := con.Version
+			if len(con.Error) > 0 {
+				version = "(failed)"
+			}
+
+			table.Rows = append(table.Rows, []uitable.Value{
+				uitable.NewValueString(filepath.Join(summary.Path, con.Path)),
+				uitable.NewValueString(con.Type),
+				uitable.NewValueString(version),
+				uitable.NewValueInt(int(con.Bytes)),
+				uitable.NewValueString(con.Duration.Round(time.Millisecond).String()),
+			})
+		}
+	}
+
+	o.ui.PrintTable(table)
+}
+
+func (o *SyncOptions) writeSummaryJSON(summaries []ctldir.SyncSummary, redactor *ctldir.Redactor) error {
+	if summaries == nil {
+		summaries = []ctldir.SyncSummary{}
+	}
+
+	bs, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Marshaling summary: %s", err)
+	}
+
+	_, err = o.stdout.Write([]byte(redactor.Redact(string(bs)) + "\n"))
+	return err
+}
+
+func (o *SyncOptions) printDiffs(summaries []ctldir.SyncSummary) {
+	for _, summary := range summaries {
+		if summary.Diff == nil {
+			continue
+		}
+
+		diff := *summary.Diff
+
+		o.ui.PrintLinef("Diff: %s (added: %d, modified: %d, removed: %d)",
+			summary.Path, len(diff.Added), len(diff.Modified), len(diff.Removed))
+
+		var lines []string
+
+		for _, path := range diff.Added {
+			lines = append(lines, "+ "+path)
+		}
+		for _, path := range diff.Modified {
+			lines = append(lines, "~ "+path)
+		}
+		for _, path := range diff.Removed {
+			lines = append(lines, "- "+path)
+		}
+
+		if len(lines) > 0 {
+			o.ui.PrintBlock([]byte(strings.Join(lines, "\n") + "\n"))
+		}
+	}
+}
+
+func (o *SyncOptions) printChecksumDeltas(summaries []ctldir.SyncSummary) {
+	for _, summary := range summaries {
+		if summary.ChecksumDelta == nil {
+			continue
+		}
+
+		delta := *summary.ChecksumDelta
+
+		o.ui.PrintLinef("Checksum delta: %s (modified: %d)", summary.Path, len(delta.Modified))
+
+		var lines []string
+
+		for _, file := range delta.Modified {
+			lines = append(lines, fmt.Sprintf("~ %s (sha256:%s -> sha256:%s)", file.Path, file.PrevSHA256, file.SHA256))
+		}
+
+		if len(lines) > 0 {
+			o.ui.PrintBlock([]byte(strings.Join(lines, "\n") + "\n"))
+		}
+	}
+}
+
+func (o *SyncOptions) printDedupSavings(summaries []ctldir.SyncSummary) {
+	var totalSavedBytes int64
+
+	for _, summary := range summaries {
+		if summary.DedupSavedBytes > 0 {
+			o.ui.PrintLinef("Dedup: %s (saved bytes: %d)", summary.Path, summary.DedupSavedBytes)
+		}
+		totalSavedBytes += summary.DedupSavedBytes
+	}
+
+	o.ui.PrintLinef("Dedup: saved %d bytes in total", totalSavedBytes)
+}
+
+func (o *SyncOptions) parseMode(flag, val string) (os.FileMode, error) {
+	if len(val) == 0 {
+		return 0, nil
+	}
+
+	mode, err := strconv.ParseUint(val, 8, 32)
+	if err != nil || mode == 0 || os.FileMode(mode)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("Expected %s to be octal permissions (e.g. 0755), but was '%s'", flag, val)
 	}
 
-	return newLockConfig.WriteToFile(o.LockFile)
+	return os.FileMode(mode), nil
 }
 
 func (o *SyncOptions) directories() ([]dirOverride, error) {
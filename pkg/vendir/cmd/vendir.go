@@ -39,6 +39,7 @@ func NewVendirCmd(o *VendirOptions) *cobra.Command {
 	o.UIFlags.Set(cmd)
 
 	cmd.AddCommand(NewSyncCmd(NewSyncOptions(o.ui)))
+	cmd.AddCommand(NewVerifyCmd(NewVerifyOptions(o.ui)))
 	cmd.AddCommand(NewVersionCmd(NewVersionOptions(o.ui)))
 
 	toolsCmd := NewToolsCmd()
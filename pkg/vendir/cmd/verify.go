@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	"github.com/spf13/cobra"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctldir "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/directory"
+)
+
+type VerifyOptions struct {
+	ui ui.UI
+
+	Files      []string
+	SecretDirs []string
+	LockFile   string
+	Chdir      string
+	TempDir    string
+
+	ContentSHA bool
+	Strict     bool
+}
+
+func NewVerifyOptions(ui ui.UI) *VerifyOptions {
+	return &VerifyOptions{ui: ui}
+}
+
+func NewVerifyCmd(o *VerifyOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that lock file matches currently resolved contents",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+	cmd.Flags().StringSliceVarP(&o.Files, "file", "f", []string{defaultConfigName}, "Set configuration file")
+	cmd.Flags().StringSliceVar(&o.SecretDirs, "secret-dir", nil, "Set directory with secrets laid out as <dir>/<secret-name>/<key> (e.g. mounted K8s secrets) used when secret is not found in configuration")
+	cmd.Flags().StringVar(&o.LockFile, "lock-file", defaultLockName, "Set lock file")
+	cmd.Flags().StringVarP(&o.Chdir, "chdir", "C", "", "Set directory against which configuration, lock file and relative paths within configuration are resolved (defaults to current directory)")
+	cmd.Flags().StringVar(&o.TempDir, "tmp-dir", "", "Set directory for temporary files (defaults to system temporary directory)")
+	cmd.Flags().BoolVar(&o.Strict, "strict", false, "Fail if configuration includes unknown fields (e.g. misspelled keys) instead of ignoring them")
+	cmd.Flags().BoolVar(&o.ContentSHA, "content-sha", false, "Only compare directories on disk with content SHAs recorded in lock file (no contents are fetched)")
+	return cmd
+}
+
+func (o *VerifyOptions) Run() error {
+	// Values of resolved secrets are redacted from all output
+	redactor := ctldir.NewRedactor()
+	o.ui = ctldir.NewRedactingUI(o.ui, redactor)
+
+	return redactor.RedactError(o.run(redactor))
+}
+
+func (o *VerifyOptions) run(redactor *ctldir.Redactor) error {
+	if len(o.Chdir) > 0 {
+		resolveFilesAgainstChdir(o.Chdir, o.Files, &o.LockFile, o.SecretDirs)
+	}
+
+	conf, secrets, configMaps, err := ctlconf.NewConfigFromFilesWithOpts(o.Files, ctlconf.ConfigLoadOpts{Strict: o.Strict})
+	if err != nil {
+		return err
+	}
+
+	lockConfig, err := ctlconf.NewLockConfigFromFile(o.LockFile)
+	if err != nil {
+		return err
+	}
+
+	githubAPIToken := os.Getenv("VENDIR_GITHUB_API_TOKEN")
+	redactor.Add(githubAPIToken)
+
+	// Unlike sync, verification does not place anything
+	// next to configuration unless asked to
+	tempDir := o.TempDir
+	if len(tempDir) == 0 {
+		tempDir, err = ioutil.TempDir("", "vendir-verify")
+		if err != nil {
+			return fmt.Errorf("Creating tmp dir: %s", err)
+		}
+		defer os.RemoveAll(tempDir)
+	}
+
+	syncOpts := ctldir.SyncOpts{
+		RefFetcher: ctldir.NewSecretRefFetcher(ctldir.NewNamedRefFetcher(secrets, configMaps),
+			o.SecretDirs, os.Environ(), redactor),
+		GithubAPIToken: githubAPIToken,
+		HelmBinary:     os.Getenv("VENDIR_HELM_BINARY"),
+		HgBinary:       os.Getenv("VENDIR_HG_BINARY"),
+		SvnBinary:      os.Getenv("VENDIR_SVN_BINARY"),
+		AwsBinary:      os.Getenv("VENDIR_AWS_BINARY"),
+		AzBinary:       os.Getenv("VENDIR_AZ_BINARY"),
+		TempDir:        tempDir,
+		BaseDir:        o.Chdir,
+	}
+
+	var allDiffs []string
+
+	for _, dirConf := range conf.Directories {
+		var dirLockConfig ctlconf.LockDirectory
+
+		for _, dir := range lockConfig.Directories {
+			if dir.Path == dirConf.Path {
+				dirLockConfig = dir
+			}
+		}
+
+		var diffs []string
+
+		if o.ContentSHA {
+			diffs, err = ctldir.NewDirectory(dirConf, o.ui).VerifyContentSHA(dirLockConfig, syncOpts)
+		} else {
+			diffs, err = ctldir.NewDirectory(dirConf, o.ui).Verify(dirLockConfig, syncOpts)
+		}
+		if err != nil {
+			return fmt.Errorf("Verifying directory '%s': %s", dirConf.Path, err)
+		}
+
+		allDiffs = append(allDiffs, diffs...)
+	}
+
+	for _, diff := range allDiffs {
+		o.ui.ErrorLinef("%s", diff)
+	}
+
+	if len(allDiffs) > 0 {
+		return fmt.Errorf("Expected lock config '%s' to match resolved contents, but found %d difference(s)",
+			o.LockFile, len(allDiffs))
+	}
+
+	o.ui.PrintLinef("Lock config '%s' matches resolved contents", o.LockFile)
+
+	return nil
+}
@@ -25,6 +25,10 @@ type Config struct {
 }
 
 func NewConfigFromFiles(paths []string) (Config, []Secret, []ConfigMap, error) {
+	return NewConfigFromFilesWithOpts(paths, ConfigLoadOpts{})
+}
+
+func NewConfigFromFilesWithOpts(paths []string, opts ConfigLoadOpts) (Config, []Secret, []ConfigMap, error) {
 	var configs []Config
 	var secrets []Secret
 	var configMaps []ConfigMap
@@ -57,7 +61,12 @@ func NewConfigFromFiles(paths []string) (Config, []Secret, []ConfigMap, error) {
 			configMaps = append(configMaps, cm)
 
 		case res.APIVersion == knownAPIVersion && res.Kind == knownKind:
-			config, err := NewConfigFromBytes(docBytes)
+			docBytes, err := interpolateEnv(docBytes)
+			if err != nil {
+				return fmt.Errorf("Interpolating environment variables: %s", err)
+			}
+
+			config, err := NewConfigFromBytesWithOpts(docBytes, opts)
 			if err != nil {
 				return fmt.Errorf("Unmarshaling config: %s", err)
 			}
@@ -84,8 +93,19 @@ func NewConfigFromFiles(paths []string) (Config, []Secret, []ConfigMap, error) {
 }
 
 func NewConfigFromBytes(bs []byte) (Config, error) {
+	return NewConfigFromBytesWithOpts(bs, ConfigLoadOpts{})
+}
+
+func NewConfigFromBytesWithOpts(bs []byte, opts ConfigLoadOpts) (Config, error) {
 	var config Config
 
+	if opts.Strict {
+		err := checkUnknownFields(bs, config)
+		if err != nil {
+			return Config{}, fmt.Errorf("Unmarshaling config: %s", err)
+		}
+	}
+
 	err := yaml.Unmarshal(bs, &config)
 	if err != nil {
 		return Config{}, fmt.Errorf("Unmarshaling config: %s", err)
@@ -135,7 +155,13 @@ func (c Config) Validate() error {
 		}
 	}
 
-	return c.checkOverlappingPaths()
+	err := checkOverlappingPaths(c.Directories)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.SyncOrder()
+	return err
 }
 
 func (c Config) AsBytes() ([]byte, error) {
@@ -206,8 +232,10 @@ func (c Config) Subset(paths []string) (Config, error) {
 			newCon.Path = EntireDirPath
 
 			result.Directories = append(result.Directories, Directory{
-				Path:     path,
-				Contents: []DirectoryContents{newCon},
+				Path:               path,
+				Contents:           []DirectoryContents{newCon},
+				CommonExcludePaths: dir.CommonExcludePaths,
+				PreservePaths:      subsetPreservePaths(dir.PreservePaths, con.Path),
 			})
 		}
 	}
@@ -218,13 +246,54 @@ func (c Config) Subset(paths []string) (Config, error) {
 		}
 	}
 
+	// Directories that are not part of subset are not going to be synced,
+	// hence contents referencing them are copied from their previous output
+	for i, dir := range result.Directories {
+		for j, con := range dir.Contents {
+			if con.Directory == nil || len(con.Directory.FromDirectory) == 0 {
+				continue
+			}
+			if len(result.directoriesContaining(con.Directory.FromDirectory)) > 0 {
+				continue
+			}
+			newDirCon := *con.Directory
+			newDirCon.Path = newDirCon.FromDirectory
+			newDirCon.FromDirectory = ""
+			result.Directories[i].Contents[j].Directory = &newDirCon
+		}
+	}
+
 	// return validated config
 	return result, result.Validate()
 }
 
+// subsetPreservePaths keeps preserved paths that are located within
+// contents path (made relative to it) or that match at any depth
+func subsetPreservePaths(paths []string, conPath string) []string {
+	if filepath.Clean(conPath) == EntireDirPath {
+		return paths
+	}
+
+	var result []string
+	for _, path := range paths {
+		switch {
+		case strings.HasPrefix(path, "**/"):
+			result = append(result, path)
+		case strings.HasPrefix(path, filepath.Clean(conPath)+"/"):
+			result = append(result, strings.TrimPrefix(path, filepath.Clean(conPath)+"/"))
+		}
+	}
+	return result
+}
+
 func (c Config) Lock(lockConfig LockConfig) error {
 	for _, dir := range c.Directories {
 		for _, con := range dir.Contents {
+			// Disabled contents may not have been recorded in lock config
+			if con.Disabled {
+				continue
+			}
+
 			lockContents, err := lockConfig.FindContents(dir.Path, con.Path)
 			if err != nil {
 				return err
@@ -240,10 +309,12 @@ func (c Config) Lock(lockConfig LockConfig) error {
 	return nil
 }
 
-func (c Config) checkOverlappingPaths() error {
+// checkOverlappingPaths ensures that contents within and
+// across given directories do not manage same files
+func checkOverlappingPaths(dirs []Directory) error {
 	paths := []string{}
 
-	for _, dir := range c.Directories {
+	for _, dir := range dirs {
 		for _, con := range dir.Contents {
 			paths = append(paths, filepath.Join(dir.Path, con.Path))
 		}
@@ -260,3 +331,85 @@ func (c Config) checkOverlappingPaths() error {
 
 	return nil
 }
+
+// SyncOrder returns directories ordered such that directories
+// referenced via fromDirectory are synced before directories referencing them
+func (c Config) SyncOrder() ([]Directory, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	var result []Directory
+	var stack []string
+	states := map[int]int{}
+
+	var visit func(int) error
+
+	visit = func(idx int) error {
+		dir := c.Directories[idx]
+
+		switch states[idx] {
+		case visited:
+			return nil
+		case visiting:
+			for i, path := range stack {
+				if path == dir.Path {
+					cycle := append(append([]string{}, stack[i:]...), dir.Path)
+					return fmt.Errorf("Expected directories to not reference each other "+
+						"in a cycle: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+
+		states[idx] = visiting
+		stack = append(stack, dir.Path)
+
+		for _, con := range dir.Contents {
+			if con.Directory == nil || len(con.Directory.FromDirectory) == 0 {
+				continue
+			}
+
+			depIdxs := c.directoriesContaining(con.Directory.FromDirectory)
+			if len(depIdxs) == 0 {
+				return fmt.Errorf("Expected fromDirectory '%s' (contents '%s' of directory '%s') "+
+					"to reference path within one of config directories", con.Directory.FromDirectory, con.Path, dir.Path)
+			}
+
+			for _, depIdx := range depIdxs {
+				err := visit(depIdx)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		states[idx] = visited
+		result = append(result, dir)
+		return nil
+	}
+
+	for i := range c.Directories {
+		err := visit(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (c Config) directoriesContaining(path string) []int {
+	var result []int
+	slashPath := filepath.ToSlash(filepath.Clean(path))
+
+	for i, dir := range c.Directories {
+		dirPath := filepath.ToSlash(filepath.Clean(dir.Path))
+		if slashPath == dirPath || strings.HasPrefix(slashPath, dirPath+"/") {
+			result = append(result, i)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestConfigSyncOrder(t *testing.T) {
+	conf, err := ctlconf.NewConfigFromBytes([]byte(`
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor/b
+  contents:
+  - path: .
+    directory:
+      fromDirectory: vendor/a/sub
+- path: vendor/a
+  contents:
+  - path: sub
+    manual: {}
+`))
+	if err != nil {
+		t.Fatalf("Expected config to load: %s", err)
+	}
+
+	dirs, err := conf.SyncOrder()
+	if err != nil {
+		t.Fatalf("Expected sync order to be determined: %s", err)
+	}
+	if len(dirs) != 2 || dirs[0].Path != "vendor/a" || dirs[1].Path != "vendor/b" {
+		t.Fatalf("Expected referenced directory to be synced first, but was: %#v", dirs)
+	}
+
+	_, err = ctlconf.NewConfigFromBytes([]byte(`
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor/a
+  contents:
+  - path: .
+    directory:
+      fromDirectory: vendor/b
+- path: vendor/b
+  contents:
+  - path: .
+    directory:
+      fromDirectory: vendor/a
+`))
+	if err == nil || !strings.Contains(err.Error(), "in a cycle: vendor/a -> vendor/b -> vendor/a") {
+		t.Fatalf("Expected cycle error, but was: %v", err)
+	}
+}
+
+func TestConfigStrictRejectsUnknownFields(t *testing.T) {
+	configTpl := `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: github.com/org/repo
+    git:
+      url: https://github.com/org/repo
+      %s: origin/main
+  - path: inline
+    inline:
+      pathsFrom:
+      - secretRef:
+          name: files
+`
+
+	_, err := ctlconf.NewConfigFromBytes([]byte(fmt.Sprintf(configTpl, "refs")))
+	if err != nil {
+		t.Fatalf("Expected unknown fields to be ignored without strict mode: %s", err)
+	}
+
+	_, err = ctlconf.NewConfigFromBytesWithOpts([]byte(fmt.Sprintf(configTpl, "refs")), ctlconf.ConfigLoadOpts{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "Unknown field 'directories[0].contents[0].git.refs'") {
+		t.Fatalf("Expected unknown field error, but was: %v", err)
+	}
+
+	_, err = ctlconf.NewConfigFromBytesWithOpts([]byte(fmt.Sprintf(configTpl, "ref")), ctlconf.ConfigLoadOpts{Strict: true})
+	if err != nil {
+		t.Fatalf("Expected valid config to load in strict mode: %s", err)
+	}
+}
@@ -6,10 +6,39 @@ const (
 
 	SecretK8sCoreV1SSHAuthPrivateKey = "ssh-privatekey"
 	SecretSSHAuthKnownHosts          = "ssh-knownhosts" // not part of k8s
+	SecretSSHAuthPassphrase          = "ssh-passphrase" // not part of k8s
 
 	SecretToken = "token"
+
+	SecretK8sCorev1TLSCertKey       = "tls.crt"
+	SecretK8sCorev1TLSPrivateKeyKey = "tls.key"
+	SecretCACert                    = "ca.crt" // not part of k8s TLS secret
+
+	SecretCosignPublicKey = "cosign.pub"
+
+	SecretS3AccessKeyID     = "accessKeyID"
+	SecretS3SecretAccessKey = "secretAccessKey"
+	SecretS3SessionToken    = "sessionToken"
+
+	SecretAzureConnectionString = "connectionString"
+	SecretAzureSASToken         = "sasToken"
+	SecretAzureAccountKey       = "accountKey"
+
+	SecretGCSServiceAccountJSON = "serviceAccountJSON"
 )
 
+// SecretKeys lists all keys that secrets referenced by contents may include
+var SecretKeys = []string{
+	SecretK8sCorev1BasicAuthUsernameKey, SecretK8sCorev1BasicAuthPasswordKey,
+	SecretK8sCoreV1SSHAuthPrivateKey, SecretSSHAuthKnownHosts, SecretSSHAuthPassphrase,
+	SecretToken,
+	SecretK8sCorev1TLSCertKey, SecretK8sCorev1TLSPrivateKeyKey, SecretCACert,
+	SecretCosignPublicKey,
+	SecretS3AccessKeyID, SecretS3SecretAccessKey, SecretS3SessionToken,
+	SecretAzureConnectionString, SecretAzureSASToken, SecretAzureAccountKey,
+	SecretGCSServiceAccountJSON,
+}
+
 // There structs have minimal used set of fields from their K8s representations.
 
 type GenericMetadata struct {
@@ -2,7 +2,11 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vmware-tanzu/carvel-vendir/pkg/vendir/versions"
 )
@@ -24,6 +28,15 @@ var (
 type Directory struct {
 	Path     string              `json:"path"`
 	Contents []DirectoryContents `json:"contents,omitempty"`
+
+	// Excluded from all contents in addition to their own exclude paths
+	// +optional
+	CommonExcludePaths []string `json:"commonExcludePaths,omitempty"`
+
+	// Files not managed by vendir (relative to directory path) that
+	// are kept in place when directory is replaced
+	// +optional
+	PreservePaths []string `json:"preservePaths,omitempty"`
 }
 
 type DirectoryContents struct {
@@ -37,6 +50,14 @@ type DirectoryContents struct {
 	Manual        *DirectoryContentsManual        `json:"manual,omitempty"`
 	Directory     *DirectoryContentsDirectory     `json:"directory,omitempty"`
 	Inline        *DirectoryContentsInline        `json:"inline,omitempty"`
+	S3            *DirectoryContentsS3            `json:"s3,omitempty"`
+	Hg            *DirectoryContentsHg            `json:"hg,omitempty"`
+	Svn           *DirectoryContentsSvn           `json:"svn,omitempty"`
+	AzureBlob     *DirectoryContentsAzureBlob     `json:"azureBlob,omitempty"`
+	GCS           *DirectoryContentsGCS           `json:"gcs,omitempty"`
+	Archive       *DirectoryContentsArchive       `json:"archive,omitempty"`
+	Symlink       *DirectoryContentsSymlink       `json:"symlink,omitempty"`
+	Overlay       *DirectoryContentsOverlay       `json:"overlay,omitempty"`
 
 	IncludePaths []string `json:"includePaths,omitempty"`
 	ExcludePaths []string `json:"excludePaths,omitempty"`
@@ -45,6 +66,31 @@ type DirectoryContents struct {
 	LegalPaths []string `json:"legalPaths,omitempty"`
 
 	NewRootPath string `json:"newRootPath,omitempty"`
+
+	// Moves matched paths within contents (applied in order after newRootPath)
+	// +optional
+	PathMappings []DirectoryContentsPathMapping `json:"pathMappings,omitempty"`
+
+	// Rewrites line endings of text files (applied after path mappings)
+	// +optional
+	LineEndings *DirectoryContentsLineEndings `json:"lineEndings,omitempty"`
+
+	// Runs command within contents directory before it's moved into place
+	// +optional
+	PostSync *DirectoryContentsPostSync `json:"postSync,omitempty"`
+
+	// Limits how long fetching contents may take (example: 5m)
+	// +optional
+	Timeout string `json:"timeout,omitempty"`
+
+	// Skips syncing contents while keeping existing files in place
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Limits download rate of contents (in kilobytes per second)
+	// in addition to overall limit applied to all downloads
+	// +optional
+	MaxDownloadRate int64 `json:"maxDownloadRate,omitempty"`
 }
 
 type DirectoryContentsGit struct {
@@ -52,35 +98,170 @@ type DirectoryContentsGit struct {
 	Ref          string                            `json:"ref,omitempty"`
 	RefSelection *versions.VersionSelection        `json:"refSelection,omitempty"`
 	Verification *DirectoryContentsGitVerification `json:"verification,omitempty"`
-	// Secret may include one or more keys: ssh-privatekey, ssh-knownhosts
+	// Refs tried in order when ref cannot be resolved
+	// (e.g. when upstream renamed its default branch)
+	// +optional
+	RefFallbacks []string `json:"refFallbacks,omitempty"`
+	// Secret may include one or more keys: ssh-privatekey, ssh-passphrase, ssh-knownhosts
 	// +optional
 	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
 	// +optional
 	LFSSkipSmudge bool `json:"lfsSkipSmudge,omitempty"`
+	// Fetch LFS objects after checkout (requires git-lfs)
+	// +optional
+	LFS bool `json:"lfs,omitempty"`
+	// Fetch submodules recursively after checkout (enabled by default)
+	// +optional
+	Submodules *bool `json:"submodules,omitempty"`
+	// Limit fetched history to specified number of commits
+	// +optional
+	Depth int `json:"depth,omitempty"`
+	// Only check out files within given directories
+	// +optional
+	SparseCheckout []string `json:"sparseCheckout,omitempty"`
+	// Partial clone filter (e.g. blob:none, tree:0) so that
+	// only objects needed for checkout are fetched
+	// +optional
+	Filter string `json:"filter,omitempty"`
+	// Only keep files that changed (added or modified)
+	// between this ref and checked out ref
+	// +optional
+	ChangedFrom string `json:"changedFrom,omitempty"`
+	// Only fetch single file (path relative to repository root)
+	// placed into contents directory under its base name
+	// +optional
+	File string `json:"file,omitempty"`
+	// Keep repository metadata (.git directory) so that
+	// history can be inspected after sync
+	// +optional
+	KeepGitDir bool `json:"keepGitDir,omitempty"`
+	// Local repository (e.g. mirror) whose objects are reused
+	// instead of being downloaded again; invalid path results
+	// in a warning and regular fetch
+	// +optional
+	ReferenceRepo string `json:"referenceRepo,omitempty"`
+}
+
+type DirectoryContentsPathMapping struct {
+	// Path or glob pattern (e.g. dist/*) relative to contents root
+	From string `json:"from"`
+	// Destination path; paths matched by a pattern are moved into it
+	To string `json:"to"`
+}
+
+const (
+	LineEndingsLF       = "lf"
+	LineEndingsCRLF     = "crlf"
+	LineEndingsPreserve = "preserve"
+)
+
+type DirectoryContentsLineEndings struct {
+	// One of: lf, crlf, preserve
+	Style string `json:"style"`
+	// Only files with given extensions (e.g. .yml) are rewritten;
+	// by default all text files are rewritten
+	// +optional
+	Extensions []string `json:"extensions,omitempty"`
+	// Files with NUL byte within this many leading bytes are
+	// treated as binary and left untouched (default: 8000)
+	// +optional
+	BinaryCheckBytes int `json:"binaryCheckBytes,omitempty"`
+}
+
+type DirectoryContentsPostSync struct {
+	// Executable followed by its arguments (not interpreted by shell)
+	Command []string `json:"command"`
+	// Additional environment variables in KEY=VALUE format
+	// +optional
+	Env []string `json:"env,omitempty"`
+	// Example: 5m
+	// +optional
+	Timeout string `json:"timeout,omitempty"`
 }
 
 type DirectoryContentsGitVerification struct {
 	PublicKeysSecretRef *DirectoryContentsLocalRef `json:"publicKeysSecretRef,omitempty"`
+	// Restricts which of public keys may sign ref
+	// (full fingerprints or long key IDs)
+	// +optional
+	AllowedKeyFingerprints []string `json:"allowedKeyFingerprints,omitempty"`
 }
 
 type DirectoryContentsHTTP struct {
 	// URL can point to one of following formats: text, tgz, zip
 	URL string `json:"url,omitempty"`
+	// Download multiple files (as is, without unpacking) into
+	// given paths instead of single URL
+	// +optional
+	Files []DirectoryContentsHTTPFile `json:"files,omitempty"`
 	// +optional
 	SHA256 string `json:"sha256,omitempty"`
-	// Secret may include one or more keys: username, password
+	// +optional
+	SHA512 string `json:"sha512,omitempty"`
+	// Remove leading path components of unpacked archive entries
+	// +optional
+	StripComponents int `json:"stripComponents,omitempty"`
+	// Only keep given directory of unpacked archive (applied after stripping components)
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+	// Additional request headers (e.g. custom token header)
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+	// Secret may include one or more keys: username, password (basic auth) or token (bearer auth)
 	// +optional
 	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
+	// Disables TLS certificate verification (e.g. for self-signed
+	// certificates during development); never use for production
+	// +optional
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+}
+
+type DirectoryContentsHTTPFile struct {
+	URL string `json:"url"`
+	// Path of downloaded file relative to contents path
+	Path string `json:"path"`
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+	// +optional
+	SHA512 string `json:"sha512,omitempty"`
 }
 
 type DirectoryContentsImage struct {
 	// Example: username/app1-config:v0.1.0
 	URL string `json:"url,omitempty"`
+	// Selects image out of multi-platform image index
+	// Example: linux/amd64
+	// +optional
+	Platform string `json:"platform,omitempty"`
 	// Secret may include one or more keys: username, password, token.
-	// By default anonymous access is used for authentication.
+	// By default credentials from ~/.docker/config.json are used if present,
+	// otherwise anonymous access is used for authentication.
 	// TODO support docker config formated secret
 	// +optional
 	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
+	// Disables TLS certificate verification (e.g. for self-signed
+	// certificates during development); never use for production
+	// +optional
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+	// Verifies image signature via cosign before image is extracted
+	// +optional
+	Verification *DirectoryContentsImageVerification `json:"verification,omitempty"`
+	// Only extract given files or directories (relative to image root)
+	// out of flattened image filesystem; each path has to be present
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+}
+
+type DirectoryContentsImageVerification struct {
+	// Secret with cosign public key (cosign.pub key)
+	// +optional
+	PublicKeySecretRef *DirectoryContentsLocalRef `json:"publicKeySecretRef,omitempty"`
+	// Identity (e.g. email) and OIDC issuer of signing certificate
+	// issued by Fulcio (keyless signing recorded in Rekor)
+	// +optional
+	CertificateIdentity string `json:"certificateIdentity,omitempty"`
+	// +optional
+	CertificateOIDCIssuer string `json:"certificateOIDCIssuer,omitempty"`
 }
 
 type DirectoryContentsGithubRelease struct {
@@ -88,8 +269,16 @@ type DirectoryContentsGithubRelease struct {
 	Tag    string `json:"tag"`
 	Latest bool   `json:"latest,omitempty"`
 	URL    string `json:"url,omitempty"`
+	// Consider pre-releases when resolving latest release
+	// +optional
+	IncludePrereleases bool `json:"includePrereleases,omitempty"`
+	// Base URL of GitHub API for GitHub Enterprise Server
+	// (e.g. https://github.example.com/api/v3); defaults to https://api.github.com
+	// +optional
+	APIURL string `json:"apiURL,omitempty"`
 
 	Checksums                     map[string]string `json:"checksums,omitempty"`
+	ChecksumsAsset                string            `json:"checksumsAsset,omitempty"`
 	DisableAutoChecksumValidation bool              `json:"disableAutoChecksumValidation,omitempty"`
 
 	AssetNames    []string                        `json:"assetNames,omitempty"`
@@ -104,11 +293,34 @@ type DirectoryContentsHelmChart struct {
 	// Example: stable/redis
 	Name string `json:"name,omitempty"`
 	// +optional
-	Version    string                          `json:"version,omitempty"`
-	Repository *DirectoryContentsHelmChartRepo `json:"repository,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Selects highest chart version from repository index
+	// (only used when version is not specified)
+	// +optional
+	VersionSelection *versions.VersionSelection      `json:"versionSelection,omitempty"`
+	Repository       *DirectoryContentsHelmChartRepo `json:"repository,omitempty"`
 
 	// +optional
 	HelmVersion string `json:"helmVersion,omitempty"`
+
+	// Renders chart templates instead of keeping chart as is
+	// +optional
+	Template *DirectoryContentsHelmChartTemplate `json:"template,omitempty"`
+	// Disables TLS certificate verification (e.g. for self-signed
+	// certificates during development); never use for production
+	// +optional
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+}
+
+type DirectoryContentsHelmChartTemplate struct {
+	// Paths relative to vendir.yml
+	// +optional
+	ValuesFiles []string `json:"valuesFiles,omitempty"`
+	// Defaults to chart name
+	// +optional
+	ReleaseName string `json:"releaseName,omitempty"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 type DirectoryContentsHelmChartRepo struct {
@@ -121,6 +333,16 @@ type DirectoryContentsManual struct{}
 
 type DirectoryContentsDirectory struct {
 	Path string `json:"path"`
+	// Path within another directory of the same config (e.g. vendor/charts/nginx);
+	// referenced directory is synced first. Mutually exclusive with path.
+	// +optional
+	FromDirectory string `json:"fromDirectory,omitempty"`
+	// By default symlinks are copied as symlinks
+	// +optional
+	FollowSymlinks bool `json:"followSymlinks,omitempty"`
+	// Keeps file owners of copied files (typically requires root)
+	// +optional
+	PreserveOwnership bool `json:"preserveOwnership,omitempty"`
 }
 
 type DirectoryContentsInline struct {
@@ -133,13 +355,131 @@ type DirectoryContentsInlineSource struct {
 	ConfigMapRef *DirectoryContentsInlineSourceRef `json:"configMapRef,omitempty"`
 }
 
+type DirectoryContentsArchive struct {
+	// Local path to .tar, .tar.gz (.tgz) or .zip file
+	Path string `json:"path"`
+	// Remove leading path components of unpacked archive entries
+	// +optional
+	StripComponents int `json:"stripComponents,omitempty"`
+	// Only keep given directory of unpacked archive (applied after stripping components)
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+}
+
+const (
+	OverlayConflictPolicyOverwrite = "overwrite"
+	OverlayConflictPolicyError     = "error"
+)
+
+type DirectoryContentsOverlay struct {
+	// Synced in order into contents path; files of later
+	// sources replace files of earlier ones. Source path is
+	// relative to contents path (defaults to '.')
+	Sources []DirectoryContents `json:"sources"`
+	// What to do when multiple sources produce the same file:
+	// overwrite (default) or error
+	// +optional
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+}
+
+type DirectoryContentsSymlink struct {
+	// Link paths (relative to contents path) mapped to their targets.
+	// Targets have to be relative and stay within directory.
+	// Example: latest: ../v1.2.3
+	Links map[string]string `json:"links,omitempty"`
+}
+
 type DirectoryContentsInlineSourceRef struct {
 	DirectoryPath             string `json:"directoryPath,omitempty"`
 	DirectoryContentsLocalRef `json:",inline"`
 }
 
+type DirectoryContentsS3 struct {
+	Bucket string `json:"bucket,omitempty"`
+	// Only objects with keys under prefix (matched at path separator)
+	// or with key equal to prefix are fetched
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// +optional
+	Region string `json:"region,omitempty"`
+	// Endpoint allows to use S3 compatible stores (e.g. MinIO)
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// Secret may include one or more keys: accessKeyID, secretAccessKey, sessionToken.
+	// By default credentials are taken from environment.
+	// +optional
+	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
+
+	// Objects (and their ETags and versions) to fetch instead of listing bucket;
+	// populated from lock configuration
+	LockedObjects []LockDirectoryContentsS3Object `json:"-"`
+}
+
+type DirectoryContentsAzureBlob struct {
+	// Storage account name
+	Account   string `json:"account,omitempty"`
+	Container string `json:"container,omitempty"`
+	// Only blobs with names starting with prefix are fetched
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint allows to use emulators (e.g. Azurite)
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// Secret may include one of keys: connectionString, sasToken, accountKey.
+	// By default credentials are taken from environment.
+	// +optional
+	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
+
+	// Blobs (and their ETags) to fetch instead of listing container;
+	// populated from lock configuration
+	LockedBlobs []LockDirectoryContentsAzureBlobBlob `json:"-"`
+}
+
+type DirectoryContentsGCS struct {
+	Bucket string `json:"bucket,omitempty"`
+	// Only objects with names starting with prefix are fetched
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint allows to use emulators (e.g. fake-gcs-server)
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// Secret may include key: serviceAccountJSON.
+	// By default application default credentials are used.
+	// +optional
+	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
+
+	// Objects (and their generations) to fetch instead of listing bucket;
+	// populated from lock configuration
+	LockedObjects []LockDirectoryContentsGCSObject `json:"-"`
+}
+
+type DirectoryContentsHg struct {
+	URL string `json:"url,omitempty"`
+	// Changeset ID, tag, branch or bookmark
+	Ref string `json:"ref,omitempty"`
+	// Secret may include one or more keys: ssh-privatekey, ssh-knownhosts, username, password
+	// +optional
+	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
+}
+
+type DirectoryContentsSvn struct {
+	URL string `json:"url,omitempty"`
+	// Revision number (or keyword such as HEAD); defaults to HEAD
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// Secret may include one or more keys: username, password
+	// +optional
+	SecretRef *DirectoryContentsLocalRef `json:"secretRef,omitempty"`
+}
+
 type DirectoryContentsUnpackArchive struct {
 	Path string `json:"path"`
+	// Remove leading path components of unpacked archive entries
+	// +optional
+	StripComponents int `json:"stripComponents,omitempty"`
+	// Only keep given directory of unpacked archive (applied after stripping components)
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
 }
 
 type DirectoryContentsLocalRef struct {
@@ -164,6 +504,12 @@ func (c Directory) Validate() error {
 		}
 	}
 
+	for _, path := range c.PreservePaths {
+		if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, "../") || len(path) == 0 {
+			return fmt.Errorf("Expected preserved path '%s' to be relative to directory path", path)
+		}
+	}
+
 	for i, con := range c.Contents {
 		err := con.Validate()
 		if err != nil {
@@ -171,7 +517,10 @@ func (c Directory) Validate() error {
 		}
 	}
 
-	return nil
+	// Contents are fetched into shared staging dir hence one contents
+	// must not overwrite files of another (checked here as well since
+	// directory may be synced without loading config from files)
+	return checkOverlappingPaths([]Directory{c})
 }
 
 func (c DirectoryContents) Validate() error {
@@ -201,6 +550,30 @@ func (c DirectoryContents) Validate() error {
 	if c.Inline != nil {
 		srcTypes = append(srcTypes, "inline")
 	}
+	if c.Archive != nil {
+		srcTypes = append(srcTypes, "archive")
+	}
+	if c.Symlink != nil {
+		srcTypes = append(srcTypes, "symlink")
+	}
+	if c.Overlay != nil {
+		srcTypes = append(srcTypes, "overlay")
+	}
+	if c.S3 != nil {
+		srcTypes = append(srcTypes, "s3")
+	}
+	if c.Hg != nil {
+		srcTypes = append(srcTypes, "hg")
+	}
+	if c.Svn != nil {
+		srcTypes = append(srcTypes, "svn")
+	}
+	if c.AzureBlob != nil {
+		srcTypes = append(srcTypes, "azureBlob")
+	}
+	if c.GCS != nil {
+		srcTypes = append(srcTypes, "gcs")
+	}
 
 	if len(srcTypes) == 0 {
 		return fmt.Errorf("Expected directory contents type to be specified (one of git, manual, etc.)")
@@ -209,17 +582,411 @@ func (c DirectoryContents) Validate() error {
 		return fmt.Errorf("Expected exactly one directory contents type to be specified (multiple found: %s)", strings.Join(srcTypes, ", "))
 	}
 
+	if c.Git != nil {
+		err := c.Git.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Directory != nil {
+		err := c.Directory.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.HTTP != nil {
+		err := c.HTTP.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Image != nil {
+		err := c.Image.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.HelmChart != nil {
+		err := c.HelmChart.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Symlink != nil {
+		err := c.Symlink.Validate(c.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Overlay != nil {
+		err := c.Overlay.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.GithubRelease != nil && c.GithubRelease.IncludePrereleases && !c.GithubRelease.Latest {
+		return fmt.Errorf("Expected github release includePrereleases to be used with latest")
+	}
+
+	for i, mapping := range c.PathMappings {
+		if c.Manual != nil {
+			return fmt.Errorf("Expected path mappings to not be used with manual contents")
+		}
+		err := mapping.Validate()
+		if err != nil {
+			return fmt.Errorf("Validating path mapping (%d): %s", i, err)
+		}
+	}
+
+	if c.LineEndings != nil {
+		if c.Manual != nil {
+			return fmt.Errorf("Expected line endings to not be used with manual contents")
+		}
+		err := c.LineEndings.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.PostSync != nil {
+		if c.Manual != nil {
+			return fmt.Errorf("Expected post sync command to not be used with manual contents")
+		}
+		err := c.PostSync.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(c.Timeout) > 0 {
+		_, err := c.TimeoutDuration()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.MaxDownloadRate < 0 {
+		return fmt.Errorf("Expected max download rate to not be negative")
+	}
+
 	// entire dir path is allowed for contents
 	if c.Path != EntireDirPath {
 		err := isDisallowedPath(c.Path)
 		if err != nil {
 			return err
 		}
+		err = isEscapingPath(c.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var gitFilterRegexp = regexp.MustCompile(`^(blob:none|blob:limit=[0-9]+[kmg]?|tree:[0-9]+|object:type=(blob|tree|commit|tag)|sparse:oid=\S+|combine:\S+)$`)
+
+// SubmodulesEnabled returns true unless submodules were explicitly disabled
+func (c DirectoryContentsGit) SubmodulesEnabled() bool {
+	return c.Submodules == nil || *c.Submodules
+}
+
+func (c DirectoryContentsGit) Validate() error {
+	if c.Depth < 0 {
+		return fmt.Errorf("Expected git depth to be non-negative")
+	}
+	if len(c.Filter) > 0 && !gitFilterRegexp.MatchString(c.Filter) {
+		return fmt.Errorf("Expected git filter '%s' to be a partial clone filter (e.g. blob:none, blob:limit=1m, tree:0)", c.Filter)
+	}
+	if c.LFS && c.LFSSkipSmudge {
+		return fmt.Errorf("Expected only one of git lfs or lfsSkipSmudge to be specified")
+	}
+	if c.LFS && len(c.File) > 0 {
+		return fmt.Errorf("Expected git lfs to not be used with file")
+	}
+	if len(c.RefFallbacks) > 0 && len(c.Ref) == 0 {
+		return fmt.Errorf("Expected git ref to be specified when ref fallbacks are used")
+	}
+	if len(c.File) > 0 {
+		if len(c.SparseCheckout) > 0 || len(c.ChangedFrom) > 0 || (c.Submodules != nil && *c.Submodules) || c.KeepGitDir {
+			return fmt.Errorf("Expected git file to not be used with sparseCheckout, changedFrom, submodules or keepGitDir")
+		}
+		cleanFile := filepath.ToSlash(filepath.Clean(c.File))
+		if cleanFile == "." || cleanFile == ".." || strings.HasPrefix(cleanFile, "../") {
+			return fmt.Errorf("Expected git file '%s' to be a path within repository", c.File)
+		}
+	}
+	return nil
+}
+
+func (c DirectoryContentsHTTP) Validate() error {
+	if len(c.Files) == 0 {
+		return nil
+	}
+	if len(c.URL) > 0 || len(c.SHA256) > 0 || len(c.SHA512) > 0 {
+		return fmt.Errorf("Expected http files to not be used with url, sha256 or sha512")
+	}
+	if c.StripComponents > 0 || len(c.SubPath) > 0 {
+		return fmt.Errorf("Expected http files to not be used with stripComponents or subPath since files are not unpacked")
+	}
+
+	seenPaths := map[string]struct{}{}
+
+	for i, file := range c.Files {
+		if len(file.URL) == 0 {
+			return fmt.Errorf("Expected http file (%d) to have non-empty url", i)
+		}
+		if len(file.Path) == 0 || file.Path == "." {
+			return fmt.Errorf("Expected http file (%d) to have non-empty path", i)
+		}
+		err := isEscapingPath(file.Path)
+		if err != nil {
+			return fmt.Errorf("Validating http file (%d): %s", i, err)
+		}
+		if _, found := seenPaths[file.Path]; found {
+			return fmt.Errorf("Expected http file path '%s' to be unique", file.Path)
+		}
+		seenPaths[file.Path] = struct{}{}
+	}
+
+	return nil
+}
+
+var imageDigestRegexp = regexp.MustCompile("^(sha256:[a-f0-9]{64}|sha512:[a-f0-9]{128})$")
+
+func (c DirectoryContentsImage) Validate() error {
+	digest := c.Digest()
+	if strings.Contains(c.URL, "@") && !imageDigestRegexp.MatchString(digest) {
+		return fmt.Errorf("Expected image digest '%s' to be in form 'sha256:<64 hex characters>'", digest)
+	}
+	for _, path := range c.Paths {
+		if len(path) == 0 || path == "." {
+			return fmt.Errorf("Expected image paths to not be empty or image root")
+		}
+		err := isEscapingPath(path)
+		if err != nil {
+			return fmt.Errorf("Validating image path: %s", err)
+		}
+	}
+	if c.Verification != nil {
+		return c.Verification.Validate()
+	}
+	return nil
+}
+
+func (c DirectoryContentsImageVerification) Validate() error {
+	keyless := len(c.CertificateIdentity) > 0 || len(c.CertificateOIDCIssuer) > 0
+
+	if (c.PublicKeySecretRef != nil) == keyless {
+		return fmt.Errorf("Expected image verification to specify either publicKeySecretRef or certificateIdentity")
+	}
+	if keyless && (len(c.CertificateIdentity) == 0 || len(c.CertificateOIDCIssuer) == 0) {
+		return fmt.Errorf("Expected image verification to specify both certificateIdentity and certificateOIDCIssuer")
+	}
+	return nil
+}
+
+// Digest returns digest that image URL is pinned to (if any)
+func (c DirectoryContentsImage) Digest() string {
+	pieces := strings.SplitN(c.URL, "@", 2)
+	if len(pieces) != 2 {
+		return ""
 	}
+	return pieces[1]
+}
 
+func (c DirectoryContentsHelmChart) Validate() error {
+	if c.VersionSelection != nil {
+		if c.VersionSelection.Semver == nil {
+			return fmt.Errorf("Expected helm chart version selection to specify semver")
+		}
+		if c.Repository != nil && strings.HasPrefix(c.Repository.URL, "oci://") {
+			return fmt.Errorf("Expected helm chart version selection to not be used with OCI repository")
+		}
+	}
+	return nil
+}
+
+func (c DirectoryContentsSymlink) Validate(conPath string) error {
+	if len(c.Links) == 0 {
+		return fmt.Errorf("Expected at least one symlink to be specified")
+	}
+	for linkPath, target := range c.Links {
+		err := isEscapingPath(linkPath)
+		if err != nil {
+			return fmt.Errorf("Validating symlink '%s': %s", linkPath, err)
+		}
+		if filepath.Clean(linkPath) == "." {
+			return fmt.Errorf("Expected symlink path to not be empty")
+		}
+		if filepath.IsAbs(target) {
+			return fmt.Errorf("Expected symlink '%s' target '%s' to be relative", linkPath, target)
+		}
+		// Target is resolved relative to link's parent directory
+		resolvedTarget := filepath.Join(conPath, filepath.Dir(linkPath), target)
+		if resolvedTarget == ".." || strings.HasPrefix(resolvedTarget, "../") {
+			return fmt.Errorf("Expected symlink '%s' target '%s' to stay within directory", linkPath, target)
+		}
+	}
 	return nil
 }
 
+func (c DirectoryContentsOverlay) Validate() error {
+	if len(c.Sources) == 0 {
+		return fmt.Errorf("Expected at least one overlay source to be specified")
+	}
+
+	switch c.ConflictPolicy {
+	case "", OverlayConflictPolicyOverwrite, OverlayConflictPolicyError:
+	default:
+		return fmt.Errorf("Unknown overlay conflict policy '%s' (known: %s, %s)",
+			c.ConflictPolicy, OverlayConflictPolicyOverwrite, OverlayConflictPolicyError)
+	}
+
+	for i, src := range c.Sources {
+		if src.Manual != nil || src.Overlay != nil {
+			return fmt.Errorf("Expected overlay source (%d) to not be manual or overlay", i)
+		}
+		if src.Disabled {
+			return fmt.Errorf("Expected overlay source (%d) to not be disabled", i)
+		}
+		err := src.WithOverlaySourcePath().Validate()
+		if err != nil {
+			return fmt.Errorf("Validating overlay source (%d): %s", i, err)
+		}
+	}
+
+	return nil
+}
+
+// InsecureSkipTLSVerify returns true if contents (or any of
+// overlay sources) are fetched without TLS certificate verification
+func (c DirectoryContents) InsecureSkipTLSVerify() bool {
+	switch {
+	case c.HTTP != nil:
+		return c.HTTP.InsecureSkipTLSVerify
+	case c.Image != nil:
+		return c.Image.InsecureSkipTLSVerify
+	case c.HelmChart != nil:
+		return c.HelmChart.InsecureSkipTLSVerify
+	case c.Overlay != nil:
+		for _, src := range c.Overlay.Sources {
+			if src.InsecureSkipTLSVerify() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithOverlaySourcePath defaults path of overlay source to contents root
+func (c DirectoryContents) WithOverlaySourcePath() DirectoryContents {
+	if len(c.Path) == 0 {
+		c.Path = EntireDirPath
+	}
+	return c
+}
+
+func (c DirectoryContentsDirectory) Validate() error {
+	if len(c.FromDirectory) > 0 {
+		if len(c.Path) > 0 {
+			return fmt.Errorf("Expected only one of directory path or fromDirectory to be specified")
+		}
+		return isEscapingPath(c.FromDirectory)
+	}
+	if len(c.Path) == 0 {
+		return fmt.Errorf("Expected directory path or fromDirectory to be specified")
+	}
+	return nil
+}
+
+// SourcePath returns local path to copy contents from
+func (c DirectoryContentsDirectory) SourcePath() string {
+	if len(c.FromDirectory) > 0 {
+		return c.FromDirectory
+	}
+	return c.Path
+}
+
+func (c DirectoryContentsPathMapping) Validate() error {
+	if len(c.From) == 0 || len(c.To) == 0 {
+		return fmt.Errorf("Expected both from and to to be specified")
+	}
+	if filepath.Clean(c.From) == "." {
+		return fmt.Errorf("Expected from to not be contents root")
+	}
+	err := isEscapingPath(c.From)
+	if err != nil {
+		return err
+	}
+	return isEscapingPath(c.To)
+}
+
+func (c DirectoryContentsLineEndings) Validate() error {
+	switch c.Style {
+	case LineEndingsLF, LineEndingsCRLF, LineEndingsPreserve:
+	default:
+		return fmt.Errorf("Expected line endings style to be one of: %s, %s, %s",
+			LineEndingsLF, LineEndingsCRLF, LineEndingsPreserve)
+	}
+	for _, ext := range c.Extensions {
+		if !strings.HasPrefix(ext, ".") || len(ext) == 1 {
+			return fmt.Errorf("Expected line endings extension '%s' to start with '.' (e.g. .yml)", ext)
+		}
+	}
+	if c.BinaryCheckBytes < 0 {
+		return fmt.Errorf("Expected line endings binary check bytes to not be negative")
+	}
+	return nil
+}
+
+func (c DirectoryContentsPostSync) Validate() error {
+	if len(c.Command) == 0 || len(c.Command[0]) == 0 {
+		return fmt.Errorf("Expected post sync command to be non-empty")
+	}
+	for _, env := range c.Env {
+		if !strings.Contains(env, "=") {
+			return fmt.Errorf("Expected post sync env variable '%s' to be in KEY=VALUE format", env)
+		}
+	}
+	if len(c.Timeout) > 0 {
+		_, err := c.TimeoutDuration()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c DirectoryContentsPostSync) TimeoutDuration() (time.Duration, error) {
+	if len(c.Timeout) == 0 {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("Parsing post sync timeout: %s", err)
+	}
+	return timeout, nil
+}
+
+func (c DirectoryContents) TimeoutDuration() (time.Duration, error) {
+	if len(c.Timeout) == 0 {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("Parsing timeout: %s", err)
+	}
+	return timeout, nil
+}
+
 func (c DirectoryContents) IsEntireDir() bool {
 	return c.Path == EntireDirPath
 }
@@ -241,6 +1008,25 @@ func isDisallowedPath(path string) error {
 	return nil
 }
 
+// isEscapingPath checks that contents path is relative,
+// normalized and stays within directory path
+func isEscapingPath(path string) error {
+	slashPath := filepath.ToSlash(path)
+
+	if strings.HasPrefix(slashPath, "/") || filepath.IsAbs(path) {
+		return fmt.Errorf("Expected path '%s' to be relative", path)
+	}
+	for _, piece := range strings.Split(slashPath, "/") {
+		if piece == ".." {
+			return fmt.Errorf("Expected path '%s' to not traverse to parent directory", path)
+		}
+	}
+	if cleanPath := filepath.ToSlash(filepath.Clean(path)); cleanPath != slashPath {
+		return fmt.Errorf("Expected path '%s' to be normalized (i.e. '%s')", path, cleanPath)
+	}
+	return nil
+}
+
 func (c DirectoryContents) Lock(lockConfig LockDirectoryContents) error {
 	switch {
 	case c.Git != nil:
@@ -259,6 +1045,22 @@ func (c DirectoryContents) Lock(lockConfig LockDirectoryContents) error {
 		return nil // nothing to lock
 	case c.Inline != nil:
 		return nil // nothing to lock
+	case c.Archive != nil:
+		return nil // nothing to lock
+	case c.Symlink != nil:
+		return nil // nothing to lock
+	case c.Overlay != nil:
+		return c.Overlay.Lock(lockConfig.Overlay)
+	case c.S3 != nil:
+		return c.S3.Lock(lockConfig.S3)
+	case c.Hg != nil:
+		return c.Hg.Lock(lockConfig.Hg)
+	case c.Svn != nil:
+		return c.Svn.Lock(lockConfig.Svn)
+	case c.AzureBlob != nil:
+		return c.AzureBlob.Lock(lockConfig.AzureBlob)
+	case c.GCS != nil:
+		return c.GCS.Lock(lockConfig.GCS)
 	default:
 		panic("Unknown contents type")
 	}
@@ -272,6 +1074,30 @@ func (c *DirectoryContentsGit) Lock(lockConfig *LockDirectoryContentsGit) error
 		return fmt.Errorf("Expected git SHA to be non-empty")
 	}
 	c.Ref = lockConfig.SHA
+	c.RefFallbacks = nil
+	if len(c.ChangedFrom) > 0 {
+		if len(lockConfig.ChangedFromSHA) == 0 {
+			return fmt.Errorf("Expected git changed from SHA to be non-empty")
+		}
+		c.ChangedFrom = lockConfig.ChangedFromSHA
+	}
+	return nil
+}
+
+func (c *DirectoryContentsOverlay) Lock(lockConfig *LockDirectoryContentsOverlay) error {
+	if lockConfig == nil {
+		return fmt.Errorf("Expected overlay lock configuration to be non-empty")
+	}
+	if len(lockConfig.Sources) != len(c.Sources) {
+		return fmt.Errorf("Expected overlay lock configuration to have %d sources, but had %d",
+			len(c.Sources), len(lockConfig.Sources))
+	}
+	for i, src := range c.Sources {
+		err := src.Lock(lockConfig.Sources[i])
+		if err != nil {
+			return fmt.Errorf("Locking overlay source (%d): %s", i, err)
+		}
+	}
 	return nil
 }
 
@@ -279,6 +1105,35 @@ func (c *DirectoryContentsHTTP) Lock(lockConfig *LockDirectoryContentsHTTP) erro
 	if lockConfig == nil {
 		return fmt.Errorf("Expected HTTP lock configuration to be non-empty")
 	}
+	if len(c.Files) > 0 {
+		return c.lockFiles(lockConfig.Files)
+	}
+	// Detect drift of content when no explicit digest was configured
+	if len(c.SHA256) == 0 && len(c.SHA512) == 0 {
+		c.SHA256 = lockConfig.SHA256
+	}
+	return nil
+}
+
+func (c *DirectoryContentsHTTP) lockFiles(lockFiles []LockDirectoryContentsHTTPFile) error {
+	lockSHA256s := map[string]string{}
+	for _, lockFile := range lockFiles {
+		lockSHA256s[lockFile.Path] = lockFile.SHA256
+	}
+
+	files := append([]DirectoryContentsHTTPFile{}, c.Files...)
+
+	for i, file := range files {
+		lockSHA256, found := lockSHA256s[file.Path]
+		if !found {
+			return fmt.Errorf("Expected HTTP lock configuration to include file '%s'", file.Path)
+		}
+		if len(file.SHA256) == 0 && len(file.SHA512) == 0 {
+			files[i].SHA256 = lockSHA256
+		}
+	}
+
+	c.Files = files
 	return nil
 }
 
@@ -289,6 +1144,9 @@ func (c *DirectoryContentsImage) Lock(lockConfig *LockDirectoryContentsImage) er
 	if len(lockConfig.URL) == 0 {
 		return fmt.Errorf("Expected image URL to be non-empty")
 	}
+	if !strings.Contains(lockConfig.URL, "@") {
+		return fmt.Errorf("Expected image URL '%s' to be pinned to digest", lockConfig.URL)
+	}
 	c.URL = lockConfig.URL
 	return nil
 }
@@ -304,6 +1162,61 @@ func (c *DirectoryContentsGithubRelease) Lock(lockConfig *LockDirectoryContentsG
 	return nil
 }
 
+func (c *DirectoryContentsS3) Lock(lockConfig *LockDirectoryContentsS3) error {
+	if lockConfig == nil {
+		return fmt.Errorf("Expected S3 lock configuration to be non-empty")
+	}
+	if len(lockConfig.Objects) == 0 {
+		return fmt.Errorf("Expected S3 objects to be non-empty")
+	}
+	c.LockedObjects = lockConfig.Objects
+	return nil
+}
+
+func (c *DirectoryContentsAzureBlob) Lock(lockConfig *LockDirectoryContentsAzureBlob) error {
+	if lockConfig == nil {
+		return fmt.Errorf("Expected Azure blob lock configuration to be non-empty")
+	}
+	if len(lockConfig.Blobs) == 0 {
+		return fmt.Errorf("Expected Azure blobs to be non-empty")
+	}
+	c.LockedBlobs = lockConfig.Blobs
+	return nil
+}
+
+func (c *DirectoryContentsGCS) Lock(lockConfig *LockDirectoryContentsGCS) error {
+	if lockConfig == nil {
+		return fmt.Errorf("Expected GCS lock configuration to be non-empty")
+	}
+	if len(lockConfig.Objects) == 0 {
+		return fmt.Errorf("Expected GCS objects to be non-empty")
+	}
+	c.LockedObjects = lockConfig.Objects
+	return nil
+}
+
+func (c *DirectoryContentsHg) Lock(lockConfig *LockDirectoryContentsHg) error {
+	if lockConfig == nil {
+		return fmt.Errorf("Expected hg lock configuration to be non-empty")
+	}
+	if len(lockConfig.SHA) == 0 {
+		return fmt.Errorf("Expected hg changeset ID to be non-empty")
+	}
+	c.Ref = lockConfig.SHA
+	return nil
+}
+
+func (c *DirectoryContentsSvn) Lock(lockConfig *LockDirectoryContentsSvn) error {
+	if lockConfig == nil {
+		return fmt.Errorf("Expected svn lock configuration to be non-empty")
+	}
+	if lockConfig.Revision <= 0 {
+		return fmt.Errorf("Expected svn revision to be positive")
+	}
+	c.Revision = strconv.FormatInt(lockConfig.Revision, 10)
+	return nil
+}
+
 func (c *DirectoryContentsHelmChart) Lock(lockConfig *LockDirectoryContentsHelmChart) error {
 	if lockConfig == nil {
 		return fmt.Errorf("Expected helm chart lock configuration to be non-empty")
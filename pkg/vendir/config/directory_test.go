@@ -0,0 +1,46 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestDirectoryValidateContentsPaths(t *testing.T) {
+	cases := []struct {
+		Paths       []string
+		ExpectedErr string
+	}{
+		{[]string{"a", "b/c", "bc"}, ""},
+		{[]string{"../outside"}, "Expected path '../outside' to not traverse to parent directory"},
+		{[]string{"a/../../outside"}, "Expected path 'a/../../outside' to not traverse to parent directory"},
+		{[]string{"/abs"}, "Expected path '/abs' to be relative"},
+		{[]string{"a//b"}, "Expected path 'a//b' to be normalized (i.e. 'a/b')"},
+		{[]string{"a", "a"}, "Expected to not manage overlapping paths: 'vendor/a' and 'vendor/a'"},
+		{[]string{"a/b", "c", "a"}, "Expected to not manage overlapping paths: 'vendor/a/b' and 'vendor/a'"},
+	}
+
+	for _, tc := range cases {
+		dir := ctlconf.Directory{Path: "vendor"}
+		for _, path := range tc.Paths {
+			dir.Contents = append(dir.Contents, ctlconf.DirectoryContents{
+				Path:   path,
+				Manual: &ctlconf.DirectoryContentsManual{},
+			})
+		}
+
+		err := dir.Validate()
+
+		if len(tc.ExpectedErr) == 0 {
+			if err != nil {
+				t.Fatalf("Expected paths %v to be valid, but was: %s", tc.Paths, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tc.ExpectedErr) {
+			t.Fatalf("Expected paths %v to fail with '%s', but was: %v", tc.Paths, tc.ExpectedErr, err)
+		}
+	}
+}
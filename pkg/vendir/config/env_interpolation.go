@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// interpolateEnv replaces ${VAR} references in all string values
+// of a config document with values of environment variables.
+// '$$' escapes to '$'. Inline contents are left as is since
+// they commonly include shell-like syntax.
+func interpolateEnv(docBytes []byte) ([]byte, error) {
+	var doc interface{}
+
+	err := yaml.Unmarshal(docBytes, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshaling doc: %s", err)
+	}
+
+	doc, err = interpolateEnvValue(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(doc)
+}
+
+func interpolateEnvValue(val interface{}) (interface{}, error) {
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		for k, v := range typedVal {
+			if k == "inline" {
+				continue
+			}
+			newV, err := interpolateEnvValue(v)
+			if err != nil {
+				return nil, err
+			}
+			typedVal[k] = newV
+		}
+		return typedVal, nil
+
+	case []interface{}:
+		for i, v := range typedVal {
+			newV, err := interpolateEnvValue(v)
+			if err != nil {
+				return nil, err
+			}
+			typedVal[i] = newV
+		}
+		return typedVal, nil
+
+	case string:
+		return expandEnvVars(typedVal)
+
+	default:
+		return val, nil
+	}
+}
+
+func expandEnvVars(str string) (string, error) {
+	var result strings.Builder
+
+	for i := 0; i < len(str); i++ {
+		if str[i] != '$' || i+1 == len(str) {
+			result.WriteByte(str[i])
+			continue
+		}
+
+		switch str[i+1] {
+		case '$':
+			result.WriteByte('$')
+			i++
+
+		case '{':
+			endIdx := strings.IndexByte(str[i:], '}')
+			if endIdx == -1 {
+				return "", fmt.Errorf("Expected closing '}' for environment variable reference in '%s'", str)
+			}
+
+			name := str[i+2 : i+endIdx]
+			if len(name) == 0 {
+				return "", fmt.Errorf("Expected non-empty environment variable name in '%s'", str)
+			}
+
+			val, found := os.LookupEnv(name)
+			if !found {
+				return "", fmt.Errorf("Expected environment variable '%s' to be set", name)
+			}
+
+			result.WriteString(val)
+			i += endIdx
+
+		default:
+			result.WriteByte(str[i])
+		}
+	}
+
+	return result.String(), nil
+}
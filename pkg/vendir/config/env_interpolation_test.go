@@ -0,0 +1,82 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestConfigEnvInterpolation(t *testing.T) {
+	os.Setenv("VENDIR_TEST_REF", "v1.0.0")
+	defer os.Unsetenv("VENDIR_TEST_REF")
+
+	path := writeTestConfig(t, `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: repo
+    git:
+      url: https://github.com/org/repo-$$1
+      ref: ${VENDIR_TEST_REF}
+  - path: inline
+    inline:
+      paths:
+        script.sh: echo ${HOME}
+`)
+	defer os.Remove(path)
+
+	conf, _, _, err := ctlconf.NewConfigFromFiles([]string{path})
+	if err != nil {
+		t.Fatalf("Expected config to load: %s", err)
+	}
+
+	git := conf.Directories[0].Contents[0].Git
+	if git.Ref != "v1.0.0" || git.URL != "https://github.com/org/repo-$1" {
+		t.Fatalf("Expected git config to be interpolated, but was: %#v", git)
+	}
+
+	script := conf.Directories[0].Contents[1].Inline.Paths["script.sh"]
+	if script != "echo ${HOME}" {
+		t.Fatalf("Expected inline contents to be left as is, but was: %s", script)
+	}
+}
+
+func TestConfigEnvInterpolationMissingVar(t *testing.T) {
+	path := writeTestConfig(t, `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: repo
+    git:
+      ref: ${VENDIR_TEST_MISSING}
+`)
+	defer os.Remove(path)
+
+	_, _, _, err := ctlconf.NewConfigFromFiles([]string{path})
+	if err == nil || !strings.Contains(err.Error(), "Expected environment variable 'VENDIR_TEST_MISSING' to be set") {
+		t.Fatalf("Expected missing variable error, but was: %v", err)
+	}
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "vendir-config-test")
+	if err != nil {
+		t.Fatalf("Creating tmp file: %s", err)
+	}
+
+	defer file.Close()
+
+	_, err = file.Write([]byte(content))
+	if err != nil {
+		t.Fatalf("Writing tmp file: %s", err)
+	}
+
+	return file.Name()
+}
@@ -1,24 +1,56 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 
 	"github.com/ghodss/yaml"
 )
 
 type LockConfig struct {
-	APIVersion  string          `json:"apiVersion"`
-	Kind        string          `json:"kind"`
-	Directories []LockDirectory `json:"directories"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// SchemaVersion is incremented when lock contents change in a way
+	// older vendir versions may misinterpret (missing value means 1)
+	SchemaVersion int             `json:"schemaVersion,omitempty"`
+	Directories   []LockDirectory `json:"directories"`
+}
+
+// LockSchemaVersion is the latest lock schema version
+// written and understood by this version of vendir
+const LockSchemaVersion = 2
+
+// lockSchemaMigrations upgrade lock config in memory from a given
+// schema version to the next one
+var lockSchemaMigrations = map[int]func(*LockConfig){
+	// Version 2 introduced optional fields only (e.g. file checksums,
+	// stats, resolved image digests) which version 1 locks simply lack
+	1: func(*LockConfig) {},
 }
 
 func NewLockConfig() LockConfig {
 	return LockConfig{
-		APIVersion: "vendir.k14s.io/v1alpha1",
-		Kind:       "LockConfig",
+		APIVersion:    "vendir.k14s.io/v1alpha1",
+		Kind:          "LockConfig",
+		SchemaVersion: LockSchemaVersion,
+	}
+}
+
+const (
+	LockFormatYAML = "yaml"
+	LockFormatJSON = "json"
+)
+
+// LockFormatFromPath determines lock format based on file extension
+// (files without .json extension are treated as YAML)
+func LockFormatFromPath(path string) string {
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		return LockFormatJSON
 	}
+	return LockFormatYAML
 }
 
 func NewLockConfigFromFile(path string) (LockConfig, error) {
@@ -27,13 +59,23 @@ func NewLockConfigFromFile(path string) (LockConfig, error) {
 		return LockConfig{}, fmt.Errorf("Reading lock config '%s': %s", path, err)
 	}
 
+	if LockFormatFromPath(path) == LockFormatJSON {
+		return newLockConfigFromBytes(bs, json.Unmarshal)
+	}
+
 	return NewLockConfigFromBytes(bs)
 }
 
 func NewLockConfigFromBytes(bs []byte) (LockConfig, error) {
+	return newLockConfigFromBytes(bs, func(bs []byte, obj interface{}) error {
+		return yaml.Unmarshal(bs, obj)
+	})
+}
+
+func newLockConfigFromBytes(bs []byte, unmarshalFunc func([]byte, interface{}) error) (LockConfig, error) {
 	var config LockConfig
 
-	err := yaml.Unmarshal(bs, &config)
+	err := unmarshalFunc(bs, &config)
 	if err != nil {
 		return LockConfig{}, fmt.Errorf("Unmarshaling lock config: %s", err)
 	}
@@ -43,13 +85,31 @@ func NewLockConfigFromBytes(bs []byte) (LockConfig, error) {
 		return LockConfig{}, fmt.Errorf("Validating lock config: %s", err)
 	}
 
+	config.migrate()
+
 	return config, nil
 }
 
+// migrate upgrades validated lock config to the latest schema version
+func (c *LockConfig) migrate() {
+	if c.SchemaVersion == 0 {
+		c.SchemaVersion = 1
+	}
+	for c.SchemaVersion < LockSchemaVersion {
+		lockSchemaMigrations[c.SchemaVersion](c)
+		c.SchemaVersion++
+	}
+}
+
+// WriteToFile writes lock config in a format based on file extension
 func (c LockConfig) WriteToFile(path string) error {
-	bs, err := c.AsBytes()
+	return c.WriteToFileWithFormat(path, LockFormatFromPath(path))
+}
+
+func (c LockConfig) WriteToFileWithFormat(path, format string) error {
+	bs, err := c.AsBytesWithFormat(format)
 	if err != nil {
-		return fmt.Errorf("Marshaling lock config: %s", err)
+		return err
 	}
 
 	err = ioutil.WriteFile(path, bs, 0700)
@@ -69,6 +129,26 @@ func (c LockConfig) AsBytes() ([]byte, error) {
 	return bs, nil
 }
 
+func (c LockConfig) AsJSONBytes() ([]byte, error) {
+	bs, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Marshaling lock config: %s", err)
+	}
+
+	return append(bs, '\n'), nil
+}
+
+func (c LockConfig) AsBytesWithFormat(format string) ([]byte, error) {
+	switch format {
+	case LockFormatYAML:
+		return c.AsBytes()
+	case LockFormatJSON:
+		return c.AsJSONBytes()
+	default:
+		return nil, fmt.Errorf("Unknown lock format '%s' (known: %s, %s)", format, LockFormatYAML, LockFormatJSON)
+	}
+}
+
 func (c LockConfig) Validate() error {
 	const (
 		knownAPIVersion = "vendir.k14s.io/v1alpha1"
@@ -81,6 +161,14 @@ func (c LockConfig) Validate() error {
 	if c.Kind != knownKind {
 		return fmt.Errorf("Validating kind: Unknown kind (known: %s)", knownKind)
 	}
+	if c.SchemaVersion < 0 {
+		return fmt.Errorf("Validating schemaVersion: Expected to be positive")
+	}
+	if c.SchemaVersion > LockSchemaVersion {
+		return fmt.Errorf("Validating schemaVersion: Lock config uses schema version %d, "+
+			"but this version of vendir only supports up to %d (upgrade vendir to use this lock config)",
+			c.SchemaVersion, LockSchemaVersion)
+	}
 	return nil
 }
 
@@ -130,6 +218,8 @@ func (c LockConfig) MergeContents(path string, replaceCon LockDirectoryContents)
 			newCon.Path = con.Path
 
 			dir.Contents[j] = newCon
+			// Digest no longer describes partially updated directory
+			dir.ContentSHA = ""
 			c.Directories[i] = dir
 		}
 	}
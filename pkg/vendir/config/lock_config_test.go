@@ -0,0 +1,100 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestLockConfigJSONRoundTrip(t *testing.T) {
+	lockConfig, err := ctlconf.NewLockConfigFromBytes([]byte(`
+apiVersion: vendir.k14s.io/v1alpha1
+kind: LockConfig
+directories:
+- path: vendor
+  contentSHA: abc
+  contents:
+  - path: repo
+    git:
+      sha: 0123456789abcdef
+      commitTitle: "Title: with \"quotes\""
+      tags: [v1.0.0]
+  - path: file
+    http:
+      sha256: def
+`))
+	if err != nil {
+		t.Fatalf("Expected lock config to load: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "vendir-lock-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	jsonPath := filepath.Join(dir, "vendir.lock.json")
+	yamlPath := filepath.Join(dir, "vendir.lock.yml")
+
+	err = lockConfig.WriteToFile(jsonPath)
+	if err != nil {
+		t.Fatalf("Expected lock config to be written: %s", err)
+	}
+
+	bs, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("Reading lock file: %s", err)
+	}
+	if bs[0] != '{' {
+		t.Fatalf("Expected lock file to be JSON, but was: %s", bs)
+	}
+
+	jsonLockConfig, err := ctlconf.NewLockConfigFromFile(jsonPath)
+	if err != nil {
+		t.Fatalf("Expected JSON lock config to load: %s", err)
+	}
+
+	err = jsonLockConfig.WriteToFile(yamlPath)
+	if err != nil {
+		t.Fatalf("Expected lock config to be written: %s", err)
+	}
+
+	yamlLockConfig, err := ctlconf.NewLockConfigFromFile(yamlPath)
+	if err != nil {
+		t.Fatalf("Expected YAML lock config to load: %s", err)
+	}
+
+	if !reflect.DeepEqual(lockConfig, jsonLockConfig) || !reflect.DeepEqual(lockConfig, yamlLockConfig) {
+		t.Fatalf("Expected lock config to be preserved, but was: %#v / %#v", jsonLockConfig, yamlLockConfig)
+	}
+}
+
+func TestLockConfigSchemaVersion(t *testing.T) {
+	lockConfig, err := ctlconf.NewLockConfigFromBytes([]byte(`
+apiVersion: vendir.k14s.io/v1alpha1
+kind: LockConfig
+directories: []
+`))
+	if err != nil {
+		t.Fatalf("Expected lock config to load: %s", err)
+	}
+
+	if lockConfig.SchemaVersion != ctlconf.LockSchemaVersion {
+		t.Fatalf("Expected lock config without schema version to be migrated, but was: %d", lockConfig.SchemaVersion)
+	}
+
+	_, err = ctlconf.NewLockConfigFromBytes([]byte(`
+apiVersion: vendir.k14s.io/v1alpha1
+kind: LockConfig
+schemaVersion: 100
+directories: []
+`))
+	if err == nil || !strings.Contains(err.Error(), "upgrade vendir") {
+		t.Fatalf("Expected lock config with newer schema version to fail, but was: %v", err)
+	}
+}
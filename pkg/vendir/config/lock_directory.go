@@ -3,6 +3,8 @@ package config
 type LockDirectory struct {
 	Path     string                  `json:"path"`
 	Contents []LockDirectoryContents `json:"contents"`
+	// Digest of all files within directory after sync
+	ContentSHA string `json:"contentSHA,omitempty"`
 }
 
 type LockDirectoryContents struct {
@@ -16,27 +18,91 @@ type LockDirectoryContents struct {
 	Manual        *LockDirectoryContentsManual        `json:"manual,omitempty"`
 	Directory     *LockDirectoryContentsDirectory     `json:"directory,omitempty"`
 	Inline        *LockDirectoryContentsInline        `json:"inline,omitempty"`
+	S3            *LockDirectoryContentsS3            `json:"s3,omitempty"`
+	Hg            *LockDirectoryContentsHg            `json:"hg,omitempty"`
+	Svn           *LockDirectoryContentsSvn           `json:"svn,omitempty"`
+	AzureBlob     *LockDirectoryContentsAzureBlob     `json:"azureBlob,omitempty"`
+	GCS           *LockDirectoryContentsGCS           `json:"gcs,omitempty"`
+	Archive       *LockDirectoryContentsArchive       `json:"archive,omitempty"`
+	Symlink       *LockDirectoryContentsSymlink       `json:"symlink,omitempty"`
+	Overlay       *LockDirectoryContentsOverlay       `json:"overlay,omitempty"`
+
+	// Only recorded during lazy sync (or for http contents with validators)
+	// to detect unchanged contents
+	ConfigDigest   string `json:"configDigest,omitempty"`
+	ContentsDigest string `json:"contentsDigest,omitempty"`
+
+	// Only recorded when requested; sha256 of each file keyed by its path
+	FileChecksums map[string]string `json:"fileChecksums,omitempty"`
+
+	// Only recorded when requested; describes how contents were fetched
+	Stats *LockDirectoryContentsStats `json:"stats,omitempty"`
+}
+
+type LockDirectoryContentsStats struct {
+	// Bytes downloaded by fetchers that report download progress
+	// (http, githubRelease, gcs); zero for other contents types
+	TransferredBytes int64 `json:"transferredBytes"`
+	// Total size of files placed into contents path
+	Bytes int64 `json:"bytes"`
+	// Time it took to sync contents (example: 1.5s)
+	Duration string `json:"duration"`
 }
 
 type LockDirectoryContentsGit struct {
 	SHA         string   `json:"sha"`
 	Tags        []string `json:"tags,omitempty"`
 	CommitTitle string   `json:"commitTitle"`
+	// Committer date of resolved commit (RFC3339, UTC); recorded best-effort
+	CommitTimestamp string `json:"commitTimestamp,omitempty"`
+	// Fingerprint of a key that verified commit or tag signature
+	VerifiedKeyFingerprint string `json:"verifiedKeyFingerprint,omitempty"`
+	// Resolved SHA of changed from ref
+	ChangedFromSHA string `json:"changedFromSHA,omitempty"`
+	// Ref that was resolved; only recorded when ref fallbacks are configured
+	Ref string `json:"ref,omitempty"`
+}
+
+type LockDirectoryContentsHTTP struct {
+	SHA256 string `json:"sha256,omitempty"`
+	// Validators used for conditional requests on subsequent syncs
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// Only set when multiple files are configured
+	Files []LockDirectoryContentsHTTPFile `json:"files,omitempty"`
 }
 
-type LockDirectoryContentsHTTP struct{}
+type LockDirectoryContentsHTTPFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
 
 type LockDirectoryContentsImage struct {
-	URL string `json:"url"`
+	URL      string `json:"url"`
+	Platform string `json:"platform,omitempty"`
+	// Public key fingerprint or certificate identity that verified image signature
+	VerifiedIdentity string `json:"verifiedIdentity,omitempty"`
 }
 
 type LockDirectoryContentsGithubRelease struct {
-	URL string `json:"url"`
+	URL    string                                    `json:"url"`
+	Assets []LockDirectoryContentsGithubReleaseAsset `json:"assets,omitempty"`
+	// Tag of resolved release
+	Tag string `json:"tag,omitempty"`
+}
+
+type LockDirectoryContentsGithubReleaseAsset struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	// API URL of downloaded asset
+	URL string `json:"url,omitempty"`
 }
 
 type LockDirectoryContentsHelmChart struct {
 	Version    string `json:"version"`
 	AppVersion string `json:"appVersion"`
+	// Only present for charts pulled from OCI registries
+	Digest string `json:"digest,omitempty"`
 }
 
 type LockDirectoryContentsManual struct{}
@@ -44,3 +110,56 @@ type LockDirectoryContentsManual struct{}
 type LockDirectoryContentsDirectory struct{}
 
 type LockDirectoryContentsInline struct{}
+
+type LockDirectoryContentsSymlink struct{}
+
+type LockDirectoryContentsOverlay struct {
+	// Resolved references of overlay sources (in order)
+	Sources []LockDirectoryContents `json:"sources"`
+}
+
+type LockDirectoryContentsArchive struct {
+	SHA256 string `json:"sha256"`
+}
+
+type LockDirectoryContentsAzureBlob struct {
+	Blobs []LockDirectoryContentsAzureBlobBlob `json:"blobs,omitempty"`
+}
+
+type LockDirectoryContentsAzureBlobBlob struct {
+	Name       string `json:"name"`
+	ETag       string `json:"etag,omitempty"`
+	ContentMD5 string `json:"contentMD5,omitempty"`
+}
+
+type LockDirectoryContentsGCS struct {
+	Objects []LockDirectoryContentsGCSObject `json:"objects,omitempty"`
+}
+
+type LockDirectoryContentsGCSObject struct {
+	Name       string `json:"name"`
+	Generation string `json:"generation"`
+	// Base64 encoded CRC32C checksum
+	CRC32C string `json:"crc32c,omitempty"`
+}
+
+type LockDirectoryContentsHg struct {
+	// Full changeset ID
+	SHA            string `json:"sha"`
+	ChangesetTitle string `json:"changesetTitle"`
+}
+
+type LockDirectoryContentsSvn struct {
+	// Resolved revision number
+	Revision int64 `json:"revision"`
+}
+
+type LockDirectoryContentsS3 struct {
+	Objects []LockDirectoryContentsS3Object `json:"objects,omitempty"`
+}
+
+type LockDirectoryContentsS3Object struct {
+	Key       string `json:"key"`
+	ETag      string `json:"etag,omitempty"`
+	VersionID string `json:"versionID,omitempty"`
+}
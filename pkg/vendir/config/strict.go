@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// ConfigLoadOpts customizes how configuration files are loaded
+type ConfigLoadOpts struct {
+	// Strict rejects fields that are not part of config (e.g. typos such as
+	// 'refs' instead of 'ref') instead of silently ignoring them
+	Strict bool
+}
+
+// checkUnknownFields returns an error describing first field (sorted by path)
+// found in doc that does not correspond to a field of given object type
+func checkUnknownFields(docBytes []byte, obj interface{}) error {
+	var doc interface{}
+
+	err := yaml.Unmarshal(docBytes, &doc)
+	if err != nil {
+		return err
+	}
+
+	var unknown []string
+	collectUnknownFields(doc, reflect.TypeOf(obj), "", &unknown)
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("Unknown field '%s' (strict mode does not allow unknown fields)", unknown[0])
+	}
+
+	return nil
+}
+
+func collectUnknownFields(val interface{}, typ reflect.Type, path string, unknown *[]string) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typed := val.(type) {
+	case map[string]interface{}:
+		switch typ.Kind() {
+		case reflect.Struct:
+			fields := map[string]reflect.Type{}
+			structFields(typ, fields)
+
+			for key, fieldVal := range typed {
+				fieldType, found := fields[key]
+				if !found {
+					*unknown = append(*unknown, joinFieldPath(path, key))
+					continue
+				}
+				collectUnknownFields(fieldVal, fieldType, joinFieldPath(path, key), unknown)
+			}
+
+		case reflect.Map:
+			for key, itemVal := range typed {
+				collectUnknownFields(itemVal, typ.Elem(), joinFieldPath(path, key), unknown)
+			}
+		}
+
+	case []interface{}:
+		if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+			for i, itemVal := range typed {
+				collectUnknownFields(itemVal, typ.Elem(), fmt.Sprintf("%s[%d]", path, i), unknown)
+			}
+		}
+	}
+}
+
+// structFields collects fields by their JSON names (including fields of inlined structs)
+func structFields(typ reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && len(name) == 0 {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				structFields(fieldType, fields)
+				continue
+			}
+		}
+
+		if len(field.PkgPath) > 0 {
+			continue // unexported
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		fields[name] = field.Type
+	}
+}
+
+func joinFieldPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
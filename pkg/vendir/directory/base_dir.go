@@ -0,0 +1,70 @@
+package directory
+
+import (
+	"path/filepath"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlgit "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/git"
+)
+
+// resolvePath joins relative path with base dir
+// (empty base dir means current working directory)
+func resolvePath(baseDir, path string) string {
+	if len(baseDir) == 0 || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// dirPath returns location of directory on disk
+func (d *Directory) dirPath(syncOpts SyncOpts) string {
+	return resolvePath(syncOpts.BaseDir, d.opts.Path)
+}
+
+// contentsWithBaseDir resolves local paths referenced by contents against base dir
+func contentsWithBaseDir(contents ctlconf.DirectoryContents, baseDir string) ctlconf.DirectoryContents {
+	if len(baseDir) == 0 {
+		return contents
+	}
+
+	if contents.Directory != nil {
+		dirContents := *contents.Directory
+		if len(dirContents.Path) > 0 {
+			dirContents.Path = resolvePath(baseDir, dirContents.Path)
+		}
+		if len(dirContents.FromDirectory) > 0 {
+			dirContents.FromDirectory = resolvePath(baseDir, dirContents.FromDirectory)
+		}
+		contents.Directory = &dirContents
+	}
+
+	if contents.Archive != nil {
+		archiveContents := *contents.Archive
+		archiveContents.Path = resolvePath(baseDir, archiveContents.Path)
+		contents.Archive = &archiveContents
+	}
+
+	if contents.Git != nil {
+		gitContents := *contents.Git
+		if len(gitContents.URL) > 0 && ctlgit.IsLocalPath(gitContents.URL) {
+			gitContents.URL = resolvePath(baseDir, gitContents.URL)
+		}
+		if len(gitContents.ReferenceRepo) > 0 {
+			gitContents.ReferenceRepo = resolvePath(baseDir, gitContents.ReferenceRepo)
+		}
+		contents.Git = &gitContents
+	}
+
+	if contents.HelmChart != nil && contents.HelmChart.Template != nil {
+		helmContents := *contents.HelmChart
+		tplContents := *helmContents.Template
+		tplContents.ValuesFiles = nil
+		for _, path := range helmContents.Template.ValuesFiles {
+			tplContents.ValuesFiles = append(tplContents.ValuesFiles, resolvePath(baseDir, path))
+		}
+		helmContents.Template = &tplContents
+		contents.HelmChart = &helmContents
+	}
+
+	return contents
+}
@@ -0,0 +1,24 @@
+package directory
+
+import (
+	"strings"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// withCABundle makes CA bundle available to fetchers via proxy opts
+func withCABundle(syncOpts SyncOpts, tempArea ctlfetch.TempArea) (SyncOpts, error) {
+	if len(syncOpts.CABundle) == 0 {
+		return syncOpts, nil
+	}
+
+	caBundle := syncOpts.CABundle
+	if !strings.Contains(caBundle, "-----BEGIN") {
+		caBundle = resolvePath(syncOpts.BaseDir, caBundle)
+	}
+
+	var err error
+
+	syncOpts.Proxy, err = ctlfetch.NewCABundle(caBundle, syncOpts.Proxy, tempArea)
+	return syncOpts, err
+}
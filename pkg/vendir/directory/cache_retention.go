@@ -0,0 +1,57 @@
+package directory
+
+import (
+	"fmt"
+	"path/filepath"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// retainCachedVersions evicts cached artifacts of contents
+// versions older than configured number of recent versions
+func (d *Directory) retainCachedVersions(lockContents ctlconf.LockDirectoryContents, syncOpts SyncOpts) error {
+	if syncOpts.CacheRetention <= 0 || syncOpts.DryRun {
+		return nil
+	}
+
+	var version string
+	var fileDigests []string
+
+	switch {
+	case lockContents.HTTP != nil:
+		version = lockContents.HTTP.SHA256
+		fileDigests = []string{lockContents.HTTP.SHA256}
+		if len(lockContents.HTTP.Files) > 0 {
+			// Version digest is not a digest of any cached file
+			fileDigests = nil
+			for _, file := range lockContents.HTTP.Files {
+				fileDigests = append(fileDigests, file.SHA256)
+			}
+		}
+
+	case lockContents.GithubRelease != nil:
+		version = lockContents.GithubRelease.URL
+		for _, asset := range lockContents.GithubRelease.Assets {
+			fileDigests = append(fileDigests, asset.SHA256)
+		}
+
+	default:
+		return nil // versions are only tracked for cached files
+	}
+
+	// Same contents path may be used by multiple projects sharing cache
+	source, err := filepath.Abs(filepath.Join(d.dirPath(syncOpts), lockContents.Path))
+	if err != nil {
+		return err
+	}
+
+	cache := ctlfetch.NewCache(syncOpts.CacheDir, syncOpts.CacheMaxSize)
+
+	err = cache.RetainVersions(source, version, fileDigests, syncOpts.CacheRetention)
+	if err != nil {
+		return fmt.Errorf("Pruning cached versions of directory '%s': %s", lockContents.Path, err)
+	}
+
+	return nil
+}
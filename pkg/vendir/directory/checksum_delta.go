@@ -0,0 +1,57 @@
+package directory
+
+import (
+	"path/filepath"
+	"sort"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// ChecksumDelta lists files whose content changed compared to
+// checksums recorded in previous lock config; added and removed
+// files are not included (they are reported by diff)
+type ChecksumDelta struct {
+	Modified []ChecksumDeltaFile `json:"modified"`
+}
+
+type ChecksumDeltaFile struct {
+	// Path relative to directory
+	Path       string `json:"path"`
+	PrevSHA256 string `json:"prevSHA256"`
+	SHA256     string `json:"sha256"`
+}
+
+// checksumDelta compares recorded file checksums of synced contents
+// with ones found in previous lock config (contents without
+// previously recorded checksums are not compared)
+func (d *Directory) checksumDelta(lockContents []ctlconf.LockDirectoryContents, syncOpts SyncOpts) ChecksumDelta {
+	var delta ChecksumDelta
+
+	if syncOpts.PrevLockConfig == nil {
+		return delta
+	}
+
+	for _, con := range lockContents {
+		prevCon, err := syncOpts.PrevLockConfig.FindContents(d.opts.Path, con.Path)
+		if err != nil || len(prevCon.FileChecksums) == 0 {
+			continue
+		}
+
+		for path, checksum := range con.FileChecksums {
+			prevChecksum, found := prevCon.FileChecksums[path]
+			if found && prevChecksum != checksum {
+				delta.Modified = append(delta.Modified, ChecksumDeltaFile{
+					Path:       filepath.Join(con.Path, path),
+					PrevSHA256: prevChecksum,
+					SHA256:     checksum,
+				})
+			}
+		}
+	}
+
+	sort.Slice(delta.Modified, func(i, j int) bool {
+		return delta.Modified[i].Path < delta.Modified[j].Path
+	})
+
+	return delta
+}
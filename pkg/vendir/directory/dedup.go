@@ -0,0 +1,108 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// Dedup replaces identical files across synced directories with hardlinks.
+// Hardlinked files share contents (modifying one in place modifies all of them),
+// hence it is only used when explicitly requested.
+type Dedup struct {
+	files map[dedupKey]string
+	lock  sync.Mutex
+}
+
+type dedupKey struct {
+	sha256 string
+	size   int64
+	// Hardlinks share permissions as well
+	mode os.FileMode
+}
+
+func NewDedup() *Dedup {
+	return &Dedup{files: map[dedupKey]string{}}
+}
+
+// Apply hardlinks files in given directory to identical files seen
+// in previously applied directories (or the same directory) and
+// returns number of bytes saved. Files that cannot be hardlinked
+// (e.g. located on different filesystems) are kept as copies.
+func (d *Dedup) Apply(dirPath string) (int64, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var savedBytes int64
+
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() == 0 {
+			return nil
+		}
+
+		sha256, err := ctlfetch.FileSHA256(path)
+		if err != nil {
+			return err
+		}
+
+		key := dedupKey{sha256: sha256, size: info.Size(), mode: info.Mode().Perm()}
+
+		linked, err := d.link(key, path, info)
+		if err != nil {
+			return fmt.Errorf("Hardlinking '%s': %s", path, err)
+		}
+		if linked {
+			savedBytes += info.Size()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Deduplicating files of directory '%s': %s", dirPath, err)
+	}
+
+	return savedBytes, nil
+}
+
+func (d *Dedup) link(key dedupKey, path string, info os.FileInfo) (bool, error) {
+	existingPath, found := d.files[key]
+	if !found {
+		d.files[key] = path
+		return false, nil
+	}
+
+	// Previously seen file may have been removed or replaced since
+	existingInfo, err := os.Lstat(existingPath)
+	if err != nil || !existingInfo.Mode().IsRegular() || existingInfo.Size() != key.size ||
+		existingInfo.Mode().Perm() != key.mode {
+		d.files[key] = path
+		return false, nil
+	}
+
+	if os.SameFile(existingInfo, info) {
+		return false, nil
+	}
+
+	tmpPath := path + ".vendir-dedup"
+
+	err = os.Link(existingPath, tmpPath)
+	if err != nil {
+		// Fall back to keeping a copy (e.g. different filesystems or
+		// filesystem without hardlinks support)
+		return false, nil
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+
+	return true, nil
+}
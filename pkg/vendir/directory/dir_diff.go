@@ -0,0 +1,110 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// DirDiff lists files (relative to directory root) that differ
+// between previous and newly synced directory
+type DirDiff struct {
+	Added    []string `json:"added,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// NewDirDiff compares files by their contents (and symlinks by their targets).
+// Missing old directory results in all new files being reported as added.
+func NewDirDiff(oldPath, newPath string) (DirDiff, error) {
+	oldFiles, err := dirFileDigests(oldPath)
+	if err != nil {
+		return DirDiff{}, err
+	}
+
+	newFiles, err := dirFileDigests(newPath)
+	if err != nil {
+		return DirDiff{}, err
+	}
+
+	var diff DirDiff
+
+	for path, newDigest := range newFiles {
+		oldDigest, found := oldFiles[path]
+		switch {
+		case !found:
+			diff.Added = append(diff.Added, path)
+		case oldDigest != newDigest:
+			diff.Modified = append(diff.Modified, path)
+		}
+	}
+
+	for path := range oldFiles {
+		if _, found := newFiles[path]; !found {
+			diff.Removed = append(diff.Removed, path)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Modified)
+	sort.Strings(diff.Removed)
+
+	return diff, nil
+}
+
+func (d DirDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Modified) == 0 && len(d.Removed) == 0
+}
+
+func dirFileDigests(path string) (map[string]string, error) {
+	result := map[string]string{}
+
+	_, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+
+		relPath = filepath.ToSlash(relPath)
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			result[relPath] = "symlink:" + target
+			return nil
+		}
+
+		digest, err := ctlfetch.FileSHA256(filePath)
+		if err != nil {
+			return err
+		}
+
+		result[relPath] = fmt.Sprintf("file:%t:%s", info.Mode()&0111 != 0, digest)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Calculating file digests of directory '%s': %s", path, err)
+	}
+
+	return result, nil
+}
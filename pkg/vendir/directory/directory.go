@@ -1,20 +1,24 @@
 package directory
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cppforlife/go-cli-ui/ui"
 	dircopy "github.com/otiai10/copy"
 	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
 	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
-	ctlgit "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/git"
-	ctlghr "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/githubrelease"
-	ctlhelmc "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/helmchart"
 	ctlhttp "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/http"
-	ctlimg "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/image"
-	ctlinl "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/inline"
 )
 
 type Directory struct {
@@ -29,150 +33,752 @@ func NewDirectory(opts ctlconf.Directory, ui ui.UI) *Directory {
 type SyncOpts struct {
 	RefFetcher     ctlfetch.RefFetcher
 	GithubAPIToken string
-	HelmBinary     string
+	// GithubRateLimitMaxWait limits how long to wait for GitHub API
+	// rate limit to reset before failing (zero value does not wait)
+	GithubRateLimitMaxWait time.Duration
+	HelmBinary             string
+	HgBinary               string
+	SvnBinary              string
+	AwsBinary              string
+	AzBinary               string
+	TempDir                string
+	// Parallelism limits number of contents fetched concurrently
+	// (values less than 2 mean contents are fetched sequentially)
+	Parallelism int
+	// DryRun fetches and filters contents without replacing directory
+	DryRun bool
+	// ResolveOnly fetches contents only to resolve their references
+	// (e.g. git SHAs, image digests) without replacing directory;
+	// unlike dry run, resulting lock config is meant to be saved
+	ResolveOnly bool
+	// Retries specifies how many times network fetches are retried
+	Retries      int
+	RetryBackoff time.Duration
+	// Lazy reuses existing contents when their configuration and
+	// files on disk did not change since they were recorded in PrevLockConfig
+	Lazy bool
+	// PrevLockConfig is also used to retain lock contents of skipped contents
+	PrevLockConfig *ctlconf.LockConfig
+	// CacheDir holds downloaded artifacts shared across syncs
+	// (empty value disables cache; max size of 0 means unbounded)
+	CacheDir     string
+	CacheMaxSize int64
+	// CacheRetention limits how many recently synced versions of http
+	// and githubRelease contents keep their artifacts in cache
+	// (zero value keeps all versions)
+	CacheRetention int
+	// Timeout limits how long entire directory sync may take
+	// (zero value means no limit)
+	Timeout time.Duration
+	// Diff compares previous directory with synced directory
+	// and includes resulting diff into sync summary
+	Diff bool
+	// Proxy takes precedence over proxy environment variables
+	Proxy ctlfetch.ProxyOpts
+	// Progress is optionally notified as contents are synced
+	Progress SyncProgress
+	// Locked pins contents to references recorded in PrevLockConfig
+	// and fails if fetched contents do not match them
+	Locked bool
+	// MinFreeSpace (in bytes) that has to be available for staging
+	// and final directory before sync starts (zero value disables check)
+	MinFreeSpace int64
+	// FailIfUnchanged fails sync if all contents resolved to the same
+	// references as recorded in PrevLockConfig (e.g. upstream stopped publishing)
+	FailIfUnchanged bool
+	// MaxDownloadRate (in bytes per second) is shared by all downloads
+	// of directory contents (zero value means no limit)
+	MaxDownloadRate int64
+	// RecordFileChecksums records sha256 of every synced file
+	// within lock contents (e.g. for auditing)
+	RecordFileChecksums bool
+	// ChecksumDelta reports files whose recorded checksums differ from
+	// ones in PrevLockConfig (requires RecordFileChecksums)
+	ChecksumDelta bool
+	// RecordStats records transferred bytes, size and
+	// sync duration of each contents within lock contents
+	RecordStats bool
+	// ContinueOnError keeps existing files of failed contents and continues
+	// syncing other contents; sync fails with PartialSyncError at the end
+	ContinueOnError bool
+	// BaseDir is used to resolve relative paths (directory path, temp dir and
+	// local paths referenced by contents); empty value means working directory
+	BaseDir string
+	// CABundle (file path or inline PEM) specifies CA certificates
+	// trusted by all HTTPS sources in addition to system roots
+	CABundle string
+	// IncludeContentPaths limits synced contents to given paths (relative to directory);
+	// other contents are skipped as if they were disabled (nil means all contents are synced)
+	IncludeContentPaths []string
+	// DirMode (if non-zero) is used when creating staging and intermediate
+	// directories and is applied to all synced directories
+	DirMode os.FileMode
+	// FileMode (if non-zero) is applied to all synced files; files that were
+	// executable also get execute bits wherever FileMode allows reading
+	FileMode os.FileMode
+	// Dedup (if set) hardlinks identical files across synced directories
+	// instead of keeping copies; files must not be modified in place afterwards
+	Dedup *Dedup
+	// GroupOutput prefixes output lines with contents path and prints
+	// output of each contents at once after it is synced
+	GroupOutput bool
+	// OfflineFallback keeps existing contents (instead of failing) when their
+	// source cannot be reached due to connectivity errors; existing files have
+	// to be recorded in previous lock config and match its file checksums (if any)
+	OfflineFallback bool
 }
 
-func (d *Directory) Sync(syncOpts SyncOpts) (ctlconf.LockDirectory, error) {
+func (d *Directory) Sync(syncOpts SyncOpts) (ctlconf.LockDirectory, SyncSummary, error) {
 	lockConfig := ctlconf.LockDirectory{Path: d.opts.Path}
+	summary := SyncSummary{Path: d.opts.Path}
 
-	stagingDir := NewStagingDir()
+	// Directory may be constructed without loading config from files
+	err := d.opts.Validate()
+	if err != nil {
+		return lockConfig, summary, fmt.Errorf("Validating directory '%s': %s", d.opts.Path, err)
+	}
+
+	stagingDir := NewStagingDir(resolvePath(syncOpts.BaseDir, syncOpts.TempDir)).WithDirMode(syncOpts.DirMode)
+
+	// Checked before tmp dir is prepared and any contents are synced
+	err = d.checkManualContents(stagingDir, syncOpts)
+	if err != nil {
+		return lockConfig, summary, err
+	}
 
-	err := stagingDir.Prepare()
+	err = stagingDir.Prepare()
 	if err != nil {
-		return lockConfig, err
+		return lockConfig, summary, err
 	}
 
 	defer stagingDir.CleanUp()
 
-	for _, contents := range d.opts.Contents {
-		stagingDstPath, err := stagingDir.NewChild(contents.Path)
-		if err != nil {
-			return lockConfig, err
+	syncOpts, err = withCABundle(syncOpts, stagingDir.TempArea())
+	if err != nil {
+		return lockConfig, summary, err
+	}
+
+	err = d.checkFreeSpace(stagingDir, syncOpts)
+	if err != nil {
+		return lockConfig, summary, err
+	}
+
+	lockConfig, summary, err = d.syncWithStagingDir(stagingDir, syncOpts)
+	if err != nil {
+		// Manual or skipped contents may have been already moved into staging dir
+		restoreErr := d.restorePreservedContents(stagingDir, syncOpts)
+		if restoreErr != nil {
+			return lockConfig, summary, fmt.Errorf("%s (restoring existing contents: %s)", err, restoreErr)
 		}
+		return lockConfig, summary, err
+	}
 
-		lockDirContents := ctlconf.LockDirectoryContents{Path: contents.Path}
+	return lockConfig, summary, newPartialSyncError(summary)
+}
 
-		skipFileFilter := false
-		skipNewRootPath := false
+func (d *Directory) syncWithStagingDir(stagingDir StagingDir, syncOpts SyncOpts) (ctlconf.LockDirectory, SyncSummary, error) {
+	lockConfig := ctlconf.LockDirectory{Path: d.opts.Path}
+	summary := SyncSummary{Path: d.opts.Path}
 
-		switch {
-		case contents.Git != nil:
-			gitSync := ctlgit.NewSync(*contents.Git, NewInfoLog(d.ui), syncOpts.RefFetcher)
+	var err error
+	var lockedContents []ctlconf.LockDirectoryContents
 
-			d.ui.PrintLinef("Fetching: %s + %s (git from %s)", d.opts.Path, contents.Path, gitSync.Desc())
+	if syncOpts.Locked {
+		if syncOpts.PrevLockConfig == nil {
+			return lockConfig, summary, fmt.Errorf("Expected lock config to be provided when syncing locked")
+		}
 
-			lock, err := gitSync.Sync(stagingDstPath, stagingDir.TempArea())
-			if err != nil {
-				return lockConfig, fmt.Errorf("Syncing directory '%s' with git contents: %s", contents.Path, err)
+		for _, contents := range d.opts.Contents {
+			if contents.InsecureSkipTLSVerify() && !d.isSkipped(contents, syncOpts) {
+				return lockConfig, summary, fmt.Errorf("Expected contents '%s' to not skip TLS verification when syncing "+
+					"locked since it could mask man-in-the-middle substituting contents of reproducible builds", contents.Path)
 			}
+		}
 
-			lockDirContents.Git = &lock
+		lockedContents, err = d.applyLocks(*syncOpts.PrevLockConfig, syncOpts)
+		if err != nil {
+			return lockConfig, summary, err
+		}
+	}
 
-		case contents.HTTP != nil:
-			d.ui.PrintLinef("Fetching: %s + %s (http from %s)", d.opts.Path, contents.Path, contents.HTTP.URL)
+	ctx := context.Background()
 
-			lock, err := ctlhttp.NewSync(*contents.HTTP, syncOpts.RefFetcher).Sync(stagingDstPath, stagingDir.TempArea())
-			if err != nil {
-				return lockConfig, fmt.Errorf("Syncing directory '%s' with HTTP contents: %s", contents.Path, err)
-			}
+	if syncOpts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, syncOpts.Timeout)
+		defer cancel()
+	}
 
-			lockDirContents.HTTP = &lock
+	if syncOpts.MaxDownloadRate > 0 {
+		ctx = ctlfetch.WithRateLimiter(ctx, ctlfetch.NewRateLimiter(syncOpts.MaxDownloadRate))
+	}
 
-		case contents.Image != nil:
-			d.ui.PrintLinef("Fetching: %s + %s (image from %s)", d.opts.Path, contents.Path, contents.Image.URL)
+	lockConfig.Contents, summary.Contents, err = d.syncAllContents(ctx, stagingDir, syncOpts)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return lockConfig, summary, fmt.Errorf("Timed out after %s: %s", syncOpts.Timeout.Round(time.Millisecond), err)
+		}
+		return lockConfig, summary, err
+	}
 
-			lock, err := ctlimg.NewSync(*contents.Image, syncOpts.RefFetcher).Sync(stagingDstPath)
-			if err != nil {
-				return lockConfig, fmt.Errorf("Syncing directory '%s' with image contents: %s", contents.Path, err)
-			}
+	for i, lockedContent := range lockedContents {
+		if d.isSkipped(d.opts.Contents[i], syncOpts) {
+			continue
+		}
+		err = verifyLocked(lockedContent, lockConfig.Contents[i])
+		if err != nil {
+			return lockConfig, summary, err
+		}
+	}
 
-			lockDirContents.Image = &lock
+	if syncOpts.FailIfUnchanged {
+		err = d.checkChanged(lockConfig.Contents, syncOpts)
+		if err != nil {
+			return lockConfig, summary, err
+		}
+	}
 
-		case contents.GithubRelease != nil:
-			sync := ctlghr.NewSync(*contents.GithubRelease, syncOpts.GithubAPIToken, syncOpts.RefFetcher)
+	lockConfig.Contents = d.withoutUnlockedSkipped(lockConfig.Contents, summary.Contents, syncOpts)
 
-			desc, _, _ := sync.DescAndURL()
-			d.ui.PrintLinef("Fetching: %s + %s (github release %s)", d.opts.Path, contents.Path, desc)
+	if syncOpts.RecordFileChecksums {
+		err = d.recordFileChecksums(stagingDir, lockConfig.Contents)
+		if err != nil {
+			return lockConfig, summary, err
+		}
 
-			lock, err := sync.Sync(stagingDstPath, stagingDir.TempArea())
-			if err != nil {
-				return lockConfig, fmt.Errorf("Syncing directory '%s' with github release contents: %s", contents.Path, err)
-			}
+		if syncOpts.ChecksumDelta {
+			delta := d.checksumDelta(lockConfig.Contents, syncOpts)
+			summary.ChecksumDelta = &delta
+		}
+	}
 
-			lockDirContents.GithubRelease = &lock
+	// Digest only describes managed contents hence it is
+	// calculated before preserved paths are copied. It is not
+	// recorded during dry run since manual contents are not
+	// moved into staging dir.
+	if !syncOpts.DryRun && !syncOpts.ResolveOnly {
+		lockConfig.ContentSHA, err = ctlfetch.TreeDigest(stagingDir.Path())
+		if err != nil {
+			return lockConfig, summary, err
+		}
+	}
 
-		case contents.HelmChart != nil:
-			helmChartSync := ctlhelmc.NewSync(*contents.HelmChart, syncOpts.HelmBinary, syncOpts.RefFetcher)
+	err = d.copyPreservedPaths(stagingDir, syncOpts)
+	if err != nil {
+		return lockConfig, summary, err
+	}
 
-			d.ui.PrintLinef("Fetching: %s + %s (helm chart from %s)",
-				d.opts.Path, contents.Path, helmChartSync.Desc())
+	if syncOpts.Diff {
+		diff, err := d.diff(stagingDir, syncOpts)
+		if err != nil {
+			return lockConfig, summary, err
+		}
+		summary.Diff = &diff
+	}
 
-			lock, err := helmChartSync.Sync(stagingDstPath, stagingDir.TempArea())
-			if err != nil {
-				return lockConfig, fmt.Errorf("Syncing directory '%s' with helm chart contents: %s", contents.Path, err)
-			}
+	if syncOpts.DryRun {
+		for _, contents := range d.opts.Contents {
+			d.ui.PrintLinef("Would replace: %s", filepath.Join(d.dirPath(syncOpts), contents.Path))
+		}
+		return lockConfig, summary, nil
+	}
+
+	if syncOpts.ResolveOnly {
+		return lockConfig, summary, nil
+	}
+
+	err = NewFileModes(syncOpts.DirMode, syncOpts.FileMode).Apply(stagingDir.Path())
+	if err != nil {
+		return lockConfig, summary, err
+	}
 
-			lockDirContents.HelmChart = &lock
+	err = stagingDir.Replace(d.dirPath(syncOpts))
+	if err != nil {
+		return lockConfig, summary, err
+	}
 
-		case contents.Manual != nil:
-			d.ui.PrintLinef("Fetching: %s + %s (manual)", d.opts.Path, contents.Path)
+	// Files are linked at their final location so that
+	// they can be shared with other directories
+	if syncOpts.Dedup != nil {
+		summary.DedupSavedBytes, err = syncOpts.Dedup.Apply(d.dirPath(syncOpts))
+		if err != nil {
+			return lockConfig, summary, err
+		}
+	}
 
-			srcPath := filepath.Join(d.opts.Path, contents.Path)
+	return lockConfig, summary, nil
+}
 
-			err := os.Rename(srcPath, stagingDstPath)
-			if err != nil {
-				return lockConfig, fmt.Errorf("Moving directory '%s' to staging dir: %s", srcPath, err)
-			}
+func (d *Directory) checkFreeSpace(stagingDir StagingDir, syncOpts SyncOpts) error {
+	if syncOpts.MinFreeSpace <= 0 {
+		return nil
+	}
 
-			lockDirContents.Manual = &ctlconf.LockDirectoryContentsManual{}
-			skipFileFilter = true
-			skipNewRootPath = true
+	// Directory (or some of its parents) may not exist yet
+	existingPath := filepath.Clean(d.dirPath(syncOpts))
+	for {
+		_, err := os.Stat(existingPath)
+		if err == nil || filepath.Dir(existingPath) == existingPath {
+			break
+		}
+		existingPath = filepath.Dir(existingPath)
+	}
 
-		case contents.Directory != nil:
-			d.ui.PrintLinef("Fetching: %s + %s (directory)", d.opts.Path, contents.Path)
+	for _, path := range []string{stagingDir.Path(), existingPath} {
+		err := ctlfetch.CheckFreeSpace(path, syncOpts.MinFreeSpace, "before syncing directory")
+		if err != nil {
+			return err
+		}
+	}
 
-			err := dircopy.Copy(contents.Directory.Path, stagingDstPath)
-			if err != nil {
-				return lockConfig, fmt.Errorf("Copying another directory contents into directory '%s': %s", contents.Path, err)
+	return nil
+}
+
+// restorePreservedContents moves manual or skipped contents from staging dir
+// back to their original location if they are not there already
+func (d *Directory) restorePreservedContents(stagingDir StagingDir, syncOpts SyncOpts) error {
+	for _, contents := range d.opts.Contents {
+		if !d.isPreserved(contents, syncOpts) {
+			continue
+		}
+
+		srcPath := filepath.Join(d.dirPath(syncOpts), contents.Path)
+		stagingDstPath := filepath.Join(stagingDir.Path(), contents.Path)
+
+		_, err := os.Lstat(srcPath)
+		if err == nil {
+			continue
+		}
+
+		_, err = os.Lstat(stagingDstPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
 			}
+			return err
+		}
 
-			lockDirContents.Directory = &ctlconf.LockDirectoryContentsDirectory{}
+		err = os.MkdirAll(filepath.Dir(filepath.Clean(srcPath)), 0755)
+		if err != nil {
+			return fmt.Errorf("Creating directory '%s': %s", filepath.Dir(srcPath), err)
+		}
 
-		case contents.Inline != nil:
-			d.ui.PrintLinef("Fetching: %s + %s (inline)", d.opts.Path, contents.Path)
+		err = renameDir(stagingDstPath, srcPath)
+		if err != nil {
+			return fmt.Errorf("Moving directory '%s' back from staging dir: %s", srcPath, err)
+		}
+	}
 
-			lock, err := ctlinl.NewSync(*contents.Inline, syncOpts.RefFetcher).Sync(stagingDstPath)
-			if err != nil {
-				return lockConfig, fmt.Errorf("Syncing directory '%s' with inline contents: %s", contents.Path, err)
+	return nil
+}
+
+func (d *Directory) diff(stagingDir StagingDir, syncOpts SyncOpts) (DirDiff, error) {
+	diff, err := NewDirDiff(d.dirPath(syncOpts), stagingDir.Path())
+	if err != nil {
+		return diff, fmt.Errorf("Diffing directory '%s': %s", d.opts.Path, err)
+	}
+
+	if syncOpts.DryRun || syncOpts.ResolveOnly {
+		// Manual and skipped contents are left in place during dry run
+		// hence they are not present in staging dir
+		var removed []string
+		for _, path := range diff.Removed {
+			if !d.isPreservedContentsPath(path, syncOpts) {
+				removed = append(removed, path)
 			}
+		}
+		diff.Removed = removed
+	}
 
-			lockDirContents.Inline = &lock
+	return diff, nil
+}
 
-		default:
-			return lockConfig, fmt.Errorf("Unknown contents type for directory '%s'", contents.Path)
+func (d *Directory) isPreservedContentsPath(path string, syncOpts SyncOpts) bool {
+	for _, contents := range d.opts.Contents {
+		if !d.isPreserved(contents, syncOpts) {
+			continue
+		}
+		if contents.IsEntireDir() || strings.HasPrefix(path, filepath.ToSlash(filepath.Clean(contents.Path))+"/") {
+			return true
 		}
+	}
+	return false
+}
 
-		if !skipFileFilter {
-			err = FileFilter{contents}.Apply(stagingDstPath)
+func (d *Directory) syncAllContents(ctx context.Context, stagingDir StagingDir,
+	syncOpts SyncOpts) ([]ctlconf.LockDirectoryContents, []SyncContentsSummary, error) {
+
+	if syncOpts.Parallelism <= 1 {
+		var result []ctlconf.LockDirectoryContents
+		var summaries []SyncContentsSummary
+		var outputLock sync.Mutex
+
+		for _, contents := range d.opts.Contents {
+			var lockDirContents ctlconf.LockDirectoryContents
+			var summary SyncContentsSummary
+			var err error
+
+			if syncOpts.GroupOutput {
+				lockDirContents, summary, err = d.syncContentsBuffered(ctx, contents, stagingDir, syncOpts, &outputLock)
+			} else {
+				lockDirContents, summary, err = d.syncContentsWithSummary(ctx, contents, stagingDir, syncOpts, d.ui)
+				if err != nil {
+					lockDirContents, summary, err = d.keepFailedContents(ctx, contents, stagingDir, syncOpts, err, d.ui)
+				}
+			}
 			if err != nil {
-				return lockConfig, fmt.Errorf("Filtering paths in directory '%s': %s", contents.Path, err)
+				return nil, nil, err
 			}
+			result = append(result, lockDirContents)
+			summaries = append(summaries, summary)
 		}
 
-		if !skipNewRootPath && len(contents.NewRootPath) > 0 {
-			err = NewSubPath(contents.NewRootPath).Extract(stagingDstPath, stagingDstPath, stagingDir.TempArea())
-			if err != nil {
-				return lockConfig, fmt.Errorf("Changing to new root path '%s': %s", contents.Path, err)
+		return result, summaries, nil
+	}
+
+	result := make([]ctlconf.LockDirectoryContents, len(d.opts.Contents))
+	summaries := make([]SyncContentsSummary, len(d.opts.Contents))
+
+	// Fetches that are still running are cancelled once any contents fail
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var firstErr error
+	var firstErrOnce sync.Once
+	var outputLock sync.Mutex
+	var wg sync.WaitGroup
+
+	idxCh := make(chan int)
+	failedCh := make(chan struct{})
+
+	for i := 0; i < syncOpts.Parallelism; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range idxCh {
+				// Buffer output per contents to avoid interleaving
+				lockDirContents, summary, err := d.syncContentsBuffered(ctx, d.opts.Contents[idx], stagingDir, syncOpts, &outputLock)
+				if err != nil {
+					firstErrOnce.Do(func() {
+						firstErr = err
+						close(failedCh)
+						cancel()
+					})
+					return
+				}
+
+				result[idx] = lockDirContents
+				summaries[idx] = summary
+			}
+		}()
+	}
+
+dispatchLoop:
+	for i := range d.opts.Contents {
+		select {
+		case idxCh <- i:
+		case <-failedCh:
+			break dispatchLoop
+		}
+	}
+
+	close(idxCh)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+
+	return result, summaries, nil
+}
+
+// syncContentsBuffered prints output of contents sync at once (optionally
+// prefixing each line with contents path) so that it stays contiguous
+func (d *Directory) syncContentsBuffered(ctx context.Context, contents ctlconf.DirectoryContents, stagingDir StagingDir,
+	syncOpts SyncOpts, outputLock *sync.Mutex) (ctlconf.LockDirectoryContents, SyncContentsSummary, error) {
+
+	var outputBuf bytes.Buffer
+	var contentsUI ui.UI = ui.NewWriterUI(&outputBuf, &outputBuf, ui.NewNoopLogger())
+
+	if syncOpts.GroupOutput {
+		contentsUI = NewPrefixedUI(contentsUI, fmt.Sprintf("[%s] ", contents.Path))
+	}
+
+	lockDirContents, summary, err := d.syncContentsWithSummary(ctx, contents, stagingDir, syncOpts, contentsUI)
+	if err != nil {
+		lockDirContents, summary, err = d.keepFailedContents(ctx, contents, stagingDir, syncOpts, err, contentsUI)
+	}
+
+	outputLock.Lock()
+	d.ui.PrintBlock(outputBuf.Bytes())
+	outputLock.Unlock()
+
+	return lockDirContents, summary, err
+}
+
+func (d *Directory) syncContentsWithSummary(ctx context.Context, contents ctlconf.DirectoryContents, stagingDir StagingDir,
+	syncOpts SyncOpts, ui ui.UI) (ctlconf.LockDirectoryContents, SyncContentsSummary, error) {
+
+	startTime := time.Now()
+
+	var transferredBytes int64
+
+	if syncOpts.Progress != nil || syncOpts.RecordStats {
+		progressPath := filepath.Join(d.opts.Path, contents.Path)
+
+		if syncOpts.Progress != nil {
+			syncOpts.Progress.OnContentStart(progressPath, contentsType(contents))
+		}
+
+		ctx = ctlfetch.WithBytesProgress(ctx, func(n int64) {
+			// Assets of the same contents may be downloaded concurrently
+			atomic.AddInt64(&transferredBytes, n)
+			if syncOpts.Progress != nil {
+				syncOpts.Progress.OnBytes(progressPath, n)
 			}
+		})
+	}
+
+	lockDirContents, err := d.syncContentsWithTimeout(ctx, contents, stagingDir, syncOpts, ui)
+
+	if syncOpts.Progress != nil {
+		syncOpts.Progress.OnContentDone(filepath.Join(d.opts.Path, contents.Path), lockDirContents, err)
+	}
+
+	if err != nil {
+		return lockDirContents, SyncContentsSummary{}, err
+	}
+
+	stagingDstPath, err := stagingDir.NewChild(contents.Path)
+	if err != nil {
+		return lockDirContents, SyncContentsSummary{}, err
+	}
+
+	summary, err := newSyncContentsSummary(lockDirContents, stagingDstPath, time.Since(startTime))
+	if err != nil {
+		return lockDirContents, summary, fmt.Errorf("Summarizing directory '%s': %s", contents.Path, err)
+	}
+
+	if syncOpts.RecordStats {
+		lockDirContents.Stats = &ctlconf.LockDirectoryContentsStats{
+			TransferredBytes: atomic.LoadInt64(&transferredBytes),
+			Bytes:            summary.Bytes,
+			Duration:         summary.Duration.Round(time.Millisecond).String(),
+		}
+	} else {
+		// Reused contents may carry stats of previous sync
+		lockDirContents.Stats = nil
+	}
+
+	return lockDirContents, summary, nil
+}
+
+func (d *Directory) syncContentsWithTimeout(ctx context.Context, contents ctlconf.DirectoryContents,
+	stagingDir StagingDir, syncOpts SyncOpts, ui ui.UI) (ctlconf.LockDirectoryContents, error) {
+
+	timeout, err := contents.TimeoutDuration()
+	if err != nil {
+		return ctlconf.LockDirectoryContents{Path: contents.Path}, err
+	}
+
+	contentsCtx := ctx
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		contentsCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	lockDirContents, err := d.syncContents(contentsCtx, contents, stagingDir, syncOpts, ui)
+	// Only attribute failure to contents timeout if overall sync deadline did not pass
+	if err != nil && contentsCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return lockDirContents, fmt.Errorf("Syncing directory '%s' timed out after %s: %s", contents.Path, timeout, err)
+	}
+
+	return lockDirContents, err
+}
+
+func (d *Directory) syncContents(ctx context.Context, contents ctlconf.DirectoryContents, stagingDir StagingDir,
+	syncOpts SyncOpts, ui ui.UI) (ctlconf.LockDirectoryContents, error) {
+
+	lockDirContents := ctlconf.LockDirectoryContents{Path: contents.Path}
+
+	if len(d.opts.CommonExcludePaths) > 0 {
+		contents.ExcludePaths = append(append([]string{}, contents.ExcludePaths...), d.opts.CommonExcludePaths...)
+	}
+
+	stagingDstPath, err := stagingDir.NewChild(contents.Path)
+	if err != nil {
+		return lockDirContents, err
+	}
+
+	if d.isSkipped(contents, syncOpts) {
+		return d.skipContents(contents, stagingDstPath, syncOpts, ui)
+	}
+
+	if syncOpts.Lazy && contents.Manual == nil {
+		prevLockDirContents, reused, err := d.reuseUnchanged(ctx, contents, stagingDstPath, stagingDir.TempArea(), syncOpts)
+		if err != nil {
+			return lockDirContents, err
+		}
+		if reused {
+			ui.PrintLinef("Fetching: %s + %s (skipped: unchanged since last sync)", d.opts.Path, contents.Path)
+			return prevLockDirContents, nil
+		}
+	}
+
+	if contents.HTTP != nil {
+		prevLockDirContents, reused, err := d.reuseNotModified(ctx, contents, stagingDstPath, syncOpts)
+		if err != nil {
+			return lockDirContents, err
+		}
+		if reused {
+			ui.PrintLinef("Fetching: %s + %s (skipped: not modified since last sync)", d.opts.Path, contents.Path)
+			return prevLockDirContents, nil
 		}
+	}
+
+	// Directory is replaced with staged contents, hence neither can be copied from
+	excludedPaths := []string{d.dirPath(syncOpts), stagingDir.RootPath()}
 
-		lockConfig.Contents = append(lockConfig.Contents, lockDirContents)
+	lockDirContents, err = syncContent(ctx, contents, d.dirPath(syncOpts), stagingDstPath,
+		excludedPaths, stagingDir.TempArea(), syncOpts, ui)
+	if err != nil {
+		return lockDirContents, err
 	}
 
-	err = stagingDir.Replace(d.opts.Path)
+	err = d.retainCachedVersions(lockDirContents, syncOpts)
 	if err != nil {
-		return lockConfig, err
+		return lockDirContents, err
+	}
+
+	// Digests allow to reuse contents when server reports that URL content was not modified
+	hasHTTPValidators := lockDirContents.HTTP != nil &&
+		(len(lockDirContents.HTTP.ETag) > 0 || len(lockDirContents.HTTP.LastModified) > 0)
+
+	if (syncOpts.Lazy && contents.Manual == nil) || hasHTTPValidators {
+		lockDirContents.ConfigDigest, err = contentsConfigDigest(contents)
+		if err != nil {
+			return lockDirContents, err
+		}
+
+		lockDirContents.ContentsDigest, err = ctlfetch.TreeDigest(stagingDstPath)
+		if err != nil {
+			return lockDirContents, err
+		}
+	}
+
+	return lockDirContents, nil
+}
+
+// reuseUnchanged copies existing contents into staging dir if contents
+// configuration matches previous lock config, files on disk are intact
+// and contents still resolve to the reference recorded in lock config
+func (d *Directory) reuseUnchanged(ctx context.Context, contents ctlconf.DirectoryContents, stagingDstPath string,
+	tempArea ctlfetch.TempArea, syncOpts SyncOpts) (ctlconf.LockDirectoryContents, bool, error) {
+
+	prevLockDirContents, existingPath, unchanged, err := d.prevUnchanged(contents, syncOpts)
+	if err != nil || !unchanged {
+		return ctlconf.LockDirectoryContents{}, false, err
+	}
+
+	// Unchanged configuration may reference upstream that moved (e.g. branch or image tag)
+	if !resolvesToLocked(ctx, contents, prevLockDirContents, tempArea, syncOpts) {
+		return ctlconf.LockDirectoryContents{}, false, nil
+	}
+
+	err = dircopy.Copy(existingPath, stagingDstPath)
+	if err != nil {
+		return ctlconf.LockDirectoryContents{}, false, fmt.Errorf("Copying existing directory '%s': %s", existingPath, err)
+	}
+
+	return prevLockDirContents, true, nil
+}
+
+// reuseNotModified copies existing contents into staging dir if they are intact
+// and server responds that URL content was not modified since last sync
+func (d *Directory) reuseNotModified(ctx context.Context, contents ctlconf.DirectoryContents,
+	stagingDstPath string, syncOpts SyncOpts) (ctlconf.LockDirectoryContents, bool, error) {
+
+	prevLockDirContents, existingPath, unchanged, err := d.prevUnchanged(contents, syncOpts)
+	if err != nil || !unchanged || prevLockDirContents.HTTP == nil {
+		return ctlconf.LockDirectoryContents{}, false, err
+	}
+
+	// Digests may have been recorded by lazy sync for servers without validators
+	if len(prevLockDirContents.HTTP.ETag) == 0 && len(prevLockDirContents.HTTP.LastModified) == 0 {
+		return ctlconf.LockDirectoryContents{}, false, nil
+	}
+
+	httpSync := ctlhttp.NewSync(*contents.HTTP, syncOpts.RefFetcher,
+		ctlfetch.NewCache(syncOpts.CacheDir, syncOpts.CacheMaxSize), syncOpts.Proxy)
+
+	// Failed conditional request falls back to regular download
+	notModified, err := httpSync.NotModified(ctx, *prevLockDirContents.HTTP)
+	if err != nil || !notModified {
+		return ctlconf.LockDirectoryContents{}, false, nil
 	}
 
-	return lockConfig, nil
+	err = dircopy.Copy(existingPath, stagingDstPath)
+	if err != nil {
+		return ctlconf.LockDirectoryContents{}, false, fmt.Errorf("Copying existing directory '%s': %s", existingPath, err)
+	}
+
+	return prevLockDirContents, true, nil
+}
+
+// prevUnchanged finds previous lock contents if contents configuration
+// matches previous lock config and files on disk are intact
+func (d *Directory) prevUnchanged(contents ctlconf.DirectoryContents,
+	syncOpts SyncOpts) (ctlconf.LockDirectoryContents, string, bool, error) {
+
+	if syncOpts.PrevLockConfig == nil {
+		return ctlconf.LockDirectoryContents{}, "", false, nil
+	}
+
+	prevLockDirContents, err := syncOpts.PrevLockConfig.FindContents(d.opts.Path, contents.Path)
+	if err != nil || len(prevLockDirContents.ConfigDigest) == 0 || len(prevLockDirContents.ContentsDigest) == 0 {
+		return ctlconf.LockDirectoryContents{}, "", false, nil
+	}
+
+	configDigest, err := contentsConfigDigest(contents)
+	if err != nil {
+		return ctlconf.LockDirectoryContents{}, "", false, err
+	}
+
+	if configDigest != prevLockDirContents.ConfigDigest {
+		return ctlconf.LockDirectoryContents{}, "", false, nil
+	}
+
+	existingPath := filepath.Join(d.dirPath(syncOpts), contents.Path)
+
+	_, err = os.Stat(existingPath)
+	if err != nil {
+		return ctlconf.LockDirectoryContents{}, "", false, nil
+	}
+
+	// Avoid reusing partially written or locally modified contents
+	contentsDigest, err := ctlfetch.TreeDigest(existingPath)
+	if err != nil {
+		return ctlconf.LockDirectoryContents{}, "", false, err
+	}
+
+	if contentsDigest != prevLockDirContents.ContentsDigest {
+		return ctlconf.LockDirectoryContents{}, "", false, nil
+	}
+
+	return prevLockDirContents, existingPath, true, nil
+}
+
+func contentsConfigDigest(contents ctlconf.DirectoryContents) (string, error) {
+	bs, err := json.Marshal(contents)
+	if err != nil {
+		return "", fmt.Errorf("Marshaling contents config: %s", err)
+	}
+
+	sum := sha256.Sum256(bs)
+
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
 }
@@ -0,0 +1,1475 @@
+package directory_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctldir "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/directory"
+)
+
+func TestDirectorySyncPreservesFileModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "src")
+
+	err = os.MkdirAll(filepath.Join(srcPath, "bin"), 0755)
+	if err != nil {
+		t.Fatalf("Creating src dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(srcPath, "bin", "script.sh"), []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatalf("Writing script: %s", err)
+	}
+
+	dstPath := filepath.Join(dir, "vendor")
+
+	dirConf := ctlconf.Directory{
+		Path: dstPath,
+		Contents: []ctlconf.DirectoryContents{{
+			Path:      "scripts",
+			Directory: &ctlconf.DirectoryContentsDirectory{Path: srcPath},
+		}},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dstPath, "scripts", "bin", "script.sh"))
+	if err != nil {
+		t.Fatalf("Expected script to be synced: %s", err)
+	}
+
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("Expected script mode to be 0755, but was %o", info.Mode().Perm())
+	}
+}
+
+func TestDirectorySyncAppliesDirAndFileModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "src")
+
+	err = os.MkdirAll(filepath.Join(srcPath, "bin"), 0700)
+	if err != nil {
+		t.Fatalf("Creating src dir: %s", err)
+	}
+
+	for name, mode := range map[string]os.FileMode{"script.sh": 0700, "config.yml": 0600} {
+		err = ioutil.WriteFile(filepath.Join(srcPath, "bin", name), []byte("content"), mode)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	dstPath := filepath.Join(dir, "vendor")
+
+	dirConf := ctlconf.Directory{
+		Path: dstPath,
+		Contents: []ctlconf.DirectoryContents{{
+			Path:      "scripts",
+			Directory: &ctlconf.DirectoryContentsDirectory{Path: srcPath},
+		}},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, DirMode: 0750, FileMode: 0640})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedModes := map[string]os.FileMode{
+		"":                       0750,
+		"scripts/bin":            0750,
+		"scripts/bin/script.sh":  0750,
+		"scripts/bin/config.yml": 0640,
+	}
+
+	for path, expectedMode := range expectedModes {
+		info, err := os.Stat(filepath.Join(dstPath, path))
+		if err != nil {
+			t.Fatalf("Expected '%s' to be synced: %s", path, err)
+		}
+		if info.Mode().Perm() != expectedMode {
+			t.Fatalf("Expected '%s' mode to be %o, but was %o", path, expectedMode, info.Mode().Perm())
+		}
+	}
+}
+
+func TestDirectorySyncDedupHardlinksIdenticalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "src")
+
+	err = os.MkdirAll(srcPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating src dir: %s", err)
+	}
+
+	for name, content := range map[string]string{"large.bin": "identical-content", "empty": ""} {
+		err = ioutil.WriteFile(filepath.Join(srcPath, name), []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	syncOpts := ctldir.SyncOpts{TempDir: dir, Dedup: ctldir.NewDedup()}
+
+	var summaries []ctldir.SyncSummary
+
+	for _, name := range []string{"vendor1", "vendor2"} {
+		dirConf := ctlconf.Directory{
+			Path: filepath.Join(dir, name),
+			Contents: []ctlconf.DirectoryContents{{
+				Path:      "files",
+				Directory: &ctlconf.DirectoryContentsDirectory{Path: srcPath},
+			}},
+		}
+
+		_, summary, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+		if err != nil {
+			t.Fatalf("Expected sync to succeed: %s", err)
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	if summaries[0].DedupSavedBytes != 0 || summaries[1].DedupSavedBytes != int64(len("identical-content")) {
+		t.Fatalf("Expected only second directory to save bytes, but was: %d, %d",
+			summaries[0].DedupSavedBytes, summaries[1].DedupSavedBytes)
+	}
+
+	info1, err := os.Stat(filepath.Join(dir, "vendor1", "files", "large.bin"))
+	if err != nil {
+		t.Fatalf("Expected file to be synced: %s", err)
+	}
+
+	info2, err := os.Stat(filepath.Join(dir, "vendor2", "files", "large.bin"))
+	if err != nil {
+		t.Fatalf("Expected file to be synced: %s", err)
+	}
+
+	if !os.SameFile(info1, info2) {
+		t.Fatalf("Expected identical files to be hardlinked")
+	}
+}
+
+func TestDirectorySyncExcludesOutputAndTmpDirsFromLocalDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dstPath := filepath.Join(dir, "vendor")
+
+	for _, path := range []string{filepath.Join(dir, "config", "app.yml"), filepath.Join(dstPath, "stale", "old.yml")} {
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		err = ioutil.WriteFile(path, []byte("content"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	// Source includes both output dir and tmp dir (with staging data)
+	dirConf := ctlconf.Directory{
+		Path: dstPath,
+		Contents: []ctlconf.DirectoryContents{{
+			Path:      "self",
+			Directory: &ctlconf.DirectoryContentsDirectory{Path: dir},
+		}},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dstPath, "self"))
+	if err != nil {
+		t.Fatalf("Reading synced dir: %s", err)
+	}
+
+	if len(files) != 1 || files[0].Name() != "config" {
+		t.Fatalf("Expected output and tmp dirs to be excluded, but was: %#v", files)
+	}
+
+	// Source within output dir would copy directory into itself
+	dirConf.Contents[0].Directory.Path = filepath.Join(dstPath, "self", "config")
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "to not be within output or temporary directory") {
+		t.Fatalf("Expected self-referential copy to fail, but was: %v", err)
+	}
+}
+
+func TestDirectorySyncGroupOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path:   "a",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"a.txt": "a"}},
+		}, {
+			Path:   "b",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"b.txt": "b"}},
+		}},
+	}
+
+	var outputBuf bytes.Buffer
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewWriterUI(&outputBuf, &outputBuf, ui.NewNoopLogger())).Sync(
+		ctldir.SyncOpts{TempDir: dir, GroupOutput: true})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedOutput := fmt.Sprintf("[a] Fetching: %s + a (inline)\n[b] Fetching: %s + b (inline)\n",
+		dirConf.Path, dirConf.Path)
+
+	if outputBuf.String() != expectedOutput {
+		t.Fatalf("Expected output to be prefixed with contents path, but was: %q", outputBuf.String())
+	}
+}
+
+func TestDirectorySyncDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "src")
+	dstPath := filepath.Join(dir, "vendor")
+
+	files := map[string]string{
+		filepath.Join(srcPath, "added"):             "added",
+		filepath.Join(srcPath, "same"):              "same",
+		filepath.Join(srcPath, "modified"):          "new",
+		filepath.Join(dstPath, "files", "same"):     "same",
+		filepath.Join(dstPath, "files", "modified"): "old",
+		filepath.Join(dstPath, "files", "removed"):  "removed",
+	}
+
+	for path, content := range files {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	dirConf := ctlconf.Directory{
+		Path: dstPath,
+		Contents: []ctlconf.DirectoryContents{{
+			Path:      "files",
+			Directory: &ctlconf.DirectoryContentsDirectory{Path: srcPath},
+		}},
+	}
+
+	_, summary, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, Diff: true})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedDiff := ctldir.DirDiff{
+		Added:    []string{"files/added"},
+		Modified: []string{"files/modified"},
+		Removed:  []string{"files/removed"},
+	}
+
+	if summary.Diff == nil || !reflect.DeepEqual(*summary.Diff, expectedDiff) {
+		t.Fatalf("Expected diff to be %#v, but was %#v", expectedDiff, summary.Diff)
+	}
+}
+
+func TestDirectorySyncDryRunSkipsPostSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	markerPath := filepath.Join(dir, "post-sync-ran")
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path:     "files",
+			Inline:   &ctlconf.DirectoryContentsInline{Paths: map[string]string{"file.txt": "content"}},
+			PostSync: &ctlconf.DirectoryContentsPostSync{Command: []string{"touch", markerPath}},
+		}},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, DryRun: true})
+	if err != nil {
+		t.Fatalf("Expected dry run to succeed: %s", err)
+	}
+
+	if _, err := os.Stat(markerPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected post sync command to not run during dry run: %v", err)
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if _, err := os.Stat(markerPath); err != nil {
+		t.Fatalf("Expected post sync command to run during sync: %s", err)
+	}
+}
+
+type recordingProgress struct {
+	events []string
+	bytes  int64
+}
+
+func (p *recordingProgress) OnContentStart(path, contentsType string) {
+	p.events = append(p.events, "start "+path+" "+contentsType)
+}
+
+func (p *recordingProgress) OnBytes(path string, n int64) { p.bytes += n }
+
+func (p *recordingProgress) OnContentDone(path string, lock ctlconf.LockDirectoryContents, err error) {
+	p.events = append(p.events, fmt.Sprintf("done %s %t %v", path, lock.HTTP != nil, err))
+}
+
+func TestDirectorySyncReportsProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	dstPath := filepath.Join(dir, "vendor")
+
+	dirConf := ctlconf.Directory{
+		Path: dstPath,
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "file",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/file.txt"},
+		}},
+	}
+
+	progress := &recordingProgress{}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, Progress: progress})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	progressPath := filepath.Join(dstPath, "file")
+	expectedEvents := []string{"start " + progressPath + " http", "done " + progressPath + " true <nil>"}
+
+	if !reflect.DeepEqual(progress.events, expectedEvents) {
+		t.Fatalf("Expected events to be %#v, but were %#v", expectedEvents, progress.events)
+	}
+	if progress.bytes != int64(len("content")) {
+		t.Fatalf("Expected %d bytes to be reported, but was %d", len("content"), progress.bytes)
+	}
+}
+
+func TestDirectorySyncRestoresManualContentsOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dstPath := filepath.Join(dir, "vendor")
+	manualFilePath := filepath.Join(dstPath, "manual", "file")
+
+	err = os.MkdirAll(filepath.Dir(manualFilePath), 0755)
+	if err != nil {
+		t.Fatalf("Creating manual dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(manualFilePath, []byte("manual"), 0644)
+	if err != nil {
+		t.Fatalf("Writing manual file: %s", err)
+	}
+
+	dirConf := ctlconf.Directory{
+		Path: dstPath,
+		Contents: []ctlconf.DirectoryContents{{
+			Path:   "manual",
+			Manual: &ctlconf.DirectoryContentsManual{},
+		}, {
+			Path:      "missing",
+			Directory: &ctlconf.DirectoryContentsDirectory{Path: filepath.Join(dir, "missing")},
+		}},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err == nil {
+		t.Fatalf("Expected sync to fail")
+	}
+
+	contents, err := ioutil.ReadFile(manualFilePath)
+	if err != nil {
+		t.Fatalf("Expected manual contents to be restored: %s", err)
+	}
+
+	if string(contents) != "manual" {
+		t.Fatalf("Expected manual contents to be unchanged, but was: %s", contents)
+	}
+}
+
+func TestDirectorySyncKeepsSkippedContents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "src")
+	dstPath := filepath.Join(dir, "vendor")
+
+	for path, content := range map[string]string{
+		filepath.Join(srcPath, "file"):              "new",
+		filepath.Join(dstPath, "disabled", "file"):  "existing",
+		filepath.Join(dstPath, "excluded", "file"):  "existing",
+		filepath.Join(dstPath, "included", "stale"): "existing",
+	} {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	newContents := func(path string, disabled bool) ctlconf.DirectoryContents {
+		return ctlconf.DirectoryContents{
+			Path:      path,
+			Directory: &ctlconf.DirectoryContentsDirectory{Path: srcPath},
+			Disabled:  disabled,
+		}
+	}
+
+	dirConf := ctlconf.Directory{
+		Path: dstPath,
+		Contents: []ctlconf.DirectoryContents{
+			newContents("disabled", true),
+			newContents("excluded", false),
+			newContents("included", false),
+		},
+	}
+
+	syncOpts := ctldir.SyncOpts{TempDir: dir, IncludeContentPaths: []string{"included", "disabled"}}
+
+	lockConf, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if len(lockConf.Contents) != 1 || lockConf.Contents[0].Path != "included" {
+		t.Fatalf("Expected only synced contents to be recorded in lock, but was: %#v", lockConf.Contents)
+	}
+
+	for path, expected := range map[string]string{
+		filepath.Join(dstPath, "disabled", "file"): "existing",
+		filepath.Join(dstPath, "excluded", "file"): "existing",
+		filepath.Join(dstPath, "included", "file"): "new",
+	} {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Expected file '%s' to exist: %s", path, err)
+		}
+		if string(content) != expected {
+			t.Fatalf("Expected file '%s' to contain '%s', but was '%s'", path, expected, content)
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(dstPath, "included", "stale"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected stale file to be removed, but was: %v", err)
+	}
+}
+
+func TestSyncContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := ctlconf.DirectoryContents{
+		Path: "config",
+		Inline: &ctlconf.DirectoryContentsInline{
+			Paths: map[string]string{"keep.yml": "keep", "drop.txt": "drop"},
+		},
+		IncludePaths: []string{"*.yml"},
+	}
+
+	stagingPath := filepath.Join(dir, "staging", "config")
+
+	lockContents, err := ctldir.SyncContent(contents, stagingPath, ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if lockContents.Path != "config" || lockContents.Inline == nil {
+		t.Fatalf("Expected inline lock contents, but was: %#v", lockContents)
+	}
+
+	files, err := ioutil.ReadDir(stagingPath)
+	if err != nil {
+		t.Fatalf("Reading staging path: %s", err)
+	}
+
+	if len(files) != 1 || files[0].Name() != "keep.yml" {
+		t.Fatalf("Expected only included files to be synced, but was: %#v", files)
+	}
+}
+
+func TestDirectorySyncFailIfUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "v1"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "snapshot",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/snapshot.txt"},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	syncOpts := ctldir.SyncOpts{
+		TempDir:         dir,
+		FailIfUnchanged: true,
+		PrevLockConfig:  &ctlconf.LockConfig{Directories: []ctlconf.LockDirectory{lockDir}},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err == nil {
+		t.Fatalf("Expected sync to fail since contents did not change")
+	}
+
+	content = "v2"
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed since contents changed: %s", err)
+	}
+}
+
+func TestDirectorySyncCommonExcludePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "config",
+			Inline: &ctlconf.DirectoryContentsInline{
+				Paths: map[string]string{"keep.yml": "keep", "README.md": "drop", "drop.txt": "drop"},
+			},
+			ExcludePaths: []string{"*.txt"},
+		}},
+		CommonExcludePaths: []string{"*.md"},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "vendor", "config"))
+	if err != nil {
+		t.Fatalf("Reading synced dir: %s", err)
+	}
+
+	if len(files) != 1 || files[0].Name() != "keep.yml" {
+		t.Fatalf("Expected common and contents excludes to be combined, but was: %#v", files)
+	}
+}
+
+func TestDirectorySyncPreservePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirPath := filepath.Join(dir, "vendor")
+
+	err = os.MkdirAll(dirPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	for _, name := range []string{"OWNERS", "stale.yml"} {
+		err = ioutil.WriteFile(filepath.Join(dirPath, name), []byte("local"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	dirConf := ctlconf.Directory{
+		Path: dirPath,
+		Contents: []ctlconf.DirectoryContents{{
+			Path:   "config",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"file.yml": "synced"}},
+		}},
+		PreservePaths: []string{"OWNERS", "config/local.yml"},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dirPath, "OWNERS"))
+	if err != nil || string(content) != "local" {
+		t.Fatalf("Expected preserved file to be kept, but was: %s (err: %v)", content, err)
+	}
+
+	// Preserved files are not part of content SHA
+	otherDirConf := ctlconf.Directory{Path: filepath.Join(dir, "other"), Contents: dirConf.Contents}
+
+	otherLockDir, _, err := ctldir.NewDirectory(otherDirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil || lockDir.ContentSHA != otherLockDir.ContentSHA {
+		t.Fatalf("Expected content SHA to exclude preserved paths, but was: %s (err: %v)", lockDir.ContentSHA, err)
+	}
+
+	diffs, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).VerifyContentSHA(lockDir, ctldir.SyncOpts{})
+	if err != nil || len(diffs) > 0 {
+		t.Fatalf("Expected content SHA of directory with preserved paths to match, but was: %v (err: %v)", diffs, err)
+	}
+
+	_, err = os.Stat(filepath.Join(dirPath, "stale.yml"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected unpreserved file to be deleted, but was: %v", err)
+	}
+
+	// Contents producing preserved path conflict with it
+	err = ioutil.WriteFile(filepath.Join(dirPath, "config", "local.yml"), []byte("local"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	dirConf.Contents[0].Inline.Paths["local.yml"] = "synced"
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "Expected preserved path 'config/local.yml' to not be produced by directory contents") {
+		t.Fatalf("Expected sync to fail with conflict, but was: %v", err)
+	}
+}
+
+func TestDirectorySyncRecordFileChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path:   "config",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"a.yml": "a", "sub/b.yml": "b"}},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, RecordFileChecksums: true})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedChecksums := map[string]string{
+		"a.yml":     "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+		"sub/b.yml": "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",
+	}
+
+	if !reflect.DeepEqual(lockDir.Contents[0].FileChecksums, expectedChecksums) {
+		t.Fatalf("Expected file checksums to be recorded, but was: %#v", lockDir.Contents[0].FileChecksums)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "vendor", "config", "a.yml"), []byte("tampered"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	diffs, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).VerifyContentSHA(lockDir, ctldir.SyncOpts{})
+	if err != nil {
+		t.Fatalf("Expected verification to succeed: %s", err)
+	}
+
+	if len(diffs) != 2 || !strings.Contains(diffs[0], "config/a.yml' checksum differs") {
+		t.Fatalf("Expected tampered file and content SHA to be reported, but was: %#v", diffs)
+	}
+}
+
+func TestDirectorySyncChecksumDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path:   "config",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"a.yml": "a", "b.yml": "b"}},
+		}},
+	}
+
+	syncOpts := ctldir.SyncOpts{TempDir: dir, RecordFileChecksums: true, ChecksumDelta: true}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	// Added and removed files are not part of delta
+	dirConf.Contents[0].Inline.Paths = map[string]string{"a.yml": "a2", "c.yml": "c"}
+	syncOpts.PrevLockConfig = &ctlconf.LockConfig{Directories: []ctlconf.LockDirectory{lockDir}}
+
+	_, summary, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	newSum := sha256.Sum256([]byte("a2"))
+
+	expectedDelta := &ctldir.ChecksumDelta{Modified: []ctldir.ChecksumDeltaFile{{
+		Path:       "config/a.yml",
+		PrevSHA256: lockDir.Contents[0].FileChecksums["a.yml"],
+		SHA256:     hex.EncodeToString(newSum[:]),
+	}}}
+
+	if !reflect.DeepEqual(summary.ChecksumDelta, expectedDelta) {
+		t.Fatalf("Expected checksum delta '%#v', but was '%#v'", expectedDelta, summary.ChecksumDelta)
+	}
+}
+
+func TestDirectorySyncContinueOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	failing := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "remote",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/remote.txt"},
+		}, {
+			Path:   "local",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"file.txt": "v1"}},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	failing = true
+	dirConf.Contents[1].Inline.Paths["file.txt"] = "v2"
+
+	syncOpts := ctldir.SyncOpts{
+		TempDir:         dir,
+		ContinueOnError: true,
+		PrevLockConfig:  &ctlconf.LockConfig{Directories: []ctlconf.LockDirectory{lockDir}},
+	}
+
+	newLockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+
+	var partialErr ctldir.PartialSyncError
+	if !errors.As(err, &partialErr) || len(partialErr.Failures) != 1 || partialErr.Failures[0].Path != "remote" {
+		t.Fatalf("Expected sync to fail for remote contents only, but was: %v", err)
+	}
+
+	if !reflect.DeepEqual(newLockDir.Contents[0], lockDir.Contents[0]) {
+		t.Fatalf("Expected lock contents of failed contents to be retained, but was: %#v", newLockDir.Contents[0])
+	}
+
+	for path, expected := range map[string]string{"remote/remote.txt": "/remote.txt", "local/file.txt": "v2"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "vendor", path))
+		if err != nil || string(content) != expected {
+			t.Fatalf("Expected '%s' to contain '%s', but was: %s (err: %v)", path, expected, content, err)
+		}
+	}
+}
+
+func TestDirectorySyncOfflineFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "remote",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/remote.txt"},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, RecordFileChecksums: true})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	// Closed server refuses connections
+	server.Close()
+
+	syncOpts := ctldir.SyncOpts{
+		TempDir:         dir,
+		OfflineFallback: true,
+		PrevLockConfig:  &ctlconf.LockConfig{Directories: []ctlconf.LockDirectory{lockDir}},
+	}
+
+	newLockDir, summary, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed with unreachable source: %s", err)
+	}
+
+	if !reflect.DeepEqual(newLockDir, lockDir) {
+		t.Fatalf("Expected lock contents to be retained, but was: %#v", newLockDir)
+	}
+	if len(summary.Contents[0].Warning) == 0 || len(summary.Contents[0].Error) > 0 {
+		t.Fatalf("Expected summary to include warning, but was: %#v", summary.Contents[0])
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "remote", "remote.txt"))
+	if err != nil || string(content) != "/remote.txt" {
+		t.Fatalf("Expected existing file to be kept, but was: %s (err: %v)", content, err)
+	}
+
+	// Modified files do not match recorded checksums
+	err = ioutil.WriteFile(filepath.Join(dir, "vendor", "remote", "remote.txt"), []byte("modified"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err == nil || !strings.Contains(err.Error(), "to match checksum recorded in lock config") {
+		t.Fatalf("Expected sync to fail with modified existing files, but was: %v", err)
+	}
+}
+
+func TestDirectorySyncRecordsHTTPDigestsOnlyWithValidators(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var downloads int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/validated.txt" {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		downloads++
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "plain",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/plain.txt"},
+		}, {
+			Path: "validated",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/validated.txt"},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	plain, validated := lockDir.Contents[0], lockDir.Contents[1]
+
+	if len(plain.ConfigDigest) > 0 || len(plain.ContentsDigest) > 0 || len(plain.HTTP.ETag) > 0 {
+		t.Fatalf("Expected no digests to be recorded without validators, but was: %#v", plain)
+	}
+	if len(validated.ConfigDigest) == 0 || len(validated.ContentsDigest) == 0 || validated.HTTP.ETag != `"v1"` {
+		t.Fatalf("Expected digests to be recorded with validators, but was: %#v", validated)
+	}
+
+	lockConfig := ctlconf.NewLockConfig()
+	lockConfig.Directories = []ctlconf.LockDirectory{lockDir}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, PrevLockConfig: &lockConfig})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	// Only contents without validators are downloaded again
+	if downloads != 3 {
+		t.Fatalf("Expected not modified contents to be reused, but downloads were: %d", downloads)
+	}
+}
+
+func TestDirectorySyncOnlyRetriesTransientHTTPFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/missing.txt":
+			w.WriteHeader(http.StatusNotFound)
+		case "/unavailable.txt":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/missing.txt", "/unavailable.txt"} {
+		dirConf := ctlconf.Directory{
+			Path: filepath.Join(dir, "vendor"),
+			Contents: []ctlconf.DirectoryContents{{
+				Path: "file",
+				HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + path},
+			}},
+		}
+
+		_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, Retries: 2})
+		if err == nil {
+			t.Fatalf("Expected sync of '%s' to fail", path)
+		}
+	}
+
+	if requests["/missing.txt"] != 1 {
+		t.Fatalf("Expected missing URL to be requested once, but was: %d", requests["/missing.txt"])
+	}
+	if requests["/unavailable.txt"] != 3 {
+		t.Fatalf("Expected unavailable URL to be retried, but was requested: %d", requests["/unavailable.txt"])
+	}
+}
+
+func TestDirectoryLazySyncPicksUpMovedRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	commit := func(content string) {
+		err := ioutil.WriteFile(filepath.Join(repoPath, "file.txt"), []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+		for _, args := range [][]string{{"add", "."}, {"commit", "-m", content}} {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+			cmd.Dir = repoPath
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+			}
+		}
+	}
+
+	out, err := exec.Command("git", "init", "-b", "main", repoPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Initializing repo: %s (output: %s)", err, out)
+	}
+
+	commit("v1")
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "repo",
+			Git:  &ctlconf.DirectoryContentsGit{URL: repoPath, Ref: "origin/main"},
+		}},
+	}
+
+	sync := func() (ctlconf.LockDirectory, string) {
+		var lockConfig *ctlconf.LockConfig
+
+		bs, err := ioutil.ReadFile(filepath.Join(dir, "vendir.lock.yml"))
+		if err == nil {
+			prevLockConfig, err := ctlconf.NewLockConfigFromBytes(bs)
+			if err != nil {
+				t.Fatalf("Reading lock config: %s", err)
+			}
+			lockConfig = &prevLockConfig
+		}
+
+		var outputBuf bytes.Buffer
+
+		lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewWriterUI(&outputBuf, &outputBuf, ui.NewNoopLogger())).Sync(
+			ctldir.SyncOpts{TempDir: dir, Lazy: true, PrevLockConfig: lockConfig})
+		if err != nil {
+			t.Fatalf("Expected sync to succeed: %s", err)
+		}
+
+		newLockConfig := ctlconf.NewLockConfig()
+		newLockConfig.Directories = []ctlconf.LockDirectory{lockDir}
+
+		err = newLockConfig.WriteToFile(filepath.Join(dir, "vendir.lock.yml"))
+		if err != nil {
+			t.Fatalf("Writing lock config: %s", err)
+		}
+
+		return lockDir, outputBuf.String()
+	}
+
+	firstLockDir, _ := sync()
+
+	_, output := sync()
+	if !strings.Contains(output, "skipped: unchanged since last sync") {
+		t.Fatalf("Expected unchanged contents to be reused, but output was: %s", output)
+	}
+
+	// Upstream branch moves while configuration stays the same
+	commit("v2")
+
+	lockDir, output := sync()
+	if strings.Contains(output, "skipped") || lockDir.Contents[0].Git.SHA == firstLockDir.Contents[0].Git.SHA {
+		t.Fatalf("Expected moved branch to be fetched, but output was: %s", output)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "repo", "file.txt"))
+	if err != nil || string(content) != "v2" {
+		t.Fatalf("Expected content of moved branch, but was: %s (err: %v)", content, err)
+	}
+}
+
+func TestDirectoryVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "v1"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"`+content+`"`)
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "remote",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/file.txt"},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, RecordStats: true})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	// Details that are not references (e.g. digests, stats) are not compared
+	lockDir.Contents[0].ConfigDigest = "sha256:older"
+	lockDir.Contents[0].HTTP.ETag = ""
+
+	diffs, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Verify(lockDir, ctldir.SyncOpts{TempDir: dir})
+	if err != nil || len(diffs) > 0 {
+		t.Fatalf("Expected lock config to match, but was: %v (err: %v)", diffs, err)
+	}
+
+	content = "v2"
+
+	diffs, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Verify(lockDir, ctldir.SyncOpts{TempDir: dir})
+	if err != nil || len(diffs) != 1 || !strings.Contains(diffs[0], "Expected contents 'remote' to match lock config") {
+		t.Fatalf("Expected changed contents to be reported, but was: %v (err: %v)", diffs, err)
+	}
+
+	existing, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "remote", "file.txt"))
+	if err != nil || string(existing) != "v1" {
+		t.Fatalf("Expected directory to be left as is, but was: %s (err: %v)", existing, err)
+	}
+}
+
+func TestDirectorySyncParallelCancelsFetchesOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/failing.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// Slow download only finishes when request is cancelled
+		select {
+		case <-r.Context().Done():
+		case <-time.After(30 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	dirConf := ctlconf.Directory{
+		Path: filepath.Join(dir, "vendor"),
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "slow",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/slow.txt"},
+		}, {
+			Path: "failing",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/failing.txt"},
+		}},
+	}
+
+	startedAt := time.Now()
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{TempDir: dir, Parallelism: 2})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Expected sync to fail with error of failing contents, but was: %v", err)
+	}
+
+	if elapsed := time.Since(startedAt); elapsed > 10*time.Second {
+		t.Fatalf("Expected running fetches to be cancelled, but sync took %s", elapsed)
+	}
+}
+
+func TestDirectorySyncResolvesPathsAgainstBaseDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, "local"), 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "local", "file.txt"), []byte("local"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	dirConf := ctlconf.Directory{
+		Path: "vendor",
+		Contents: []ctlconf.DirectoryContents{{
+			Path:      "copied",
+			Directory: &ctlconf.DirectoryContentsDirectory{Path: "local"},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if lockDir.Path != "vendor" {
+		t.Fatalf("Expected lock config to keep relative directory path, but was '%s'", lockDir.Path)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "copied", "file.txt"))
+	if err != nil || string(content) != "local" {
+		t.Fatalf("Expected directory to be synced within base dir, but was: %s (err: %v)", content, err)
+	}
+}
+
+func TestDirectorySyncSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirConf := ctlconf.Directory{
+		Path: "vendor",
+		Contents: []ctlconf.DirectoryContents{{
+			Path:   "v1.2.3",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"file.txt": "content"}},
+		}, {
+			Path:    "links",
+			Symlink: &ctlconf.DirectoryContentsSymlink{Links: map[string]string{"latest": "../v1.2.3"}},
+		}},
+	}
+
+	err = dirConf.Validate()
+	if err != nil {
+		t.Fatalf("Expected config to be valid: %s", err)
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "links", "latest", "file.txt"))
+	if err != nil || string(content) != "content" {
+		t.Fatalf("Expected symlink to point to sibling contents, but was: %s (err: %v)", content, err)
+	}
+
+	dirConf.Contents[1].Symlink.Links["latest"] = "../../outside"
+
+	err = dirConf.Validate()
+	if err == nil || !strings.Contains(err.Error(), "to stay within directory") {
+		t.Fatalf("Expected escaping symlink target to be rejected, but was: %v", err)
+	}
+}
+
+func TestDirectorySyncOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	overlay := &ctlconf.DirectoryContentsOverlay{
+		Sources: []ctlconf.DirectoryContents{{
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{
+				"chart/values.yml": "base", "chart/Chart.yml": "chart"}},
+		}, {
+			Path:   "chart",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"values.yml": "patched"}},
+		}},
+	}
+
+	dirConf := ctlconf.Directory{
+		Path:     "vendor",
+		Contents: []ctlconf.DirectoryContents{{Path: "overlaid", Overlay: overlay}},
+	}
+
+	err = dirConf.Validate()
+	if err != nil {
+		t.Fatalf("Expected config to be valid: %s", err)
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	for path, expected := range map[string]string{"values.yml": "patched", "Chart.yml": "chart"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "overlaid", "chart", path))
+		if err != nil || string(content) != expected {
+			t.Fatalf("Expected file '%s' to be '%s', but was: %s (err: %v)", path, expected, content, err)
+		}
+	}
+
+	if lockOverlay := lockDir.Contents[0].Overlay; lockOverlay == nil || len(lockOverlay.Sources) != 2 {
+		t.Fatalf("Expected lock config to record overlay sources, but was: %#v", lockDir.Contents[0])
+	}
+
+	overlay.ConflictPolicy = ctlconf.OverlayConflictPolicyError
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "Expected path 'values.yml' to not be produced by earlier sources") {
+		t.Fatalf("Expected conflicting overlay sources to fail, but was: %v", err)
+	}
+}
+
+func TestDirectorySyncRecordStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	dirConf := ctlconf.Directory{
+		Path: "vendor",
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "remote",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: server.URL + "/file.txt"},
+		}},
+	}
+
+	lockDir, _, err := ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if lockDir.Contents[0].Stats != nil {
+		t.Fatalf("Expected stats to not be recorded by default")
+	}
+
+	lockDir, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir, RecordStats: true})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	stats := lockDir.Contents[0].Stats
+	if stats == nil || stats.TransferredBytes != 10 || stats.Bytes != 10 || len(stats.Duration) == 0 {
+		t.Fatalf("Expected stats to be recorded, but was: %#v", stats)
+	}
+}
+
+func TestDirectorySyncChecksManualContentsExist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirConf := ctlconf.Directory{
+		Path: "vendor",
+		Contents: []ctlconf.DirectoryContents{{
+			Path:   "inline",
+			Inline: &ctlconf.DirectoryContentsInline{Paths: map[string]string{"file": "inline"}},
+		}, {
+			Path:   "manual",
+			Manual: &ctlconf.DirectoryContentsManual{},
+		}},
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "Expected manual contents 'manual' of directory 'vendor' to exist") {
+		t.Fatalf("Expected missing manual contents to be reported, but was: %v", err)
+	}
+
+	_, err = os.Lstat(filepath.Join(dir, "vendor"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected other contents to not be synced: %v", err)
+	}
+
+	// Simulate manual contents left in staging dir by interrupted sync
+	leftoverPath := filepath.Join(dir, ".vendir-tmp", "staging", "manual", "file")
+
+	err = os.MkdirAll(filepath.Dir(leftoverPath), 0755)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(leftoverPath, []byte("manual"), 0644)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(ctldir.SyncOpts{BaseDir: dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "manual", "file"))
+	if err != nil || string(content) != "manual" {
+		t.Fatalf("Expected leftover manual contents to be restored, but was: %s (err: %v)", content, err)
+	}
+}
+
+func TestDirectorySyncLockedRefusesInsecureSkipTLSVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-directory-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirConf := ctlconf.Directory{
+		Path: "vendor",
+		Contents: []ctlconf.DirectoryContents{{
+			Path: "remote",
+			HTTP: &ctlconf.DirectoryContentsHTTP{URL: "https://example.com/file.txt", InsecureSkipTLSVerify: true},
+		}},
+	}
+
+	syncOpts := ctldir.SyncOpts{BaseDir: dir, Locked: true, PrevLockConfig: &ctlconf.LockConfig{}}
+
+	_, _, err = ctldir.NewDirectory(dirConf, ui.NewNoopUI()).Sync(syncOpts)
+	if err == nil || !strings.Contains(err.Error(), "Expected contents 'remote' to not skip TLS verification when syncing locked") {
+		t.Fatalf("Expected locked sync to be refused, but was: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	dircopy "github.com/otiai10/copy"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// PartialSyncError indicates that directory was synced
+// except for contents that failed (their existing files were kept)
+type PartialSyncError struct {
+	Path     string
+	Failures []SyncContentsSummary
+}
+
+func (e PartialSyncError) Error() string {
+	var msgs []string
+	for _, failure := range e.Failures {
+		msgs = append(msgs, fmt.Sprintf("- %s: %s", filepath.Join(e.Path, failure.Path), failure.Error))
+	}
+	return fmt.Sprintf("Expected all contents to sync successfully, but %d failed:\n%s",
+		len(e.Failures), strings.Join(msgs, "\n"))
+}
+
+func newPartialSyncError(summary SyncSummary) error {
+	var failures []SyncContentsSummary
+	for _, con := range summary.Contents {
+		if len(con.Error) > 0 {
+			failures = append(failures, con)
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return PartialSyncError{Path: summary.Path, Failures: failures}
+}
+
+// keepFailedContents keeps existing files of contents that could not be
+// reached (with offline fallback) or failed (when continuing on error)
+// and retains previously recorded lock contents (if any).
+// Existing files are copied so that they stay in place if entire sync fails.
+func (d *Directory) keepFailedContents(ctx context.Context, contents ctlconf.DirectoryContents, stagingDir StagingDir,
+	syncOpts SyncOpts, syncErr error, ui ui.UI) (ctlconf.LockDirectoryContents, SyncContentsSummary, error) {
+
+	lockDirContents, summary, applied, err := d.useOfflineFallback(ctx, contents, stagingDir, syncOpts, syncErr, ui)
+	if applied {
+		if err == nil {
+			return lockDirContents, summary, nil
+		}
+		syncErr = err
+	}
+
+	lockDirContents = ctlconf.LockDirectoryContents{Path: contents.Path}
+	summary = SyncContentsSummary{Path: contents.Path, Type: contentsType(contents)}
+
+	// Preserved contents are not fetched hence their failures are not recoverable;
+	// overall timeout would affect all remaining contents
+	if !syncOpts.ContinueOnError || d.isPreserved(contents, syncOpts) || ctx.Err() != nil {
+		return lockDirContents, summary, syncErr
+	}
+
+	ui.PrintLinef("Fetching: %s + %s (failed: keeping existing contents): %s", d.opts.Path, contents.Path, syncErr)
+
+	stagingDstPath := filepath.Join(stagingDir.Path(), contents.Path)
+
+	err = os.RemoveAll(stagingDstPath)
+	if err != nil {
+		return lockDirContents, summary, fmt.Errorf("Deleting dir %s: %s", stagingDstPath, err)
+	}
+
+	if !syncOpts.DryRun && !syncOpts.ResolveOnly {
+		srcPath := filepath.Join(d.dirPath(syncOpts), contents.Path)
+
+		_, err := os.Lstat(srcPath)
+		if err == nil {
+			err = dircopy.Copy(srcPath, stagingDstPath)
+			if err != nil {
+				return lockDirContents, summary, fmt.Errorf("Copying existing directory '%s': %s", srcPath, err)
+			}
+		}
+	}
+
+	if syncOpts.PrevLockConfig != nil {
+		prevLockDirContents, err := syncOpts.PrevLockConfig.FindContents(d.opts.Path, contents.Path)
+		if err == nil {
+			lockDirContents = prevLockDirContents
+		}
+	}
+
+	summary.Error = syncErr.Error()
+
+	return lockDirContents, summary, nil
+}
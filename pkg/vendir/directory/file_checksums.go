@@ -0,0 +1,81 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// recordFileChecksums sets file checksums of contents found in staging dir
+// (manual contents are not moved into staging dir during dry run)
+func (d *Directory) recordFileChecksums(stagingDir StagingDir, lockContents []ctlconf.LockDirectoryContents) error {
+	for i, con := range lockContents {
+		path := filepath.Join(stagingDir.Path(), con.Path)
+
+		_, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		lockContents[i].FileChecksums, err = ctlfetch.FileSHA256s(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyFileChecksums compares files on disk with checksums
+// recorded in lock contents and describes files that differ
+func (d *Directory) verifyFileChecksums(dirPath string, lockContents []ctlconf.LockDirectoryContents) ([]string, error) {
+	var diffs []string
+
+	for _, con := range lockContents {
+		if len(con.FileChecksums) == 0 {
+			continue
+		}
+
+		conPath := filepath.Join(dirPath, con.Path)
+
+		actual := map[string]string{}
+
+		_, err := os.Lstat(conPath)
+		if err == nil {
+			actual, err = ctlfetch.FileSHA256s(conPath)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		var conDiffs []string
+
+		for path, checksum := range con.FileChecksums {
+			actualChecksum, found := actual[path]
+			switch {
+			case !found:
+				conDiffs = append(conDiffs, fmt.Sprintf("File '%s' is missing", filepath.Join(conPath, path)))
+			case actualChecksum != checksum:
+				conDiffs = append(conDiffs, fmt.Sprintf("File '%s' checksum differs (locked: %s, actual: %s)",
+					filepath.Join(conPath, path), checksum, actualChecksum))
+			}
+		}
+
+		for path := range actual {
+			if _, found := con.FileChecksums[path]; !found {
+				conDiffs = append(conDiffs, fmt.Sprintf("File '%s' is not recorded in lock config", filepath.Join(conPath, path)))
+			}
+		}
+
+		sort.Strings(conDiffs)
+		diffs = append(diffs, conDiffs...)
+	}
+
+	return diffs, nil
+}
@@ -19,11 +19,24 @@ func (d FileFilter) Apply(dirPath string) error {
 	excludePaths := d.scopePatterns(append([]string{}, d.contents.ExcludePaths...), dirPath)
 	legalPaths := d.scopePatterns(append([]string{}, d.contents.LegalPathsWithDefaults()...), dirPath)
 
+	var submodules *GitSubmodules
+
+	if d.contents.Git != nil && d.contents.Git.SubmodulesEnabled() {
+		subs, err := NewGitSubmodules(dirPath, d.contents.Git.KeepGitDir)
+		if err != nil {
+			return err
+		}
+		submodules = &subs
+	}
+
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if info.IsDir() {
+			if d.isKeptGitDir(path, dirPath) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -33,7 +46,7 @@ func (d FileFilter) Apply(dirPath string) error {
 			matched = true
 		}
 
-		ok, err := d.matchAgainstPatterns(path, includePaths)
+		ok, err := d.matchAgainstPatternsWithParents(path, dirPath, includePaths)
 		if err != nil {
 			return err
 		}
@@ -41,7 +54,7 @@ func (d FileFilter) Apply(dirPath string) error {
 			matched = true
 		}
 
-		ok, err = d.matchAgainstPatterns(path, excludePaths)
+		ok, err = d.matchAgainstPatternsWithParents(path, dirPath, excludePaths)
 		if err != nil {
 			return err
 		}
@@ -71,16 +84,43 @@ func (d FileFilter) Apply(dirPath string) error {
 	}
 
 	_, err = d.deleteEmptyDirs(dirPath, true)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if submodules != nil {
+		return submodules.Reconcile()
+	}
+
+	return nil
 }
 
 func (d FileFilter) scopePatterns(patterns []string, dirPath string) []string {
 	for i, pattern := range patterns {
+		// Join removes trailing slash hence 'dir/' matches as directory 'dir'
 		patterns[i] = filepath.Join(dirPath, pattern)
 	}
 	return patterns
 }
 
+// matchAgainstPatternsWithParents matches file path and its parent directories
+// (up to dirPath) so that pattern matching directory applies to all of its files
+func (d FileFilter) matchAgainstPatternsWithParents(path, dirPath string, patterns []string) (bool, error) {
+	dirPath = filepath.Clean(dirPath)
+
+	for ; path != dirPath && len(path) > len(dirPath); path = filepath.Dir(path) {
+		ok, err := d.matchAgainstPatterns(path, patterns)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func (d FileFilter) matchAgainstPatterns(path string, patterns []string) (bool, error) {
 	for _, pattern := range patterns {
 		ok, err := doublestar.PathMatch(pattern, path)
@@ -104,6 +144,10 @@ func (d FileFilter) deleteEmptyDirs(dirPath string, topLevel bool) (bool, error)
 
 	for _, file := range files {
 		if file.IsDir() {
+			if topLevel && d.isKeptGitDir(filepath.Join(dirPath, file.Name()), dirPath) {
+				// Repository metadata legitimately contains empty directories
+				continue
+			}
 			hasFilesInside, err := d.deleteEmptyDirs(filepath.Join(dirPath, file.Name()), false)
 			if err != nil {
 				return false, err
@@ -126,3 +170,10 @@ func (d FileFilter) deleteEmptyDirs(dirPath string, topLevel bool) (bool, error)
 
 	return true, nil
 }
+
+// isKeptGitDir checks if path is git repository metadata
+// that was explicitly requested to be kept as is
+func (d FileFilter) isKeptGitDir(path, dirPath string) bool {
+	return d.contents.Git != nil && d.contents.Git.KeepGitDir &&
+		filepath.Clean(path) == filepath.Join(dirPath, ".git")
+}
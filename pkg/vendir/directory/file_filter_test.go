@@ -0,0 +1,191 @@
+package directory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestFileFilterIncludeExcludeDirectories(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "vendir-file-filter-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dirPath)
+
+	for _, path := range []string{"LICENSE", "config/app.yml", "config/tests/app_test.yml", "docs/README.md", "main.go"} {
+		fullPath := filepath.Join(dirPath, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+
+		err = ioutil.WriteFile(fullPath, []byte("content"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	contents := ctlconf.DirectoryContents{
+		IncludePaths: []string{"config", "**/*.go"},
+		ExcludePaths: []string{"config/tests/"},
+	}
+
+	err = FileFilter{contents}.Apply(dirPath)
+	if err != nil {
+		t.Fatalf("Expected filtering to succeed: %s", err)
+	}
+
+	var result []string
+
+	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(dirPath, path)
+		result = append(result, relPath)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walking dir: %s", err)
+	}
+
+	sort.Strings(result)
+
+	expectedResult := []string{".", "LICENSE", "config", "config/app.yml", "main.go"}
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected result '%#v' to equal '%#v'", result, expectedResult)
+	}
+}
+
+func TestFileFilterKeepsGitDir(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "vendir-file-filter-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dirPath)
+
+	// Empty directories are commonly found within git metadata
+	err = os.MkdirAll(filepath.Join(dirPath, ".git/refs/tags"), 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	for _, path := range []string{".git/HEAD", "config/app.yml", "main.go"} {
+		fullPath := filepath.Join(dirPath, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+
+		err = ioutil.WriteFile(fullPath, []byte("content"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	contents := ctlconf.DirectoryContents{
+		Git:          &ctlconf.DirectoryContentsGit{KeepGitDir: true},
+		IncludePaths: []string{"config"},
+	}
+
+	err = FileFilter{contents}.Apply(dirPath)
+	if err != nil {
+		t.Fatalf("Expected filtering to succeed: %s", err)
+	}
+
+	for _, path := range []string{".git/HEAD", ".git/refs/tags", "config/app.yml"} {
+		_, err := os.Stat(filepath.Join(dirPath, path))
+		if err != nil {
+			t.Fatalf("Expected '%s' to be kept: %s", path, err)
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(dirPath, "main.go"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected main.go to be filtered out, but was: %v", err)
+	}
+}
+
+func TestFileFilterCleansUpFilteredOutGitSubmodules(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "vendir-file-filter-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dirPath)
+
+	writeFiles := func() {
+		for path, content := range map[string]string{
+			".gitmodules":         "[submodule \"a\"]\n\tpath = a\n\turl = ../a\n[submodule \"b\"]\n\tpath = b\n\turl = ../b\n",
+			".git/config":         "[core]\n\tbare = false\n[submodule \"a\"]\n\turl = ../a\n[submodule \"b\"]\n\turl = ../b\n",
+			".git/modules/a/HEAD": "ref",
+			".git/modules/b/HEAD": "ref",
+			"a/.git":              "gitdir: ../.git/modules/a",
+			"a/file":              "content",
+			"b/.git":              "gitdir: ../.git/modules/b",
+			"b/file":              "content",
+		} {
+			fullPath := filepath.Join(dirPath, path)
+
+			err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+			if err != nil {
+				t.Fatalf("Creating dir: %s", err)
+			}
+
+			err = ioutil.WriteFile(fullPath, []byte(content), 0600)
+			if err != nil {
+				t.Fatalf("Writing file: %s", err)
+			}
+		}
+	}
+
+	writeFiles()
+
+	contents := ctlconf.DirectoryContents{
+		Git:          &ctlconf.DirectoryContentsGit{KeepGitDir: true},
+		ExcludePaths: []string{"b"},
+	}
+
+	err = FileFilter{contents}.Apply(dirPath)
+	if err != nil {
+		t.Fatalf("Expected filtering to succeed: %s", err)
+	}
+
+	for _, path := range []string{".gitmodules", ".git/config"} {
+		bs, err := ioutil.ReadFile(filepath.Join(dirPath, path))
+		if err != nil {
+			t.Fatalf("Reading %s: %s", path, err)
+		}
+		if !strings.Contains(string(bs), `[submodule "a"]`) || strings.Contains(string(bs), `[submodule "b"]`) {
+			t.Fatalf("Expected %s to only reference kept submodule, but was: %s", path, bs)
+		}
+	}
+
+	_, err = os.Stat(filepath.Join(dirPath, ".git/modules/b"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected metadata of filtered out submodule to be removed, but was: %v", err)
+	}
+
+	writeFiles()
+
+	// Filtering out .gitmodules would leave kept submodule dangling
+	contents.ExcludePaths = nil
+	contents.IncludePaths = []string{"a"}
+
+	err = FileFilter{contents}.Apply(dirPath)
+	if err == nil || !strings.Contains(err.Error(), "Expected filters to keep '.gitmodules' since git submodule 'a' is kept") {
+		t.Fatalf("Expected filtering to fail, but was: %v", err)
+	}
+}
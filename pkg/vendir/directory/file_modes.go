@@ -0,0 +1,62 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileModes normalizes permissions of synced tree (e.g. to make
+// it readable by a group different from the one running vendir)
+type FileModes struct {
+	dirMode  os.FileMode
+	fileMode os.FileMode
+}
+
+// NewFileModes returns FileModes; zero mode preserves existing permissions
+func NewFileModes(dirMode, fileMode os.FileMode) FileModes {
+	return FileModes{dirMode: dirMode.Perm(), fileMode: fileMode.Perm()}
+}
+
+func (m FileModes) Apply(dirPath string) error {
+	if m.dirMode == 0 && m.fileMode == 0 {
+		return nil
+	}
+
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			// Changing mode would affect symlink target
+			return nil
+
+		case info.IsDir():
+			if m.dirMode != 0 {
+				return os.Chmod(path, m.dirMode)
+			}
+
+		case info.Mode().IsRegular():
+			if m.fileMode != 0 {
+				return os.Chmod(path, m.fileModeFor(info.Mode()))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Setting permissions of directory '%s': %s", dirPath, err)
+	}
+
+	return nil
+}
+
+func (m FileModes) fileModeFor(mode os.FileMode) os.FileMode {
+	if mode&0111 == 0 {
+		return m.fileMode
+	}
+	// Similar to chmod's 'X': executables stay executable for those who can read them
+	return m.fileMode | (m.fileMode&0444)>>2
+}
@@ -0,0 +1,10 @@
+package directory
+
+import (
+	"os"
+)
+
+// File ownership is not carried over on Windows
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
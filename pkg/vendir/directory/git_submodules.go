@@ -0,0 +1,195 @@
+package directory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	gitSubmoduleSectionRegexp = regexp.MustCompile(`^\[submodule "(.+)"\]$`)
+	gitSubmodulePathRegexp    = regexp.MustCompile(`^path\s*=\s*(.+)$`)
+)
+
+type gitSubmodule struct {
+	Name string
+	// Path of submodule relative to contents directory
+	Path string
+	// ParentPath is path of repository that includes submodule
+	// ("." for top level repository)
+	ParentPath string
+	// ParentGitDir is repository metadata directory of parent
+	// (submodule metadata is stored under its modules/ directory)
+	ParentGitDir string
+}
+
+func (s gitSubmodule) GitDir() string {
+	return filepath.Join(s.ParentGitDir, "modules", s.Name)
+}
+
+// GitSubmodules makes sure that file filtering does not leave
+// references to submodules that were filtered out and does not
+// remove metadata required by submodules that were kept
+type GitSubmodules struct {
+	dirPath    string
+	keepGitDir bool
+	submodules []gitSubmodule
+}
+
+// NewGitSubmodules reads submodules (including nested ones)
+// declared in .gitmodules files before filtering is applied
+func NewGitSubmodules(dirPath string, keepGitDir bool) (GitSubmodules, error) {
+	subs := GitSubmodules{dirPath: dirPath, keepGitDir: keepGitDir}
+
+	err := subs.read(".", ".git")
+	if err != nil {
+		return GitSubmodules{}, fmt.Errorf("Reading git submodules: %s", err)
+	}
+
+	return subs, nil
+}
+
+func (s *GitSubmodules) read(parentPath, parentGitDir string) error {
+	bs, err := ioutil.ReadFile(filepath.Join(s.dirPath, parentPath, ".gitmodules"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var subs []gitSubmodule
+
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if match := gitSubmoduleSectionRegexp.FindStringSubmatch(line); match != nil {
+			subs = append(subs, gitSubmodule{Name: match[1], ParentPath: parentPath, ParentGitDir: parentGitDir})
+			continue
+		}
+
+		if match := gitSubmodulePathRegexp.FindStringSubmatch(line); match != nil && len(subs) > 0 {
+			subs[len(subs)-1].Path = filepath.Join(parentPath, strings.Trim(match[1], `"`))
+		}
+	}
+
+	for _, sub := range subs {
+		if len(sub.Path) == 0 {
+			continue
+		}
+
+		// Parent is recorded before its nested submodules
+		s.submodules = append(s.submodules, sub)
+
+		err := s.read(sub.Path, sub.GitDir())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reconcile checks that kept submodules are still referenced by their
+// parent repository and cleans up metadata of filtered out submodules
+func (s GitSubmodules) Reconcile() error {
+	for _, sub := range s.submodules {
+		_, err := os.Stat(filepath.Join(s.dirPath, sub.Path))
+		if err == nil {
+			err := s.checkKept(sub)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		err = s.cleanUp(sub)
+		if err != nil {
+			return fmt.Errorf("Cleaning up filtered out git submodule '%s': %s", sub.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func (s GitSubmodules) checkKept(sub gitSubmodule) error {
+	if !s.keepGitDir {
+		// Without repository metadata submodule references are not used
+		return nil
+	}
+
+	for _, path := range []string{filepath.Join(sub.ParentPath, ".gitmodules"), filepath.Join(sub.Path, ".git")} {
+		_, err := os.Stat(filepath.Join(s.dirPath, path))
+		if err != nil {
+			return fmt.Errorf("Expected filters to keep '%s' since git submodule '%s' is kept", path, sub.Path)
+		}
+	}
+
+	return nil
+}
+
+func (s GitSubmodules) cleanUp(sub gitSubmodule) error {
+	header := fmt.Sprintf(`[submodule "%s"]`, sub.Name)
+
+	err := s.removeConfigSection(filepath.Join(sub.ParentPath, ".gitmodules"), header, true)
+	if err != nil {
+		return err
+	}
+
+	if !s.keepGitDir {
+		return nil
+	}
+
+	err = s.removeConfigSection(filepath.Join(sub.ParentGitDir, "config"), header, false)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(s.dirPath, sub.GitDir()))
+}
+
+// removeConfigSection removes section (and its keys) from git config
+// formatted file; file is removed if requested when no sections are left
+func (s GitSubmodules) removeConfigSection(path, header string, removeIfEmpty bool) error {
+	path = filepath.Join(s.dirPath, path)
+
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var result []string
+	var inSection, hasSections bool
+
+	for _, line := range strings.Split(string(bs), "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmedLine, "[") {
+			inSection = trimmedLine == header
+			if !inSection {
+				hasSections = true
+			}
+		}
+		if !inSection {
+			result = append(result, line)
+		}
+	}
+
+	if removeIfEmpty && !hasSections {
+		return os.Remove(path)
+	}
+
+	return ioutil.WriteFile(path, []byte(strings.Join(result, "\n")), 0644)
+}
@@ -0,0 +1,183 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlgit "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/git"
+	ctlghr "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/githubrelease"
+	ctlimg "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/image"
+)
+
+var (
+	fullChangesetIDRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	svnRevisionRegexp     = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// resolvesToLocked checks (without fetching contents) that contents
+// still resolve to the same reference as recorded in previous lock config
+// (e.g. branch did not move). Returns false when reference cannot be
+// resolved up front (e.g. http URL without sha256) or resolution failed,
+// in which case contents are fetched as usual.
+func resolvesToLocked(ctx context.Context, contents ctlconf.DirectoryContents,
+	prevLockContents ctlconf.LockDirectoryContents, tempArea ctlfetch.TempArea, syncOpts SyncOpts) bool {
+
+	ref, resolved := resolveRef(ctx, contentsWithBaseDir(contents, syncOpts.BaseDir), tempArea, syncOpts)
+	if !resolved {
+		return false
+	}
+
+	lockedRef, found := lockedRef(prevLockContents)
+
+	return found && ref == lockedRef
+}
+
+// resolveRef returns comparable reference that contents currently resolve to
+func resolveRef(ctx context.Context, contents ctlconf.DirectoryContents,
+	tempArea ctlfetch.TempArea, syncOpts SyncOpts) (string, bool) {
+
+	switch {
+	case contents.Git != nil:
+		lock, resolved, err := ctlgit.NewSync(*contents.Git, NewInfoLog(ui.NewNoopUI()),
+			syncOpts.RefFetcher, syncOpts.Proxy).ResolveSHA(ctx, tempArea)
+		if err != nil || !resolved {
+			return "", false
+		}
+		return lock.SHA, true
+
+	case contents.Image != nil:
+		lock, resolved, err := ctlimg.NewSync(*contents.Image, syncOpts.RefFetcher,
+			ctlfetch.Cache{}, syncOpts.Proxy).Resolve(ctx)
+		if err != nil || !resolved {
+			return "", false
+		}
+		return imageDigest(lock.URL), true
+
+	case contents.GithubRelease != nil:
+		url, err := ctlghr.NewSync(*contents.GithubRelease, syncOpts.GithubAPIToken, syncOpts.RefFetcher,
+			ctlfetch.Cache{}, syncOpts.Proxy, syncOpts.GithubRateLimitMaxWait, NewInfoLog(ui.NewNoopUI())).ResolveURL(ctx)
+		if err != nil {
+			return "", false
+		}
+		return url, true
+
+	case contents.HTTP != nil:
+		// Only content pinned by checksum is known without downloading
+		// (contents with validators are handled via conditional requests)
+		if len(contents.HTTP.Files) > 0 || len(contents.HTTP.SHA256) == 0 {
+			return "", false
+		}
+		return contents.HTTP.SHA256, true
+
+	case contents.HelmChart != nil:
+		// Version constraints are only resolved against repository index
+		if contents.HelmChart.VersionSelection != nil || len(contents.HelmChart.Version) == 0 ||
+			strings.ContainsAny(contents.HelmChart.Version, "<>=~^*|, ") {
+			return "", false
+		}
+		return contents.HelmChart.Version, true
+
+	case contents.Hg != nil:
+		if !fullChangesetIDRegexp.MatchString(contents.Hg.Ref) {
+			return "", false
+		}
+		return contents.Hg.Ref, true
+
+	case contents.Svn != nil:
+		if !svnRevisionRegexp.MatchString(contents.Svn.Revision) {
+			return "", false
+		}
+		return contents.Svn.Revision, true
+
+	case contents.S3 != nil && len(contents.S3.LockedObjects) > 0:
+		return fmt.Sprintf("%v", contents.S3.LockedObjects), true
+
+	case contents.AzureBlob != nil && len(contents.AzureBlob.LockedBlobs) > 0:
+		return fmt.Sprintf("%v", contents.AzureBlob.LockedBlobs), true
+
+	case contents.GCS != nil && len(contents.GCS.LockedObjects) > 0:
+		return fmt.Sprintf("%v", contents.GCS.LockedObjects), true
+
+	case contents.Archive != nil:
+		sha256, err := ctlfetch.FileSHA256(contents.Archive.Path)
+		if err != nil {
+			return "", false
+		}
+		return sha256, true
+
+	case contents.Inline != nil || contents.Symlink != nil:
+		return "", true // fully determined by configuration
+
+	case contents.Overlay != nil:
+		var refs []string
+		for _, src := range contents.Overlay.Sources {
+			ref, resolved := resolveRef(ctx, src, tempArea, syncOpts)
+			if !resolved {
+				return "", false
+			}
+			refs = append(refs, ref)
+		}
+		return strings.Join(refs, ","), true
+
+	default:
+		// Local directories may change without any reference changing
+		return "", false
+	}
+}
+
+// lockedRef returns reference recorded in lock contents
+// in the same form as returned by resolveRef
+func lockedRef(lock ctlconf.LockDirectoryContents) (string, bool) {
+	switch {
+	case lock.Git != nil:
+		return lock.Git.SHA, true
+	case lock.Image != nil:
+		return imageDigest(lock.Image.URL), true
+	case lock.GithubRelease != nil:
+		return lock.GithubRelease.URL, true
+	case lock.HTTP != nil:
+		return lock.HTTP.SHA256, true
+	case lock.HelmChart != nil:
+		return lock.HelmChart.Version, true
+	case lock.Hg != nil:
+		return lock.Hg.SHA, true
+	case lock.Svn != nil:
+		return fmt.Sprintf("%d", lock.Svn.Revision), true
+	case lock.S3 != nil:
+		return fmt.Sprintf("%v", lock.S3.Objects), true
+	case lock.AzureBlob != nil:
+		return fmt.Sprintf("%v", lock.AzureBlob.Blobs), true
+	case lock.GCS != nil:
+		return fmt.Sprintf("%v", lock.GCS.Objects), true
+	case lock.Archive != nil:
+		return lock.Archive.SHA256, true
+	case lock.Inline != nil || lock.Symlink != nil:
+		return "", true
+	case lock.Overlay != nil:
+		var refs []string
+		for _, src := range lock.Overlay.Sources {
+			ref, found := lockedRef(src)
+			if !found {
+				return "", false
+			}
+			refs = append(refs, ref)
+		}
+		return strings.Join(refs, ","), true
+	default:
+		return "", false
+	}
+}
+
+// imageDigest drops registry and repository since pulled image
+// ref may name them differently (e.g. index.docker.io vs docker.io)
+func imageDigest(url string) string {
+	if idx := strings.LastIndex(url, "@"); idx >= 0 {
+		return url[idx+1:]
+	}
+	return url
+}
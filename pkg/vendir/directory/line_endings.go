@@ -0,0 +1,103 @@
+package directory
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// Same number of bytes git inspects when detecting binary files
+const defaultBinaryCheckBytes = 8000
+
+// LineEndings rewrites line endings of text files so that vendored
+// trees do not depend on platform specific checkouts
+type LineEndings struct {
+	opts ctlconf.DirectoryContentsLineEndings
+}
+
+func NewLineEndings(opts ctlconf.DirectoryContentsLineEndings) LineEndings {
+	return LineEndings{opts}
+}
+
+func (e LineEndings) Apply(dirPath string) error {
+	if e.opts.Style == ctlconf.LineEndingsPreserve {
+		return nil
+	}
+
+	return filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			// Repository metadata (e.g. kept .git dir) must not be rewritten
+			if path != dirPath && (info.Name() == ".git" || info.Name() == ".hg") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || !e.matchesExtension(path) {
+			return nil
+		}
+
+		err = e.rewrite(path)
+		if err != nil {
+			return fmt.Errorf("Rewriting '%s': %s", path, err)
+		}
+
+		return nil
+	})
+}
+
+func (e LineEndings) matchesExtension(path string) bool {
+	if len(e.opts.Extensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, allowedExt := range e.opts.Extensions {
+		if ext == strings.ToLower(allowedExt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e LineEndings) rewrite(path string) error {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if e.isBinary(bs) {
+		return nil
+	}
+
+	newBs := bytes.Replace(bs, []byte("\r\n"), []byte("\n"), -1)
+	if e.opts.Style == ctlconf.LineEndingsCRLF {
+		newBs = bytes.Replace(newBs, []byte("\n"), []byte("\r\n"), -1)
+	}
+
+	if bytes.Equal(bs, newBs) {
+		return nil
+	}
+
+	// Existing file keeps its permissions
+	return ioutil.WriteFile(path, newBs, 0600)
+}
+
+func (e LineEndings) isBinary(bs []byte) bool {
+	checkBytes := e.opts.BinaryCheckBytes
+	if checkBytes == 0 {
+		checkBytes = defaultBinaryCheckBytes
+	}
+	if len(bs) > checkBytes {
+		bs = bs[:checkBytes]
+	}
+	return bytes.IndexByte(bs, 0) >= 0
+}
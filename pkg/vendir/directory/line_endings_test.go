@@ -0,0 +1,62 @@
+package directory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestLineEndings(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "vendir-line-endings-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dirPath)
+
+	files := map[string]string{
+		"config.yml":     "a: 1\r\nb: 2\nc: 3\r\n",
+		"image.png":      "\x89PNG\r\n\x00\r\n",
+		"README.md":      "readme\r\n",
+		".git/hooks.yml": "[core]\r\n",
+	}
+
+	for path, content := range files {
+		fullPath := filepath.Join(dirPath, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+
+		err = ioutil.WriteFile(fullPath, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	err = NewLineEndings(ctlconf.DirectoryContentsLineEndings{
+		Style:      ctlconf.LineEndingsCRLF,
+		Extensions: []string{".yml", ".png"},
+	}).Apply(dirPath)
+	if err != nil {
+		t.Fatalf("Expected rewriting line endings to succeed: %s", err)
+	}
+
+	// Binary files, files with other extensions and
+	// repository metadata are left untouched
+	files["config.yml"] = "a: 1\r\nb: 2\r\nc: 3\r\n"
+
+	for path, expectedContent := range files {
+		bs, err := ioutil.ReadFile(filepath.Join(dirPath, path))
+		if err != nil {
+			t.Fatalf("Reading file: %s", err)
+		}
+		if string(bs) != expectedContent {
+			t.Fatalf("Expected '%s' to have content %q, but was %q", path, expectedContent, bs)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlgit "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/git"
+	ctlghr "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/githubrelease"
+	ctlhelmc "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/helmchart"
+)
+
+// DirectoryVersions lists versions available for contents of a directory
+type DirectoryVersions struct {
+	Path     string             `json:"path"`
+	Contents []ContentsVersions `json:"contents"`
+}
+
+type ContentsVersions struct {
+	Path string `json:"path"`
+	// Type matches contents type key in config (e.g. git, helmChart)
+	Type string `json:"type"`
+	// Versions can be used as git ref, helm chart
+	// version or github release tag respectively
+	Versions []string `json:"versions"`
+}
+
+// ListVersions returns versions available for git, helmChart and
+// githubRelease contents without fetching them (other contents are omitted)
+func (d *Directory) ListVersions(syncOpts SyncOpts) (DirectoryVersions, error) {
+	result := DirectoryVersions{Path: d.opts.Path}
+
+	stagingDir := NewStagingDir(resolvePath(syncOpts.BaseDir, syncOpts.TempDir))
+
+	err := stagingDir.Prepare()
+	if err != nil {
+		return result, err
+	}
+
+	defer stagingDir.CleanUp()
+
+	syncOpts, err = withCABundle(syncOpts, stagingDir.TempArea())
+	if err != nil {
+		return result, err
+	}
+
+	ctx := context.Background()
+
+	for _, contents := range d.opts.Contents {
+		if d.isSkipped(contents, syncOpts) {
+			continue
+		}
+
+		contentsVers, err := d.listContentsVersions(ctx, contentsWithBaseDir(contents, syncOpts.BaseDir),
+			stagingDir.TempArea(), syncOpts)
+		if err != nil {
+			return result, fmt.Errorf("Listing versions of contents '%s': %s", contents.Path, err)
+		}
+
+		if contentsVers != nil {
+			result.Contents = append(result.Contents, *contentsVers)
+		}
+	}
+
+	return result, nil
+}
+
+func (d *Directory) listContentsVersions(ctx context.Context, contents ctlconf.DirectoryContents,
+	tempArea ctlfetch.TempArea, syncOpts SyncOpts) (*ContentsVersions, error) {
+
+	result := &ContentsVersions{Path: contents.Path}
+
+	var err error
+
+	switch {
+	case contents.Git != nil:
+		result.Type = "git"
+		result.Versions, err = ctlgit.NewSync(*contents.Git, NewInfoLog(d.ui),
+			syncOpts.RefFetcher, syncOpts.Proxy).ListRefs(ctx, tempArea)
+
+	case contents.HelmChart != nil:
+		result.Type = "helmChart"
+		result.Versions, err = ctlhelmc.NewSync(*contents.HelmChart, syncOpts.HelmBinary,
+			syncOpts.RefFetcher, ctlfetch.Cache{}, syncOpts.Proxy).ListVersions(ctx)
+
+	case contents.GithubRelease != nil:
+		result.Type = "githubRelease"
+		result.Versions, err = ctlghr.NewSync(*contents.GithubRelease, syncOpts.GithubAPIToken, syncOpts.RefFetcher,
+			ctlfetch.Cache{}, syncOpts.Proxy, syncOpts.GithubRateLimitMaxWait, NewInfoLog(d.ui)).ListReleases(ctx)
+
+	default:
+		return nil, nil
+	}
+
+	return result, err
+}
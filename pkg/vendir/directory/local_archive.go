@@ -0,0 +1,56 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type LocalArchive struct {
+	opts ctlconf.DirectoryContentsArchive
+}
+
+func NewLocalArchive(opts ctlconf.DirectoryContentsArchive) LocalArchive {
+	return LocalArchive{opts}
+}
+
+// Extract unpacks archive into given path; entries
+// that would be placed outside of it are rejected
+func (a LocalArchive) Extract(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsArchive, error) {
+	lockConf := ctlconf.LockDirectoryContentsArchive{}
+
+	if len(a.opts.Path) == 0 {
+		return lockConf, fmt.Errorf("Expected non-empty path")
+	}
+
+	sha256, err := ctlfetch.FileSHA256(a.opts.Path)
+	if err != nil {
+		return lockConf, fmt.Errorf("Calculating checksum of archive '%s': %s", a.opts.Path, err)
+	}
+
+	lockConf.SHA256 = sha256
+
+	incomingTmpPath, err := tempArea.NewTempDir("archive")
+	if err != nil {
+		return lockConf, err
+	}
+
+	defer os.RemoveAll(incomingTmpPath)
+
+	final, err := ctlfetch.NewArchive(a.opts.Path, false, "", a.opts.StripComponents).Unpack(incomingTmpPath)
+	if err != nil {
+		return lockConf, fmt.Errorf("Unpacking archive '%s': %s", a.opts.Path, err)
+	}
+	if !final {
+		return lockConf, fmt.Errorf("Expected known archive type (zip, tgz, tar)")
+	}
+
+	err = ctlfetch.MoveSubDir(incomingTmpPath, a.opts.SubPath, dstPath)
+	if err != nil {
+		return lockConf, err
+	}
+
+	return lockConf, nil
+}
@@ -0,0 +1,286 @@
+package directory
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dircopy "github.com/otiai10/copy"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type LocalDirCopy struct {
+	opts          ctlconf.DirectoryContentsDirectory
+	excludedPaths []string
+}
+
+func NewLocalDirCopy(opts ctlconf.DirectoryContentsDirectory) LocalDirCopy {
+	// Output of another directory is copied the same way as any local directory
+	opts.Path = opts.SourcePath()
+	return LocalDirCopy{opts: opts}
+}
+
+// WithExcludedPaths returns LocalDirCopy that skips given paths (e.g. output
+// and temporary directories) when they are found within copied directory
+// and fails when copied directory is located within one of them
+func (c LocalDirCopy) WithExcludedPaths(paths []string) LocalDirCopy {
+	c.excludedPaths = nil
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err == nil {
+			c.excludedPaths = append(c.excludedPaths, absPath)
+		}
+	}
+	return c
+}
+
+func (c LocalDirCopy) Copy(dstPath string) error {
+	err := c.checkNotExcluded()
+	if err != nil {
+		return err
+	}
+
+	err = c.copy(dstPath)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.PreserveOwnership {
+		err = c.copyOwnership(dstPath)
+		if err != nil {
+			return fmt.Errorf("Preserving ownership: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (c LocalDirCopy) copy(dstPath string) error {
+	if c.opts.FollowSymlinks {
+		return c.copyExcluding(c.opts.Path, dstPath, c.copyFollowingSymlinks)
+	}
+
+	err := c.checkSymlinks()
+	if err != nil {
+		return err
+	}
+
+	// Symlinks are copied as is (not dereferenced)
+	return c.copyExcluding(c.opts.Path, dstPath, dircopy.Copy)
+}
+
+// checkNotExcluded prevents self-referential copies (e.g. copying
+// directory's own output or staging data into itself)
+func (c LocalDirCopy) checkNotExcluded() error {
+	srcPath, err := filepath.Abs(c.opts.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, excludedPath := range c.excludedPaths {
+		if srcPath == excludedPath || strings.HasPrefix(srcPath, excludedPath+string(filepath.Separator)) {
+			return fmt.Errorf("Expected directory path '%s' to not be within output or temporary directory '%s'",
+				c.opts.Path, excludedPath)
+		}
+	}
+
+	return nil
+}
+
+// copyExcluding copies srcPath using copyFunc, descending into
+// directories that include excluded paths to skip them
+func (c LocalDirCopy) copyExcluding(srcPath, dstPath string, copyFunc func(string, string) error) error {
+	excluded, containsExcluded := c.exclusion(srcPath)
+	if excluded {
+		return nil
+	}
+	if !containsExcluded {
+		return copyFunc(srcPath, dstPath)
+	}
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("Checking '%s': %s", srcPath, err)
+	}
+
+	err = os.MkdirAll(dstPath, 0700)
+	if err != nil {
+		return fmt.Errorf("Creating directory '%s': %s", dstPath, err)
+	}
+
+	fileInfos, err := ioutil.ReadDir(srcPath)
+	if err != nil {
+		return fmt.Errorf("Reading directory '%s': %s", srcPath, err)
+	}
+
+	for _, fileInfo := range fileInfos {
+		err := c.copyExcluding(filepath.Join(srcPath, fileInfo.Name()), filepath.Join(dstPath, fileInfo.Name()), copyFunc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Chmod(dstPath, info.Mode()&ctlfetch.PreservedModeBits)
+}
+
+// exclusion returns whether path is excluded or is a parent of excluded path
+func (c LocalDirCopy) exclusion(path string) (bool, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, false
+	}
+
+	var containsExcluded bool
+
+	for _, excludedPath := range c.excludedPaths {
+		if absPath == excludedPath {
+			return true, false
+		}
+		if strings.HasPrefix(excludedPath, absPath+string(filepath.Separator)) {
+			containsExcluded = true
+		}
+	}
+
+	return false, containsExcluded
+}
+
+// copyOwnership changes owner of copied files to match source files
+// (typically requires elevated privileges)
+func (c LocalDirCopy) copyOwnership(dstPath string) error {
+	return filepath.Walk(dstPath, func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dstPath, path)
+		if err != nil {
+			return err
+		}
+
+		srcPath := filepath.Join(c.opts.Path, relPath)
+
+		statFunc := os.Lstat
+		if c.opts.FollowSymlinks {
+			statFunc = os.Stat
+		}
+
+		srcInfo, err := statFunc(srcPath)
+		if err != nil {
+			return err
+		}
+
+		uid, gid, found := fileOwner(srcInfo)
+		if !found {
+			return nil
+		}
+
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+// checkSymlinks makes sure that copied symlinks do not
+// point outside of copied directory (e.g. leak host paths)
+func (c LocalDirCopy) checkSymlinks() error {
+	return filepath.Walk(c.opts.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if excluded, _ := c.exclusion(path); excluded {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("Reading symlink '%s': %s", path, err)
+		}
+
+		if filepath.IsAbs(target) {
+			return fmt.Errorf("Expected symlink '%s' to be relative, but points to '%s' "+
+				"(hint: use 'followSymlinks: true' to copy symlinked content)", path, target)
+		}
+
+		relPath, err := filepath.Rel(c.opts.Path, filepath.Join(filepath.Dir(path), target))
+		if err != nil {
+			return fmt.Errorf("Resolving symlink '%s': %s", path, err)
+		}
+
+		_, err = ctlfetch.ScopedPath(c.opts.Path, relPath)
+		if err != nil {
+			return fmt.Errorf("Expected symlink '%s' to point within directory, but points to '%s' "+
+				"(hint: use 'followSymlinks: true' to copy symlinked content)", path, target)
+		}
+
+		return nil
+	})
+}
+
+func (c LocalDirCopy) copyFollowingSymlinks(srcPath, dstPath string) error {
+	// Stat (not Lstat) dereferences symlinks
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("Checking '%s': %s", srcPath, err)
+	}
+
+	if !info.IsDir() {
+		return c.copyFile(srcPath, dstPath, info.Mode())
+	}
+
+	err = os.MkdirAll(dstPath, 0700)
+	if err != nil {
+		return fmt.Errorf("Creating directory '%s': %s", dstPath, err)
+	}
+
+	fileInfos, err := ioutil.ReadDir(srcPath)
+	if err != nil {
+		return fmt.Errorf("Reading directory '%s': %s", srcPath, err)
+	}
+
+	for _, fileInfo := range fileInfos {
+		err := c.copyFollowingSymlinks(filepath.Join(srcPath, fileInfo.Name()), filepath.Join(dstPath, fileInfo.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Restore original mode after contents are written
+	return os.Chmod(dstPath, info.Mode()&ctlfetch.PreservedModeBits)
+}
+
+func (LocalDirCopy) copyFile(srcPath, dstPath string, mode os.FileMode) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("Opening file '%s': %s", srcPath, err)
+	}
+
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return fmt.Errorf("Creating file '%s': %s", dstPath, err)
+	}
+
+	defer dstFile.Close()
+
+	// Explicitly set mode since umask applies during file creation
+	err = dstFile.Chmod(mode & ctlfetch.PreservedModeBits)
+	if err != nil {
+		return fmt.Errorf("Changing file '%s' mode: %s", dstPath, err)
+	}
+
+	_, err = io.Copy(dstFile, srcFile)
+	if err != nil {
+		return fmt.Errorf("Copying file '%s': %s", srcPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package directory
+
+import (
+	"fmt"
+	"reflect"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// applyLocks pins contents to references recorded in lock config
+// and returns lock contents that fetched contents are expected to match
+func (d *Directory) applyLocks(lockConfig ctlconf.LockConfig, syncOpts SyncOpts) ([]ctlconf.LockDirectoryContents, error) {
+	var result []ctlconf.LockDirectoryContents
+
+	for _, contents := range d.opts.Contents {
+		// Skipped contents may not have been recorded in lock config
+		if d.isSkipped(contents, syncOpts) {
+			result = append(result, ctlconf.LockDirectoryContents{Path: contents.Path})
+			continue
+		}
+
+		lockContents, err := lockConfig.FindContents(d.opts.Path, contents.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = contents.Lock(lockContents)
+		if err != nil {
+			return nil, fmt.Errorf("Locking contents '%s': %s", contents.Path, err)
+		}
+
+		result = append(result, lockContents)
+	}
+
+	return result, nil
+}
+
+// verifyLocked checks that fetched contents resolved to
+// the same references as the ones recorded in lock config
+func verifyLocked(expected, actual ctlconf.LockDirectoryContents) error {
+	var locked, fetched interface{}
+
+	switch {
+	case actual.Git != nil && expected.Git != nil:
+		locked = expected.Git.SHA + ":" + expected.Git.ChangedFromSHA
+		fetched = actual.Git.SHA + ":" + actual.Git.ChangedFromSHA
+
+	case actual.HTTP != nil && expected.HTTP != nil:
+		if len(expected.HTTP.SHA256) == 0 {
+			return nil
+		}
+		locked, fetched = expected.HTTP.SHA256, actual.HTTP.SHA256
+
+	case actual.Image != nil && expected.Image != nil:
+		locked, fetched = expected.Image.URL, actual.Image.URL
+
+	case actual.GithubRelease != nil && expected.GithubRelease != nil:
+		locked, fetched = comparableGithubRelease(*expected.GithubRelease), comparableGithubRelease(*actual.GithubRelease)
+
+	case actual.HelmChart != nil && expected.HelmChart != nil:
+		locked, fetched = expected.HelmChart.Version, actual.HelmChart.Version
+		// Digest is only recorded for charts pulled from OCI registries
+		if len(expected.HelmChart.Digest) > 0 {
+			locked = expected.HelmChart.Version + "@" + expected.HelmChart.Digest
+			fetched = actual.HelmChart.Version + "@" + actual.HelmChart.Digest
+		}
+
+	case actual.S3 != nil && expected.S3 != nil:
+		locked, fetched = expected.S3.Objects, actual.S3.Objects
+
+	case actual.AzureBlob != nil && expected.AzureBlob != nil:
+		locked, fetched = expected.AzureBlob.Blobs, actual.AzureBlob.Blobs
+
+	case actual.GCS != nil && expected.GCS != nil:
+		locked, fetched = expected.GCS.Objects, actual.GCS.Objects
+
+	case actual.Archive != nil && expected.Archive != nil:
+		locked, fetched = expected.Archive.SHA256, actual.Archive.SHA256
+
+	case actual.Hg != nil && expected.Hg != nil:
+		locked, fetched = expected.Hg.SHA, actual.Hg.SHA
+
+	case actual.Svn != nil && expected.Svn != nil:
+		locked, fetched = expected.Svn.Revision, actual.Svn.Revision
+
+	case actual.Overlay != nil && expected.Overlay != nil:
+		if len(actual.Overlay.Sources) != len(expected.Overlay.Sources) {
+			return fmt.Errorf("Expected contents '%s' to have the same overlay sources as in lock config", actual.Path)
+		}
+		for i, src := range actual.Overlay.Sources {
+			err := verifyLocked(expected.Overlay.Sources[i], src)
+			if err != nil {
+				return fmt.Errorf("Verifying overlay source (%d) of contents '%s': %s", i, actual.Path, err)
+			}
+		}
+		return nil
+
+	case actual.Manual != nil || actual.Directory != nil || actual.Inline != nil || actual.Symlink != nil:
+		return nil // nothing is locked
+
+	default:
+		return fmt.Errorf("Expected contents '%s' to be of the same type as in lock config", actual.Path)
+	}
+
+	if !reflect.DeepEqual(locked, fetched) {
+		return fmt.Errorf("Expected contents '%s' to match lock config, but upstream has changed "+
+			"(locked: %v, fetched: %v)", actual.Path, locked, fetched)
+	}
+
+	return nil
+}
+
+// comparableGithubRelease drops details that are not recorded by older lock configs
+// (release tag is determined by release URL)
+func comparableGithubRelease(lock ctlconf.LockDirectoryContentsGithubRelease) ctlconf.LockDirectoryContentsGithubRelease {
+	lock.Tag = ""
+
+	var assets []ctlconf.LockDirectoryContentsGithubReleaseAsset
+	for _, asset := range lock.Assets {
+		asset.URL = ""
+		assets = append(assets, asset)
+	}
+	lock.Assets = assets
+	return lock
+}
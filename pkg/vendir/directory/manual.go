@@ -0,0 +1,69 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkManualContents makes sure that manual contents exist before any
+// contents are synced. Manual contents left in tmp dir by previous
+// interrupted sync are moved back since tmp dir is deleted before sync.
+func (d *Directory) checkManualContents(stagingDir StagingDir, syncOpts SyncOpts) error {
+	// Manual contents are not moved when only resolving references
+	if syncOpts.ResolveOnly {
+		return nil
+	}
+
+	for _, contents := range d.opts.Contents {
+		if contents.Manual == nil || d.isSkipped(contents, syncOpts) {
+			continue
+		}
+
+		srcPath := filepath.Join(d.dirPath(syncOpts), contents.Path)
+
+		_, err := os.Lstat(srcPath)
+		if err == nil {
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("Checking manual contents '%s': %s", srcPath, err)
+		}
+
+		restored, err := d.restoreLeftoverManualContents(srcPath, contents.Path, stagingDir)
+		if err != nil {
+			return err
+		}
+		if !restored {
+			return fmt.Errorf("Expected manual contents '%s' of directory '%s' to exist at '%s', but did not find it",
+				contents.Path, d.opts.Path, srcPath)
+		}
+	}
+
+	return nil
+}
+
+func (d *Directory) restoreLeftoverManualContents(srcPath, conPath string, stagingDir StagingDir) (bool, error) {
+	for _, leftoverPath := range stagingDir.LeftoverPaths(conPath) {
+		_, err := os.Lstat(leftoverPath)
+		if err != nil {
+			continue
+		}
+
+		d.ui.PrintLinef("Restoring manual contents '%s' left by previous sync", srcPath)
+
+		err = os.MkdirAll(filepath.Dir(filepath.Clean(srcPath)), 0755)
+		if err != nil {
+			return false, fmt.Errorf("Creating directory '%s': %s", filepath.Dir(srcPath), err)
+		}
+
+		err = renameDir(leftoverPath, srcPath)
+		if err != nil {
+			return false, fmt.Errorf("Moving manual contents '%s' back from tmp dir: %s", srcPath, err)
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
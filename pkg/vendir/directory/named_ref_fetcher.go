@@ -19,12 +19,7 @@ func NewNamedRefFetcher(secrets []ctlconf.Secret, configMaps []ctlconf.ConfigMap
 }
 
 func (f NamedRefFetcher) GetSecret(name string) (ctlconf.Secret, error) {
-	var found []ctlconf.Secret
-	for _, secret := range f.secrets {
-		if secret.Metadata.Name == name {
-			found = append(found, secret)
-		}
-	}
+	found := f.findSecrets(name)
 
 	if len(found) == 0 {
 		return ctlconf.Secret{}, fmt.Errorf(
@@ -38,6 +33,16 @@ func (f NamedRefFetcher) GetSecret(name string) (ctlconf.Secret, error) {
 	return found[0], nil
 }
 
+func (f NamedRefFetcher) findSecrets(name string) []ctlconf.Secret {
+	var found []ctlconf.Secret
+	for _, secret := range f.secrets {
+		if secret.Metadata.Name == name {
+			found = append(found, secret)
+		}
+	}
+	return found
+}
+
 func (f NamedRefFetcher) GetConfigMap(name string) (ctlconf.ConfigMap, error) {
 	var found []ctlconf.ConfigMap
 	for _, configMap := range f.configMaps {
@@ -0,0 +1,102 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	dircopy "github.com/otiai10/copy"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// useOfflineFallback keeps existing files of contents whose source could not
+// be reached, provided that they were recorded in previous lock config
+// (and match recorded file checksums, if any). Returns false when
+// fallback does not apply to given error.
+func (d *Directory) useOfflineFallback(ctx context.Context, contents ctlconf.DirectoryContents, stagingDir StagingDir,
+	syncOpts SyncOpts, syncErr error, ui ui.UI) (ctlconf.LockDirectoryContents, SyncContentsSummary, bool, error) {
+
+	lockDirContents := ctlconf.LockDirectoryContents{Path: contents.Path}
+	summary := SyncContentsSummary{Path: contents.Path, Type: contentsType(contents)}
+
+	// Overall timeout is not a connectivity error of a particular source
+	if !syncOpts.OfflineFallback || !ctlfetch.IsNetworkError(syncErr) || d.isPreserved(contents, syncOpts) || ctx.Err() != nil {
+		return lockDirContents, summary, false, nil
+	}
+
+	fallbackErr := func(msg string, args ...interface{}) error {
+		return fmt.Errorf("%s (offline fallback: %s)", syncErr, fmt.Sprintf(msg, args...))
+	}
+
+	if syncOpts.PrevLockConfig == nil {
+		return lockDirContents, summary, true, fallbackErr("no lock config")
+	}
+
+	prevLockDirContents, err := syncOpts.PrevLockConfig.FindContents(d.opts.Path, contents.Path)
+	if err != nil {
+		return lockDirContents, summary, true, fallbackErr("%s", err)
+	}
+
+	srcPath := filepath.Join(d.dirPath(syncOpts), contents.Path)
+
+	_, err = os.Lstat(srcPath)
+	if err != nil {
+		return lockDirContents, summary, true, fallbackErr("Checking existing contents: %s", err)
+	}
+
+	if len(prevLockDirContents.FileChecksums) > 0 {
+		checksums, err := ctlfetch.FileSHA256s(srcPath)
+		if err != nil {
+			return lockDirContents, summary, true, fallbackErr("Calculating checksums of existing contents: %s", err)
+		}
+
+		err = d.checkSameChecksums(prevLockDirContents.FileChecksums, checksums)
+		if err != nil {
+			return lockDirContents, summary, true, fallbackErr("%s", err)
+		}
+	}
+
+	ui.ErrorLinef("Warning: Fetching: %s + %s (unreachable: keeping existing contents matching lock config): %s",
+		d.opts.Path, contents.Path, syncErr)
+
+	stagingDstPath := filepath.Join(stagingDir.Path(), contents.Path)
+
+	err = os.RemoveAll(stagingDstPath)
+	if err != nil {
+		return lockDirContents, summary, true, fmt.Errorf("Deleting dir %s: %s", stagingDstPath, err)
+	}
+
+	// Existing files are copied so that they stay in place if entire sync fails
+	if !syncOpts.DryRun && !syncOpts.ResolveOnly {
+		err = dircopy.Copy(srcPath, stagingDstPath)
+		if err != nil {
+			return lockDirContents, summary, true, fmt.Errorf("Copying existing directory '%s': %s", srcPath, err)
+		}
+	}
+
+	summary, err = newSyncContentsSummary(prevLockDirContents, stagingDstPath, 0)
+	if err != nil {
+		return lockDirContents, summary, true, err
+	}
+
+	summary.Warning = fmt.Sprintf("Kept existing contents since source was unreachable: %s", syncErr)
+
+	return prevLockDirContents, summary, true, nil
+}
+
+func (d *Directory) checkSameChecksums(expected, actual map[string]string) error {
+	for path, checksum := range expected {
+		if actual[path] != checksum {
+			return fmt.Errorf("Expected existing file '%s' to match checksum recorded in lock config", path)
+		}
+	}
+	for path := range actual {
+		if _, found := expected[path]; !found {
+			return fmt.Errorf("Expected existing file '%s' to be recorded in lock config", path)
+		}
+	}
+	return nil
+}
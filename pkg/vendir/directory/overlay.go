@@ -0,0 +1,98 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// syncOverlay syncs each overlay source separately and then
+// merges it into destination so that later sources take precedence
+func syncOverlay(ctx context.Context, overlay ctlconf.DirectoryContentsOverlay, dirPath, stagingDstPath string,
+	excludedPaths []string, tempArea ctlfetch.TempArea, syncOpts SyncOpts, ui ui.UI) (ctlconf.LockDirectoryContentsOverlay, error) {
+
+	lock := ctlconf.LockDirectoryContentsOverlay{}
+
+	err := os.MkdirAll(stagingDstPath, 0755)
+	if err != nil {
+		return lock, fmt.Errorf("Creating directory: %s", err)
+	}
+
+	for i, src := range overlay.Sources {
+		src = src.WithOverlaySourcePath()
+
+		tmpDir, err := tempArea.NewTempDir("overlay")
+		if err != nil {
+			return lock, err
+		}
+
+		srcStagingPath := filepath.Join(tmpDir, "contents")
+
+		srcLock, err := syncContent(ctx, src, dirPath, srcStagingPath, excludedPaths, tempArea, syncOpts, ui)
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return lock, fmt.Errorf("Syncing overlay source (%d): %s", i, err)
+		}
+
+		err = mergeOverlaySource(srcStagingPath, filepath.Join(stagingDstPath, src.Path), overlay.ConflictPolicy)
+		os.RemoveAll(tmpDir)
+		if err != nil {
+			return lock, fmt.Errorf("Merging overlay source (%d): %s", i, err)
+		}
+
+		lock.Sources = append(lock.Sources, srcLock)
+	}
+
+	return lock, nil
+}
+
+func mergeOverlaySource(srcPath, dstPath, conflictPolicy string) error {
+	_, err := os.Lstat(srcPath)
+	if os.IsNotExist(err) {
+		return nil // nothing was produced (e.g. when only resolving)
+	}
+
+	return filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+
+		newPath := filepath.Join(dstPath, relPath)
+
+		existingInfo, err := os.Lstat(newPath)
+		switch {
+		case os.IsNotExist(err):
+			// nothing to replace
+		case err != nil:
+			return err
+		case info.IsDir() && existingInfo.IsDir():
+			return nil // merge directory contents
+		case conflictPolicy == ctlconf.OverlayConflictPolicyError:
+			return fmt.Errorf("Expected path '%s' to not be produced by earlier sources", filepath.ToSlash(relPath))
+		default:
+			err := os.RemoveAll(newPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if info.IsDir() && relPath != "." {
+			return os.MkdirAll(newPath, info.Mode().Perm())
+		}
+		if info.IsDir() {
+			return os.MkdirAll(newPath, 0755)
+		}
+
+		return os.Rename(path, newPath)
+	})
+}
@@ -0,0 +1,114 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+type PathMappings struct {
+	mappings []ctlconf.DirectoryContentsPathMapping
+}
+
+func NewPathMappings(mappings []ctlconf.DirectoryContentsPathMapping) PathMappings {
+	return PathMappings{mappings}
+}
+
+// Apply moves matched paths within given directory. Mappings are applied
+// in order and paths matched by a single pattern are moved in sorted order.
+func (m PathMappings) Apply(dirPath string) error {
+	dirPath = filepath.Clean(dirPath)
+
+	for _, mapping := range m.mappings {
+		err := m.apply(mapping, dirPath)
+		if err != nil {
+			return fmt.Errorf("Mapping '%s' to '%s': %s", mapping.From, mapping.To, err)
+		}
+	}
+	return nil
+}
+
+func (m PathMappings) apply(mapping ctlconf.DirectoryContentsPathMapping, dirPath string) error {
+	srcPaths, err := doublestar.Glob(filepath.Join(dirPath, mapping.From))
+	if err != nil {
+		return err
+	}
+
+	if len(srcPaths) == 0 {
+		return fmt.Errorf("Expected to match at least one path, but did not")
+	}
+
+	sort.Strings(srcPaths)
+
+	// Paths matched by a pattern keep their names within destination directory
+	isPattern := strings.ContainsAny(mapping.From, "*?[{")
+	dstPath := filepath.Join(dirPath, mapping.To)
+
+	for _, srcPath := range srcPaths {
+		_, err := os.Lstat(srcPath)
+		if os.IsNotExist(err) {
+			// Already moved together with its parent directory
+			continue
+		}
+
+		newPath := dstPath
+		if isPattern {
+			newPath = filepath.Join(dstPath, filepath.Base(srcPath))
+		}
+
+		if newPath == srcPath {
+			continue
+		}
+
+		if strings.HasPrefix(newPath+string(filepath.Separator), srcPath+string(filepath.Separator)) {
+			return fmt.Errorf("Expected destination '%s' to not be within '%s'",
+				m.relPath(newPath, dirPath), m.relPath(srcPath, dirPath))
+		}
+
+		_, err = os.Lstat(newPath)
+		if err == nil {
+			return fmt.Errorf("Expected destination '%s' to not exist (conflicts with '%s')",
+				m.relPath(newPath, dirPath), m.relPath(srcPath, dirPath))
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		err = os.MkdirAll(filepath.Dir(newPath), 0700)
+		if err != nil {
+			return fmt.Errorf("Creating directory: %s", err)
+		}
+
+		err = os.Rename(srcPath, newPath)
+		if err != nil {
+			return fmt.Errorf("Moving '%s': %s", m.relPath(srcPath, dirPath), err)
+		}
+
+		m.deleteEmptyParents(filepath.Dir(srcPath), dirPath)
+	}
+
+	return nil
+}
+
+// deleteEmptyParents removes directories left empty after their contents were moved
+func (PathMappings) deleteEmptyParents(path, dirPath string) {
+	for ; path != dirPath && len(path) > len(dirPath); path = filepath.Dir(path) {
+		// not RemoveAll to only delete empty directories
+		if os.Remove(path) != nil {
+			return
+		}
+	}
+}
+
+func (PathMappings) relPath(path, dirPath string) string {
+	relPath, err := filepath.Rel(dirPath, path)
+	if err != nil {
+		return path
+	}
+	return relPath
+}
@@ -0,0 +1,73 @@
+package directory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestPathMappings(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "vendir-path-mappings-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dirPath)
+
+	for _, path := range []string{"dist/a.js", "dist/lib/b.js", "include/c.h", "README.md"} {
+		fullPath := filepath.Join(dirPath, path)
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+
+		err = ioutil.WriteFile(fullPath, []byte("content"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	err = NewPathMappings([]ctlconf.DirectoryContentsPathMapping{
+		{From: "dist/*", To: "."},
+		{From: "include", To: "headers"},
+	}).Apply(dirPath)
+	if err != nil {
+		t.Fatalf("Expected mapping to succeed: %s", err)
+	}
+
+	var result []string
+
+	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(dirPath, path)
+		result = append(result, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walking dir: %s", err)
+	}
+
+	sort.Strings(result)
+
+	expectedResult := []string{".", "README.md", "a.js", "headers", "headers/c.h", "lib", "lib/b.js"}
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected result '%#v' to equal '%#v'", result, expectedResult)
+	}
+
+	err = NewPathMappings([]ctlconf.DirectoryContentsPathMapping{
+		{From: "headers/c.h", To: "README.md"},
+	}).Apply(dirPath)
+	if err == nil || !strings.Contains(err.Error(), "Expected destination 'README.md' to not exist (conflicts with 'headers/c.h')") {
+		t.Fatalf("Expected conflict error, but was: %v", err)
+	}
+}
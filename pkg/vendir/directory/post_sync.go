@@ -0,0 +1,53 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+type PostSync struct {
+	opts    ctlconf.DirectoryContentsPostSync
+	infoLog io.Writer
+}
+
+func NewPostSync(opts ctlconf.DirectoryContentsPostSync, infoLog io.Writer) PostSync {
+	return PostSync{opts, infoLog}
+}
+
+// Run executes command with given directory as working directory
+func (p PostSync) Run(ctx context.Context, path string) error {
+	timeout, err := p.opts.TimeoutDuration()
+	if err != nil {
+		return err
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	p.infoLog.Write([]byte(fmt.Sprintf("--> %s\n", strings.Join(p.opts.Command, " "))))
+
+	cmd := exec.CommandContext(ctx, p.opts.Command[0], p.opts.Command[1:]...)
+	cmd.Dir = path
+	cmd.Env = append(os.Environ(), p.opts.Env...)
+	cmd.Stdout = p.infoLog
+	cmd.Stderr = p.infoLog
+
+	err = cmd.Run()
+	if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Running post sync command: Timed out after %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("Running post sync command: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package directory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+)
+
+// PrefixedUI prefixes each line of output (including lines
+// written in pieces via BeginLinef) with given prefix
+type PrefixedUI struct {
+	ui.UI
+	prefix string
+	state  *prefixedUIState
+}
+
+type prefixedUIState struct {
+	midLine bool
+	lock    sync.Mutex
+}
+
+var _ ui.UI = PrefixedUI{}
+
+func NewPrefixedUI(ui ui.UI, prefix string) PrefixedUI {
+	return PrefixedUI{ui, prefix, &prefixedUIState{}}
+}
+
+func (u PrefixedUI) ErrorLinef(pattern string, args ...interface{}) {
+	u.UI.ErrorLinef("%s", u.prefixed(fmt.Sprintf(pattern, args...), true))
+}
+
+func (u PrefixedUI) PrintLinef(pattern string, args ...interface{}) {
+	u.UI.PrintLinef("%s", u.prefixed(fmt.Sprintf(pattern, args...), true))
+}
+
+func (u PrefixedUI) BeginLinef(pattern string, args ...interface{}) {
+	u.UI.BeginLinef("%s", u.prefixed(fmt.Sprintf(pattern, args...), false))
+}
+
+func (u PrefixedUI) EndLinef(pattern string, args ...interface{}) {
+	u.UI.EndLinef("%s", u.prefixed(fmt.Sprintf(pattern, args...), true))
+}
+
+func (u PrefixedUI) PrintBlock(block []byte) {
+	u.UI.PrintBlock([]byte(u.prefixed(string(block), false)))
+}
+
+func (u PrefixedUI) PrintErrorBlock(block string) {
+	u.UI.PrintErrorBlock(u.prefixed(block, false))
+}
+
+// prefixed adds prefix at the beginning of each line; endsLine
+// indicates that underlying UI terminates output with a new line
+func (u PrefixedUI) prefixed(str string, endsLine bool) string {
+	u.state.lock.Lock()
+	defer u.state.lock.Unlock()
+
+	var result strings.Builder
+
+	for i, line := range strings.SplitAfter(str, "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		if i > 0 || !u.state.midLine {
+			result.WriteString(u.prefix)
+		}
+		result.WriteString(line)
+	}
+
+	if len(str) == 0 && !u.state.midLine {
+		result.WriteString(u.prefix)
+	}
+
+	u.state.midLine = !endsLine && !strings.HasSuffix(str, "\n")
+
+	return result.String()
+}
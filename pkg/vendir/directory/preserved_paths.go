@@ -0,0 +1,102 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	dircopy "github.com/otiai10/copy"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// copyPreservedPaths copies files that are not managed by vendir
+// from existing directory into staging dir so that they survive replacement
+func (d *Directory) copyPreservedPaths(stagingDir StagingDir, syncOpts SyncOpts) error {
+	dirPath := filepath.Clean(d.dirPath(syncOpts))
+
+	relPaths, err := d.preservedPaths(dirPath)
+	if err != nil {
+		return err
+	}
+
+	var copiedPaths []string
+
+	for _, relPath := range relPaths {
+		if d.isWithinPaths(relPath, copiedPaths) {
+			// Already copied together with its parent directory
+			continue
+		}
+
+		path := filepath.Join(dirPath, relPath)
+		stagingDstPath := filepath.Join(stagingDir.Path(), relPath)
+
+		_, err = os.Lstat(stagingDstPath)
+		if err == nil {
+			return fmt.Errorf("Expected preserved path '%s' to not be produced by directory contents", relPath)
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		err = dircopy.Copy(path, stagingDstPath)
+		if err != nil {
+			return fmt.Errorf("Copying preserved path '%s': %s", relPath, err)
+		}
+
+		copiedPaths = append(copiedPaths, relPath)
+	}
+
+	return nil
+}
+
+// preservedPaths returns sorted paths (relative to given directory)
+// of existing files and directories matching preserved path patterns
+func (d *Directory) preservedPaths(dirPath string) ([]string, error) {
+	var relPaths []string
+
+	for _, pattern := range d.opts.PreservePaths {
+		matches, err := doublestar.Glob(filepath.Join(dirPath, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("Matching preserved path '%s': %s", pattern, err)
+		}
+
+		for _, match := range matches {
+			relPath, err := filepath.Rel(dirPath, match)
+			if err != nil {
+				return nil, err
+			}
+			relPaths = append(relPaths, relPath)
+		}
+	}
+
+	sort.Strings(relPaths)
+
+	return relPaths, nil
+}
+
+// ContentSHA calculates digest of given directory on disk
+// without preserved paths (they are not managed by vendir)
+func (d *Directory) ContentSHA(dirPath string) (string, error) {
+	relPaths, err := d.preservedPaths(filepath.Clean(dirPath))
+	if err != nil {
+		return "", err
+	}
+
+	for i, relPath := range relPaths {
+		relPaths[i] = filepath.ToSlash(relPath)
+	}
+
+	return ctlfetch.TreeDigestExcluding(dirPath, relPaths)
+}
+
+func (*Directory) isWithinPaths(path string, parentPaths []string) bool {
+	for _, parentPath := range parentPaths {
+		if strings.HasPrefix(path, parentPath+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package directory
+
+import (
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// SyncProgress receives events about contents being synced
+// (e.g. to render progress bars in embedding applications).
+// Implementations must be safe for concurrent use when
+// contents are fetched in parallel.
+type SyncProgress interface {
+	// Path includes directory path (e.g. vendor/github.com/org/repo)
+	OnContentStart(path, contentsType string)
+	// Number of bytes downloaded since previous call
+	// (only reported by http and githubRelease contents)
+	OnBytes(path string, n int64)
+	OnContentDone(path string, lock ctlconf.LockDirectoryContents, err error)
+}
+
+func contentsType(contents ctlconf.DirectoryContents) string {
+	switch {
+	case contents.Git != nil:
+		return "git"
+	case contents.HTTP != nil:
+		return "http"
+	case contents.Image != nil:
+		return "image"
+	case contents.GithubRelease != nil:
+		return "githubRelease"
+	case contents.HelmChart != nil:
+		return "helmChart"
+	case contents.S3 != nil:
+		return "s3"
+	case contents.Hg != nil:
+		return "hg"
+	case contents.Svn != nil:
+		return "svn"
+	case contents.AzureBlob != nil:
+		return "azureBlob"
+	case contents.GCS != nil:
+		return "gcs"
+	case contents.Manual != nil:
+		return "manual"
+	case contents.Directory != nil:
+		return "directory"
+	case contents.Inline != nil:
+		return "inline"
+	case contents.Archive != nil:
+		return "archive"
+	case contents.Symlink != nil:
+		return "symlink"
+	case contents.Overlay != nil:
+		return "overlay"
+	default:
+		return ""
+	}
+}
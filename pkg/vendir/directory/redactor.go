@@ -0,0 +1,112 @@
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+)
+
+const (
+	redactedValue = "<redacted>"
+	// Very short values (e.g. "1") would redact unrelated output
+	minRedactedValueLen = 4
+)
+
+// Redactor replaces secret values in output with a placeholder
+type Redactor struct {
+	values []string
+	lock   sync.RWMutex
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+func (r *Redactor) Add(val string) {
+	// Multi-line values (e.g. private keys) are also redacted line by line
+	// since output is frequently split on new lines
+	for _, v := range append([]string{val}, strings.Split(val, "\n")...) {
+		v = strings.TrimSpace(v)
+		if len(v) < minRedactedValueLen {
+			continue
+		}
+
+		r.lock.Lock()
+		if !r.has(v) {
+			r.values = append(r.values, v)
+			// Longer values are replaced first so that their substrings do not leak
+			sort.SliceStable(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+		}
+		r.lock.Unlock()
+	}
+}
+
+func (r *Redactor) has(val string) bool {
+	for _, v := range r.values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) Redact(str string) string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, val := range r.values {
+		str = strings.Replace(str, val, redactedValue, -1)
+	}
+	return str
+}
+
+func (r *Redactor) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	redacted := r.Redact(err.Error())
+	if redacted == err.Error() {
+		return err
+	}
+	return errors.New(redacted)
+}
+
+// RedactingUI redacts secret values from all printed output
+type RedactingUI struct {
+	ui.UI
+	redactor *Redactor
+}
+
+var _ ui.UI = RedactingUI{}
+
+func NewRedactingUI(ui ui.UI, redactor *Redactor) RedactingUI {
+	return RedactingUI{ui, redactor}
+}
+
+func (u RedactingUI) ErrorLinef(pattern string, args ...interface{}) {
+	u.UI.ErrorLinef("%s", u.redactor.Redact(fmt.Sprintf(pattern, args...)))
+}
+
+func (u RedactingUI) PrintLinef(pattern string, args ...interface{}) {
+	u.UI.PrintLinef("%s", u.redactor.Redact(fmt.Sprintf(pattern, args...)))
+}
+
+func (u RedactingUI) BeginLinef(pattern string, args ...interface{}) {
+	u.UI.BeginLinef("%s", u.redactor.Redact(fmt.Sprintf(pattern, args...)))
+}
+
+func (u RedactingUI) EndLinef(pattern string, args ...interface{}) {
+	u.UI.EndLinef("%s", u.redactor.Redact(fmt.Sprintf(pattern, args...)))
+}
+
+func (u RedactingUI) PrintBlock(block []byte) {
+	u.UI.PrintBlock([]byte(u.redactor.Redact(string(block))))
+}
+
+func (u RedactingUI) PrintErrorBlock(block string) {
+	u.UI.PrintErrorBlock(u.redactor.Redact(block))
+}
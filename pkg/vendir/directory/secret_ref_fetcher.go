@@ -0,0 +1,159 @@
+package directory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const (
+	secretEnvPrefix       = "VENDIR_SECRET_"
+	secretEnvKeySeparator = "__"
+)
+
+// SecretRefFetcher resolves secrets referenced by contents (e.g. secretRef)
+// from following sources; first source that includes secret wins:
+//  1. secrets specified in configuration files
+//  2. secret directories laid out as mounted K8s secrets (<dir>/<name>/<key>)
+//  3. env variables named VENDIR_SECRET_<NAME>__<KEY>
+//
+// Values of resolved secrets are registered with redactor.
+type SecretRefFetcher struct {
+	named      NamedRefFetcher
+	secretDirs []string
+	env        []string
+	redactor   *Redactor
+}
+
+var _ ctlfetch.RefFetcher = SecretRefFetcher{}
+
+func NewSecretRefFetcher(named NamedRefFetcher, secretDirs []string,
+	env []string, redactor *Redactor) SecretRefFetcher {
+
+	return SecretRefFetcher{named, secretDirs, env, redactor}
+}
+
+func (f SecretRefFetcher) GetSecret(name string) (ctlconf.Secret, error) {
+	secret, err := f.getSecret(name)
+	if err != nil {
+		return ctlconf.Secret{}, err
+	}
+
+	for _, val := range secret.Data {
+		f.redactor.Add(string(val))
+	}
+
+	return secret, nil
+}
+
+func (f SecretRefFetcher) getSecret(name string) (ctlconf.Secret, error) {
+	if len(f.named.findSecrets(name)) > 0 {
+		return f.named.GetSecret(name)
+	}
+
+	for _, dir := range f.secretDirs {
+		secret, found, err := f.secretFromDir(dir, name)
+		if err != nil {
+			return ctlconf.Secret{}, fmt.Errorf("Reading secret '%s' from directory '%s': %s", name, dir, err)
+		}
+		if found {
+			return secret, nil
+		}
+	}
+
+	if secret, found := f.secretFromEnv(name); found {
+		return secret, nil
+	}
+
+	return ctlconf.Secret{}, fmt.Errorf("Expected to find one secret '%s' (in configuration, "+
+		"secret directories or %s%s%s<KEY> env variables), but found none",
+		name, secretEnvPrefix, f.envName(name), secretEnvKeySeparator)
+}
+
+func (f SecretRefFetcher) secretFromDir(dir, name string) (ctlconf.Secret, bool, error) {
+	// Secret names are not allowed to reference other directories
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return ctlconf.Secret{}, false, nil
+	}
+
+	secretPath := filepath.Join(dir, name)
+
+	infos, err := ioutil.ReadDir(secretPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ctlconf.Secret{}, false, nil
+		}
+		return ctlconf.Secret{}, false, err
+	}
+
+	secret := ctlconf.Secret{
+		Metadata: ctlconf.GenericMetadata{Name: name},
+		Data:     map[string][]byte{},
+	}
+
+	for _, info := range infos {
+		// Mounted K8s secrets include hidden ..data dirs with symlinked keys
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(secretPath, info.Name()))
+		if err != nil {
+			return ctlconf.Secret{}, false, err
+		}
+
+		secret.Data[info.Name()] = bs
+	}
+
+	return secret, true, nil
+}
+
+func (f SecretRefFetcher) secretFromEnv(name string) (ctlconf.Secret, bool) {
+	prefix := secretEnvPrefix + f.envName(name) + secretEnvKeySeparator
+
+	envKeys := map[string]string{}
+	for _, key := range ctlconf.SecretKeys {
+		envKeys[f.envName(key)] = key
+	}
+
+	secret := ctlconf.Secret{
+		Metadata: ctlconf.GenericMetadata{Name: name},
+		Data:     map[string][]byte{},
+	}
+
+	for _, kv := range f.env {
+		pieces := strings.SplitN(kv, "=", 2)
+		if len(pieces) != 2 || !strings.HasPrefix(pieces[0], prefix) {
+			continue
+		}
+		if key, found := envKeys[strings.TrimPrefix(pieces[0], prefix)]; found {
+			secret.Data[key] = []byte(pieces[1])
+		}
+	}
+
+	return secret, len(secret.Data) > 0
+}
+
+// envName uppercases name and replaces characters
+// not allowed in env variable names with underscores
+func (SecretRefFetcher) envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func (f SecretRefFetcher) GetConfigMap(name string) (ctlconf.ConfigMap, error) {
+	return f.named.GetConfigMap(name)
+}
@@ -0,0 +1,78 @@
+package directory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+func TestSecretRefFetcherPrecedenceAndRedaction(t *testing.T) {
+	secretDir, err := ioutil.TempDir("", "vendir-secret-dir-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(secretDir)
+
+	for _, name := range []string{"from-config", "from-dir"} {
+		err := os.MkdirAll(filepath.Join(secretDir, name), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(secretDir, name, "password"), []byte("dir-password"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	configSecret := ctlconf.Secret{
+		Metadata: ctlconf.GenericMetadata{Name: "from-config"},
+		Data:     map[string][]byte{"password": []byte("config-password")},
+	}
+
+	env := []string{
+		"VENDIR_SECRET_FROM_DIR__PASSWORD=env-password",
+		"VENDIR_SECRET_FROM_ENV_1__PASSWORD=env-password",
+		"VENDIR_SECRET_FROM_ENV_1__TLS_CRT=env-cert",
+		"VENDIR_SECRET_FROM_ENV_1__UNKNOWN=ignored",
+	}
+
+	redactor := NewRedactor()
+	fetcher := NewSecretRefFetcher(NewNamedRefFetcher([]ctlconf.Secret{configSecret}, nil),
+		[]string{secretDir}, env, redactor)
+
+	expectedSecrets := map[string]map[string]string{
+		"from-config": {"password": "config-password"},
+		"from-dir":    {"password": "dir-password"},
+		"from.env-1":  {"password": "env-password", "tls.crt": "env-cert"},
+	}
+
+	for name, expectedData := range expectedSecrets {
+		secret, err := fetcher.GetSecret(name)
+		if err != nil {
+			t.Fatalf("Expected secret '%s' to be found: %s", name, err)
+		}
+		data := map[string]string{}
+		for key, val := range secret.Data {
+			data[key] = string(val)
+		}
+		if fmt.Sprintf("%v", data) != fmt.Sprintf("%v", expectedData) {
+			t.Fatalf("Expected secret '%s' to have data %v, but was %v", name, expectedData, data)
+		}
+	}
+
+	_, err = fetcher.GetSecret("missing")
+	if err == nil || !strings.Contains(err.Error(), "VENDIR_SECRET_MISSING__<KEY>") {
+		t.Fatalf("Expected missing secret to fail, but was: %v", err)
+	}
+
+	redacted := redactor.Redact("auth failed for config-password, dir-password and env-cert")
+	if redacted != "auth failed for <redacted>, <redacted> and <redacted>" {
+		t.Fatalf("Expected secret values to be redacted, but was: %s", redacted)
+	}
+}
@@ -0,0 +1,86 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// isSkipped checks whether contents are disabled
+// or were not included via sync options
+func (d *Directory) isSkipped(contents ctlconf.DirectoryContents, syncOpts SyncOpts) bool {
+	if contents.Disabled {
+		return true
+	}
+	if syncOpts.IncludeContentPaths == nil {
+		return false
+	}
+	for _, path := range syncOpts.IncludeContentPaths {
+		if filepath.Clean(path) == filepath.Clean(contents.Path) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPreserved checks whether existing contents are moved
+// as is into staging dir instead of being fetched
+func (d *Directory) isPreserved(contents ctlconf.DirectoryContents, syncOpts SyncOpts) bool {
+	return contents.Manual != nil || d.isSkipped(contents, syncOpts)
+}
+
+// skipContents keeps existing files in place and retains
+// previously recorded lock contents (if any)
+func (d *Directory) skipContents(contents ctlconf.DirectoryContents, stagingDstPath string,
+	syncOpts SyncOpts, ui ui.UI) (ctlconf.LockDirectoryContents, error) {
+
+	ui.PrintLinef("Fetching: %s + %s (skipped: disabled)", d.opts.Path, contents.Path)
+
+	srcPath := filepath.Join(d.dirPath(syncOpts), contents.Path)
+
+	// Similar to manual contents, existing files must stay in place since staging dir is discarded
+	if !syncOpts.DryRun && !syncOpts.ResolveOnly {
+		_, err := os.Lstat(srcPath)
+		if err == nil {
+			err = renameDir(srcPath, stagingDstPath)
+			if err != nil {
+				return ctlconf.LockDirectoryContents{}, fmt.Errorf("Moving directory '%s' to staging dir: %s", srcPath, err)
+			}
+		}
+	}
+
+	if syncOpts.PrevLockConfig != nil {
+		prevLockDirContents, err := syncOpts.PrevLockConfig.FindContents(d.opts.Path, contents.Path)
+		if err == nil {
+			return prevLockDirContents, nil
+		}
+	}
+
+	return ctlconf.LockDirectoryContents{Path: contents.Path}, nil
+}
+
+// withoutUnlockedSkipped removes skipped (or failed) contents that
+// were never recorded in lock config from resulting lock contents
+func (d *Directory) withoutUnlockedSkipped(lockContents []ctlconf.LockDirectoryContents,
+	summaries []SyncContentsSummary, syncOpts SyncOpts) []ctlconf.LockDirectoryContents {
+
+	var result []ctlconf.LockDirectoryContents
+
+	for i, contents := range d.opts.Contents {
+		if d.isSkipped(contents, syncOpts) || len(summaries[i].Error) > 0 {
+			if syncOpts.PrevLockConfig == nil {
+				continue
+			}
+			_, err := syncOpts.PrevLockConfig.FindContents(d.opts.Path, contents.Path)
+			if err != nil {
+				continue
+			}
+		}
+		result = append(result, lockContents[i])
+	}
+
+	return result
+}
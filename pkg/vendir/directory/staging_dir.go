@@ -1,11 +1,14 @@
 package directory
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
 
+	dircopy "github.com/otiai10/copy"
 	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
 )
 
@@ -13,10 +16,14 @@ type StagingDir struct {
 	rootDir     string
 	stagingDir  string
 	incomingDir string
+	// dirMode is used for created directories when set
+	dirMode os.FileMode
 }
 
-func NewStagingDir() StagingDir {
-	rootDir := ".vendir-tmp"
+// NewStagingDir creates staging dir rooted in a given tmp dir
+// (empty tmp dir means current working directory)
+func NewStagingDir(tmpDir string) StagingDir {
+	rootDir := filepath.Join(tmpDir, ".vendir-tmp")
 	return StagingDir{
 		rootDir:     rootDir,
 		stagingDir:  filepath.Join(rootDir, "staging"),
@@ -30,12 +37,13 @@ func (d StagingDir) Prepare() error {
 		return err
 	}
 
-	err = os.MkdirAll(d.stagingDir, 0700)
+	// Staging dir becomes final location hence regular permissions
+	err = os.MkdirAll(d.stagingDir, d.mode(0755))
 	if err != nil {
 		return fmt.Errorf("Creating staging dir '%s': %s", d.stagingDir, err)
 	}
 
-	err = os.MkdirAll(d.incomingDir, 0700)
+	err = os.MkdirAll(d.incomingDir, d.mode(0700))
 	if err != nil {
 		return fmt.Errorf("Creating incoming dir '%s': %s", d.incomingDir, err)
 	}
@@ -43,11 +51,35 @@ func (d StagingDir) Prepare() error {
 	return nil
 }
 
+// WithDirMode returns staging dir that creates
+// directories with given mode instead of defaults
+func (d StagingDir) WithDirMode(mode os.FileMode) StagingDir {
+	d.dirMode = mode
+	return d
+}
+
+func (d StagingDir) mode(defaultMode os.FileMode) os.FileMode {
+	if d.dirMode != 0 {
+		return d.dirMode
+	}
+	return defaultMode
+}
+
+// Path returns location of directory that will replace final directory
+func (d StagingDir) Path() string {
+	return d.stagingDir
+}
+
+// RootPath returns directory that includes all staging and temporary files
+func (d StagingDir) RootPath() string {
+	return d.rootDir
+}
+
 func (d StagingDir) NewChild(path string) (string, error) {
 	childPath := filepath.Join(d.stagingDir, path)
 	childPathParent := filepath.Dir(childPath)
 
-	err := os.MkdirAll(childPathParent, 0700)
+	err := os.MkdirAll(childPathParent, d.mode(0755))
 	if err != nil {
 		return "", fmt.Errorf("Creating directory '%s': %s", childPathParent, err)
 	}
@@ -55,28 +87,65 @@ func (d StagingDir) NewChild(path string) (string, error) {
 	return childPath, nil
 }
 
+// Replace swaps given directory with staging dir. Previous directory
+// is kept aside until staging dir is in place so that it could be restored on failure.
 func (d StagingDir) Replace(path string) error {
-	err := os.RemoveAll(path)
+	prevPath := d.previousDir()
+	hasPrev := true
+
+	err := renameDir(path, prevPath)
 	if err != nil {
-		return fmt.Errorf("Deleting dir %s: %s", path, err)
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("Moving dir %s aside: %s", path, err)
+		}
+		hasPrev = false
 	}
 
 	// Clean to avoid getting 'out/in/' from 'out/in/' instead of just 'out'
 	parentPath := filepath.Dir(filepath.Clean(path))
 
-	err = os.MkdirAll(parentPath, 0700)
+	err = os.MkdirAll(parentPath, d.mode(0755))
+	if err == nil {
+		err = renameDir(d.stagingDir, path)
+		if err != nil {
+			err = fmt.Errorf("Moving staging directory '%s' to final location '%s': %s", d.stagingDir, path, err)
+		}
+	} else {
+		err = fmt.Errorf("Creating final location parent dir %s: %s", parentPath, err)
+	}
+
 	if err != nil {
-		return fmt.Errorf("Creating final location parent dir %s: %s", parentPath, err)
+		if hasPrev {
+			restoreErr := renameDir(prevPath, path)
+			if restoreErr != nil {
+				return fmt.Errorf("%s (restoring previous dir: %s)", err, restoreErr)
+			}
+		}
+		return err
 	}
 
-	err = os.Rename(d.stagingDir, path)
+	err = os.RemoveAll(prevPath)
 	if err != nil {
-		return fmt.Errorf("Moving staging directory '%s' to final location '%s': %s", d.stagingDir, path, err)
+		return fmt.Errorf("Deleting dir %s: %s", prevPath, err)
 	}
 
 	return nil
 }
 
+// LeftoverPaths returns locations where given path (relative to directory)
+// may have been left by interrupted sync: previous directory moved aside
+// during replace and staging dir (in that order)
+func (d StagingDir) LeftoverPaths(path string) []string {
+	return []string{
+		filepath.Join(d.previousDir(), path),
+		filepath.Join(d.stagingDir, path),
+	}
+}
+
+func (d StagingDir) previousDir() string {
+	return filepath.Join(d.rootDir, "previous")
+}
+
 func (d StagingDir) TempArea() StagingTempArea {
 	return StagingTempArea{d.incomingDir}
 }
@@ -100,16 +169,15 @@ type StagingTempArea struct {
 var _ ctlfetch.TempArea = StagingTempArea{}
 
 func (d StagingTempArea) NewTempDir(name string) (string, error) {
-	tmpDir := filepath.Join(d.path, name)
-
-	absTmpDir, err := filepath.Abs(tmpDir)
+	// Unique name allows multiple contents to be fetched concurrently
+	tmpDir, err := ioutil.TempDir(d.path, name+"-")
 	if err != nil {
-		return "", fmt.Errorf("Abs path '%s': %s", tmpDir, err)
+		return "", fmt.Errorf("Creating incoming dir for %s: %s", name, err)
 	}
 
-	err = os.Mkdir(absTmpDir, 0700)
+	absTmpDir, err := filepath.Abs(tmpDir)
 	if err != nil {
-		return "", fmt.Errorf("Creating incoming dir '%s' for %s: %s", absTmpDir, name, err)
+		return "", fmt.Errorf("Abs path '%s': %s", tmpDir, err)
 	}
 
 	return absTmpDir, nil
@@ -118,3 +186,24 @@ func (d StagingTempArea) NewTempDir(name string) (string, error) {
 func (d StagingTempArea) NewTempFile(pattern string) (*os.File, error) {
 	return ioutil.TempFile(d.path, pattern)
 }
+
+// renameDir moves directory falling back to copy and delete
+// when source and destination live on different filesystems
+func renameDir(path, dstPath string) error {
+	err := os.Rename(path, dstPath)
+	if err == nil {
+		return nil
+	}
+
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	err = dircopy.Copy(path, dstPath)
+	if err != nil {
+		return fmt.Errorf("Copying across filesystems: %s", err)
+	}
+
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,45 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+type Symlinks struct {
+	opts ctlconf.DirectoryContentsSymlink
+}
+
+func NewSymlinks(opts ctlconf.DirectoryContentsSymlink) Symlinks {
+	return Symlinks{opts}
+}
+
+// Create makes configured symlinks within given directory. Targets are
+// not required to exist since they typically point to sibling contents.
+func (s Symlinks) Create(dstPath string) error {
+	var linkPaths []string
+	for linkPath := range s.opts.Links {
+		linkPaths = append(linkPaths, linkPath)
+	}
+
+	sort.Strings(linkPaths)
+
+	for _, linkPath := range linkPaths {
+		path := filepath.Join(dstPath, linkPath)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return fmt.Errorf("Creating directory: %s", err)
+		}
+
+		err = os.Symlink(s.opts.Links[linkPath], path)
+		if err != nil {
+			return fmt.Errorf("Creating symlink '%s': %s", linkPath, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,433 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlazb "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/azureblob"
+	ctlgcs "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/gcs"
+	ctlgit "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/git"
+	ctlghr "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/githubrelease"
+	ctlhelmc "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/helmchart"
+	ctlhg "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/hg"
+	ctlhttp "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/http"
+	ctlimg "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/image"
+	ctlinl "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/inline"
+	ctls3 "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/s3"
+	ctlsvn "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/svn"
+)
+
+// SyncContent fetches single contents entry into given staging path
+// (replacing anything already there) and returns its lock contents.
+// Manual contents are not supported since they are only kept in place within directory.
+func SyncContent(contents ctlconf.DirectoryContents, stagingPath string, opts SyncOpts) (ctlconf.LockDirectoryContents, error) {
+	lockDirContents := ctlconf.LockDirectoryContents{Path: contents.Path}
+
+	err := contents.Validate()
+	if err != nil {
+		return lockDirContents, err
+	}
+
+	if contents.Manual != nil {
+		return lockDirContents, fmt.Errorf("Expected contents '%s' to not be manual", contents.Path)
+	}
+
+	err = os.MkdirAll(filepath.Dir(stagingPath), 0755)
+	if err != nil {
+		return lockDirContents, fmt.Errorf("Creating directory '%s': %s", filepath.Dir(stagingPath), err)
+	}
+
+	tempPath, err := ioutil.TempDir(resolvePath(opts.BaseDir, opts.TempDir), ".vendir-tmp-")
+	if err != nil {
+		return lockDirContents, fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempPath)
+
+	ctx := context.Background()
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	if opts.MaxDownloadRate > 0 {
+		ctx = ctlfetch.WithRateLimiter(ctx, ctlfetch.NewRateLimiter(opts.MaxDownloadRate))
+	}
+
+	opts, err = withCABundle(opts, StagingTempArea{tempPath})
+	if err != nil {
+		return lockDirContents, err
+	}
+
+	return syncContent(ctx, contents, filepath.Dir(stagingPath), stagingPath, []string{tempPath},
+		StagingTempArea{tempPath}, opts, ui.NewNoopUI())
+}
+
+// syncContent fetches contents and applies configured post processing (filtering, etc.);
+// excluded paths (in addition to staging destination) are never copied from local directories
+func syncContent(ctx context.Context, contents ctlconf.DirectoryContents, dirPath, stagingDstPath string,
+	excludedPaths []string, tempArea ctlfetch.TempArea, syncOpts SyncOpts, ui ui.UI) (ctlconf.LockDirectoryContents, error) {
+
+	lockDirContents := ctlconf.LockDirectoryContents{Path: contents.Path}
+
+	var err error
+
+	contents = contentsWithBaseDir(contents, syncOpts.BaseDir)
+
+	// Overlay sources print their own warnings
+	if contents.Overlay == nil && contents.InsecureSkipTLSVerify() {
+		ui.ErrorLinef("Warning: Skipping TLS certificate verification for %s + %s. Anyone able to intercept "+
+			"network traffic (man-in-the-middle) could substitute fetched contents; only use insecureSkipTLSVerify "+
+			"with trusted networks during development", dirPath, contents.Path)
+	}
+
+	if contents.MaxDownloadRate > 0 {
+		ctx = ctlfetch.WithRateLimiter(ctx, ctlfetch.NewRateLimiter(contents.MaxDownloadRate*1024))
+	}
+
+	cache := ctlfetch.NewCache(syncOpts.CacheDir, syncOpts.CacheMaxSize)
+
+	skipFileFilter := false
+	skipNewRootPath := false
+
+	switch {
+	case contents.Git != nil:
+		gitSync := ctlgit.NewSync(*contents.Git, NewInfoLog(ui), syncOpts.RefFetcher, syncOpts.Proxy)
+
+		ui.PrintLinef("Fetching: %s + %s (git from %s)", dirPath, contents.Path, gitSync.Desc())
+
+		var lock ctlconf.LockDirectoryContentsGit
+		var resolved bool
+
+		// Files are not needed when only resolving references
+		// (unless their checksums or differences are recorded)
+		if syncOpts.ResolveOnly && !syncOpts.RecordFileChecksums && !syncOpts.Diff {
+			err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+				lock, resolved, err = gitSync.Resolve(ctx, tempArea)
+				return
+			})
+			if err != nil {
+				return lockDirContents, fmt.Errorf("Syncing directory '%s' with git contents: %s", contents.Path, err)
+			}
+		}
+
+		if resolved {
+			lockDirContents.Git = &lock
+			// Nothing was fetched to post process
+			return lockDirContents, nil
+		}
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = gitSync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with git contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.Git = &lock
+
+	case contents.HTTP != nil:
+		desc := contents.HTTP.URL
+		if len(contents.HTTP.Files) > 0 {
+			desc = fmt.Sprintf("%d files", len(contents.HTTP.Files))
+		}
+
+		ui.PrintLinef("Fetching: %s + %s (http from %s)", dirPath, contents.Path, desc)
+
+		var lock ctlconf.LockDirectoryContentsHTTP
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = ctlhttp.NewSync(*contents.HTTP, syncOpts.RefFetcher, cache, syncOpts.Proxy).Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with HTTP contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.HTTP = &lock
+
+	case contents.Image != nil:
+		ui.PrintLinef("Fetching: %s + %s (image from %s)", dirPath, contents.Path, contents.Image.URL)
+
+		var lock ctlconf.LockDirectoryContentsImage
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = ctlimg.NewSync(*contents.Image, syncOpts.RefFetcher, cache, syncOpts.Proxy).Sync(ctx, stagingDstPath)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with image contents: %s", contents.Path, err)
+		}
+
+		if lock.URL != contents.Image.URL {
+			ui.PrintLinef("Resolved: %s + %s (image %s to %s)", dirPath, contents.Path, contents.Image.URL, lock.URL)
+		}
+
+		lockDirContents.Image = &lock
+
+	case contents.GithubRelease != nil:
+		sync := ctlghr.NewSync(*contents.GithubRelease, syncOpts.GithubAPIToken, syncOpts.RefFetcher,
+			cache, syncOpts.Proxy, syncOpts.GithubRateLimitMaxWait, NewInfoLog(ui))
+
+		desc, _, _ := sync.DescAndURL()
+		ui.PrintLinef("Fetching: %s + %s (github release %s)", dirPath, contents.Path, desc)
+
+		var lock ctlconf.LockDirectoryContentsGithubRelease
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = sync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with github release contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.GithubRelease = &lock
+
+	case contents.HelmChart != nil:
+		helmChartSync := ctlhelmc.NewSync(*contents.HelmChart, syncOpts.HelmBinary, syncOpts.RefFetcher, cache, syncOpts.Proxy)
+
+		ui.PrintLinef("Fetching: %s + %s (helm chart from %s)",
+			dirPath, contents.Path, helmChartSync.Desc())
+
+		var lock ctlconf.LockDirectoryContentsHelmChart
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = helmChartSync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with helm chart contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.HelmChart = &lock
+
+	case contents.S3 != nil:
+		s3Sync := ctls3.NewSync(*contents.S3, syncOpts.AwsBinary, syncOpts.RefFetcher, syncOpts.Proxy)
+
+		ui.PrintLinef("Fetching: %s + %s (s3 from %s)", dirPath, contents.Path, s3Sync.Desc())
+
+		var lock ctlconf.LockDirectoryContentsS3
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = s3Sync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with S3 contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.S3 = &lock
+
+	case contents.AzureBlob != nil:
+		azureBlobSync := ctlazb.NewSync(*contents.AzureBlob, syncOpts.AzBinary, syncOpts.RefFetcher, syncOpts.Proxy)
+
+		ui.PrintLinef("Fetching: %s + %s (azure blob from %s)", dirPath, contents.Path, azureBlobSync.Desc())
+
+		var lock ctlconf.LockDirectoryContentsAzureBlob
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = azureBlobSync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with Azure blob contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.AzureBlob = &lock
+
+	case contents.GCS != nil:
+		gcsSync := ctlgcs.NewSync(*contents.GCS, syncOpts.RefFetcher, syncOpts.Proxy)
+
+		ui.PrintLinef("Fetching: %s + %s (gcs from %s)", dirPath, contents.Path, gcsSync.Desc())
+
+		var lock ctlconf.LockDirectoryContentsGCS
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = gcsSync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with GCS contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.GCS = &lock
+
+	case contents.Hg != nil:
+		hgSync := ctlhg.NewSync(*contents.Hg, syncOpts.HgBinary, NewInfoLog(ui), syncOpts.RefFetcher, syncOpts.Proxy)
+
+		ui.PrintLinef("Fetching: %s + %s (hg from %s)", dirPath, contents.Path, hgSync.Desc())
+
+		var lock ctlconf.LockDirectoryContentsHg
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = hgSync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with hg contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.Hg = &lock
+
+	case contents.Svn != nil:
+		svnSync := ctlsvn.NewSync(*contents.Svn, syncOpts.SvnBinary, NewInfoLog(ui), syncOpts.RefFetcher, syncOpts.Proxy)
+
+		ui.PrintLinef("Fetching: %s + %s (svn from %s)", dirPath, contents.Path, svnSync.Desc())
+
+		var lock ctlconf.LockDirectoryContentsSvn
+
+		err := retry(ctx, syncOpts, stagingDstPath, func() (err error) {
+			lock, err = svnSync.Sync(ctx, stagingDstPath, tempArea)
+			return
+		})
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with svn contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.Svn = &lock
+
+	case contents.Manual != nil:
+		ui.PrintLinef("Fetching: %s + %s (manual)", dirPath, contents.Path)
+
+		srcPath := filepath.Join(dirPath, contents.Path)
+
+		// Manual contents must stay in place since staging dir is discarded
+		if !syncOpts.DryRun && !syncOpts.ResolveOnly {
+			err := renameDir(srcPath, stagingDstPath)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return lockDirContents, fmt.Errorf("Expected manual contents to exist at '%s', but did not find it", srcPath)
+				}
+				return lockDirContents, fmt.Errorf("Moving directory '%s' to staging dir: %s", srcPath, err)
+			}
+		}
+
+		lockDirContents.Manual = &ctlconf.LockDirectoryContentsManual{}
+		skipFileFilter = true
+		skipNewRootPath = true
+
+	case contents.Directory != nil:
+		ui.PrintLinef("Fetching: %s + %s (directory)", dirPath, contents.Path)
+
+		dirCopy := NewLocalDirCopy(*contents.Directory).WithExcludedPaths(
+			append([]string{stagingDstPath}, excludedPaths...))
+
+		err := dirCopy.Copy(stagingDstPath)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Copying another directory contents into directory '%s': %s", contents.Path, err)
+		}
+
+		lockDirContents.Directory = &ctlconf.LockDirectoryContentsDirectory{}
+
+	case contents.Inline != nil:
+		ui.PrintLinef("Fetching: %s + %s (inline)", dirPath, contents.Path)
+
+		lock, err := ctlinl.NewSync(*contents.Inline, syncOpts.RefFetcher).Sync(stagingDstPath)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with inline contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.Inline = &lock
+
+	case contents.Archive != nil:
+		ui.PrintLinef("Fetching: %s + %s (archive from %s)", dirPath, contents.Path, contents.Archive.Path)
+
+		lock, err := NewLocalArchive(*contents.Archive).Extract(stagingDstPath, tempArea)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with archive contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.Archive = &lock
+
+	case contents.Symlink != nil:
+		ui.PrintLinef("Fetching: %s + %s (symlink)", dirPath, contents.Path)
+
+		err := NewSymlinks(*contents.Symlink).Create(stagingDstPath)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Creating symlinks in directory '%s': %s", contents.Path, err)
+		}
+
+		lockDirContents.Symlink = &ctlconf.LockDirectoryContentsSymlink{}
+
+	case contents.Overlay != nil:
+		ui.PrintLinef("Fetching: %s + %s (overlay of %d sources)", dirPath, contents.Path, len(contents.Overlay.Sources))
+
+		lock, err := syncOverlay(ctx, *contents.Overlay, filepath.Join(dirPath, contents.Path), stagingDstPath,
+			excludedPaths, tempArea, syncOpts, ui)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Syncing directory '%s' with overlay contents: %s", contents.Path, err)
+		}
+
+		lockDirContents.Overlay = &lock
+
+	default:
+		return lockDirContents, fmt.Errorf("Unknown contents type for directory '%s'", contents.Path)
+	}
+
+	if !skipFileFilter {
+		err = FileFilter{contents}.Apply(stagingDstPath)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Filtering paths in directory '%s': %s", contents.Path, err)
+		}
+	}
+
+	if !skipNewRootPath && len(contents.NewRootPath) > 0 {
+		err = NewSubPath(contents.NewRootPath).Extract(stagingDstPath, stagingDstPath, tempArea)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Changing to new root path '%s': %s", contents.Path, err)
+		}
+	}
+
+	if len(contents.PathMappings) > 0 {
+		err = NewPathMappings(contents.PathMappings).Apply(stagingDstPath)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Mapping paths in directory '%s': %s", contents.Path, err)
+		}
+	}
+
+	if contents.LineEndings != nil {
+		err = NewLineEndings(*contents.LineEndings).Apply(stagingDstPath)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Normalizing line endings in directory '%s': %s", contents.Path, err)
+		}
+	}
+
+	// Post sync command does not affect resolved references
+	// and may have side effects outside of directory
+	if contents.PostSync != nil && !syncOpts.DryRun && !syncOpts.ResolveOnly {
+		err = NewPostSync(*contents.PostSync, NewInfoLog(ui)).Run(ctx, stagingDstPath)
+		if err != nil {
+			return lockDirContents, fmt.Errorf("Post processing directory '%s': %s", contents.Path, err)
+		}
+	}
+
+	return lockDirContents, nil
+}
+
+func retry(ctx context.Context, syncOpts SyncOpts, dstPath string, fetchFunc func() error) error {
+	retryOpts := ctlfetch.RetryOpts{Retries: syncOpts.Retries, Backoff: syncOpts.RetryBackoff}
+
+	return retryOpts.Run(ctx, func() error {
+		// Clean up partially fetched contents from previous attempt
+		err := os.RemoveAll(dstPath)
+		if err != nil {
+			return fmt.Errorf("Deleting dir %s: %s", dstPath, err)
+		}
+		err = fetchFunc()
+		if err != nil && ctx.Err() != nil {
+			// No point in retrying once deadline passed
+			return ctlfetch.NewNonRetryableError(err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,126 @@
+package directory
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// SyncSummary describes outcome of a directory sync
+// in a form suitable for automation
+type SyncSummary struct {
+	Path     string                `json:"path"`
+	Contents []SyncContentsSummary `json:"contents"`
+	// Only populated when diff is requested
+	Diff *DirDiff `json:"diff,omitempty"`
+	// Only populated when checksum delta is requested
+	ChecksumDelta *ChecksumDelta `json:"checksumDelta,omitempty"`
+	// Bytes not stored due to hardlinking identical files (only when dedup is requested)
+	DedupSavedBytes int64 `json:"dedupSavedBytes,omitempty"`
+}
+
+type SyncContentsSummary struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	// Resolved reference (e.g. git SHA, image digest, chart version)
+	Version string `json:"version,omitempty"`
+	// Total size of files placed into contents path
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	// Only set when sync continued after contents failed
+	Error string `json:"error,omitempty"`
+	// Only set when existing contents were kept since source was unreachable
+	Warning string `json:"warning,omitempty"`
+}
+
+func newSyncContentsSummary(lock ctlconf.LockDirectoryContents,
+	dstPath string, duration time.Duration) (SyncContentsSummary, error) {
+
+	summary := SyncContentsSummary{Path: lock.Path, Duration: duration}
+
+	summary.Type, summary.Version = lockContentsTypeAndVersion(lock)
+
+	err := filepath.Walk(dstPath, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			summary.Bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return summary, err
+	}
+
+	return summary, nil
+}
+
+func lockContentsTypeAndVersion(lock ctlconf.LockDirectoryContents) (string, string) {
+	var typ, version string
+
+	switch {
+	case lock.Git != nil:
+		typ = "git"
+		version = lock.Git.SHA
+	case lock.HTTP != nil:
+		typ = "http"
+		if len(lock.HTTP.SHA256) > 0 {
+			version = "sha256:" + lock.HTTP.SHA256
+		}
+	case lock.Image != nil:
+		typ = "image"
+		version = lock.Image.URL
+	case lock.GithubRelease != nil:
+		typ = "githubRelease"
+		version = lock.GithubRelease.URL
+		if len(lock.GithubRelease.Tag) > 0 {
+			version = lock.GithubRelease.Tag
+		}
+	case lock.HelmChart != nil:
+		typ = "helmChart"
+		version = lock.HelmChart.Version
+		if len(lock.HelmChart.Digest) > 0 {
+			version += "@" + lock.HelmChart.Digest
+		}
+	case lock.S3 != nil:
+		typ = "s3"
+	case lock.AzureBlob != nil:
+		typ = "azureBlob"
+	case lock.GCS != nil:
+		typ = "gcs"
+	case lock.Hg != nil:
+		typ = "hg"
+		version = lock.Hg.SHA
+	case lock.Svn != nil:
+		typ = "svn"
+		version = "r" + strconv.FormatInt(lock.Svn.Revision, 10)
+	case lock.Manual != nil:
+		typ = "manual"
+	case lock.Directory != nil:
+		typ = "directory"
+	case lock.Inline != nil:
+		typ = "inline"
+	case lock.Archive != nil:
+		typ = "archive"
+		version = "sha256:" + lock.Archive.SHA256
+	case lock.Symlink != nil:
+		typ = "symlink"
+	case lock.Overlay != nil:
+		typ = "overlay"
+		var versions []string
+		for _, src := range lock.Overlay.Sources {
+			srcType, srcVersion := lockContentsTypeAndVersion(src)
+			if len(srcVersion) > 0 {
+				versions = append(versions, srcType+":"+srcVersion)
+			}
+		}
+		version = strings.Join(versions, ", ")
+	}
+
+	return typ, version
+}
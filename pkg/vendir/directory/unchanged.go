@@ -0,0 +1,61 @@
+package directory
+
+import (
+	"fmt"
+	"reflect"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// checkChanged fails if all synced contents resolved to the same
+// references as recorded in previous lock config. Contents that were
+// not previously recorded are considered to be changed.
+func (d *Directory) checkChanged(lockContents []ctlconf.LockDirectoryContents, syncOpts SyncOpts) error {
+	if syncOpts.PrevLockConfig == nil {
+		return nil
+	}
+
+	var compared int
+
+	for i, contents := range d.opts.Contents {
+		if d.isPreserved(contents, syncOpts) {
+			continue
+		}
+
+		prevLockContents, err := syncOpts.PrevLockConfig.FindContents(d.opts.Path, contents.Path)
+		if err != nil {
+			return nil
+		}
+
+		if !sameResolvedContents(prevLockContents, lockContents[i]) {
+			return nil
+		}
+
+		compared++
+	}
+
+	if compared == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("Expected contents of directory '%s' to change since last sync, "+
+		"but resolved references match lock config", d.opts.Path)
+}
+
+func sameResolvedContents(a, b ctlconf.LockDirectoryContents) bool {
+	return reflect.DeepEqual(resolvedContents(a), resolvedContents(b))
+}
+
+// resolvedContents drops details that do not identify resolved references
+func resolvedContents(contents ctlconf.LockDirectoryContents) ctlconf.LockDirectoryContents {
+	contents.ConfigDigest = ""
+	contents.ContentsDigest = ""
+	contents.FileChecksums = nil
+	contents.Stats = nil
+
+	if contents.HTTP != nil {
+		contents.HTTP = &ctlconf.LockDirectoryContentsHTTP{SHA256: contents.HTTP.SHA256, Files: contents.HTTP.Files}
+	}
+
+	return contents
+}
@@ -0,0 +1,92 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// Verify resolves directory contents (without replacing directory) and returns
+// descriptions of contents whose resolved references (e.g. git SHAs, image digests)
+// differ from given lock config. Details that are not references (digests, stats,
+// commit timestamps, etc.) are not compared since they may be missing from older
+// lock configs or only recorded in some modes.
+func (d *Directory) Verify(lockConfig ctlconf.LockDirectory, syncOpts SyncOpts) ([]string, error) {
+	// References are resolved without fetching contents when possible
+	// (e.g. git refs via ls-remote) and manual contents stay in place
+	syncOpts.ResolveOnly = true
+	syncOpts.DryRun = false
+	syncOpts.RecordFileChecksums = false
+	syncOpts.Diff = false
+
+	resolvedLockConfig, _, err := d.Sync(syncOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+
+	for _, resolvedCon := range resolvedLockConfig.Contents {
+		var lockedCon *ctlconf.LockDirectoryContents
+
+		for i, con := range lockConfig.Contents {
+			if con.Path == resolvedCon.Path {
+				lockedCon = &lockConfig.Contents[i]
+				break
+			}
+		}
+
+		if lockedCon == nil {
+			diffs = append(diffs, fmt.Sprintf("Contents '%s' within directory '%s' are missing from lock config",
+				resolvedCon.Path, d.opts.Path))
+			continue
+		}
+
+		err := verifyLocked(*lockedCon, resolvedCon)
+		if err != nil {
+			diffs = append(diffs, fmt.Sprintf("Directory '%s': %s", d.opts.Path, err))
+		}
+	}
+
+	return diffs, nil
+}
+
+// VerifyContentSHA compares digest of directory on disk with digest
+// recorded in given lock config without fetching any contents.
+// Individual files are compared as well if their checksums were recorded.
+func (d *Directory) VerifyContentSHA(lockConfig ctlconf.LockDirectory, syncOpts SyncOpts) ([]string, error) {
+	dirPath := d.dirPath(syncOpts)
+
+	_, err := os.Stat(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{fmt.Sprintf("Directory '%s' does not exist", d.opts.Path)}, nil
+		}
+		return nil, err
+	}
+
+	diffs, err := d.verifyFileChecksums(dirPath, lockConfig.Contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lockConfig.ContentSHA) == 0 {
+		if len(diffs) == 0 {
+			diffs = append(diffs, fmt.Sprintf("Directory '%s' does not have content SHA recorded in lock config", d.opts.Path))
+		}
+		return diffs, nil
+	}
+
+	contentSHA, err := d.ContentSHA(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentSHA != lockConfig.ContentSHA {
+		diffs = append(diffs, fmt.Sprintf("Directory '%s' content SHA differs (locked: %s, actual: %s)",
+			d.opts.Path, lockConfig.ContentSHA, contentSHA))
+	}
+
+	return diffs, nil
+}
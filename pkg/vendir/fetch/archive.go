@@ -12,14 +12,18 @@ import (
 	"strings"
 )
 
+// PreservedModeBits are carried over from source files
+const PreservedModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
 type Archive struct {
 	path               string
 	fallbackOnPlain    bool
 	fallbackOnPlainURL string
+	stripComponents    int
 }
 
-func NewArchive(path string, fallbackOnPlain bool, fallbackOnPlainURL string) Archive {
-	return Archive{path, fallbackOnPlain, fallbackOnPlainURL}
+func NewArchive(path string, fallbackOnPlain bool, fallbackOnPlainURL string, stripComponents int) Archive {
+	return Archive{path, fallbackOnPlain, fallbackOnPlainURL, stripComponents}
 }
 
 func (t Archive) Unpack(dstPath string) (bool, error) {
@@ -43,10 +47,19 @@ func (t Archive) Unpack(dstPath string) (bool, error) {
 	return false, nil
 }
 
-func (t Archive) writeIntoFile(srcFile io.Reader, dstPath, additionalPath string) error {
-	dstFilePath := filepath.Join(dstPath, additionalPath)
+func (t Archive) writeIntoFile(srcFile io.Reader, dstPath, additionalPath string, mode os.FileMode) error {
+	additionalPath, skip := t.strippedPath(additionalPath)
+	if skip {
+		return nil
+	}
+
+	// Disallow entries escaping destination (e.g. '../../etc/passwd')
+	dstFilePath, err := ScopedPath(dstPath, additionalPath)
+	if err != nil {
+		return fmt.Errorf("Checking archive entry path: %s", err)
+	}
 
-	err := os.MkdirAll(filepath.Dir(dstFilePath), 0700)
+	err = os.MkdirAll(filepath.Dir(dstFilePath), 0755)
 	if err != nil {
 		return fmt.Errorf("Making intermediate dir: %s", err)
 	}
@@ -63,12 +76,33 @@ func (t Archive) writeIntoFile(srcFile io.Reader, dstPath, additionalPath string
 		return fmt.Errorf("Copying into dst file: %s", err)
 	}
 
+	if mode != 0 {
+		err = dstFile.Chmod(mode & PreservedModeBits)
+		if err != nil {
+			return fmt.Errorf("Changing dst file mode: %s", err)
+		}
+	}
+
 	return nil
 }
 
-func (t Archive) writeIntoFileAndClose(srcFile io.ReadCloser, dstPath, additionalPath string) error {
+func (t Archive) writeIntoFileAndClose(srcFile io.ReadCloser, dstPath, additionalPath string, mode os.FileMode) error {
 	defer srcFile.Close()
-	return t.writeIntoFile(srcFile, dstPath, additionalPath)
+	return t.writeIntoFile(srcFile, dstPath, additionalPath, mode)
+}
+
+// strippedPath removes leading path components similar to tar's --strip-components
+func (t Archive) strippedPath(path string) (string, bool) {
+	if t.stripComponents == 0 {
+		return path, false
+	}
+
+	pieces := strings.Split(strings.TrimPrefix(filepath.ToSlash(path), "/"), "/")
+	if len(pieces) <= t.stripComponents {
+		return "", true
+	}
+
+	return filepath.Join(pieces[t.stripComponents:]...), false
 }
 
 func (t Archive) tryZip(path, dstPath string) (bool, error) {
@@ -90,7 +124,7 @@ func (t Archive) tryZip(path, dstPath string) (bool, error) {
 			return true, fmt.Errorf("Opening zip file: %s", err)
 		}
 
-		err = t.writeIntoFileAndClose(srcZipFile, dstPath, f.Name)
+		err = t.writeIntoFileAndClose(srcZipFile, dstPath, f.Name, f.Mode())
 		if err != nil {
 			return true, err
 		}
@@ -129,6 +163,7 @@ func (t Archive) tryTarWithGzip(path, dstPath string, gzipped bool) (bool, error
 
 	tarReader := tar.NewReader(fileReader)
 	readEntries := false
+	dirModes := map[string]os.FileMode{}
 
 	for {
 		header, err := tarReader.Next()
@@ -144,10 +179,15 @@ func (t Archive) tryTarWithGzip(path, dstPath string, gzipped bool) (bool, error
 		switch header.Typeflag {
 		case tar.TypeDir:
 			// TODO should we make empty directories?
+			// Apply modes after all entries are written in case directory is not writable
+			dirPath, skip := t.strippedPath(header.Name)
+			if !skip {
+				dirModes[dirPath] = header.FileInfo().Mode()
+			}
 			continue
 
 		case tar.TypeReg:
-			err = t.writeIntoFile(tarReader, dstPath, header.Name)
+			err = t.writeIntoFile(tarReader, dstPath, header.Name, header.FileInfo().Mode())
 			if err != nil {
 				return true, err
 			}
@@ -157,6 +197,19 @@ func (t Archive) tryTarWithGzip(path, dstPath string, gzipped bool) (bool, error
 		}
 	}
 
+	for dirPath, mode := range dirModes {
+		dstDirPath, err := ScopedPath(dstPath, dirPath)
+		if err != nil {
+			return true, fmt.Errorf("Checking archive entry path: %s", err)
+		}
+
+		// Only directories that contain files are created
+		err = os.Chmod(dstDirPath, mode&PreservedModeBits)
+		if err != nil && !os.IsNotExist(err) {
+			return true, fmt.Errorf("Changing dir mode: %s", err)
+		}
+	}
+
 	return true, nil
 }
 
@@ -179,5 +232,5 @@ func (t Archive) tryPlain(path, dstPath string) error {
 	}
 
 	// Cannot just move since it may be on a different device
-	return t.writeIntoFileAndClose(srcFile, dstPath, fileName)
+	return t.writeIntoFileAndClose(srcFile, dstPath, fileName, 0)
 }
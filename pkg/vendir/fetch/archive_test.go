@@ -0,0 +1,89 @@
+package fetch_test
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestArchiveStripComponentsAndModes(t *testing.T) {
+	archivePath, dstPath, cleanUp := newTarArchive(t, map[string]string{
+		"root/bin/script.sh": "#!/bin/sh",
+		"root/README.md":     "readme",
+		"top-level-file":     "skipped",
+	})
+	defer cleanUp()
+
+	_, err := ctlfetch.NewArchive(archivePath, false, "", 1).Unpack(dstPath)
+	if err != nil {
+		t.Fatalf("Expected unpacking to succeed: %s", err)
+	}
+
+	fi, err := os.Stat(filepath.Join(dstPath, "bin", "script.sh"))
+	if err != nil {
+		t.Fatalf("Expected stripped file to exist: %s", err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Fatalf("Expected file mode to be preserved, but was %s", fi.Mode())
+	}
+
+	_, err = os.Stat(filepath.Join(dstPath, "top-level-file"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected file with too few components to be skipped")
+	}
+}
+
+func TestArchiveRejectsEscapingPaths(t *testing.T) {
+	archivePath, dstPath, cleanUp := newTarArchive(t, map[string]string{
+		"../escaped": "content",
+	})
+	defer cleanUp()
+
+	_, err := ctlfetch.NewArchive(archivePath, false, "", 0).Unpack(dstPath)
+	if err == nil || !strings.Contains(err.Error(), "Invalid path") {
+		t.Fatalf("Expected unpacking to fail due to invalid path, but was: %v", err)
+	}
+}
+
+func newTarArchive(t *testing.T, files map[string]string) (string, string, func()) {
+	tmpDir, err := ioutil.TempDir("", "vendir-archive-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+
+	archivePath := filepath.Join(tmpDir, "archive.tar")
+
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("Creating archive: %s", err)
+	}
+
+	tarWriter := tar.NewWriter(archiveFile)
+
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, ".sh") {
+			header.Mode = 0755
+		}
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			t.Fatalf("Writing tar header: %s", err)
+		}
+		_, err = tarWriter.Write([]byte(content))
+		if err != nil {
+			t.Fatalf("Writing tar content: %s", err)
+		}
+	}
+
+	tarWriter.Close()
+	archiveFile.Close()
+
+	dstPath := filepath.Join(tmpDir, "dst")
+
+	return archivePath, dstPath, func() { os.RemoveAll(tmpDir) }
+}
@@ -0,0 +1,211 @@
+package azureblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type Sync struct {
+	opts       ctlconf.DirectoryContentsAzureBlob
+	azBinary   string
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewSync(opts ctlconf.DirectoryContentsAzureBlob, azBinary string,
+	refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) *Sync {
+
+	if len(azBinary) == 0 {
+		azBinary = "az"
+	}
+
+	return &Sync{opts, azBinary, refFetcher, proxy}
+}
+
+func (t *Sync) Desc() string {
+	return fmt.Sprintf("azure://%s/%s/%s", t.opts.Account, t.opts.Container, t.opts.Prefix)
+}
+
+func (t *Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsAzureBlob, error) {
+	lockConf := ctlconf.LockDirectoryContentsAzureBlob{}
+
+	if len(t.opts.Account) == 0 {
+		return lockConf, fmt.Errorf("Expected non-empty account")
+	}
+	if len(t.opts.Container) == 0 {
+		return lockConf, fmt.Errorf("Expected non-empty container")
+	}
+
+	env, err := t.env()
+	if err != nil {
+		return lockConf, err
+	}
+
+	var blobs []azureBlob
+
+	if len(t.opts.LockedBlobs) > 0 {
+		for _, lockedBlob := range t.opts.LockedBlobs {
+			blob := azureBlob{Name: lockedBlob.Name}
+			blob.Properties.ETag = `"` + lockedBlob.ETag + `"`
+			blob.Properties.ContentSettings.ContentMD5 = lockedBlob.ContentMD5
+			blobs = append(blobs, blob)
+		}
+	} else {
+		blobs, err = t.listBlobs(ctx, env)
+		if err != nil {
+			return lockConf, fmt.Errorf("Listing blobs: %s", err)
+		}
+	}
+
+	incomingTmpPath, err := tempArea.NewTempDir("azureblob")
+	if err != nil {
+		return lockConf, err
+	}
+
+	defer os.RemoveAll(incomingTmpPath)
+
+	for _, blob := range blobs {
+		relPath := strings.TrimPrefix(blob.Name, t.opts.Prefix)
+
+		// Skip "directory" placeholder blobs
+		if len(relPath) == 0 || strings.HasSuffix(relPath, "/") {
+			continue
+		}
+
+		path, err := ctlfetch.ScopedPath(incomingTmpPath, relPath)
+		if err != nil {
+			return lockConf, fmt.Errorf("Placing blob '%s': %s", blob.Name, err)
+		}
+
+		err = t.downloadBlob(ctx, blob, path, env)
+		if err != nil {
+			return lockConf, fmt.Errorf("Downloading blob '%s': %s", blob.Name, err)
+		}
+
+		lockConf.Blobs = append(lockConf.Blobs, ctlconf.LockDirectoryContentsAzureBlobBlob{
+			Name:       blob.Name,
+			ETag:       strings.Trim(blob.Properties.ETag, `"`),
+			ContentMD5: blob.Properties.ContentSettings.ContentMD5,
+		})
+	}
+
+	if len(lockConf.Blobs) == 0 {
+		return lockConf, fmt.Errorf("Expected to find at least one blob under '%s', but found none", t.Desc())
+	}
+
+	err = ctlfetch.MoveDir(incomingTmpPath, dstPath)
+	if err != nil {
+		return lockConf, err
+	}
+
+	return lockConf, nil
+}
+
+type azureBlob struct {
+	Name       string
+	Properties azureBlobProperties
+}
+
+type azureBlobProperties struct {
+	ETag            string `json:"etag"`
+	ContentSettings struct {
+		ContentMD5 string `json:"contentMd5"`
+	} `json:"contentSettings"`
+}
+
+func (t *Sync) listBlobs(ctx context.Context, env []string) ([]azureBlob, error) {
+	args := []string{"storage", "blob", "list", "--container-name", t.opts.Container, "--num-results", "*"}
+
+	if len(t.opts.Prefix) > 0 {
+		args = append(args, "--prefix", t.opts.Prefix)
+	}
+
+	out, err := t.run(ctx, args, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs []azureBlob
+
+	err = json.Unmarshal([]byte(out), &blobs)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshaling blobs list: %s", err)
+	}
+
+	return blobs, nil
+}
+
+func (t *Sync) downloadBlob(ctx context.Context, blob azureBlob, dstPath string, env []string) error {
+	err := os.MkdirAll(filepath.Dir(dstPath), 0700)
+	if err != nil {
+		return fmt.Errorf("Making intermediate dir: %s", err)
+	}
+
+	// Make sure blob did not change since it was listed (or locked)
+	args := []string{"storage", "blob", "download", "--container-name", t.opts.Container,
+		"--name", blob.Name, "--file", dstPath, "--if-match", blob.Properties.ETag, "--no-progress"}
+
+	_, err = t.run(ctx, args, env)
+	return err
+}
+
+func (t *Sync) run(ctx context.Context, args []string, env []string) (string, error) {
+	args = append(args, "--account-name", t.opts.Account, "--output", "json")
+
+	if len(t.opts.Endpoint) > 0 {
+		args = append(args, "--blob-endpoint", t.opts.Endpoint)
+	}
+
+	var stdoutBs, stderrBs bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, t.azBinary, args...)
+	cmd.Env = env
+	cmd.Stdout = &stdoutBs
+	cmd.Stderr = &stderrBs
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("Azure CLI %s: %s (stderr: %s)", strings.Join(args[:3], " "), err, stderrBs.String())
+	}
+
+	return stdoutBs.String(), nil
+}
+
+// env provides credentials via environment variables
+// understood by Azure CLI to avoid exposing them in process arguments
+func (t *Sync) env() ([]string, error) {
+	env := append(os.Environ(), t.proxy.Env()...)
+
+	if t.opts.SecretRef == nil {
+		return env, nil
+	}
+
+	secret, err := t.refFetcher.GetSecret(t.opts.SecretRef.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, val := range secret.Data {
+		switch name {
+		case ctlconf.SecretAzureConnectionString:
+			env = append(env, "AZURE_STORAGE_CONNECTION_STRING="+string(val))
+		case ctlconf.SecretAzureSASToken:
+			env = append(env, "AZURE_STORAGE_SAS_TOKEN="+string(val))
+		case ctlconf.SecretAzureAccountKey:
+			env = append(env, "AZURE_STORAGE_KEY="+string(val))
+		default:
+			return nil, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
+		}
+	}
+
+	return env, nil
+}
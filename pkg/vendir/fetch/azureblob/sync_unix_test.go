@@ -0,0 +1,135 @@
+//go:build !windows
+// +build !windows
+
+package azureblob_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlazb "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/azureblob"
+)
+
+// fakeAz serves a container with a single blob (ETag "0x1")
+// and records its invocations; download preconditions are enforced
+const fakeAz = `#!/bin/sh
+echo "$@" >> %s
+case "$3" in
+  list)
+    echo '[{"name": "prefix/", "properties": {"etag": "\"0x0\""}},
+      {"name": "prefix/file.txt", "properties": {"etag": "\"0x1\"", "contentSettings": {"contentMd5": "mgNkuembtIDdJeHwKEyFVQ=="}}}]' ;;
+  download)
+    while [ $# -gt 1 ]; do
+      case "$1" in
+        --file) file="$2" ;;
+        --if-match) [ "$2" = '"0x1"' ] || { echo "ERROR: The condition specified using HTTP conditional header(s) is not met." >&2; exit 1; } ;;
+      esac
+      shift
+    done
+    printf content > "$file" ;;
+esac
+`
+
+func TestSyncWithLockedBlobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-azureblob-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "az.log")
+	azPath := filepath.Join(dir, "az")
+
+	err = ioutil.WriteFile(azPath, []byte(fmt.Sprintf(fakeAz, logPath)), 0700)
+	if err != nil {
+		t.Fatalf("Writing fake az: %s", err)
+	}
+
+	sync := func(opts ctlconf.DirectoryContentsAzureBlob, dstName string) (ctlconf.LockDirectoryContentsAzureBlob, []string, error) {
+		os.Remove(logPath)
+
+		dstPath := filepath.Join(dir, dstName)
+
+		lockConf, err := ctlazb.NewSync(opts, azPath, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).
+			Sync(context.Background(), dstPath, testTempArea{dir})
+
+		logBs, _ := ioutil.ReadFile(logPath)
+		calls := strings.Split(strings.TrimSpace(string(logBs)), "\n")
+
+		if err == nil {
+			bs, err := ioutil.ReadFile(filepath.Join(dstPath, "file.txt"))
+			if err != nil || string(bs) != "content" {
+				t.Fatalf("Expected downloaded content to match: %v", err)
+			}
+		}
+
+		return lockConf, calls, err
+	}
+
+	opts := ctlconf.DirectoryContentsAzureBlob{Account: "account", Container: "container", Prefix: "prefix/"}
+
+	lockConf, calls, err := sync(opts, "unlocked")
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedLockConf := ctlconf.LockDirectoryContentsAzureBlob{
+		Blobs: []ctlconf.LockDirectoryContentsAzureBlobBlob{{Name: "prefix/file.txt", ETag: "0x1", ContentMD5: "mgNkuembtIDdJeHwKEyFVQ=="}},
+	}
+	if !reflect.DeepEqual(lockConf, expectedLockConf) {
+		t.Fatalf("Expected ETag and MD5 to be recorded, but was: %#v", lockConf)
+	}
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "storage blob list") {
+		t.Fatalf("Expected container to be listed, but calls were: %#v", calls)
+	}
+
+	err = opts.Lock(&lockConf)
+	if err != nil {
+		t.Fatalf("Expected locking to succeed: %s", err)
+	}
+
+	lockConf, calls, err = sync(opts, "locked")
+	if err != nil {
+		t.Fatalf("Expected locked sync to succeed: %s", err)
+	}
+	if !reflect.DeepEqual(lockConf, expectedLockConf) {
+		t.Fatalf("Expected locked blobs to be recorded, but was: %#v", lockConf)
+	}
+	if len(calls) != 1 || !strings.Contains(calls[0], `--if-match "0x1" `) {
+		t.Fatalf("Expected locked blob to be fetched without listing, but calls were: %#v", calls)
+	}
+
+	changedOpts := ctlconf.DirectoryContentsAzureBlob{Account: "account", Container: "container", Prefix: "prefix/"}
+
+	err = changedOpts.Lock(&ctlconf.LockDirectoryContentsAzureBlob{
+		Blobs: []ctlconf.LockDirectoryContentsAzureBlobBlob{{Name: "prefix/file.txt", ETag: "0x0"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected locking to succeed: %s", err)
+	}
+
+	_, _, err = sync(changedOpts, "changed")
+	if err == nil || !strings.Contains(err.Error(), "condition specified using HTTP conditional header(s) is not met") {
+		t.Fatalf("Expected changed blob to fail locked sync, but was: %v", err)
+	}
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
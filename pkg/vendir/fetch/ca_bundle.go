@@ -0,0 +1,69 @@
+package fetch
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Locations of system CA certificates on common
+// Linux distributions (same as ones checked by Go)
+var systemCABundlePaths = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// NewCABundle reads CA certificates from given file path or inline PEM
+// and writes them together with system CA certificates into tmp dir.
+// Returned proxy opts are used by all HTTPS requests.
+func NewCABundle(pathOrPEM string, proxy ProxyOpts, tempArea TempArea) (ProxyOpts, error) {
+	caCerts := []byte(pathOrPEM)
+
+	if !strings.Contains(pathOrPEM, "-----BEGIN") {
+		var err error
+
+		caCerts, err = ioutil.ReadFile(pathOrPEM)
+		if err != nil {
+			return proxy, fmt.Errorf("Reading CA bundle: %s", err)
+		}
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM(caCerts) {
+		return proxy, fmt.Errorf("Expected CA bundle to contain at least one PEM encoded certificate")
+	}
+
+	var combinedCerts []byte
+
+	for _, path := range systemCABundlePaths {
+		bs, err := ioutil.ReadFile(path)
+		if err == nil {
+			combinedCerts = append(bs, '\n')
+			break
+		}
+	}
+
+	combinedCerts = append(combinedCerts, caCerts...)
+
+	tmpDir, err := tempArea.NewTempDir("ca-bundle")
+	if err != nil {
+		return proxy, err
+	}
+
+	combinedPath := filepath.Join(tmpDir, "ca-bundle.crt")
+
+	err = ioutil.WriteFile(combinedPath, combinedCerts, 0600)
+	if err != nil {
+		return proxy, fmt.Errorf("Writing CA bundle: %s", err)
+	}
+
+	proxy.CACerts = caCerts
+	proxy.CACertsPath = combinedPath
+
+	return proxy, nil
+}
@@ -0,0 +1,252 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	dircopy "github.com/otiai10/copy"
+)
+
+// Cache stores downloaded artifacts on disk so that they
+// could be reused across directories and vendir invocations.
+// Files are keyed by their sha256 digest; directories are keyed
+// by resolved reference (e.g. image digest) and verified against
+// digest of their contents recorded when they were stored.
+// Cache with empty path is disabled.
+type Cache struct {
+	path    string
+	maxSize int64
+}
+
+const (
+	cacheFilesDir   = "files"
+	cacheDirsDir    = "dirs"
+	cacheDigestFile = "digest"
+	cacheContentDir = "contents"
+)
+
+// NewCache returns cache rooted at given path
+// (max size of 0 means cache size is not bounded)
+func NewCache(path string, maxSize int64) Cache {
+	return Cache{path, maxSize}
+}
+
+func (c Cache) Enabled() bool { return len(c.path) > 0 }
+
+// GetFile copies cached file with given sha256 digest to dstPath.
+// Cached files that do not match digest are removed.
+func (c Cache) GetFile(sha256Digest, dstPath string) (bool, error) {
+	if !c.Enabled() || len(sha256Digest) == 0 {
+		return false, nil
+	}
+
+	sha256Digest = strings.TrimPrefix(sha256Digest, "sha256:")
+	entryPath := filepath.Join(c.path, cacheFilesDir, sha256Digest)
+
+	actualDigest, err := FileSHA256(entryPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Calculating cached file digest: %s", err)
+	}
+
+	if actualDigest != sha256Digest {
+		return false, os.RemoveAll(entryPath)
+	}
+
+	err = dircopy.Copy(entryPath, dstPath)
+	if err != nil {
+		return false, fmt.Errorf("Copying cached file: %s", err)
+	}
+
+	return true, c.touch(entryPath)
+}
+
+// PutFile stores file under its sha256 digest
+func (c Cache) PutFile(sha256Digest, srcPath string) error {
+	if !c.Enabled() || len(sha256Digest) == 0 {
+		return nil
+	}
+
+	sha256Digest = strings.TrimPrefix(sha256Digest, "sha256:")
+
+	return c.put(filepath.Join(c.path, cacheFilesDir, sha256Digest), func(tmpPath string) error {
+		return dircopy.Copy(srcPath, tmpPath)
+	})
+}
+
+// GetDir copies cached directory with given key into dstPath.
+// Cached directories that were modified since they were stored are removed.
+func (c Cache) GetDir(key, dstPath string) (bool, error) {
+	if !c.Enabled() || len(key) == 0 {
+		return false, nil
+	}
+
+	entryPath := c.dirEntryPath(key)
+
+	expectedDigest, err := ioutil.ReadFile(filepath.Join(entryPath, cacheDigestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Reading cached directory digest: %s", err)
+	}
+
+	actualDigest, err := TreeDigest(filepath.Join(entryPath, cacheContentDir))
+	if err != nil || actualDigest != string(expectedDigest) {
+		return false, os.RemoveAll(entryPath)
+	}
+
+	err = dircopy.Copy(filepath.Join(entryPath, cacheContentDir), dstPath)
+	if err != nil {
+		return false, fmt.Errorf("Copying cached directory: %s", err)
+	}
+
+	return true, c.touch(entryPath)
+}
+
+// PutDir stores copy of directory under given key
+func (c Cache) PutDir(key, srcPath string) error {
+	if !c.Enabled() || len(key) == 0 {
+		return nil
+	}
+
+	return c.put(c.dirEntryPath(key), func(tmpPath string) error {
+		err := dircopy.Copy(srcPath, filepath.Join(tmpPath, cacheContentDir))
+		if err != nil {
+			return err
+		}
+
+		digest, err := TreeDigest(filepath.Join(tmpPath, cacheContentDir))
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filepath.Join(tmpPath, cacheDigestFile), []byte(digest), 0600)
+	})
+}
+
+// Prune removes least recently used entries until
+// total cache size is within configured max size
+func (c Cache) Prune() error {
+	if !c.Enabled() || c.maxSize <= 0 {
+		return nil
+	}
+
+	type cacheEntry struct {
+		Path    string
+		Size    int64
+		ModTime time.Time
+	}
+
+	var entries []cacheEntry
+	var totalSize int64
+
+	for _, kindDir := range []string{cacheFilesDir, cacheDirsDir} {
+		infos, err := ioutil.ReadDir(filepath.Join(c.path, kindDir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("Listing cache entries: %s", err)
+		}
+
+		for _, info := range infos {
+			entry := cacheEntry{Path: filepath.Join(c.path, kindDir, info.Name()), ModTime: info.ModTime()}
+
+			entry.Size, err = c.size(entry.Path)
+			if err != nil {
+				return fmt.Errorf("Calculating cache entry size: %s", err)
+			}
+
+			entries = append(entries, entry)
+			totalSize += entry.Size
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ModTime.Before(entries[j].ModTime) })
+
+	for _, entry := range entries {
+		if totalSize <= c.maxSize {
+			break
+		}
+
+		err := os.RemoveAll(entry.Path)
+		if err != nil {
+			return fmt.Errorf("Deleting cache entry: %s", err)
+		}
+
+		totalSize -= entry.Size
+	}
+
+	return nil
+}
+
+func (c Cache) put(entryPath string, writeFunc func(string) error) error {
+	err := os.MkdirAll(filepath.Dir(entryPath), 0700)
+	if err != nil {
+		return fmt.Errorf("Creating cache dir: %s", err)
+	}
+
+	// Write into temporary location first so that concurrent
+	// readers never observe partially written entries
+	tmpPath, err := ioutil.TempDir(filepath.Dir(entryPath), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("Creating cache tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpPath)
+
+	tmpEntryPath := filepath.Join(tmpPath, "entry")
+
+	err = writeFunc(tmpEntryPath)
+	if err != nil {
+		return fmt.Errorf("Writing cache entry: %s", err)
+	}
+
+	err = os.RemoveAll(entryPath)
+	if err != nil {
+		return fmt.Errorf("Deleting previous cache entry: %s", err)
+	}
+
+	err = os.Rename(tmpEntryPath, entryPath)
+	if err != nil {
+		return fmt.Errorf("Moving cache entry: %s", err)
+	}
+
+	return c.Prune()
+}
+
+func (c Cache) dirEntryPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.path, cacheDirsDir, hex.EncodeToString(sum[:]))
+}
+
+func (Cache) touch(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+func (Cache) size(path string) (int64, error) {
+	var size int64
+
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
@@ -0,0 +1,187 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const cacheVersionsDir = "versions"
+
+// Guards version records that are updated by concurrently synced contents
+var cacheVersionsLock sync.Mutex
+
+type cacheSourceVersions struct {
+	Source string `json:"source"`
+	// Ordered from the most recently synced
+	Versions []cacheSourceVersion `json:"versions"`
+}
+
+type cacheSourceVersion struct {
+	Version string `json:"version"`
+	// sha256 digests of cached files used by this version
+	Files []string `json:"files"`
+}
+
+// RetainVersions records cached files used by given version of a source
+// and deletes cached files that are only used by versions older than
+// the most recent retention versions of this or any other source
+func (c Cache) RetainVersions(source, version string, fileDigests []string, retention int) error {
+	if !c.Enabled() || retention <= 0 || len(version) == 0 {
+		return nil
+	}
+
+	cacheVersionsLock.Lock()
+	defer cacheVersionsLock.Unlock()
+
+	recordPath := c.versionsRecordPath(source)
+
+	record, err := c.readVersionsRecord(recordPath)
+	if err != nil {
+		return err
+	}
+
+	record.Source = source
+
+	var files []string
+	for _, digest := range fileDigests {
+		files = append(files, strings.TrimPrefix(digest, "sha256:"))
+	}
+
+	versions := []cacheSourceVersion{{Version: version, Files: files}}
+	for _, ver := range record.Versions {
+		if ver.Version != version {
+			versions = append(versions, ver)
+		}
+	}
+
+	var evicted []cacheSourceVersion
+	if len(versions) > retention {
+		evicted = versions[retention:]
+		versions = versions[:retention]
+	}
+
+	record.Versions = versions
+
+	err = c.writeVersionsRecord(recordPath, record)
+	if err != nil {
+		return err
+	}
+
+	if len(evicted) == 0 {
+		return nil
+	}
+
+	retainedFiles, err := c.retainedFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, ver := range evicted {
+		for _, digest := range ver.Files {
+			if retainedFiles[digest] {
+				continue
+			}
+			err := os.RemoveAll(filepath.Join(c.path, cacheFilesDir, digest))
+			if err != nil {
+				return fmt.Errorf("Deleting cache entry: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// retainedFiles returns files used by retained versions of all sources
+func (c Cache) retainedFiles() (map[string]bool, error) {
+	result := map[string]bool{}
+
+	infos, err := ioutil.ReadDir(filepath.Join(c.path, cacheVersionsDir))
+	if err != nil {
+		return nil, fmt.Errorf("Listing cache version records: %s", err)
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".json" {
+			continue
+		}
+
+		record, err := c.readVersionsRecord(filepath.Join(c.path, cacheVersionsDir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ver := range record.Versions {
+			for _, digest := range ver.Files {
+				result[digest] = true
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (c Cache) versionsRecordPath(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(c.path, cacheVersionsDir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (Cache) readVersionsRecord(path string) (cacheSourceVersions, error) {
+	var record cacheSourceVersions
+
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return record, nil
+		}
+		return record, fmt.Errorf("Reading cache version record: %s", err)
+	}
+
+	err = json.Unmarshal(bs, &record)
+	if err != nil {
+		return record, fmt.Errorf("Unmarshaling cache version record '%s': %s", path, err)
+	}
+
+	return record, nil
+}
+
+func (Cache) writeVersionsRecord(path string, record cacheSourceVersions) error {
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("Marshaling cache version record: %s", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("Creating cache dir: %s", err)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("Creating cache tmp file: %s", err)
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(bs)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Writing cache version record: %s", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		return fmt.Errorf("Moving cache version record: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package fetch_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestCacheFileRoundTripAndCorruption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-cache-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "src")
+	content := []byte("content")
+	digest := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	err = ioutil.WriteFile(srcPath, content, 0600)
+	if err != nil {
+		t.Fatalf("Writing src file: %s", err)
+	}
+
+	cache := ctlfetch.NewCache(filepath.Join(dir, "cache"), 0)
+
+	err = cache.PutFile(digest, srcPath)
+	if err != nil {
+		t.Fatalf("Expected put to succeed: %s", err)
+	}
+
+	dstPath := filepath.Join(dir, "dst")
+
+	found, err := cache.GetFile(digest, dstPath)
+	if err != nil || !found {
+		t.Fatalf("Expected cache hit, but was: %t %v", found, err)
+	}
+
+	bs, err := ioutil.ReadFile(dstPath)
+	if err != nil || string(bs) != string(content) {
+		t.Fatalf("Expected cached content, but was: %s %v", bs, err)
+	}
+
+	// Entry content no longer matches its digest
+	err = ioutil.WriteFile(filepath.Join(dir, "cache", "files", digest), []byte("corrupt"), 0600)
+	if err != nil {
+		t.Fatalf("Corrupting entry: %s", err)
+	}
+
+	found, err = cache.GetFile(digest, dstPath)
+	if err != nil || found {
+		t.Fatalf("Expected cache miss for corrupt entry, but was: %t %v", found, err)
+	}
+}
+
+func TestCachePrunesLeastRecentlyUsedEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-cache-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := ctlfetch.NewCache(filepath.Join(dir, "cache"), 100)
+
+	for _, key := range []string{"key1", "key2"} {
+		srcPath := filepath.Join(dir, key)
+
+		err = os.MkdirAll(srcPath, 0700)
+		if err != nil {
+			t.Fatalf("Creating src dir: %s", err)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(srcPath, "file"), []byte("12345678"), 0600)
+		if err != nil {
+			t.Fatalf("Writing src file: %s", err)
+		}
+
+		err = cache.PutDir(key, srcPath)
+		if err != nil {
+			t.Fatalf("Expected put to succeed: %s", err)
+		}
+	}
+
+	found, err := cache.GetDir("key2", filepath.Join(dir, "dst"))
+	if err != nil || !found {
+		t.Fatalf("Expected cache hit for recent entry, but was: %t %v", found, err)
+	}
+
+	found, err = cache.GetDir("key1", filepath.Join(dir, "dst"))
+	if err != nil || found {
+		t.Fatalf("Expected cache miss for pruned entry, but was: %t %v", found, err)
+	}
+}
+
+func TestCacheRetainVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-cache-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := ctlfetch.NewCache(filepath.Join(dir, "cache"), 0)
+
+	put := func(content string) string {
+		srcPath := filepath.Join(dir, "src")
+		err := ioutil.WriteFile(srcPath, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing src file: %s", err)
+		}
+		digest := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+		err = cache.PutFile(digest, srcPath)
+		if err != nil {
+			t.Fatalf("Expected put to succeed: %s", err)
+		}
+		return digest
+	}
+
+	isCached := func(digest string) bool {
+		found, err := cache.GetFile(digest, filepath.Join(dir, "dst"))
+		if err != nil {
+			t.Fatalf("Expected get to succeed: %s", err)
+		}
+		return found
+	}
+
+	v1, v2, v3, shared := put("v1"), put("v2"), put("v3"), put("shared")
+
+	for _, ver := range []struct {
+		Source, Version string
+		Files           []string
+	}{
+		{"other", "o1", []string{shared}},
+		{"src", "v1", []string{v1, shared}},
+		{"src", "v2", []string{v2}},
+		{"src", "v3", []string{v3}},
+	} {
+		err := cache.RetainVersions(ver.Source, ver.Version, ver.Files, 2)
+		if err != nil {
+			t.Fatalf("Expected retaining versions to succeed: %s", err)
+		}
+	}
+
+	if isCached(v1) {
+		t.Fatalf("Expected oldest version to be evicted")
+	}
+	for _, digest := range []string{v2, v3, shared} {
+		if !isCached(digest) {
+			t.Fatalf("Expected file '%s' of retained version to be kept", digest)
+		}
+	}
+}
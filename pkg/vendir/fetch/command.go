@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// killedCommandWaitDelay limits how long killed command is waited on
+// (e.g. when a child process escaped process group and keeps output open)
+const killedCommandWaitDelay = 5 * time.Second
+
+// RunCommand runs command (created via exec.Command) until it exits or
+// ctx is done. Once ctx is done, command and its child processes (e.g. git
+// remote helpers, ssh) are killed as a process group and reaped, so that
+// hung network operations cannot block sync past its deadline.
+func RunCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if ctx.Done() == nil {
+		// Without deadline command stays in vendir's process group
+		// (e.g. so that git can still prompt for credentials)
+		return cmd.Run()
+	}
+
+	if ctx.Err() != nil {
+		return commandCtxErr(ctx)
+	}
+
+	startProcessGroup(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- cmd.Wait() }()
+
+	stopForwarding := forwardTermSignals(cmd)
+	defer stopForwarding()
+
+	select {
+	case err := <-waitCh:
+		return err
+
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+
+		select {
+		case <-waitCh:
+		case <-time.After(killedCommandWaitDelay):
+		}
+
+		return commandCtxErr(ctx)
+	}
+}
+
+func commandCtxErr(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timed out (killed command and its child processes)")
+	}
+	return fmt.Errorf("Canceled (killed command and its child processes)")
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package fetch
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+func startProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	// Negative pid signals entire process group led by command
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// forwardTermSignals kills process group when vendir is interrupted since
+// separate process group does not receive signals sent by terminal; signal
+// is then re-raised so that vendir terminates as it would otherwise
+func forwardTermSignals(cmd *exec.Cmd) func() {
+	sigCh := make(chan os.Signal, 1)
+	doneCh := make(chan struct{})
+
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			killProcessGroup(cmd)
+			signal.Stop(sigCh)
+			syscall.Kill(os.Getpid(), sig.(syscall.Signal))
+		case <-doneCh:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(doneCh)
+	}
+}
@@ -0,0 +1,16 @@
+package fetch
+
+import (
+	"os/exec"
+)
+
+// Process groups are not used on Windows; only command itself is killed
+func startProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func forwardTermSignals(cmd *exec.Cmd) func() {
+	return func() {}
+}
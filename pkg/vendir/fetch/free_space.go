@@ -0,0 +1,22 @@
+package fetch
+
+import (
+	"fmt"
+)
+
+// CheckFreeSpace fails if filesystem containing given path has
+// less than required number of bytes available. Check is skipped
+// when available space cannot be determined on current platform.
+func CheckFreeSpace(path string, required int64, purpose string) error {
+	if required <= 0 {
+		return nil
+	}
+
+	available, found := FreeSpace(path)
+	if !found || available >= uint64(required) {
+		return nil
+	}
+
+	return NewNonRetryableError(fmt.Errorf("Expected at least %d bytes of free space in '%s' %s, "+
+		"but only %d bytes are available", required, path, purpose, available))
+}
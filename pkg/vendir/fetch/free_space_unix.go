@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package fetch
+
+import (
+	"syscall"
+)
+
+// FreeSpace returns number of bytes available to unprivileged users
+// on filesystem containing given path
+func FreeSpace(path string) (uint64, bool) {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), true
+}
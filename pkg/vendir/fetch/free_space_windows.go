@@ -0,0 +1,6 @@
+package fetch
+
+// FreeSpace is not determined on Windows
+func FreeSpace(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,226 @@
+package gcs
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const (
+	defaultTokenURI = "https://oauth2.googleapis.com/token"
+	readOnlyScope   = "https://www.googleapis.com/auth/devstorage.read_only"
+)
+
+// credentialsFile is a subset of fields found in service account keys
+// and in application default credentials created by 'gcloud auth application-default login'
+type credentialsFile struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// accessToken returns OAuth2 token based on service account key specified
+// in secret or application default credentials. Empty token (anonymous access)
+// is returned if no credentials were found (e.g. for public buckets or emulators).
+func (t *Sync) accessToken(ctx context.Context) (string, error) {
+	credsBs, err := t.credentials()
+	if err != nil {
+		return "", err
+	}
+	if len(credsBs) == 0 {
+		return "", nil
+	}
+
+	var creds credentialsFile
+
+	err = json.Unmarshal(credsBs, &creds)
+	if err != nil {
+		return "", fmt.Errorf("Unmarshaling credentials: %s", err)
+	}
+
+	tokenURI := creds.TokenURI
+	if len(tokenURI) == 0 {
+		tokenURI = defaultTokenURI
+	}
+
+	form := url.Values{}
+
+	switch creds.Type {
+	case "service_account":
+		assertion, err := creds.signedJWT(tokenURI)
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+
+	default:
+		return "", fmt.Errorf("Unsupported credentials type '%s'", creds.Type)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("Building request: %s", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.proxy.HTTPClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	bodyBs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf("Expected 200 OK, but was '%s' (body: %s)", resp.Status, bodyBs))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	err = json.Unmarshal(bodyBs, &tokenResp)
+	if err != nil {
+		return "", fmt.Errorf("Unmarshaling token response: %s", err)
+	}
+
+	return tokenResp.AccessToken, nil
+}
+
+func (t *Sync) credentials() ([]byte, error) {
+	if t.opts.SecretRef != nil {
+		secret, err := t.refFetcher.GetSecret(t.opts.SecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		var credsBs []byte
+
+		for name, val := range secret.Data {
+			switch name {
+			case ctlconf.SecretGCSServiceAccountJSON:
+				credsBs = val
+			default:
+				return nil, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
+			}
+		}
+
+		return credsBs, nil
+	}
+
+	// Custom endpoints are typically used with emulators
+	// that do not require authentication
+	if len(t.opts.Endpoint) > 0 {
+		return nil, nil
+	}
+
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if len(path) > 0 {
+		return ioutil.ReadFile(path)
+	}
+
+	configDir := os.Getenv("CLOUDSDK_CONFIG")
+	if len(configDir) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		configDir = filepath.Join(homeDir, ".config", "gcloud")
+	}
+
+	credsBs, err := ioutil.ReadFile(filepath.Join(configDir, "application_default_credentials.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return credsBs, nil
+}
+
+func (c credentialsFile) signedJWT(audience string) (string, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("Expected service account private key to be PEM encoded")
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsedKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("Parsing service account private key: %s", err)
+		}
+	}
+
+	key, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("Expected service account private key to be RSA key")
+	}
+
+	now := time.Now()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   c.ClientEmail,
+		"scope": readOnlyScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("Signing token: %s", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
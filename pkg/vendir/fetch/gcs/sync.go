@@ -0,0 +1,231 @@
+package gcs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const (
+	defaultEndpoint = "https://storage.googleapis.com"
+)
+
+type Sync struct {
+	opts       ctlconf.DirectoryContentsGCS
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewSync(opts ctlconf.DirectoryContentsGCS, refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) *Sync {
+	return &Sync{opts, refFetcher, proxy}
+}
+
+func (t *Sync) Desc() string {
+	return fmt.Sprintf("gs://%s/%s", t.opts.Bucket, t.opts.Prefix)
+}
+
+func (t *Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGCS, error) {
+	lockConf := ctlconf.LockDirectoryContentsGCS{}
+
+	if len(t.opts.Bucket) == 0 {
+		return lockConf, fmt.Errorf("Expected non-empty bucket")
+	}
+
+	token, err := t.accessToken(ctx)
+	if err != nil {
+		return lockConf, fmt.Errorf("Obtaining access token: %w", err)
+	}
+
+	var objects []gcsObject
+
+	if len(t.opts.LockedObjects) > 0 {
+		for _, obj := range t.opts.LockedObjects {
+			objects = append(objects, gcsObject{Name: obj.Name, Generation: obj.Generation, CRC32C: obj.CRC32C})
+		}
+	} else {
+		objects, err = t.listObjects(ctx, token)
+		if err != nil {
+			return lockConf, fmt.Errorf("Listing objects: %w", err)
+		}
+	}
+
+	incomingTmpPath, err := tempArea.NewTempDir("gcs")
+	if err != nil {
+		return lockConf, err
+	}
+
+	defer os.RemoveAll(incomingTmpPath)
+
+	for _, obj := range objects {
+		relPath := strings.TrimPrefix(obj.Name, t.opts.Prefix)
+
+		// Skip "directory" placeholder objects
+		if len(relPath) == 0 || strings.HasSuffix(relPath, "/") {
+			continue
+		}
+
+		path, err := ctlfetch.ScopedPath(incomingTmpPath, relPath)
+		if err != nil {
+			return lockConf, fmt.Errorf("Placing object '%s': %s", obj.Name, err)
+		}
+
+		err = t.downloadObject(ctx, obj, path, token)
+		if err != nil {
+			return lockConf, fmt.Errorf("Downloading object '%s': %w", obj.Name, err)
+		}
+
+		lockConf.Objects = append(lockConf.Objects, ctlconf.LockDirectoryContentsGCSObject{
+			Name:       obj.Name,
+			Generation: obj.Generation,
+			CRC32C:     obj.CRC32C,
+		})
+	}
+
+	if len(lockConf.Objects) == 0 {
+		return lockConf, fmt.Errorf("Expected to find at least one object under '%s', but found none", t.Desc())
+	}
+
+	err = ctlfetch.MoveDir(incomingTmpPath, dstPath)
+	if err != nil {
+		return lockConf, err
+	}
+
+	return lockConf, nil
+}
+
+type gcsListObjectsOutput struct {
+	Items         []gcsObject `json:"items"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+type gcsObject struct {
+	Name       string `json:"name"`
+	Generation string `json:"generation"`
+	// Base64 encoded big-endian CRC32C checksum
+	CRC32C string `json:"crc32c"`
+}
+
+func (t *Sync) listObjects(ctx context.Context, token string) ([]gcsObject, error) {
+	var objects []gcsObject
+	var pageToken string
+
+	for {
+		query := url.Values{}
+		if len(t.opts.Prefix) > 0 {
+			query.Set("prefix", t.opts.Prefix)
+		}
+		if len(pageToken) > 0 {
+			query.Set("pageToken", pageToken)
+		}
+
+		listURL := fmt.Sprintf("%s/storage/v1/b/%s/o?%s", t.endpoint(), url.PathEscape(t.opts.Bucket), query.Encode())
+
+		resp, err := t.get(ctx, listURL, token)
+		if err != nil {
+			return nil, err
+		}
+
+		var listOut gcsListObjectsOutput
+
+		err = json.NewDecoder(resp.Body).Decode(&listOut)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshaling objects list: %s", err)
+		}
+
+		objects = append(objects, listOut.Items...)
+
+		if len(listOut.NextPageToken) == 0 {
+			return objects, nil
+		}
+		pageToken = listOut.NextPageToken
+	}
+}
+
+func (t *Sync) downloadObject(ctx context.Context, obj gcsObject, dstPath, token string) error {
+	err := os.MkdirAll(filepath.Dir(dstPath), 0700)
+	if err != nil {
+		return fmt.Errorf("Making intermediate dir: %s", err)
+	}
+
+	// Pin generation to make sure object did not change since it was listed
+	downloadURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media&generation=%s", t.endpoint(),
+		url.PathEscape(t.opts.Bucket), url.PathEscape(obj.Name), url.QueryEscape(obj.Generation))
+
+	resp, err := t.get(ctx, downloadURL, token)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	file, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("Creating file: %s", err)
+	}
+
+	defer file.Close()
+
+	hash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+
+	_, err = io.Copy(io.MultiWriter(file, hash, ctlfetch.NewBytesProgressWriter(ctx)), ctlfetch.NewRateLimitedReader(ctx, resp.Body))
+	if err != nil {
+		return fmt.Errorf("Writing object: %s", err)
+	}
+
+	if len(obj.CRC32C) > 0 {
+		sumBs := make([]byte, 4)
+		binary.BigEndian.PutUint32(sumBs, hash.Sum32())
+
+		actualCRC32C := base64.StdEncoding.EncodeToString(sumBs)
+		if actualCRC32C != obj.CRC32C {
+			return fmt.Errorf("Expected CRC32C '%s' but was '%s'", obj.CRC32C, actualCRC32C)
+		}
+	}
+
+	return nil
+}
+
+func (t *Sync) get(ctx context.Context, reqURL, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Building request: %s", err)
+	}
+
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := t.proxy.HTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf("Expected 200 OK, but was '%s' (body: %s)", resp.Status, body))
+	}
+
+	return resp, nil
+}
+
+func (t *Sync) endpoint() string {
+	if len(t.opts.Endpoint) > 0 {
+		return strings.TrimSuffix(t.opts.Endpoint, "/")
+	}
+	return defaultEndpoint
+}
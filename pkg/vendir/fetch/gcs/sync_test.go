@@ -0,0 +1,275 @@
+package gcs_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlgcs "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/gcs"
+)
+
+const (
+	testToken   = "test-access-token"
+	testContent = "content"
+)
+
+func TestSyncWithServiceAccountKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Generating key: %s", err)
+	}
+
+	keyBs, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Marshaling key: %s", err)
+	}
+
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("Expected jwt-bearer grant type, but was '%s'", r.FormValue("grant_type"))
+		}
+
+		claims, err := verifiedJWTClaims(r.FormValue("assertion"), &key.PublicKey)
+		if err != nil {
+			t.Errorf("Expected valid assertion: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if claims["iss"] != "sa@project.iam.gserviceaccount.com" || claims["aud"] != "http://"+r.Host+"/token" ||
+			claims["scope"] != "https://www.googleapis.com/auth/devstorage.read_only" {
+			t.Errorf("Expected assertion claims to match, but was: %#v", claims)
+		}
+
+		writeToken(w)
+	})
+	defer server.Close()
+
+	creds := fmt.Sprintf(`{"type":"service_account","client_email":"sa@project.iam.gserviceaccount.com",`+
+		`"private_key_id":"key-id","private_key":%q,"token_uri":"%s/token"}`,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBs}), server.URL)
+
+	expectSuccessfulSync(t, server, creds)
+}
+
+func TestSyncWithAuthorizedUser(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("client_id") != "client-id" ||
+			r.FormValue("client_secret") != "client-secret" || r.FormValue("refresh_token") != "refresh-token" {
+			t.Errorf("Expected refresh token form, but was: %#v", r.PostForm)
+		}
+		writeToken(w)
+	})
+	defer server.Close()
+
+	creds := fmt.Sprintf(`{"type":"authorized_user","client_id":"client-id","client_secret":"client-secret",`+
+		`"refresh_token":"refresh-token","token_uri":"%s/token"}`, server.URL)
+
+	expectSuccessfulSync(t, server, creds)
+}
+
+func TestSyncCredentialsErrors(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+	})
+	defer server.Close()
+
+	tests := []struct {
+		creds       string
+		expectedErr string
+	}{
+		{
+			creds:       fmt.Sprintf(`{"type":"authorized_user","refresh_token":"refresh-token","token_uri":"%s/token"}`, server.URL),
+			expectedErr: `Obtaining access token: Expected 200 OK, but was '401 Unauthorized' (body: {"error":"invalid_grant"})`,
+		},
+		{
+			creds:       `{"type":"external_account"}`,
+			expectedErr: "Obtaining access token: Unsupported credentials type 'external_account'",
+		},
+		{
+			creds:       `{"type":"service_account","private_key":"not-pem"}`,
+			expectedErr: "Obtaining access token: Expected service account private key to be PEM encoded",
+		},
+		{
+			creds:       `not-json`,
+			expectedErr: "Obtaining access token: Unmarshaling credentials: ",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := syncWithCredentials(t, server, test.creds)
+		if err == nil || !strings.HasPrefix(err.Error(), test.expectedErr) {
+			t.Fatalf("Expected error '%s', but was: %v", test.expectedErr, err)
+		}
+	}
+}
+
+func expectSuccessfulSync(t *testing.T, server *httptest.Server, creds string) {
+	lockConf, err := syncWithCredentials(t, server, creds)
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if len(lockConf.Objects) != 1 || lockConf.Objects[0].Name != "prefix/file.txt" || lockConf.Objects[0].Generation != "1" {
+		t.Fatalf("Expected object to be recorded in lock, but was: %#v", lockConf)
+	}
+}
+
+func syncWithCredentials(t *testing.T, server *httptest.Server, creds string) (ctlconf.LockDirectoryContentsGCS, error) {
+	dir, err := ioutil.TempDir("", "vendir-gcs-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := ctlconf.DirectoryContentsGCS{
+		Bucket:    "bucket",
+		Prefix:    "prefix/",
+		Endpoint:  server.URL,
+		SecretRef: &ctlconf.DirectoryContentsLocalRef{Name: "gcs-creds"},
+	}
+	refFetcher := testRefFetcher{ctlconf.Secret{
+		Metadata: ctlconf.GenericMetadata{Name: "gcs-creds"},
+		Data:     map[string][]byte{ctlconf.SecretGCSServiceAccountJSON: []byte(creds)},
+	}}
+	dstPath := filepath.Join(dir, "dst")
+
+	lockConf, err := ctlgcs.NewSync(opts, refFetcher, ctlfetch.ProxyOpts{}).Sync(context.Background(), dstPath, testTempArea{dir})
+	if err != nil {
+		return lockConf, err
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dstPath, "file.txt"))
+	if err != nil || string(bs) != testContent {
+		t.Fatalf("Expected downloaded content to match: %v", err)
+	}
+
+	return lockConf, nil
+}
+
+// newTestServer serves token endpoint via given handler and
+// storage API for a single object that requires issued token
+func newTestServer(t *testing.T, tokenHandler http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			t.Errorf("Expected form POST, but was '%s' with '%s'", r.Method, r.Header.Get("Content-Type"))
+		}
+		tokenHandler(w, r)
+	})
+	mux.HandleFunc("/storage/v1/b/bucket/o", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		sumBs := make([]byte, 4)
+		binary.BigEndian.PutUint32(sumBs, crc32.Checksum([]byte(testContent), crc32.MakeTable(crc32.Castagnoli)))
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items": []map[string]string{{
+				"name":       "prefix/file.txt",
+				"generation": "1",
+				"crc32c":     base64.StdEncoding.EncodeToString(sumBs),
+			}},
+		})
+	})
+	mux.HandleFunc("/storage/v1/b/bucket/o/prefix/file.txt", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		if r.URL.Query().Get("alt") != "media" || r.URL.Query().Get("generation") != "1" {
+			t.Errorf("Expected pinned generation download, but was: %s", r.URL)
+		}
+		w.Write([]byte(testContent))
+	})
+	return httptest.NewServer(mux)
+}
+
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func writeToken(w http.ResponseWriter) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": testToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func verifiedJWTClaims(assertion string, key *rsa.PublicKey) (map[string]interface{}, error) {
+	pieces := strings.Split(assertion, ".")
+	if len(pieces) != 3 {
+		return nil, fmt.Errorf("Expected 3 pieces, but was %d", len(pieces))
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(pieces[2])
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(pieces[0] + "." + pieces[1]))
+
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+	if err != nil {
+		return nil, err
+	}
+
+	claimsBs, err := base64.RawURLEncoding.DecodeString(pieces[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+
+	err = json.Unmarshal(claimsBs, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+type testRefFetcher struct {
+	secret ctlconf.Secret
+}
+
+func (f testRefFetcher) GetSecret(string) (ctlconf.Secret, error) { return f.secret, nil }
+
+func (f testRefFetcher) GetConfigMap(string) (ctlconf.ConfigMap, error) {
+	return ctlconf.ConfigMap{}, fmt.Errorf("Not found")
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
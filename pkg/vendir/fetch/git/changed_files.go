@@ -0,0 +1,91 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// keepChangedFiles removes checked out files that did not change
+// (or were deleted) since configured ref and returns resolved SHA of that ref
+func (t *Git) keepChangedFiles(ctx context.Context, dstPath string) (string, error) {
+	out, _, err := t.run(ctx, []string{"rev-parse", "--verify", t.opts.ChangedFrom + "^{commit}"}, nil, dstPath)
+	if err != nil {
+		hintMsg := ""
+		if t.opts.Depth > 0 {
+			hintMsg = " (hint: ref may not be part of shallow history; consider increasing depth)"
+		}
+		return "", fmt.Errorf("Resolving changed from ref '%s': %s%s", t.opts.ChangedFrom, err, hintMsg)
+	}
+
+	fromSHA := strings.TrimSpace(out)
+
+	out, _, err = t.run(ctx, []string{"-c", "core.quotePath=false", "diff", "--name-only",
+		"--no-renames", "--diff-filter=d", fromSHA, "HEAD"}, nil, dstPath)
+	if err != nil {
+		return "", err
+	}
+
+	changedPaths := map[string]struct{}{}
+
+	for _, path := range strings.Split(out, "\n") {
+		if len(path) > 0 {
+			changedPaths[path] = struct{}{}
+		}
+	}
+
+	var dirPaths []string
+
+	err = filepath.Walk(dstPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dstPath, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == ".git" {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() {
+			if relPath != "." {
+				dirPaths = append(dirPaths, path)
+			}
+			return nil
+		}
+
+		if _, found := changedPaths[filepath.ToSlash(relPath)]; found {
+			return nil
+		}
+
+		return os.Remove(path)
+	})
+	if err != nil {
+		return "", fmt.Errorf("Removing unchanged files: %s", err)
+	}
+
+	// Remove directories left empty starting with the deepest ones
+	sort.Sort(sort.Reverse(sort.StringSlice(dirPaths)))
+
+	for _, path := range dirPaths {
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return "", fmt.Errorf("Reading directory '%s': %s", path, err)
+		}
+		if len(files) == 0 {
+			err = os.Remove(path)
+			if err != nil {
+				return "", fmt.Errorf("Removing empty directory '%s': %s", path, err)
+			}
+		}
+	}
+
+	return fromSHA, nil
+}
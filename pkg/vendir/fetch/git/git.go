@@ -2,6 +2,7 @@ package git
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,7 +10,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
 	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
@@ -20,68 +23,261 @@ type Git struct {
 	opts       ctlconf.DirectoryContentsGit
 	infoLog    io.Writer
 	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
 }
 
 func NewGit(opts ctlconf.DirectoryContentsGit,
-	infoLog io.Writer, refFetcher ctlfetch.RefFetcher) *Git {
+	infoLog io.Writer, refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) *Git {
 
-	return &Git{opts, infoLog, refFetcher}
+	return &Git{opts, infoLog, refFetcher, proxy}
 }
 
 type GitInfo struct {
 	SHA         string
 	Tags        []string
 	CommitTitle string
+	// Committer date in RFC3339 format (UTC)
+	CommitTimestamp string
+	// Only set when verification is configured
+	VerifiedKeyFingerprint string
+	// Only set when changed from ref is configured
+	ChangedFromSHA string
+	// Only set when ref fallbacks are configured
+	Ref string
 }
 
-func (t *Git) Retrieve(dstPath string, tempArea ctlfetch.TempArea) (GitInfo, error) {
+func (t *Git) Retrieve(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (GitInfo, error) {
 	if len(t.opts.URL) == 0 {
 		return GitInfo{}, fmt.Errorf("Expected non-empty URL")
 	}
 
-	err := t.fetch(dstPath, tempArea)
+	ref, verifiedKeyFingerprint, err := t.fetch(ctx, dstPath, tempArea)
 	if err != nil {
 		return GitInfo{}, err
 	}
 
-	info := GitInfo{}
+	info := GitInfo{VerifiedKeyFingerprint: verifiedKeyFingerprint}
 
-	out, _, err := t.run([]string{"rev-parse", "HEAD"}, nil, dstPath)
+	if len(t.opts.RefFallbacks) > 0 {
+		info.Ref = ref
+	}
+
+	headRef := "HEAD"
+	if len(t.opts.File) > 0 {
+		// Ref is not checked out when fetching single file
+		headRef = ref + "^{commit}"
+	}
+
+	out, _, err := t.run(ctx, []string{"rev-parse", headRef}, nil, dstPath)
 	if err != nil {
 		return GitInfo{}, err
 	}
 
 	info.SHA = strings.TrimSpace(out)
 
-	out, _, err = t.run([]string{"describe", "--tags", info.SHA}, nil, dstPath)
-	if err == nil {
-		info.Tags = strings.Split(strings.TrimSpace(out), "\n")
+	if len(t.opts.Ref) == 0 && t.opts.RefSelection != nil {
+		// Record selected tag since describe may pick other tag pointing to same commit
+		info.Tags = []string{ref}
+	} else {
+		out, _, err = t.run(ctx, []string{"describe", "--tags", info.SHA}, nil, dstPath)
+		if err == nil {
+			info.Tags = strings.Split(strings.TrimSpace(out), "\n")
+		}
 	}
 
-	out, _, err = t.run([]string{"log", "-n", "1", "--pretty=%B", info.SHA}, nil, dstPath)
-	if err != nil {
-		return GitInfo{}, err
+	info.CommitTitle, info.CommitTimestamp = t.commitMetadata(ctx, info.SHA, dstPath)
+
+	if len(t.opts.ChangedFrom) > 0 {
+		info.ChangedFromSHA, err = t.keepChangedFiles(ctx, dstPath)
+		if err != nil {
+			return GitInfo{}, err
+		}
 	}
 
-	info.CommitTitle = strings.TrimSpace(out)
+	if len(t.opts.File) > 0 {
+		err = t.extractFile(ctx, ref, info.SHA, dstPath)
+		if err != nil {
+			return GitInfo{}, ctlfetch.NewNonRetryableError(err)
+		}
+	}
 
 	return info, nil
 }
 
-func (t *Git) fetch(dstPath string, tempArea ctlfetch.TempArea) error {
-	authOpts, err := t.getAuthOpts()
+// commitMetadata returns commit message and committer date; both are
+// best-effort (empty) when commit object is not available locally
+func (t *Git) commitMetadata(ctx context.Context, sha, dstPath string) (string, string) {
+	out, _, err := t.run(ctx, []string{"log", "-n", "1", "--pretty=%cI%n%B", sha}, nil, dstPath)
 	if err != nil {
-		return err
+		return "", ""
+	}
+
+	pieces := strings.SplitN(out, "\n", 2)
+	if len(pieces) != 2 {
+		return "", ""
+	}
+
+	var timestamp string
+
+	committedAt, err := time.Parse(time.RFC3339, strings.TrimSpace(pieces[0]))
+	if err == nil {
+		timestamp = committedAt.UTC().Format(time.RFC3339)
+	}
+
+	return strings.TrimSpace(pieces[1]), timestamp
+}
+
+// fetch checks out configured ref and returns resolved ref and
+// fingerprint of a key that verified ref signature (if verification is configured)
+func (t *Git) fetch(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (string, string, error) {
+	if t.opts.LFS {
+		_, err := exec.LookPath("git-lfs")
+		if err != nil {
+			return "", "", ctlfetch.NewNonRetryableError(fmt.Errorf(
+				"Expected git-lfs to be installed to fetch LFS objects: %s", err))
+		}
 	}
 
 	authDir, err := tempArea.NewTempDir("git-auth")
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
 	defer os.RemoveAll(authDir)
 
-	env := os.Environ()
+	env, gitUrl, gitCredsPath, err := t.remoteEnv(authDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	if t.opts.LFSSkipSmudge {
+		env = append(env, "GIT_LFS_SKIP_SMUDGE=1")
+	}
+
+	fetchArgs := []string{"fetch", "origin"}
+
+	if t.opts.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(t.opts.Depth))
+		if t.opts.RefSelection != nil {
+			// Shallow fetch only follows tags reachable within fetched history
+			fetchArgs = append(fetchArgs, "--tags")
+		}
+	}
+
+	err = t.runMultiple(ctx, [][]string{{"init"}}, env, dstPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Objects found in reference repository are not fetched
+	usesReferenceRepo := len(t.opts.ReferenceRepo) > 0 && t.addReferenceRepo(dstPath)
+
+	argss := [][]string{
+		{"config", "credential.helper", "store --file " + gitCredsPath},
+		{"remote", "add", "origin", gitUrl},
+	}
+
+	err = t.runMultiple(ctx, argss, env, dstPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = t.fetchObjects(ctx, fetchArgs, env, dstPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	ref, err := t.resolveRef(ctx, dstPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	if t.opts.Depth > 0 {
+		// Ref (e.g. older commit SHA) may not be part of shallow history
+		_, _, err := t.run(ctx, []string{"cat-file", "-e", ref + "^{commit}"}, env, dstPath)
+		if err != nil {
+			err = t.runMultiple(ctx, [][]string{{"fetch", "--unshallow", "origin"}}, env, dstPath)
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	var verifiedKeyFingerprint string
+
+	if t.opts.Verification != nil {
+		verifiedKeyFingerprint, err = Verification{dstPath, *t.opts.Verification, t.refFetcher}.Verify(ctx, ref)
+		if err != nil {
+			return "", "", ctlfetch.NewNonRetryableError(err)
+		}
+	}
+
+	if len(t.opts.File) > 0 {
+		// Single file is read directly from git objects without checkout
+		return ref, verifiedKeyFingerprint, nil
+	}
+
+	if len(t.opts.SparseCheckout) > 0 {
+		args := append([]string{"sparse-checkout", "set", "--cone"}, t.opts.SparseCheckout...)
+
+		_, _, err := t.run(ctx, args, env, dstPath)
+		if err != nil {
+			// Older git versions (<2.27) do not support sparse-checkout command
+			t.infoLog.Write([]byte(fmt.Sprintf("Warning: Falling back to full checkout since "+
+				"sparse checkout could not be configured: %s\n", err)))
+		}
+	}
+
+	argss = [][]string{
+		// TODO following causes rev-parse HEAD to fail:
+		// {"checkout", t.opts.Ref, "--recurse-submodules", "."},
+		{"-c", "advice.detachedHead=false", "checkout", ref},
+	}
+
+	if t.opts.SubmodulesEnabled() {
+		// Submodules are cloned as separate repositories hence do not see
+		// credential helper configured above; -c is passed down to them
+		argss = append(argss, []string{"-c", "credential.helper=store --file " + gitCredsPath,
+			"submodule", "update", "--init", "--recursive"})
+	}
+
+	if t.opts.LFS {
+		// Replaces LFS pointer files unless they were already
+		// smudged during checkout (i.e. LFS filters are installed globally)
+		argss = append(argss, []string{"lfs", "pull", "origin"})
+	}
+
+	err = t.runMultiple(ctx, argss, env, dstPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	if usesReferenceRepo && t.opts.KeepGitDir {
+		// Kept repository should not depend on reference repository
+		err = t.dissociateReferenceRepo(ctx, env, dstPath)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return ref, verifiedKeyFingerprint, nil
+}
+
+// remoteEnv configures authentication for remote repository (files are
+// written into authDir) and returns environment, remote URL and credentials path
+func (t *Git) remoteEnv(authDir string) ([]string, string, string, error) {
+	var authOpts gitAuthOpts
+	var err error
+
+	// Local repositories are read directly hence do not need credentials
+	if !t.isLocalURL() {
+		authOpts, err = t.getAuthOpts()
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	env := append(os.Environ(), t.proxy.Env()...)
 
 	if authOpts.IsPresent() {
 		sshCmd := []string{"ssh", "-o", "ServerAliveInterval=30", "-o", "ForwardAgent=no", "-F", "/dev/null"}
@@ -91,10 +287,18 @@ func (t *Git) fetch(dstPath string, tempArea ctlfetch.TempArea) error {
 
 			err = ioutil.WriteFile(path, []byte(*authOpts.PrivateKey), 0600)
 			if err != nil {
-				return fmt.Errorf("Writing private key: %s", err)
+				return nil, "", "", fmt.Errorf("Writing private key: %s", err)
 			}
 
 			sshCmd = append(sshCmd, "-i", path, "-o", "IdentitiesOnly=yes")
+
+			if authOpts.Passphrase != nil {
+				askPassEnv, err := t.askPassEnv(authDir, *authOpts.Passphrase)
+				if err != nil {
+					return nil, "", "", err
+				}
+				env = append(env, askPassEnv...)
+			}
 		}
 
 		if authOpts.KnownHosts != nil {
@@ -102,7 +306,7 @@ func (t *Git) fetch(dstPath string, tempArea ctlfetch.TempArea) error {
 
 			err = ioutil.WriteFile(path, []byte(*authOpts.KnownHosts), 0600)
 			if err != nil {
-				return fmt.Errorf("Writing known hosts: %s", err)
+				return nil, "", "", fmt.Errorf("Writing known hosts: %s", err)
 			}
 
 			sshCmd = append(sshCmd, "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile="+path)
@@ -113,21 +317,21 @@ func (t *Git) fetch(dstPath string, tempArea ctlfetch.TempArea) error {
 		env = append(env, "GIT_SSH_COMMAND="+strings.Join(sshCmd, " "))
 	}
 
-	if t.opts.LFSSkipSmudge {
-		env = append(env, "GIT_LFS_SKIP_SMUDGE=1")
+	gitUrl, err := t.remoteURL()
+	if err != nil {
+		return nil, "", "", err
 	}
 
-	gitUrl := t.opts.URL
 	gitCredsPath := filepath.Join(authDir, ".git-credentials")
 
 	if authOpts.Username != nil && authOpts.Password != nil {
 		if !strings.HasPrefix(gitUrl, "https://") {
-			return fmt.Errorf("Username/password authentication is only supported for https remotes")
+			return nil, "", "", fmt.Errorf("Username/password authentication is only supported for https remotes")
 		}
 
 		gitCredsUrl, err := url.Parse(gitUrl)
 		if err != nil {
-			return fmt.Errorf("Parsing git remote url: %s", err)
+			return nil, "", "", fmt.Errorf("Parsing git remote url: %s", err)
 		}
 
 		gitCredsUrl.User = url.UserPassword(*authOpts.Username, *authOpts.Password)
@@ -135,47 +339,116 @@ func (t *Git) fetch(dstPath string, tempArea ctlfetch.TempArea) error {
 
 		err = ioutil.WriteFile(gitCredsPath, []byte(gitCredsUrl.String()+"\n"), 0600)
 		if err != nil {
-			return fmt.Errorf("Writing %s: %s", gitCredsPath, err)
+			return nil, "", "", fmt.Errorf("Writing %s: %s", gitCredsPath, err)
 		}
 	}
 
-	argss := [][]string{
-		{"init"},
-		{"config", "credential.helper", "store --file " + gitCredsPath},
-		{"remote", "add", "origin", gitUrl},
-		{"fetch", "origin"},
+	return env, gitUrl, gitCredsPath, nil
+}
+
+// addReferenceRepo configures objects of reference repository as alternates
+// (equivalent of clone --reference); returns false if it could not be used
+func (t *Git) addReferenceRepo(dstPath string) bool {
+	objectsPath, err := t.referenceRepoObjectsPath()
+	if err == nil {
+		alternatesPath := filepath.Join(dstPath, ".git", "objects", "info", "alternates")
+
+		err = os.MkdirAll(filepath.Dir(alternatesPath), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(alternatesPath, []byte(objectsPath+"\n"), 0644)
+		}
 	}
+	if err != nil {
+		t.infoLog.Write([]byte(fmt.Sprintf("Warning: Fetching without reference repository "+
+			"since '%s' could not be used: %s\n", t.opts.ReferenceRepo, err)))
+		return false
+	}
+	return true
+}
 
-	err = t.runMultiple(argss, env, dstPath)
+func (t *Git) referenceRepoObjectsPath() (string, error) {
+	repoPath, err := filepath.Abs(t.opts.ReferenceRepo)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	// Reference repository may be bare (e.g. created by clone --mirror)
+	for _, path := range []string{filepath.Join(repoPath, ".git", "objects"), filepath.Join(repoPath, "objects")} {
+		fi, err := os.Stat(path)
+		if err == nil && fi.IsDir() {
+			return path, nil
+		}
 	}
 
-	ref, err := t.resolveRef(dstPath)
+	return "", fmt.Errorf("Expected git repository with objects directory")
+}
+
+// dissociateReferenceRepo copies borrowed objects (equivalent of clone --dissociate)
+func (t *Git) dissociateReferenceRepo(ctx context.Context, env []string, dstPath string) error {
+	err := t.runMultiple(ctx, [][]string{{"repack", "-a", "-d"}}, env, dstPath)
 	if err != nil {
 		return err
 	}
 
-	if t.opts.Verification != nil {
-		err := Verification{dstPath, *t.opts.Verification, t.refFetcher}.Verify(ref)
-		if err != nil {
-			return err
-		}
+	err = os.Remove(filepath.Join(dstPath, ".git", "objects", "info", "alternates"))
+	if err != nil {
+		return fmt.Errorf("Removing alternates: %s", err)
 	}
 
-	argss = [][]string{
-		// TODO following causes rev-parse HEAD to fail:
-		// {"checkout", t.opts.Ref, "--recurse-submodules", "."},
-		{"-c", "advice.detachedHead=false", "checkout", ref},
-		{"submodule", "update", "--init", "--recursive"},
-		// TODO shallow clones?
+	return nil
+}
+
+// isLocalURL returns true for file:// URLs and local paths
+func (t *Git) isLocalURL() bool {
+	return strings.HasPrefix(t.opts.URL, "file://") || IsLocalPath(t.opts.URL)
+}
+
+// IsLocalPath returns true for URLs that are local paths
+// (as opposed to scp-like syntax, e.g. git@github.com:org/repo)
+func IsLocalPath(gitURL string) bool {
+	if strings.Contains(gitURL, "://") {
+		return false
+	}
+
+	colonIdx := strings.Index(gitURL, ":")
+	slashIdx := strings.Index(gitURL, "/")
+
+	return colonIdx == -1 || (slashIdx != -1 && slashIdx < colonIdx)
+}
+
+// remoteURL makes local paths absolute since git commands
+// are executed within destination directory
+func (t *Git) remoteURL() (string, error) {
+	if !IsLocalPath(t.opts.URL) {
+		return t.opts.URL, nil
+	}
+
+	path, err := filepath.Abs(t.opts.URL)
+	if err != nil {
+		return "", fmt.Errorf("Expanding local git repository path: %s", err)
 	}
 
-	return t.runMultiple(argss, env, dstPath)
+	return path, nil
 }
 
-func (t *Git) resolveRef(dstPath string) (string, error) {
+func (t *Git) resolveRef(ctx context.Context, dstPath string) (string, error) {
 	switch {
+	case len(t.opts.Ref) > 0 && len(t.opts.RefFallbacks) > 0:
+		refs := append([]string{t.opts.Ref}, t.opts.RefFallbacks...)
+
+		for _, ref := range refs {
+			_, _, err := t.run(ctx, []string{"rev-parse", "--verify", "--quiet", ref + "^{commit}"}, nil, dstPath)
+			if err == nil {
+				if ref != t.opts.Ref {
+					t.infoLog.Write([]byte(fmt.Sprintf("Warning: Using fallback ref '%s' since ref '%s' could not be resolved\n", ref, t.opts.Ref)))
+				}
+				return ref, nil
+			}
+		}
+
+		return "", ctlfetch.NewNonRetryableError(fmt.Errorf(
+			"Expected to resolve one of refs '%s', but did not", strings.Join(refs, "', '")))
+
 	case len(t.opts.Ref) > 0:
 		return t.opts.Ref, nil
 
@@ -184,26 +457,12 @@ func (t *Git) resolveRef(dstPath string) (string, error) {
 
 		switch {
 		case refSel.Semver != nil:
-			tags, err := t.tags(dstPath)
+			tags, err := t.tags(ctx, dstPath)
 			if err != nil {
 				return "", err
 			}
 
-			matchedVers := ctlver.NewSemvers(tags).FilterPrereleases(refSel.Semver.Prereleases)
-
-			if len(refSel.Semver.Constraints) > 0 {
-				matchedVers, err = matchedVers.FilterConstraints(refSel.Semver.Constraints)
-				if err != nil {
-					return "", fmt.Errorf("Selecting versions: %s", err)
-				}
-			}
-
-			highestVersion, found := matchedVers.Highest()
-			if !found {
-				return "", fmt.Errorf("Expected to find at least one version, but did not")
-			}
-
-			return highestVersion, nil
+			return t.selectSemverTag(tags)
 
 		default:
 			return "", fmt.Errorf("Unknown ref selection strategy")
@@ -214,8 +473,37 @@ func (t *Git) resolveRef(dstPath string) (string, error) {
 	}
 }
 
-func (t *Git) tags(dstPath string) ([]string, error) {
-	out, _, err := t.run([]string{"tag", "-l"}, nil, dstPath)
+func (t *Git) selectSemverTag(tags []string) (string, error) {
+	refSel := t.opts.RefSelection
+
+	allVers := ctlver.NewSemvers(tags)
+	matchedVers := allVers.FilterPrereleases(refSel.Semver.Prereleases)
+
+	if len(refSel.Semver.Constraints) > 0 {
+		var err error
+
+		matchedVers, err = matchedVers.FilterConstraints(refSel.Semver.Constraints)
+		if err != nil {
+			return "", fmt.Errorf("Selecting versions: %s", err)
+		}
+	}
+
+	highestVersion, found := matchedVers.Highest()
+	if !found {
+		consideredTags := strings.Join(allVers.Sorted().All(), ", ")
+		if len(consideredTags) == 0 {
+			consideredTags = "none"
+		}
+		return "", ctlfetch.NewNonRetryableError(fmt.Errorf(
+			"Expected to find at least one version matching constraints '%s', but did not (considered tags: %s)",
+			refSel.Semver.Constraints, consideredTags))
+	}
+
+	return highestVersion, nil
+}
+
+func (t *Git) tags(ctx context.Context, dstPath string) ([]string, error) {
+	out, _, err := t.run(ctx, []string{"tag", "-l"}, nil, dstPath)
 	if err != nil {
 		return nil, err
 	}
@@ -223,9 +511,35 @@ func (t *Git) tags(dstPath string) ([]string, error) {
 	return strings.Split(out, "\n"), nil
 }
 
-func (t *Git) runMultiple(argss [][]string, env []string, dstPath string) error {
+// fetchObjects fetches with configured partial clone filter (if any) so that
+// blobs (or trees) are only fetched lazily when needed by checkout.
+// Servers without partial clone support ignore filter (with a warning);
+// older git versions that do not know filter option fall back to full fetch.
+func (t *Git) fetchObjects(ctx context.Context, fetchArgs []string, env []string, dstPath string) error {
+	if len(t.opts.Filter) == 0 {
+		return t.runMultiple(ctx, [][]string{fetchArgs}, env, dstPath)
+	}
+
+	filterFetchArgs := append(append([]string{}, fetchArgs...), "--filter="+t.opts.Filter)
+
+	_, _, err := t.run(ctx, filterFetchArgs, env, dstPath)
+	if err != nil {
+		if !strings.Contains(err.Error(), "unknown option") {
+			return err
+		}
+
+		t.infoLog.Write([]byte(fmt.Sprintf("Warning: Falling back to full fetch since "+
+			"partial clone filter is not supported: %s\n", err)))
+
+		return t.runMultiple(ctx, [][]string{fetchArgs}, env, dstPath)
+	}
+
+	return nil
+}
+
+func (t *Git) runMultiple(ctx context.Context, argss [][]string, env []string, dstPath string) error {
 	for _, args := range argss {
-		_, _, err := t.run(args, env, dstPath)
+		_, _, err := t.run(ctx, args, env, dstPath)
 		if err != nil {
 			return err
 		}
@@ -233,7 +547,7 @@ func (t *Git) runMultiple(argss [][]string, env []string, dstPath string) error
 	return nil
 }
 
-func (t *Git) run(args []string, env []string, dstPath string) (string, string, error) {
+func (t *Git) run(ctx context.Context, args []string, env []string, dstPath string) (string, string, error) {
 	var stdoutBs, stderrBs bytes.Buffer
 
 	cmd := exec.Command("git", args...)
@@ -244,7 +558,7 @@ func (t *Git) run(args []string, env []string, dstPath string) (string, string,
 
 	t.infoLog.Write([]byte(fmt.Sprintf("--> git %s\n", strings.Join(args, " "))))
 
-	err := cmd.Run()
+	err := ctlfetch.RunCommand(ctx, cmd)
 	if err != nil {
 		return "", "", fmt.Errorf("Git %s: %s (stderr: %s)", args, err, stderrBs.String())
 	}
@@ -252,8 +566,29 @@ func (t *Git) run(args []string, env []string, dstPath string) (string, string,
 	return stdoutBs.String(), stderrBs.String(), nil
 }
 
+// askPassEnv configures ssh to non-interactively obtain
+// private key passphrase via SSH_ASKPASS program (requires OpenSSH 8.4+)
+func (t *Git) askPassEnv(authDir, passphrase string) ([]string, error) {
+	passphrasePath := filepath.Join(authDir, "private-key-passphrase")
+
+	err := ioutil.WriteFile(passphrasePath, []byte(passphrase), 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Writing private key passphrase: %s", err)
+	}
+
+	askPassPath := filepath.Join(authDir, "ssh-askpass")
+
+	err = ioutil.WriteFile(askPassPath, []byte("#!/bin/sh\ncat '"+passphrasePath+"'\n"), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("Writing ssh askpass program: %s", err)
+	}
+
+	return []string{"SSH_ASKPASS=" + askPassPath, "SSH_ASKPASS_REQUIRE=force", "DISPLAY=vendir:0"}, nil
+}
+
 type gitAuthOpts struct {
 	PrivateKey *string
+	Passphrase *string
 	KnownHosts *string
 	Username   *string
 	Password   *string
@@ -277,6 +612,9 @@ func (t *Git) getAuthOpts() (gitAuthOpts, error) {
 			case ctlconf.SecretK8sCoreV1SSHAuthPrivateKey:
 				key := string(val)
 				opts.PrivateKey = &key
+			case ctlconf.SecretSSHAuthPassphrase:
+				passphrase := string(val)
+				opts.Passphrase = &passphrase
 			case ctlconf.SecretSSHAuthKnownHosts:
 				hosts := string(val)
 				opts.KnownHosts = &hosts
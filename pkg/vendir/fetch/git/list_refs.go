@@ -0,0 +1,52 @@
+package git
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlver "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/versions"
+)
+
+// ListRefs returns tags (highest version first) followed by branches
+// (as origin/<name>) of remote repository without fetching any objects;
+// returned values can be used as ref
+func (t *Git) ListRefs(ctx context.Context, tempArea ctlfetch.TempArea) ([]string, error) {
+	authDir, err := tempArea.NewTempDir("git-auth")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(authDir)
+
+	env, gitUrl, gitCredsPath, err := t.remoteEnv(authDir)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-c", "credential.helper=store --file " + gitCredsPath,
+		"ls-remote", "--tags", "--heads", "--refs", gitUrl}
+
+	out, _, err := t.run(ctx, args, env, authDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags, branches []string
+
+	for _, line := range strings.Split(out, "\n") {
+		pieces := strings.Fields(line)
+		if len(pieces) != 2 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(pieces[1], "refs/tags/"):
+			tags = append(tags, strings.TrimPrefix(pieces[1], "refs/tags/"))
+		case strings.HasPrefix(pieces[1], "refs/heads/"):
+			branches = append(branches, "origin/"+strings.TrimPrefix(pieces[1], "refs/heads/"))
+		}
+	}
+
+	return append(ctlver.SortedWithOthers(tags), branches...), nil
+}
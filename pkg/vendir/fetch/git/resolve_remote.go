@@ -0,0 +1,192 @@
+package git
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const peeledRefSuffix = "^{}"
+
+var fullSHARegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// CanResolveRemote returns true when configured ref may be resolved
+// without fetching repository (verification and changed files
+// need repository objects; fallbacks need each ref to be tried)
+func (t *Git) CanResolveRemote() bool {
+	return t.opts.Verification == nil && len(t.opts.ChangedFrom) == 0 &&
+		len(t.opts.RefFallbacks) == 0 && (len(t.opts.Ref) > 0 || t.opts.RefSelection != nil)
+}
+
+// ResolveRemote resolves configured ref to commit SHA via ls-remote without
+// fetching any objects (commit title is not available; see FetchCommitInfo). Returns false when
+// ref is not found among remote branches and tags (e.g. abbreviated SHA or
+// revision expression), in which case repository has to be fetched.
+func (t *Git) ResolveRemote(ctx context.Context, tempArea ctlfetch.TempArea) (GitInfo, bool, error) {
+	authDir, err := tempArea.NewTempDir("git-auth")
+	if err != nil {
+		return GitInfo{}, false, err
+	}
+
+	defer os.RemoveAll(authDir)
+
+	env, gitUrl, gitCredsPath, err := t.remoteEnv(authDir)
+	if err != nil {
+		return GitInfo{}, false, err
+	}
+
+	args := []string{"-c", "credential.helper=store --file " + gitCredsPath,
+		"ls-remote", "--tags", "--heads", gitUrl}
+
+	out, _, err := t.run(ctx, args, env, authDir)
+	if err != nil {
+		return GitInfo{}, false, err
+	}
+
+	refs := t.commitSHAsByRef(out)
+
+	var ref, sha string
+	var info GitInfo
+
+	switch {
+	case len(t.opts.Ref) > 0:
+		ref = t.opts.Ref
+
+		switch {
+		case fullSHARegexp.MatchString(ref):
+			sha = ref
+		case strings.HasPrefix(ref, "origin/"):
+			sha = refs["refs/heads/"+strings.TrimPrefix(ref, "origin/")]
+		default:
+			sha = refs["refs/tags/"+ref]
+		}
+
+	default:
+		var tags []string
+		for remoteRef := range refs {
+			if strings.HasPrefix(remoteRef, "refs/tags/") {
+				tags = append(tags, strings.TrimPrefix(remoteRef, "refs/tags/"))
+			}
+		}
+
+		ref, err = t.selectSemverTag(tags)
+		if err != nil {
+			return GitInfo{}, false, err
+		}
+
+		sha = refs["refs/tags/"+ref]
+		// Record selected tag since other tags may point to same commit
+		info.Tags = []string{ref}
+	}
+
+	if len(sha) == 0 {
+		return GitInfo{}, false, nil
+	}
+
+	info.SHA = sha
+
+	if len(info.Tags) == 0 {
+		info.Tags = t.tagsPointingTo(refs, sha)
+	}
+
+	return info, true, nil
+}
+
+// FetchCommitInfo fetches resolved commit with its history and tags, but
+// without trees and blobs (where server supports filtering), to record
+// the same commit title, timestamp and tags as full fetch would; returns
+// false when commit cannot be fetched by its SHA
+func (t *Git) FetchCommitInfo(ctx context.Context, sha string, tempArea ctlfetch.TempArea) (GitInfo, bool, error) {
+	authDir, err := tempArea.NewTempDir("git-auth")
+	if err != nil {
+		return GitInfo{}, false, err
+	}
+
+	defer os.RemoveAll(authDir)
+
+	dstPath, err := tempArea.NewTempDir("git-commit")
+	if err != nil {
+		return GitInfo{}, false, err
+	}
+
+	defer os.RemoveAll(dstPath)
+
+	env, gitUrl, gitCredsPath, err := t.remoteEnv(authDir)
+	if err != nil {
+		return GitInfo{}, false, err
+	}
+
+	err = t.runMultiple(ctx, [][]string{{"init"}}, env, dstPath)
+	if err != nil {
+		return GitInfo{}, false, err
+	}
+
+	// Tags (and history leading to them) are needed to describe commit
+	args := []string{"-c", "credential.helper=store --file " + gitCredsPath,
+		"fetch", "--filter=tree:0", "--tags", gitUrl, sha}
+
+	if t.opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(t.opts.Depth))
+	}
+
+	_, _, err = t.run(ctx, args, env, dstPath)
+	if err != nil {
+		if ctlfetch.IsNetworkError(err) {
+			return GitInfo{}, false, err
+		}
+		// Servers may not allow fetching unadvertised commits
+		return GitInfo{}, false, nil
+	}
+
+	info := GitInfo{SHA: sha}
+
+	out, _, err := t.run(ctx, []string{"describe", "--tags", sha}, nil, dstPath)
+	if err == nil {
+		info.Tags = strings.Split(strings.TrimSpace(out), "\n")
+	}
+
+	info.CommitTitle, info.CommitTimestamp = t.commitMetadata(ctx, sha, dstPath)
+
+	return info, true, nil
+}
+
+// commitSHAsByRef parses ls-remote output; annotated tags
+// are resolved to commits they point to via peeled refs
+func (t *Git) commitSHAsByRef(out string) map[string]string {
+	refs := map[string]string{}
+	peeledRefs := map[string]string{}
+
+	for _, line := range strings.Split(out, "\n") {
+		pieces := strings.Fields(line)
+		if len(pieces) != 2 {
+			continue
+		}
+		if strings.HasSuffix(pieces[1], peeledRefSuffix) {
+			peeledRefs[strings.TrimSuffix(pieces[1], peeledRefSuffix)] = pieces[0]
+		} else {
+			refs[pieces[1]] = pieces[0]
+		}
+	}
+
+	for ref, sha := range peeledRefs {
+		refs[ref] = sha
+	}
+
+	return refs
+}
+
+func (t *Git) tagsPointingTo(refs map[string]string, sha string) []string {
+	var tags []string
+	for ref, refSHA := range refs {
+		if refSHA == sha && strings.HasPrefix(ref, "refs/tags/") {
+			tags = append(tags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
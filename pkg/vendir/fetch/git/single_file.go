@@ -0,0 +1,78 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// extractFile places single configured file found at given commit
+// into destination directory and removes repository metadata
+func (t *Git) extractFile(ctx context.Context, ref, sha, dstPath string) error {
+	filePath := strings.TrimPrefix(path.Clean(filepath.ToSlash(t.opts.File)), "/")
+	objectRef := sha + ":" + filePath
+
+	out, _, err := t.run(ctx, []string{"ls-tree", sha, "--", filePath}, nil, dstPath)
+	if err != nil {
+		return err
+	}
+
+	// Example: 100644 blob 8ab686eafeb1f44702738c8b0f24f2567c36da6d	README.md
+	fields := strings.Fields(out)
+	if len(fields) < 2 {
+		return fmt.Errorf("Expected file '%s' to exist at ref '%s' (%s), but did not", filePath, ref, sha)
+	}
+	if fields[1] != "blob" {
+		return fmt.Errorf("Expected '%s' at ref '%s' (%s) to be a file, but was %s", filePath, ref, sha, fields[1])
+	}
+
+	fileMode := os.FileMode(0644)
+	if fields[0] == "100755" {
+		fileMode = 0755
+	}
+
+	dstFilePath := filepath.Join(dstPath, path.Base(filePath))
+	gitDirPath := filepath.Join(dstPath, ".git")
+
+	// File name may collide with repository metadata directory
+	tmpFilePath := gitDirPath + "-vendir-file"
+
+	file, err := os.OpenFile(tmpFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fileMode)
+	if err != nil {
+		return fmt.Errorf("Creating file: %s", err)
+	}
+
+	var stderrBs bytes.Buffer
+
+	cmd := exec.Command("git", "cat-file", "blob", objectRef)
+	cmd.Dir = dstPath
+	cmd.Stdout = file
+	cmd.Stderr = &stderrBs
+
+	t.infoLog.Write([]byte(fmt.Sprintf("--> git cat-file blob %s\n", objectRef)))
+
+	err = ctlfetch.RunCommand(ctx, cmd)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("Git [cat-file blob %s]: %s (stderr: %s)", objectRef, err, stderrBs.String())
+	}
+
+	err = os.RemoveAll(gitDirPath)
+	if err != nil {
+		return fmt.Errorf("Deleting git metadata: %s", err)
+	}
+
+	err = os.Rename(tmpFilePath, dstFilePath)
+	if err != nil {
+		return fmt.Errorf("Moving file: %s", err)
+	}
+
+	return nil
+}
@@ -1,9 +1,11 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
@@ -14,12 +16,13 @@ type Sync struct {
 	opts       ctlconf.DirectoryContentsGit
 	log        io.Writer
 	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
 }
 
 func NewSync(opts ctlconf.DirectoryContentsGit,
-	log io.Writer, refFetcher ctlfetch.RefFetcher) Sync {
+	log io.Writer, refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) Sync {
 
-	return Sync{opts, log, refFetcher}
+	return Sync{opts, log, refFetcher, proxy}
 }
 
 func (d Sync) Desc() string {
@@ -36,7 +39,61 @@ func (d Sync) Desc() string {
 	return fmt.Sprintf("%s@%s", d.opts.URL, ref)
 }
 
-func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGit, error) {
+// ListRefs returns refs available in repository without fetching it
+func (d Sync) ListRefs(ctx context.Context, tempArea ctlfetch.TempArea) ([]string, error) {
+	return NewGit(d.opts, d.log, d.refFetcher, d.proxy).ListRefs(ctx, tempArea)
+}
+
+// Resolve returns lock config with commit SHA resolved without fetching
+// repository contents (only commits and tags are fetched to record
+// same commit title, timestamp and tags as Sync); returns false
+// when repository has to be fetched to resolve configured ref
+func (d Sync) Resolve(ctx context.Context, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGit, bool, error) {
+	git := NewGit(d.opts, d.log, d.refFetcher, d.proxy)
+
+	lockConf, resolved, err := d.resolveSHA(ctx, git, tempArea)
+	if err != nil || !resolved {
+		return lockConf, false, err
+	}
+
+	info, fetched, err := git.FetchCommitInfo(ctx, lockConf.SHA, tempArea)
+	if err != nil {
+		return ctlconf.LockDirectoryContentsGit{}, false, fmt.Errorf("Fetching git commit: %w", err)
+	}
+	if !fetched {
+		return ctlconf.LockDirectoryContentsGit{}, false, nil
+	}
+
+	// Selected tag is recorded as is (same as when fetching repository)
+	if d.opts.RefSelection == nil || len(d.opts.Ref) > 0 {
+		lockConf.Tags = info.Tags
+	}
+	lockConf.CommitTitle = d.singleLineCommitTitle(info.CommitTitle)
+	lockConf.CommitTimestamp = info.CommitTimestamp
+
+	return lockConf, true, nil
+}
+
+// ResolveSHA is similar to Resolve but only records
+// commit SHA and tags (nothing is fetched)
+func (d Sync) ResolveSHA(ctx context.Context, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGit, bool, error) {
+	return d.resolveSHA(ctx, NewGit(d.opts, d.log, d.refFetcher, d.proxy), tempArea)
+}
+
+func (d Sync) resolveSHA(ctx context.Context, git *Git, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGit, bool, error) {
+	if !git.CanResolveRemote() {
+		return ctlconf.LockDirectoryContentsGit{}, false, nil
+	}
+
+	info, resolved, err := git.ResolveRemote(ctx, tempArea)
+	if err != nil {
+		return ctlconf.LockDirectoryContentsGit{}, false, fmt.Errorf("Resolving git ref: %w", err)
+	}
+
+	return ctlconf.LockDirectoryContentsGit{SHA: info.SHA, Tags: info.Tags}, resolved, nil
+}
+
+func (d Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGit, error) {
 	gitLockConf := ctlconf.LockDirectoryContentsGit{}
 
 	incomingTmpPath, err := tempArea.NewTempDir("git")
@@ -46,16 +103,27 @@ func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDire
 
 	defer os.RemoveAll(incomingTmpPath)
 
-	git := NewGit(d.opts, d.log, d.refFetcher)
+	git := NewGit(d.opts, d.log, d.refFetcher, d.proxy)
 
-	info, err := git.Retrieve(incomingTmpPath, tempArea)
+	info, err := git.Retrieve(ctx, incomingTmpPath, tempArea)
 	if err != nil {
-		return gitLockConf, fmt.Errorf("Fetching git repository: %s", err)
+		return gitLockConf, fmt.Errorf("Fetching git repository: %w", err)
 	}
 
 	gitLockConf.SHA = info.SHA
 	gitLockConf.Tags = info.Tags
 	gitLockConf.CommitTitle = d.singleLineCommitTitle(info.CommitTitle)
+	gitLockConf.CommitTimestamp = info.CommitTimestamp
+	gitLockConf.VerifiedKeyFingerprint = info.VerifiedKeyFingerprint
+	gitLockConf.ChangedFromSHA = info.ChangedFromSHA
+	gitLockConf.Ref = info.Ref
+
+	if !d.opts.KeepGitDir {
+		err = os.RemoveAll(filepath.Join(incomingTmpPath, ".git"))
+		if err != nil {
+			return gitLockConf, fmt.Errorf("Deleting git metadata: %s", err)
+		}
+	}
 
 	err = os.RemoveAll(dstPath)
 	if err != nil {
@@ -0,0 +1,561 @@
+package git_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlgit "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/git"
+	ctlver "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/versions"
+)
+
+func TestSyncFetchesLFSObjects(t *testing.T) {
+	_, err := exec.LookPath("git-lfs")
+	if err != nil {
+		t.Skip("Skipping since git-lfs is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+	content := bytes.Repeat([]byte{0, 1, 2, 3}, 1024)
+
+	runGit := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = repoPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	runGit("init")
+	runGit("lfs", "install", "--local")
+	runGit("lfs", "track", "*.bin")
+
+	err = ioutil.WriteFile(filepath.Join(repoPath, "data.bin"), content, 0600)
+	if err != nil {
+		t.Fatalf("Writing LFS file: %s", err)
+	}
+
+	runGit("add", ".")
+	runGit("commit", "-m", "add data")
+
+	opts := ctlconf.DirectoryContentsGit{
+		URL: repoPath,
+		Ref: runGit("rev-parse", "HEAD"),
+		LFS: true,
+	}
+
+	dstPath := filepath.Join(dir, "dst")
+
+	_, err = ctlgit.NewSync(opts, ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).Sync(
+		context.Background(), dstPath, testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	fetchedContent, err := ioutil.ReadFile(filepath.Join(dstPath, "data.bin"))
+	if err != nil {
+		t.Fatalf("Reading fetched file: %s", err)
+	}
+
+	if !bytes.Equal(fetchedContent, content) {
+		t.Fatalf("Expected LFS pointer file to be replaced with actual content, but was: %s", fetchedContent)
+	}
+}
+
+func TestSyncFromLocalRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	runGit := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = repoPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	runGit("init")
+
+	for _, content := range []string{"v1", "v2"} {
+		err = ioutil.WriteFile(filepath.Join(repoPath, "file.txt"), []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+		runGit("add", ".")
+		runGit("commit", "-m", "commit "+content)
+		runGit("tag", content)
+	}
+
+	expectedSHA := runGit("rev-parse", "v1^{commit}")
+
+	committedAt, err := time.Parse(time.RFC3339, runGit("log", "-n", "1", "--pretty=%cI", "v1"))
+	if err != nil {
+		t.Fatalf("Parsing committer date: %s", err)
+	}
+
+	expectedTimestamp := committedAt.UTC().Format(time.RFC3339)
+
+	// Relative paths are resolved against current working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getting working dir: %s", err)
+	}
+	defer os.Chdir(wd)
+
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatalf("Changing working dir: %s", err)
+	}
+
+	for i, url := range []string{"file://" + repoPath, repoPath, "repo", "./repo"} {
+		opts := ctlconf.DirectoryContentsGit{
+			URL: url,
+			Ref: "v1",
+			// Credentials are not used for local repositories
+			SecretRef: &ctlconf.DirectoryContentsLocalRef{Name: "not-found"},
+		}
+
+		dstPath := filepath.Join(dir, fmt.Sprintf("dst%d", i))
+
+		lockConf, err := ctlgit.NewSync(opts, ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).Sync(
+			context.Background(), dstPath, testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected sync of '%s' to succeed: %s", url, err)
+		}
+
+		if lockConf.SHA != expectedSHA {
+			t.Fatalf("Expected SHA '%s' for '%s', but was '%s'", expectedSHA, url, lockConf.SHA)
+		}
+
+		if lockConf.CommitTitle != "commit v1" || lockConf.CommitTimestamp != expectedTimestamp {
+			t.Fatalf("Expected commit title and timestamp '%s' for '%s', but was '%s' and '%s'",
+				expectedTimestamp, url, lockConf.CommitTitle, lockConf.CommitTimestamp)
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dstPath, "file.txt"))
+		if err != nil {
+			t.Fatalf("Reading fetched file: %s", err)
+		}
+		if string(content) != "v1" {
+			t.Fatalf("Expected content of tagged commit for '%s', but was: %s", url, content)
+		}
+	}
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
+
+func TestSyncFetchesSubmodulesByDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Local submodules are only cloned when file transport is allowed (git 2.38.1+)
+	for key, val := range map[string]string{"GIT_CONFIG_COUNT": "1",
+		"GIT_CONFIG_KEY_0": "protocol.file.allow", "GIT_CONFIG_VALUE_0": "always"} {
+
+		os.Setenv(key, val)
+		defer os.Unsetenv(key)
+	}
+
+	runGit := func(repoPath string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = repoPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	subPath := filepath.Join(dir, "sub")
+	repoPath := filepath.Join(dir, "repo")
+
+	for _, path := range []string{subPath, repoPath} {
+		err = os.MkdirAll(path, 0700)
+		if err != nil {
+			t.Fatalf("Creating repo dir: %s", err)
+		}
+		runGit(path, "init")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(subPath, "sub.txt"), []byte("sub"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	runGit(subPath, "add", ".")
+	runGit(subPath, "commit", "-m", "add sub")
+
+	runGit(repoPath, "submodule", "add", subPath, "sub")
+	runGit(repoPath, "commit", "-m", "add submodule")
+
+	ref := runGit(repoPath, "rev-parse", "HEAD")
+
+	for _, submodules := range []*bool{nil, new(bool)} {
+		// Config without submodules field fetches submodules
+		opts := ctlconf.DirectoryContentsGit{URL: repoPath, Ref: ref, Submodules: submodules}
+		dstPath := filepath.Join(dir, fmt.Sprintf("dst-%t", submodules == nil))
+
+		_, err = ctlgit.NewSync(opts, ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).Sync(
+			context.Background(), dstPath, testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected sync to succeed: %s", err)
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dstPath, "sub", "sub.txt"))
+
+		if submodules == nil && (err != nil || string(content) != "sub") {
+			t.Fatalf("Expected submodule to be fetched by default: %v", err)
+		}
+		if submodules != nil && err == nil {
+			t.Fatalf("Expected submodule to not be fetched when disabled")
+		}
+	}
+}
+
+func TestSyncWithReferenceRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	runGit := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = repoPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	runGit("init")
+
+	err = ioutil.WriteFile(filepath.Join(repoPath, "file.txt"), []byte("v1"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	runGit("add", ".")
+	runGit("commit", "-m", "commit")
+	runGit("tag", "v1")
+	runGit("clone", "--mirror", repoPath, filepath.Join(dir, "mirror"))
+
+	for i, refRepo := range []string{filepath.Join(dir, "mirror"), filepath.Join(dir, "not-found")} {
+		opts := ctlconf.DirectoryContentsGit{
+			URL:           repoPath,
+			Ref:           "v1",
+			ReferenceRepo: refRepo,
+			KeepGitDir:    true,
+		}
+
+		dstPath := filepath.Join(dir, fmt.Sprintf("dst%d", i))
+		log := &bytes.Buffer{}
+
+		_, err := ctlgit.NewSync(opts, log, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).Sync(
+			context.Background(), dstPath, testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected sync with reference repo '%s' to succeed: %s", refRepo, err)
+		}
+
+		hasWarning := strings.Contains(log.String(), "Warning: Fetching without reference repository")
+		if hasWarning != (i == 1) {
+			t.Fatalf("Expected warning only for invalid reference repo, but was: %s", log.String())
+		}
+
+		_, err = os.Stat(filepath.Join(dstPath, ".git", "objects", "info", "alternates"))
+		if !os.IsNotExist(err) {
+			t.Fatalf("Expected kept repository to be dissociated from reference repo: %v", err)
+		}
+	}
+}
+
+func TestSyncWithPartialCloneFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	runGit := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	for _, path := range []string{"included/file.txt", "excluded/file.txt"} {
+		err = os.MkdirAll(filepath.Join(repoPath, filepath.Dir(path)), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(repoPath, path), []byte(path), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	runGit(repoPath, "init")
+	runGit(repoPath, "config", "uploadpack.allowFilter", "true")
+	runGit(repoPath, "add", ".")
+	runGit(repoPath, "commit", "-m", "commit")
+	runGit(repoPath, "tag", "v1")
+
+	opts := ctlconf.DirectoryContentsGit{
+		URL:            "file://" + repoPath,
+		Ref:            "v1",
+		Filter:         "blob:none",
+		SparseCheckout: []string{"included"},
+		KeepGitDir:     true,
+	}
+
+	dstPath := filepath.Join(dir, "dst")
+
+	info, err := ctlgit.NewSync(opts, ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).Sync(
+		context.Background(), dstPath, testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if info.SHA != runGit(repoPath, "rev-parse", "HEAD") {
+		t.Fatalf("Expected resolved SHA to be unaffected by filter, but was: %s", info.SHA)
+	}
+
+	_, err = os.Stat(filepath.Join(dstPath, "included", "file.txt"))
+	if err != nil {
+		t.Fatalf("Expected checked out file to exist: %s", err)
+	}
+
+	// Blobs outside of sparse checkout are never fetched
+	excludedBlob := runGit(repoPath, "rev-parse", "HEAD:excluded/file.txt")
+	missing := runGit(dstPath, "rev-list", "--objects", "--missing=print", "HEAD")
+
+	if !strings.Contains(missing, "?"+excludedBlob) {
+		t.Fatalf("Expected excluded blob to not be fetched, but was: %s", missing)
+	}
+}
+
+func TestSyncListRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	runGit := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = repoPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	runGit("init")
+	runGit("checkout", "-b", "main")
+	runGit("commit", "--allow-empty", "-m", "commit")
+
+	for _, tag := range []string{"v1.10.0", "v1.2.0", "latest"} {
+		runGit("tag", tag)
+	}
+
+	opts := ctlconf.DirectoryContentsGit{URL: repoPath}
+
+	refs, err := ctlgit.NewSync(opts, ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).ListRefs(
+		context.Background(), testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected listing refs to succeed: %s", err)
+	}
+
+	expectedRefs := []string{"v1.10.0", "v1.2.0", "latest", "origin/main"}
+
+	if !reflect.DeepEqual(refs, expectedRefs) {
+		t.Fatalf("Expected refs '%#v' to equal '%#v'", refs, expectedRefs)
+	}
+}
+
+func TestSyncResolveWithoutFetching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	runGit := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = repoPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	runGit("init")
+	runGit("checkout", "-b", "main")
+	runGit("commit", "--allow-empty", "-m", "first")
+	runGit("tag", "-a", "v1.0.0", "-m", "annotated")
+	runGit("tag", "stable")
+
+	tagSHA := runGit("rev-parse", "HEAD")
+
+	runGit("commit", "--allow-empty", "-m", "second")
+
+	headSHA := runGit("rev-parse", "HEAD")
+
+	tests := []struct {
+		opts         ctlconf.DirectoryContentsGit
+		expectedLock ctlconf.LockDirectoryContentsGit
+		resolved     bool
+	}{
+		// Annotated tag resolves to commit (peeled), not tag object
+		{ctlconf.DirectoryContentsGit{Ref: "v1.0.0"}, ctlconf.LockDirectoryContentsGit{SHA: tagSHA, Tags: []string{"stable", "v1.0.0"}}, true},
+		{ctlconf.DirectoryContentsGit{Ref: "origin/main"}, ctlconf.LockDirectoryContentsGit{SHA: headSHA}, true},
+		{ctlconf.DirectoryContentsGit{RefSelection: &ctlver.VersionSelection{Semver: &ctlver.VersionSelectionSemver{}}},
+			ctlconf.LockDirectoryContentsGit{SHA: tagSHA, Tags: []string{"v1.0.0"}}, true},
+		// Abbreviated SHA requires fetching repository
+		{ctlconf.DirectoryContentsGit{Ref: headSHA[:8]}, ctlconf.LockDirectoryContentsGit{}, false},
+	}
+
+	for _, test := range tests {
+		test.opts.URL = repoPath
+
+		lock, resolved, err := ctlgit.NewSync(test.opts, ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).ResolveSHA(
+			context.Background(), testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected resolving '%s' to succeed: %s", test.opts.Ref, err)
+		}
+
+		if resolved != test.resolved || !reflect.DeepEqual(lock, test.expectedLock) {
+			t.Fatalf("Expected resolving '%s' to return %#v (resolved: %t), but was %#v (resolved: %t)",
+				test.opts.Ref, test.expectedLock, test.resolved, lock, resolved)
+		}
+	}
+}
+
+func TestSyncResolveMatchesSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-git-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	runGit := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=vendir", "-c", "user.email=vendir@example.com"}, args...)...)
+		cmd.Dir = repoPath
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running git %s: %s (output: %s)", args, err, out)
+		}
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	runGit("init")
+	runGit("checkout", "-b", "main")
+	runGit("commit", "--allow-empty", "-m", "first")
+	runGit("tag", "-a", "v1.0.0", "-m", "annotated")
+	runGit("commit", "--allow-empty", "-m", "second\n\nwith body")
+
+	for _, ref := range []string{"v1.0.0", "origin/main"} {
+		sync := ctlgit.NewSync(ctlconf.DirectoryContentsGit{URL: repoPath, Ref: ref},
+			ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{})
+
+		resolvedLock, resolved, err := sync.Resolve(context.Background(), testTempArea{dir})
+		if err != nil || !resolved {
+			t.Fatalf("Expected resolving '%s' to succeed: %v (resolved: %t)", ref, err, resolved)
+		}
+
+		syncedLock, err := sync.Sync(context.Background(), filepath.Join(dir, "dst"), testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected syncing '%s' to succeed: %s", ref, err)
+		}
+
+		if len(resolvedLock.CommitTitle) == 0 || len(resolvedLock.CommitTimestamp) == 0 {
+			t.Fatalf("Expected resolved commit metadata to be recorded, but was: %#v", resolvedLock)
+		}
+		if !reflect.DeepEqual(resolvedLock, syncedLock) {
+			t.Fatalf("Expected resolved lock for '%s' to match synced lock %#v, but was %#v", ref, syncedLock, resolvedLock)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -20,10 +21,15 @@ type Verification struct {
 	refFetcher ctlfetch.RefFetcher
 }
 
-func (v Verification) Verify(ref string) error {
+// Verify returns fingerprint of a primary key that signed ref
+func (v Verification) Verify(ctx context.Context, ref string) (string, error) {
+	if v.opts.PublicKeysSecretRef == nil {
+		return "", fmt.Errorf("Expected public keys secret ref to be specified")
+	}
+
 	secret, err := v.refFetcher.GetSecret(v.opts.PublicKeysSecretRef.Name)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	publicKeysStr := ""
@@ -34,31 +40,56 @@ func (v Verification) Verify(ref string) error {
 
 	publicKeys, err := oarmor.ReadArmoredKeys(publicKeysStr)
 	if err != nil {
-		return fmt.Errorf("Reading armored key ring: %s", err)
+		return "", fmt.Errorf("Reading armored key ring: %s", err)
 	}
 
 	if len(publicKeys) == 0 {
-		return fmt.Errorf("Expected at least one public key, but found 0")
+		return "", fmt.Errorf("Expected at least one public key, but found 0")
 	}
 
-	signedObj, err := v.readObject(ref)
+	signedObj, err := v.readObject(ctx, ref)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	target := strings.NewReader(signedObj.Contents)
 	sig := strings.NewReader(signedObj.Signature)
 
-	_, err = openpgp.CheckArmoredDetachedSignature(publicKeys, target, sig)
+	signer, err := openpgp.CheckArmoredDetachedSignature(publicKeys, target, sig)
 	if err != nil {
 		hintMsg := ""
 		if strings.Contains(err.Error(), "signature made by unknown entity") {
 			hintMsg = " (hint: provided public key does not match signature)"
 		}
-		return fmt.Errorf("Checking signature: %s%s", err, hintMsg)
+		return "", fmt.Errorf("Checking signature: %s%s", err, hintMsg)
+	}
+
+	fingerprint := fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+
+	err = v.checkAllowedFingerprint(fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	return fingerprint, nil
+}
+
+// checkAllowedFingerprint matches full fingerprints or long key IDs
+// (last 16 hex characters of fingerprint); spaces are ignored
+func (v Verification) checkAllowedFingerprint(fingerprint string) error {
+	if len(v.opts.AllowedKeyFingerprints) == 0 {
+		return nil
+	}
+
+	for _, allowed := range v.opts.AllowedKeyFingerprints {
+		allowed = strings.ToUpper(strings.Replace(allowed, " ", "", -1))
+
+		if len(allowed) >= 16 && strings.HasSuffix(fingerprint, allowed) {
+			return nil
+		}
 	}
 
-	return nil
+	return fmt.Errorf("Expected signing key '%s' to be one of allowed key fingerprints, but was not", fingerprint)
 }
 
 type signedObj struct {
@@ -66,15 +97,15 @@ type signedObj struct {
 	Signature string
 }
 
-func (v Verification) readObject(ref string) (signedObj, error) {
+func (v Verification) readObject(ctx context.Context, ref string) (signedObj, error) {
 	// Check tag first since "cat-file commit <tag>" will resolve tag first,
 	// then return commit which may not be signed itself
-	out, _, err := v.run([]string{"cat-file", "tag", ref})
+	out, _, err := v.run(ctx, []string{"cat-file", "tag", ref})
 	if err == nil {
 		return v.extractTagSignature(out)
 	}
 
-	out, _, err = v.run([]string{"cat-file", "commit", ref})
+	out, _, err = v.run(ctx, []string{"cat-file", "commit", ref})
 	if err == nil {
 		return v.extractCommitSignature(out)
 	}
@@ -119,7 +150,7 @@ func (v Verification) extractTagSignature(obj string) (signedObj, error) {
 	return signedObj{Contents: nonSig, Signature: sig}, nil
 }
 
-func (v Verification) run(args []string) (string, string, error) {
+func (v Verification) run(ctx context.Context, args []string) (string, string, error) {
 	var stdoutBs, stderrBs bytes.Buffer
 
 	cmd := exec.Command("git", args...)
@@ -127,7 +158,7 @@ func (v Verification) run(args []string) (string, string, error) {
 	cmd.Stdout = &stdoutBs
 	cmd.Stderr = &stderrBs
 
-	err := cmd.Run()
+	err := ctlfetch.RunCommand(ctx, cmd)
 	if err != nil {
 		return "", "", fmt.Errorf("Git %s: %s (stderr: %s)", args, err, stderrBs.String())
 	}
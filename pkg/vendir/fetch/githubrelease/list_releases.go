@@ -0,0 +1,61 @@
+package githubrelease
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// ListReleases returns tags of published releases (newest first,
+// including pre-releases) without downloading any assets
+func (d Sync) ListReleases(ctx context.Context) ([]string, error) {
+	if len(d.opts.Slug) == 0 {
+		return nil, fmt.Errorf("Expected slug to be specified to list releases")
+	}
+
+	authToken, err := d.authToken()
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=100", d.apiURL(), d.opts.Slug)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(authToken) > 0 {
+		req.Header.Add("Authorization", "token "+authToken)
+	}
+
+	resp, err := d.doRequest(ctx, req, authToken)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf("Expected response status 200, but was '%d'", resp.StatusCode))
+	}
+
+	var releasesAPI []GithubReleaseAPI
+
+	err = json.NewDecoder(resp.Body).Decode(&releasesAPI)
+	if err != nil {
+		return nil, fmt.Errorf("Decoding releases: %s", err)
+	}
+
+	var tags []string
+
+	for _, release := range releasesAPI {
+		if !release.Draft {
+			tags = append(tags, release.TagName)
+		}
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,82 @@
+package githubrelease
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const (
+	maxRateLimitWaits = 3
+)
+
+// doRequest retries request once GitHub API rate limit resets
+// as long as it resets within allowed duration
+func (d Sync) doRequest(ctx context.Context, req *http.Request, authToken string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := d.proxy.HTTPClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		wait, limited := d.rateLimitWait(resp, time.Now())
+		if !limited {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		if d.rateLimitMaxWait <= 0 || wait > d.rateLimitMaxWait || attempt == maxRateLimitWaits {
+			hintMsg := "(hint: consider setting --github-rate-limit-wait flag to wait for rate limit to reset)"
+			if len(authToken) == 0 {
+				hintMsg = "(hint: consider setting VENDIR_GITHUB_API_TOKEN env variable to increase API rate limits)"
+			}
+			// Retrying right away would only consume more of the limit
+			return nil, ctlfetch.NewNonRetryableError(fmt.Errorf(
+				"Exceeded GitHub API rate limit (resets in %s) %s", wait.Round(time.Second), hintMsg))
+		}
+
+		d.infoLog.Write([]byte(fmt.Sprintf("Waiting %s for GitHub API rate limit to reset\n", wait.Round(time.Second))))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// rateLimitWait determines how long to wait before retrying
+// request that was rejected due to primary or secondary rate limit
+func (Sync) rateLimitWait(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	// Secondary rate limits specify how many seconds to wait
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		// GitHub suggests waiting at least a minute without further details
+		return time.Minute, true
+	}
+
+	wait := time.Unix(reset, 0).Sub(now)
+	if wait < time.Second {
+		wait = time.Second
+	}
+
+	return wait, true
+}
@@ -1,6 +1,7 @@
 package githubrelease
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/bmatcuk/doublestar"
 	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
@@ -16,20 +19,30 @@ import (
 )
 
 type Sync struct {
-	opts            ctlconf.DirectoryContentsGithubRelease
-	defaultApiToken string
-	refFetcher      ctlfetch.RefFetcher
+	opts             ctlconf.DirectoryContentsGithubRelease
+	defaultApiToken  string
+	refFetcher       ctlfetch.RefFetcher
+	cache            ctlfetch.Cache
+	proxy            ctlfetch.ProxyOpts
+	rateLimitMaxWait time.Duration
+	infoLog          io.Writer
 }
 
-func NewSync(opts ctlconf.DirectoryContentsGithubRelease,
-	defaultApiToken string, refFetcher ctlfetch.RefFetcher) Sync {
+// NewSync returns sync that waits up to rateLimitMaxWait for GitHub API
+// rate limit to reset (zero value fails right away)
+func NewSync(opts ctlconf.DirectoryContentsGithubRelease, defaultApiToken string, refFetcher ctlfetch.RefFetcher,
+	cache ctlfetch.Cache, proxy ctlfetch.ProxyOpts, rateLimitMaxWait time.Duration, infoLog io.Writer) Sync {
 
-	return Sync{opts, defaultApiToken, refFetcher}
+	return Sync{opts, defaultApiToken, refFetcher, cache, proxy, rateLimitMaxWait, infoLog}
 }
 
+const (
+	defaultAPIURL = "https://api.github.com"
+)
+
 func (d Sync) DescAndURL() (string, string, error) {
 	desc := ""
-	url := fmt.Sprintf("https://api.github.com/repos/%s/releases", d.opts.Slug)
+	url := fmt.Sprintf("%s/repos/%s/releases", d.apiURL(), d.opts.Slug)
 
 	switch {
 	case len(d.opts.URL) > 0:
@@ -38,16 +51,32 @@ func (d Sync) DescAndURL() (string, string, error) {
 	case len(d.opts.Tag) > 0:
 		desc = d.opts.Slug + "@" + d.opts.Tag
 		url += "/tags/" + d.opts.Tag
+	case d.opts.Latest && d.opts.IncludePrereleases:
+		desc = d.opts.Slug + "@latest (including pre-releases)"
+		// Releases are listed newest first
+		url += "?per_page=10"
 	case d.opts.Latest:
 		desc = d.opts.Slug + "@latest"
 		url += "/latest"
 	default:
 		return "", "", fmt.Errorf("Expected to have non-empty tag, latest or url")
 	}
+
+	if len(d.opts.APIURL) > 0 && len(d.opts.URL) == 0 {
+		desc += " via " + d.apiURL()
+	}
+
 	return desc, url, nil
 }
 
-func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGithubRelease, error) {
+func (d Sync) apiURL() string {
+	if len(d.opts.APIURL) > 0 {
+		return strings.TrimSuffix(d.opts.APIURL, "/")
+	}
+	return defaultAPIURL
+}
+
+func (d Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsGithubRelease, error) {
 	lockConf := ctlconf.LockDirectoryContentsGithubRelease{}
 
 	incomingTmpPath, err := tempArea.NewTempDir("github-release")
@@ -62,27 +91,34 @@ func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDire
 		return lockConf, err
 	}
 
-	releaseAPI, err := d.downloadRelease(authToken)
+	if len(authToken) == 0 {
+		d.infoLog.Write([]byte("Warning: Unauthenticated GitHub API requests are limited to 60 requests per hour " +
+			"(hint: consider setting VENDIR_GITHUB_API_TOKEN env variable)\n"))
+	}
+
+	releaseAPI, err := d.downloadRelease(ctx, authToken)
 	if err != nil {
-		return lockConf, fmt.Errorf("Downloading release info: %s", err)
+		return lockConf, fmt.Errorf("Downloading release info: %w", err)
 	}
 
 	fileChecksums := map[string]string{}
-	matchedAssets := []GithubReleaseAssetAPI{}
 
-	for _, asset := range releaseAPI.Assets {
-		matched, err := d.matchesAssetName(asset.Name)
-		if err != nil {
-			return lockConf, fmt.Errorf("Matching asset name '%s': %s", asset.Name, err)
-		}
-		if matched {
-			matchedAssets = append(matchedAssets, asset)
-		}
+	matchedAssets, err := d.matchAssets(releaseAPI)
+	if err != nil {
+		return lockConf, err
 	}
 
-	if len(d.opts.Checksums) > 0 {
+	switch {
+	case len(d.opts.Checksums) > 0:
 		fileChecksums = d.opts.Checksums
-	} else {
+
+	case len(d.opts.ChecksumsAsset) > 0:
+		fileChecksums, err = d.checksumsFromAsset(ctx, releaseAPI, matchedAssets, authToken, tempArea)
+		if err != nil {
+			return lockConf, fmt.Errorf("Finding checksums in asset '%s': %s", d.opts.ChecksumsAsset, err)
+		}
+
+	default:
 		if !d.opts.DisableAutoChecksumValidation {
 			fileChecksums, err = ReleaseNotesChecksums{}.Find(matchedAssets, releaseAPI.Body)
 			if err != nil {
@@ -94,22 +130,54 @@ func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDire
 	for _, asset := range matchedAssets {
 		path := filepath.Join(incomingTmpPath, asset.Name)
 
-		err = d.downloadFile(asset.URL, path, authToken)
+		// Assets without known checksum cannot be looked up in cache
+		cached, err := d.cache.GetFile(fileChecksums[asset.Name], path)
 		if err != nil {
-			return lockConf, fmt.Errorf("Downloading asset '%s': %s", asset.Name, err)
+			return lockConf, fmt.Errorf("Reading cached asset '%s': %s", asset.Name, err)
+		}
+
+		if !cached {
+			err = ctlfetch.CheckFreeSpace(incomingTmpPath, asset.Size, fmt.Sprintf("to download asset '%s'", asset.Name))
+			if err != nil {
+				return lockConf, err
+			}
+
+			err = d.downloadFile(ctx, asset.URL, path, authToken)
+			if err != nil {
+				return lockConf, fmt.Errorf("Downloading asset '%s': %w", asset.Name, err)
+			}
 		}
 
 		err = d.checkFileSize(path, asset.Size)
 		if err != nil {
-			return lockConf, fmt.Errorf("Checking asset '%s' size: %s", asset.Name, err)
+			return lockConf, ctlfetch.NewNonRetryableError(fmt.Errorf("Checking asset '%s' size: %s", asset.Name, err))
+		}
+
+		actualChecksum, err := d.fileChecksum(path)
+		if err != nil {
+			return lockConf, fmt.Errorf("Calculating asset '%s' checksum: %s", asset.Name, err)
 		}
 
-		if len(fileChecksums) > 0 {
-			err = d.checkFileChecksum(path, fileChecksums[asset.Name])
+		// Checksums asset does not include its own checksum
+		if len(fileChecksums) > 0 && asset.Name != d.opts.ChecksumsAsset {
+			err = d.checkFileChecksum(actualChecksum, fileChecksums[asset.Name])
 			if err != nil {
-				return lockConf, fmt.Errorf("Checking asset '%s' checksum: %s", asset.Name, err)
+				return lockConf, ctlfetch.NewNonRetryableError(fmt.Errorf("Checking asset '%s' checksum: %s", asset.Name, err))
 			}
 		}
+
+		if !cached {
+			err = d.cache.PutFile(actualChecksum, path)
+			if err != nil {
+				return lockConf, fmt.Errorf("Caching asset '%s': %s", asset.Name, err)
+			}
+		}
+
+		lockConf.Assets = append(lockConf.Assets, ctlconf.LockDirectoryContentsGithubReleaseAsset{
+			Name:   asset.Name,
+			SHA256: actualChecksum,
+			URL:    asset.URL,
+		})
 	}
 
 	if d.opts.UnpackArchive != nil {
@@ -120,7 +188,7 @@ func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDire
 
 		defer os.RemoveAll(newIncomingTmpPath)
 
-		final, err := ctlfetch.NewArchive(filepath.Join(incomingTmpPath, d.opts.UnpackArchive.Path), false, "").Unpack(newIncomingTmpPath)
+		final, err := ctlfetch.NewArchive(filepath.Join(incomingTmpPath, d.opts.UnpackArchive.Path), false, "", d.opts.UnpackArchive.StripComponents).Unpack(newIncomingTmpPath)
 		if err != nil {
 			return lockConf, fmt.Errorf("Unpacking archive '%s': %s", d.opts.UnpackArchive.Path, err)
 		}
@@ -129,6 +197,18 @@ func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDire
 		}
 
 		incomingTmpPath = newIncomingTmpPath
+
+		if len(d.opts.UnpackArchive.SubPath) > 0 {
+			incomingTmpPath, err = ctlfetch.ScopedPath(newIncomingTmpPath, d.opts.UnpackArchive.SubPath)
+			if err != nil {
+				return lockConf, err
+			}
+
+			info, err := os.Stat(incomingTmpPath)
+			if err != nil || !info.IsDir() {
+				return lockConf, fmt.Errorf("Expected sub path '%s' to be a directory within unpacked archive", d.opts.UnpackArchive.SubPath)
+			}
+		}
 	}
 
 	err = os.RemoveAll(dstPath)
@@ -142,27 +222,111 @@ func (d Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDire
 	}
 
 	lockConf.URL = releaseAPI.URL
+	lockConf.Tag = releaseAPI.TagName
 
 	return lockConf, nil
 }
 
-func (d Sync) matchesAssetName(name string) (bool, error) {
+// checksumsFromAsset parses checksums asset (e.g. checksums.txt, SHA256SUMS)
+// in '<sha256>  <filename>' format for all matched assets
+func (d Sync) checksumsFromAsset(ctx context.Context, releaseAPI GithubReleaseAPI, matchedAssets []GithubReleaseAssetAPI,
+	authToken string, tempArea ctlfetch.TempArea) (map[string]string, error) {
+
+	var checksumsAsset *GithubReleaseAssetAPI
+	var checkedAssets []GithubReleaseAssetAPI
+
+	for i, asset := range releaseAPI.Assets {
+		if asset.Name == d.opts.ChecksumsAsset {
+			checksumsAsset = &releaseAPI.Assets[i]
+		}
+	}
+
+	if checksumsAsset == nil {
+		return nil, fmt.Errorf("Expected to find asset, but did not (available: %s)",
+			strings.Join(releaseAPI.AssetNames(), ", "))
+	}
+
+	for _, asset := range matchedAssets {
+		if asset.Name != d.opts.ChecksumsAsset {
+			checkedAssets = append(checkedAssets, asset)
+		}
+	}
+
+	tmpFile, err := tempArea.NewTempFile("vendir-github-release-checksums")
+	if err != nil {
+		return nil, err
+	}
+
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	err = d.downloadFile(ctx, checksumsAsset.URL, tmpFile.Name(), authToken)
+	if err != nil {
+		return nil, fmt.Errorf("Downloading: %w", err)
+	}
+
+	bs, err := ioutil.ReadFile(tmpFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("Reading: %s", err)
+	}
+
+	return ReleaseNotesChecksums{}.Find(checkedAssets, string(bs))
+}
+
+func (d Sync) matchAssets(releaseAPI GithubReleaseAPI) ([]GithubReleaseAssetAPI, error) {
 	if len(d.opts.AssetNames) == 0 {
-		return true, nil
+		return releaseAPI.Assets, nil
 	}
-	for _, pattern := range d.opts.AssetNames {
-		ok, err := doublestar.PathMatch(pattern, name)
-		if err != nil {
-			return false, err
+
+	var matchedAssets []GithubReleaseAssetAPI
+	patternsMatched := map[string]bool{}
+
+	for _, asset := range releaseAPI.Assets {
+		var matched bool
+
+		for _, pattern := range d.opts.AssetNames {
+			ok, err := doublestar.PathMatch(pattern, asset.Name)
+			if err != nil {
+				return nil, fmt.Errorf("Matching asset name '%s': %s", asset.Name, err)
+			}
+			if ok {
+				patternsMatched[pattern] = true
+				matched = true
+			}
+		}
+
+		if matched {
+			matchedAssets = append(matchedAssets, asset)
 		}
-		if ok {
-			return true, nil
+	}
+
+	for _, pattern := range d.opts.AssetNames {
+		if !patternsMatched[pattern] {
+			return nil, fmt.Errorf("Expected asset name pattern '%s' to match at least one asset, but did not (available: %s)",
+				pattern, strings.Join(releaseAPI.AssetNames(), ", "))
 		}
 	}
-	return false, nil
+
+	return matchedAssets, nil
+}
+
+// ResolveURL returns API URL of configured release (e.g. of
+// currently latest release) without downloading its assets
+func (d Sync) ResolveURL(ctx context.Context) (string, error) {
+	authToken, err := d.authToken()
+	if err != nil {
+		return "", err
+	}
+
+	releaseAPI, err := d.downloadRelease(ctx, authToken)
+	if err != nil {
+		return "", fmt.Errorf("Downloading release info: %w", err)
+	}
+
+	return releaseAPI.URL, nil
 }
 
-func (d Sync) downloadRelease(authToken string) (GithubReleaseAPI, error) {
+func (d Sync) downloadRelease(ctx context.Context, authToken string) (GithubReleaseAPI, error) {
 	releaseAPI := GithubReleaseAPI{}
 
 	_, url, err := d.DescAndURL()
@@ -170,7 +334,7 @@ func (d Sync) downloadRelease(authToken string) (GithubReleaseAPI, error) {
 		return releaseAPI, err
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return releaseAPI, err
 	}
@@ -179,7 +343,7 @@ func (d Sync) downloadRelease(authToken string) (GithubReleaseAPI, error) {
 		req.Header.Add("Authorization", "token "+authToken)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := d.doRequest(ctx, req, authToken)
 	if err != nil {
 		return releaseAPI, err
 	}
@@ -193,10 +357,12 @@ func (d Sync) downloadRelease(authToken string) (GithubReleaseAPI, error) {
 			bs, _ := ioutil.ReadAll(resp.Body)
 			errMsg += fmt.Sprintf(" %s (body: '%s')", hintMsg, bs)
 		case 404:
-			hintMsg := "(hint: if you are using 'latest: true', there may not be any non-pre-release releases)"
-			errMsg += " " + hintMsg
+			if d.opts.Latest && len(d.opts.URL) == 0 {
+				return releaseAPI, fmt.Errorf("Expected repository '%s' to have at least one release that is not a pre-release, "+
+					"but found none (hint: use 'includePrereleases: true' to consider pre-releases)", d.opts.Slug)
+			}
 		}
-		return releaseAPI, fmt.Errorf(errMsg)
+		return releaseAPI, ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf(errMsg))
 	}
 
 	bs, err := ioutil.ReadAll(resp.Body)
@@ -204,6 +370,10 @@ func (d Sync) downloadRelease(authToken string) (GithubReleaseAPI, error) {
 		return releaseAPI, err
 	}
 
+	if d.opts.Latest && d.opts.IncludePrereleases && len(d.opts.URL) == 0 {
+		return d.latestRelease(bs)
+	}
+
 	err = json.Unmarshal(bs, &releaseAPI)
 	if err != nil {
 		return releaseAPI, err
@@ -212,8 +382,26 @@ func (d Sync) downloadRelease(authToken string) (GithubReleaseAPI, error) {
 	return releaseAPI, nil
 }
 
-func (d Sync) downloadFile(url, dstPath, authToken string) error {
-	req, err := http.NewRequest("GET", url, nil)
+// latestRelease picks newest published release (including pre-releases)
+func (d Sync) latestRelease(bs []byte) (GithubReleaseAPI, error) {
+	var releasesAPI []GithubReleaseAPI
+
+	err := json.Unmarshal(bs, &releasesAPI)
+	if err != nil {
+		return GithubReleaseAPI{}, err
+	}
+
+	for _, release := range releasesAPI {
+		if !release.Draft {
+			return release, nil
+		}
+	}
+
+	return GithubReleaseAPI{}, fmt.Errorf("Expected repository '%s' to have at least one release, but found none", d.opts.Slug)
+}
+
+func (d Sync) downloadFile(ctx context.Context, url, dstPath, authToken string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
@@ -225,7 +413,7 @@ func (d Sync) downloadFile(url, dstPath, authToken string) error {
 		req.Header.Add("Authorization", "token "+authToken)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := d.doRequest(ctx, req, authToken)
 	if err != nil {
 		return err
 	}
@@ -238,7 +426,7 @@ func (d Sync) downloadFile(url, dstPath, authToken string) error {
 			bs, _ := ioutil.ReadAll(resp.Body)
 			errMsg += fmt.Sprintf(" (body: '%s')", bs)
 		}
-		return fmt.Errorf(errMsg)
+		return ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf(errMsg))
 	}
 
 	out, err := os.Create(dstPath)
@@ -247,7 +435,7 @@ func (d Sync) downloadFile(url, dstPath, authToken string) error {
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	_, err = io.Copy(io.MultiWriter(out, ctlfetch.NewBytesProgressWriter(ctx)), ctlfetch.NewRateLimitedReader(ctx, resp.Body))
 	return err
 }
 
@@ -262,24 +450,26 @@ func (d Sync) checkFileSize(path string, expectedSize int64) error {
 	return nil
 }
 
-func (d Sync) checkFileChecksum(path string, expectedChecksum string) error {
-	if len(expectedChecksum) == 0 {
-		panic("Expected non-empty checksum as argument")
-	}
-
+func (d Sync) fileChecksum(path string) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer f.Close()
 
 	hash := sha256.New()
 	_, err = io.Copy(hash, f)
 	if err != nil {
-		return fmt.Errorf("Calculating checksum: %s", err)
+		return "", err
 	}
 
-	actualChecksum := fmt.Sprintf("%x", hash.Sum(nil))
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func (d Sync) checkFileChecksum(actualChecksum string, expectedChecksum string) error {
+	if len(expectedChecksum) == 0 {
+		panic("Expected non-empty checksum as argument")
+	}
 
 	if actualChecksum != expectedChecksum {
 		return fmt.Errorf("Expected file checksum to be '%s', but was '%s'",
@@ -315,9 +505,12 @@ func (d Sync) authToken() (string, error) {
 }
 
 type GithubReleaseAPI struct {
-	URL    string `json:"url"`
-	Body   string
-	Assets []GithubReleaseAssetAPI
+	URL        string `json:"url"`
+	TagName    string `json:"tag_name"`
+	Draft      bool
+	Prerelease bool
+	Body       string
+	Assets     []GithubReleaseAssetAPI
 }
 
 type GithubReleaseAssetAPI struct {
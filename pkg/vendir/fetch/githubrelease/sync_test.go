@@ -0,0 +1,155 @@
+package githubrelease_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	. "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/githubrelease"
+)
+
+func TestSyncUsesAPIURL(t *testing.T) {
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v3/repos/org/repo/releases/tags/v1.0.0":
+			fmt.Fprintf(w, `{"url": "%[1]s/api/v3/repos/org/repo/releases/1", "body": "",
+				"assets": [{"url": "%[1]s/api/v3/repos/org/repo/releases/assets/2", "name": "release.yml", "size": 7}]}`, server.URL)
+		case "/api/v3/repos/org/repo/releases/assets/2":
+			w.Write([]byte("content"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vendir-github-release-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := ctlconf.DirectoryContentsGithubRelease{
+		Slug:                          "org/repo",
+		Tag:                           "v1.0.0",
+		APIURL:                        server.URL + "/api/v3/",
+		DisableAutoChecksumValidation: true,
+	}
+
+	lockConf, err := NewSync(opts, "test-token", nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}, 0, ioutil.Discard).Sync(
+		context.Background(), filepath.Join(dir, "dst"), testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if lockConf.URL != server.URL+"/api/v3/repos/org/repo/releases/1" {
+		t.Fatalf("Expected release URL to be recorded, but was: %s", lockConf.URL)
+	}
+	if len(lockConf.Assets) != 1 || lockConf.Assets[0].URL != server.URL+"/api/v3/repos/org/repo/releases/assets/2" {
+		t.Fatalf("Expected asset URL to be recorded, but was: %#v", lockConf.Assets)
+	}
+}
+
+func TestSyncWaitsForRateLimit(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `{"url": "release-url", "body": "", "assets": []}`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vendir-github-release-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := ctlconf.DirectoryContentsGithubRelease{Slug: "org/repo", Tag: "v1.0.0", APIURL: server.URL}
+
+	_, err = NewSync(opts, "", nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}, 0, ioutil.Discard).Sync(
+		context.Background(), filepath.Join(dir, "dst"), testTempArea{dir})
+	if err == nil || !strings.Contains(err.Error(), "Exceeded GitHub API rate limit") {
+		t.Fatalf("Expected rate limit error, but was: %v", err)
+	}
+
+	requests = 0
+
+	_, err = NewSync(opts, "", nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}, time.Minute, ioutil.Discard).Sync(
+		context.Background(), filepath.Join(dir, "dst"), testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed after waiting: %s", err)
+	}
+
+	if requests != 2 {
+		t.Fatalf("Expected request to be retried once, but was requested %d times", requests)
+	}
+}
+
+func TestSyncLatestIncludingPrereleases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/releases" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `[{"url": "draft-url", "tag_name": "v3.0.0", "draft": true},
+			{"url": "rc-url", "tag_name": "v2.0.0-rc.1", "prerelease": true, "body": "", "assets": []},
+			{"url": "stable-url", "tag_name": "v1.0.0", "body": "", "assets": []}]`)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vendir-github-release-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := ctlconf.DirectoryContentsGithubRelease{
+		Slug:               "org/repo",
+		Latest:             true,
+		IncludePrereleases: true,
+		APIURL:             server.URL,
+	}
+
+	lockConf, err := NewSync(opts, "token", nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}, 0, ioutil.Discard).Sync(
+		context.Background(), filepath.Join(dir, "dst"), testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if lockConf.URL != "rc-url" || lockConf.Tag != "v2.0.0-rc.1" {
+		t.Fatalf("Expected newest non-draft release to be resolved, but was: %#v", lockConf)
+	}
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
@@ -5,14 +5,17 @@ package helmchart
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/ghodss/yaml"
+	semver "github.com/hashicorp/go-version"
 	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
 	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
 )
@@ -21,10 +24,12 @@ type Sync struct {
 	opts       ctlconf.DirectoryContentsHelmChart
 	helmBinary string
 	refFetcher ctlfetch.RefFetcher
+	cache      ctlfetch.Cache
+	proxy      ctlfetch.ProxyOpts
 }
 
 func NewSync(opts ctlconf.DirectoryContentsHelmChart,
-	helmBinary string, refFetcher ctlfetch.RefFetcher) *Sync {
+	helmBinary string, refFetcher ctlfetch.RefFetcher, cache ctlfetch.Cache, proxy ctlfetch.ProxyOpts) *Sync {
 
 	if helmBinary == "" {
 		helmBinary = "helm"
@@ -32,7 +37,7 @@ func NewSync(opts ctlconf.DirectoryContentsHelmChart,
 			helmBinary = "helm3"
 		}
 	}
-	return &Sync{opts, helmBinary, refFetcher}
+	return &Sync{opts, helmBinary, refFetcher, cache, proxy}
 }
 
 func (t *Sync) Desc() string {
@@ -41,15 +46,18 @@ func (t *Sync) Desc() string {
 		desc += t.opts.Repository.URL + "@"
 	}
 	desc += t.opts.Name + ":"
-	if len(t.opts.Version) > 0 {
+	switch {
+	case len(t.opts.Version) > 0:
 		desc += t.opts.Version
-	} else {
+	case t.opts.VersionSelection != nil && t.opts.VersionSelection.Semver != nil:
+		desc += fmt.Sprintf("[%s]", t.opts.VersionSelection.Semver.Constraints)
+	default:
 		desc += "latest"
 	}
 	return desc
 }
 
-func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsHelmChart, error) {
+func (t *Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsHelmChart, error) {
 	lockConf := ctlconf.LockDirectoryContentsHelmChart{}
 
 	if len(t.opts.Name) == 0 {
@@ -70,14 +78,38 @@ func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDir
 
 	defer os.RemoveAll(helmHomeDir)
 
-	err = t.init(helmHomeDir)
+	err = t.init(ctx, helmHomeDir)
 	if err != nil {
 		return lockConf, err
 	}
 
-	err = t.fetch(helmHomeDir, chartsDir)
+	if len(t.opts.Version) == 0 && t.opts.VersionSelection != nil {
+		// Resolved version is fetched (and cached) as if it was specified explicitly
+		t.opts.Version, err = t.selectVersion(ctx)
+		if err != nil {
+			return lockConf, fmt.Errorf("Selecting helm chart version: %w", err)
+		}
+	}
+
+	cached, err := t.cache.GetDir(t.cacheKey(), chartsDir)
 	if err != nil {
-		return lockConf, err
+		return lockConf, fmt.Errorf("Reading cached helm chart: %s", err)
+	}
+
+	if !cached {
+		if t.isOCI() {
+			lockConf.Digest, err = t.fetchOCI(ctx, helmHomeDir, chartsDir)
+		} else {
+			err = t.fetch(ctx, helmHomeDir, chartsDir)
+		}
+		if err != nil {
+			return lockConf, err
+		}
+
+		err = t.cache.PutDir(t.cacheKey(), chartsDir)
+		if err != nil {
+			return lockConf, fmt.Errorf("Caching helm chart: %s", err)
+		}
 	}
 
 	chartPath, err := t.findChartDir(chartsDir)
@@ -90,6 +122,20 @@ func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDir
 		return lockConf, fmt.Errorf("Retrieving helm chart metadata: %s", err)
 	}
 
+	if t.opts.Template != nil {
+		renderedDir, err := tempArea.NewTempDir("helm-template")
+		if err != nil {
+			return lockConf, err
+		}
+
+		defer os.RemoveAll(renderedDir)
+
+		chartPath, err = t.template(ctx, helmHomeDir, chartPath, renderedDir)
+		if err != nil {
+			return lockConf, err
+		}
+	}
+
 	err = ctlfetch.MoveDir(chartPath, dstPath)
 	if err != nil {
 		return lockConf, err
@@ -101,17 +147,17 @@ func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDir
 	return lockConf, nil
 }
 
-func (t *Sync) init(helmHomeDir string) error {
+func (t *Sync) init(ctx context.Context, helmHomeDir string) error {
 	args := []string{"init", "--client-only"}
 
 	var stdoutBs, stderrBs bytes.Buffer
 
 	cmd := exec.Command(t.helmBinary, args...)
-	cmd.Env = []string{"HOME=" + helmHomeDir}
+	cmd.Env = append([]string{"HOME=" + helmHomeDir}, t.proxy.Env()...)
 	cmd.Stdout = &stdoutBs
 	cmd.Stderr = &stderrBs
 
-	err := cmd.Run()
+	err := ctlfetch.RunCommand(ctx, cmd)
 	if err != nil {
 		stderrStr := stderrBs.String()
 		// Helm 3 does not have/need init command
@@ -125,7 +171,9 @@ func (t *Sync) init(helmHomeDir string) error {
 	return nil
 }
 
-func (t *Sync) fetch(helmHomeDir, chartsPath string) error {
+// nameAndRepoURL returns chart name and its repository URL
+// (empty URL means chart is referenced via helm configured repository)
+func (t *Sync) nameAndRepoURL() (string, string, error) {
 	const (
 		stablePrefix  = "stable/"
 		stableRepoURL = "https://kubernetes-charts.storage.googleapis.com"
@@ -140,38 +188,53 @@ func (t *Sync) fetch(helmHomeDir, chartsPath string) error {
 		name = t.opts.Name
 	}
 
+	if t.opts.Repository != nil {
+		if len(t.opts.Repository.URL) == 0 {
+			return "", "", fmt.Errorf("Expected non-empty repository URL")
+		}
+		repoURL = t.opts.Repository.URL
+	}
+
+	return name, repoURL, nil
+}
+
+func (t *Sync) fetch(ctx context.Context, helmHomeDir, chartsPath string) error {
+	name, repoURL, err := t.nameAndRepoURL()
+	if err != nil {
+		return err
+	}
+
 	args := []string{"fetch", name, "--untar", "--untardir", chartsPath}
 
 	if len(t.opts.Version) > 0 {
 		args = append(args, []string{"--version", t.opts.Version}...)
 	}
 
-	if t.opts.Repository != nil {
-		if len(t.opts.Repository.URL) == 0 {
-			return fmt.Errorf("Expected non-empty repository URL")
+	if len(repoURL) > 0 {
+		tlsArgs, err := t.tlsArgs(helmHomeDir)
+		if err != nil {
+			return fmt.Errorf("Adding helm chart TLS info: %s", err)
 		}
-		repoURL = t.opts.Repository.URL
-	}
 
-	if len(repoURL) > 0 {
 		// Add repo explicitly for helm to be recognized in fetch command
 		{
 			var stdoutBs, stderrBs bytes.Buffer
 
-			cmd := exec.Command(t.helmBinary, "repo", "add", "vendir-unused", repoURL)
-			cmd.Env = []string{"HOME=" + helmHomeDir}
+			repoAddArgs := append([]string{"repo", "add", "vendir-unused", repoURL}, tlsArgs...)
+
+			cmd := exec.Command(t.helmBinary, repoAddArgs...)
+			cmd.Env = append([]string{"HOME=" + helmHomeDir}, t.proxy.Env()...)
 			cmd.Stdout = &stdoutBs
 			cmd.Stderr = &stderrBs
 
-			err := cmd.Run()
+			err := ctlfetch.RunCommand(ctx, cmd)
 			if err != nil {
 				return fmt.Errorf("Add helm chart repository: %s (stderr: %s)", err, stderrBs.String())
 			}
 		}
 
 		args = append(args, []string{"--repo", repoURL}...)
-
-		var err error
+		args = append(args, tlsArgs...)
 
 		args, err = t.addAuthArgs(args)
 		if err != nil {
@@ -182,11 +245,11 @@ func (t *Sync) fetch(helmHomeDir, chartsPath string) error {
 	var stdoutBs, stderrBs bytes.Buffer
 
 	cmd := exec.Command(t.helmBinary, args...)
-	cmd.Env = []string{"HOME=" + helmHomeDir}
+	cmd.Env = append([]string{"HOME=" + helmHomeDir}, t.proxy.Env()...)
 	cmd.Stdout = &stdoutBs
 	cmd.Stderr = &stderrBs
 
-	err := cmd.Run()
+	err = ctlfetch.RunCommand(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("Fetching helm chart: %s (stderr: %s)", err, stderrBs.String())
 	}
@@ -194,6 +257,162 @@ func (t *Sync) fetch(helmHomeDir, chartsPath string) error {
 	return nil
 }
 
+// template renders chart into given directory and
+// returns path to directory with rendered manifests
+func (t *Sync) template(ctx context.Context, helmHomeDir, chartPath, renderedDir string) (string, error) {
+	tplOpts := t.opts.Template
+
+	releaseName := tplOpts.ReleaseName
+	if len(releaseName) == 0 {
+		releaseName = filepath.Base(chartPath)
+	}
+
+	var args []string
+
+	// Helm 3 takes release name as a positional argument
+	if t.opts.HelmVersion == "3" {
+		args = []string{"template", releaseName, chartPath}
+	} else {
+		args = []string{"template", chartPath, "--name", releaseName}
+	}
+
+	args = append(args, "--output-dir", renderedDir)
+
+	if len(tplOpts.Namespace) > 0 {
+		args = append(args, "--namespace", tplOpts.Namespace)
+	}
+
+	for _, path := range tplOpts.ValuesFiles {
+		args = append(args, "--values", path)
+	}
+
+	var stdoutBs, stderrBs bytes.Buffer
+
+	cmd := exec.Command(t.helmBinary, args...)
+	cmd.Env = append([]string{"HOME=" + helmHomeDir}, t.proxy.Env()...)
+	cmd.Stdout = &stdoutBs
+	cmd.Stderr = &stderrBs
+
+	err := ctlfetch.RunCommand(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("Templating helm chart: %s (stderr: %s)", err, stderrBs.String())
+	}
+
+	// Rendered manifests are placed into directory named after chart
+	return filepath.Join(renderedDir, filepath.Base(chartPath)), nil
+}
+
+// cacheKey returns non-empty key only for charts with exact versions
+// (OCI charts are not cached since their digest is only known after pull)
+func (t *Sync) cacheKey() string {
+	if t.isOCI() || len(t.opts.Version) == 0 {
+		return ""
+	}
+	if _, err := semver.NewVersion(t.opts.Version); err != nil {
+		return ""
+	}
+	return "helmchart:" + t.Desc()
+}
+
+func (t *Sync) isOCI() bool {
+	return t.opts.Repository != nil && strings.HasPrefix(t.opts.Repository.URL, ociPrefix)
+}
+
+var (
+	// Example digest in helm pull output:
+	//   Digest: sha256:0b5ff6f6bc0a6a9e6d5c5c4fe1fd7ac4f9e6f5b9ac02d0d8d5e2fb4e1a3c1ef8
+	helmPulledDigest = regexp.MustCompile("(?m)^Digest: (sha256:[a-f0-9]+)")
+)
+
+const ociPrefix = "oci://"
+
+// fetchOCI pulls chart from OCI registry (requires Helm 3.8+)
+// and returns pulled chart digest
+func (t *Sync) fetchOCI(ctx context.Context, helmHomeDir, chartsPath string) (string, error) {
+	chartURL := strings.TrimSuffix(t.opts.Repository.URL, "/") + "/" + t.opts.Name
+
+	if t.opts.Repository.SecretRef != nil {
+		username, password, err := t.basicAuth()
+		if err != nil {
+			return "", fmt.Errorf("Reading helm chart auth info: %s", err)
+		}
+
+		registryHost := strings.SplitN(strings.TrimPrefix(chartURL, ociPrefix), "/", 2)[0]
+
+		var stdoutBs, stderrBs bytes.Buffer
+
+		loginArgs := []string{"registry", "login", registryHost, "--username", username, "--password-stdin"}
+		if t.opts.InsecureSkipTLSVerify {
+			loginArgs = append(loginArgs, "--insecure")
+		}
+
+		cmd := exec.Command(t.helmBinary, loginArgs...)
+		cmd.Env = append([]string{"HOME=" + helmHomeDir}, t.proxy.Env()...)
+		cmd.Stdin = strings.NewReader(password)
+		cmd.Stdout = &stdoutBs
+		cmd.Stderr = &stderrBs
+
+		err = ctlfetch.RunCommand(ctx, cmd)
+		if err != nil {
+			return "", fmt.Errorf("Logging into helm chart registry: %s (stderr: %s)", err, stderrBs.String())
+		}
+	}
+
+	args := []string{"pull", chartURL, "--untar", "--untardir", chartsPath}
+
+	if t.opts.InsecureSkipTLSVerify {
+		args = append(args, "--insecure-skip-tls-verify")
+	}
+
+	if len(t.opts.Version) > 0 {
+		args = append(args, []string{"--version", t.opts.Version}...)
+	}
+
+	var stdoutBs, stderrBs bytes.Buffer
+
+	cmd := exec.Command(t.helmBinary, args...)
+	cmd.Env = append([]string{"HOME=" + helmHomeDir}, t.proxy.Env()...)
+	cmd.Stdout = &stdoutBs
+	cmd.Stderr = &stderrBs
+
+	err := ctlfetch.RunCommand(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("Pulling helm chart: %s (stderr: %s)", err, stderrBs.String())
+	}
+
+	matches := helmPulledDigest.FindStringSubmatch(stdoutBs.String() + "\n" + stderrBs.String())
+	if len(matches) != 2 {
+		return "", fmt.Errorf("Expected to find pulled chart digest in output, but did not (stdout: '%s')", stdoutBs.String())
+	}
+
+	return matches[1], nil
+}
+
+func (t *Sync) basicAuth() (string, string, error) {
+	secret, err := t.refFetcher.GetSecret(t.opts.Repository.SecretRef.Name)
+	if err != nil {
+		return "", "", err
+	}
+
+	var username, password string
+
+	for name, val := range secret.Data {
+		switch name {
+		case ctlconf.SecretK8sCorev1BasicAuthUsernameKey:
+			username = string(val)
+		case ctlconf.SecretK8sCorev1BasicAuthPasswordKey:
+			password = string(val)
+		default:
+			if ctlfetch.IsTLSSecretKey(name) {
+				continue // used when fetching from chart repository
+			}
+			return "", "", fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
+		}
+	}
+
+	return username, password, nil
+}
+
 type chartMeta struct {
 	AppVersion string
 	Version    string
@@ -254,6 +473,9 @@ func (t *Sync) addAuthArgs(args []string) ([]string, error) {
 			case ctlconf.SecretK8sCorev1BasicAuthPasswordKey:
 				authArgs = append(authArgs, []string{"--password", string(val)}...)
 			default:
+				if ctlfetch.IsTLSSecretKey(name) {
+					continue // added by tlsArgs
+				}
 				return nil, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
 			}
 		}
@@ -261,3 +483,73 @@ func (t *Sync) addAuthArgs(args []string) ([]string, error) {
 
 	return append(args, authArgs...), nil
 }
+
+// tlsArgs writes client certificate, key and CA certificate
+// found in repository secret (if any) into files passed to helm
+// and disables TLS verification if requested
+func (t *Sync) tlsArgs(helmHomeDir string) ([]string, error) {
+	tlsOpts, err := t.tlsOpts()
+	if err != nil || !tlsOpts.IsPresent() {
+		return nil, err
+	}
+
+	if len(tlsOpts.CACert) > 0 && len(t.proxy.CACerts) > 0 {
+		// Helm only trusts given CA file, hence include global CA bundle
+		tlsOpts.CACert = append(append(tlsOpts.CACert, '\n'), t.proxy.CACerts...)
+	}
+
+	var args []string
+
+	for _, file := range []struct {
+		Flag    string
+		Name    string
+		Content []byte
+	}{
+		{"--cert-file", "client.crt", tlsOpts.ClientCert},
+		{"--key-file", "client.key", tlsOpts.ClientKey},
+		{"--ca-file", "ca.crt", tlsOpts.CACert},
+	} {
+		if len(file.Content) == 0 {
+			continue
+		}
+
+		path := filepath.Join(helmHomeDir, file.Name)
+
+		err := ioutil.WriteFile(path, file.Content, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Writing %s: %s", file.Name, err)
+		}
+
+		args = append(args, file.Flag, path)
+	}
+
+	if tlsOpts.InsecureSkipVerify {
+		args = append(args, "--insecure-skip-tls-verify")
+	}
+
+	return args, nil
+}
+
+// tlsOpts validates TLS configuration found in repository secret
+func (t *Sync) tlsOpts() (ctlfetch.TLSOpts, error) {
+	if t.opts.Repository == nil || t.opts.Repository.SecretRef == nil {
+		return ctlfetch.TLSOpts{InsecureSkipVerify: t.opts.InsecureSkipTLSVerify}, nil
+	}
+
+	secret, err := t.refFetcher.GetSecret(t.opts.Repository.SecretRef.Name)
+	if err != nil {
+		return ctlfetch.TLSOpts{}, err
+	}
+
+	tlsOpts := ctlfetch.NewTLSOptsFromSecret(secret)
+	tlsOpts.InsecureSkipVerify = t.opts.InsecureSkipTLSVerify
+
+	if tlsOpts.IsPresent() {
+		_, err = tlsOpts.Config()
+		if err != nil {
+			return ctlfetch.TLSOpts{}, fmt.Errorf("Configuring TLS with secret '%s': %s", secret.Metadata.Name, err)
+		}
+	}
+
+	return tlsOpts, nil
+}
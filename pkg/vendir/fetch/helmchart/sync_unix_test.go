@@ -0,0 +1,100 @@
+//go:build !windows
+// +build !windows
+
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package helmchart
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// slowHelm hangs while fetching chart; its child process
+// keeps output open so that only killing process group helps
+const slowHelm = `#!/bin/sh
+case "$1" in
+  init) exit 0 ;;
+esac
+/bin/sleep 60 &
+echo $! > %s
+/bin/sleep 60
+`
+
+func TestSyncKillsHungHelmAfterTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-helm-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	childPidPath := filepath.Join(dir, "child-pid")
+	helmPath := filepath.Join(dir, "helm")
+
+	err = ioutil.WriteFile(helmPath, []byte(fmt.Sprintf(slowHelm, childPidPath)), 0700)
+	if err != nil {
+		t.Fatalf("Writing slow helm: %s", err)
+	}
+
+	opts := ctlconf.DirectoryContentsHelmChart{Name: "redis", Version: "1.0.0"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+
+	_, err = NewSync(opts, helmPath, ctlfetch.NoopRefFetcher{}, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).
+		Sync(ctx, filepath.Join(dir, "dst"), testTempArea{dir})
+	if err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Fatalf("Expected sync to time out, but was: %v", err)
+	}
+
+	if duration := time.Since(startTime); duration > 3*time.Second {
+		t.Fatalf("Expected hung helm to be killed promptly, but sync took %s", duration)
+	}
+
+	pidBs, err := ioutil.ReadFile(childPidPath)
+	if err != nil {
+		t.Fatalf("Reading child pid: %s", err)
+	}
+
+	childPid, err := strconv.Atoi(strings.TrimSpace(string(pidBs)))
+	if err != nil {
+		t.Fatalf("Parsing child pid: %s", err)
+	}
+
+	// Killed child may remain a zombie until reaped by init
+	for i := 0; i < 50; i++ {
+		statBs, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", childPid))
+		if syscall.Kill(childPid, 0) != nil || (err == nil && strings.Contains(string(statBs), ") Z ")) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected child process %d of hung helm to be killed", childPid)
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package helmchart
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlver "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/versions"
+)
+
+type repoIndex struct {
+	Entries map[string][]struct {
+		Version string `json:"version"`
+	} `json:"entries"`
+}
+
+// selectVersion returns highest chart version listed
+// in repository index that matches version selection
+func (t *Sync) selectVersion(ctx context.Context) (string, error) {
+	name, repoURL, err := t.nameAndRepoURL()
+	if err != nil {
+		return "", err
+	}
+
+	if len(repoURL) == 0 {
+		return "", fmt.Errorf("Expected repository URL to be specified")
+	}
+
+	index, err := t.fetchIndex(ctx, repoURL)
+	if err != nil {
+		return "", fmt.Errorf("Fetching repository index: %w", err)
+	}
+
+	var chartVersions []string
+	for _, entry := range index.Entries[name] {
+		chartVersions = append(chartVersions, entry.Version)
+	}
+
+	if len(chartVersions) == 0 {
+		return "", ctlfetch.NewNonRetryableError(fmt.Errorf(
+			"Expected to find chart '%s' in repository index, but did not", name))
+	}
+
+	semverSel := t.opts.VersionSelection.Semver
+
+	allVers := ctlver.NewSemvers(chartVersions)
+	matchedVers := allVers.FilterPrereleases(semverSel.Prereleases)
+
+	if len(semverSel.Constraints) > 0 {
+		matchedVers, err = matchedVers.FilterConstraints(semverSel.Constraints)
+		if err != nil {
+			return "", fmt.Errorf("Selecting versions: %s", err)
+		}
+	}
+
+	highestVersion, found := matchedVers.Highest()
+	if !found {
+		return "", ctlfetch.NewNonRetryableError(fmt.Errorf(
+			"Expected to find at least one version matching constraints '%s', but did not (available versions: %s)",
+			semverSel.Constraints, strings.Join(allVers.Sorted().All(), ", ")))
+	}
+
+	return highestVersion, nil
+}
+
+// ListVersions returns chart versions (highest first)
+// listed in repository index without fetching chart
+func (t *Sync) ListVersions(ctx context.Context) ([]string, error) {
+	if t.isOCI() {
+		return nil, fmt.Errorf("Expected helm chart repository to not be OCI registry to list versions")
+	}
+
+	name, repoURL, err := t.nameAndRepoURL()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(repoURL) == 0 {
+		return nil, fmt.Errorf("Expected repository URL to be specified")
+	}
+
+	index, err := t.fetchIndex(ctx, repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("Fetching repository index: %w", err)
+	}
+
+	var chartVersions []string
+	for _, entry := range index.Entries[name] {
+		chartVersions = append(chartVersions, entry.Version)
+	}
+
+	return ctlver.SortedWithOthers(chartVersions), nil
+}
+
+func (t *Sync) fetchIndex(ctx context.Context, repoURL string) (repoIndex, error) {
+	var index repoIndex
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(repoURL, "/")+"/index.yaml", nil)
+	if err != nil {
+		return index, fmt.Errorf("Building request: %s", err)
+	}
+
+	if t.opts.Repository != nil && t.opts.Repository.SecretRef != nil {
+		username, password, err := t.basicAuth()
+		if err != nil {
+			return index, fmt.Errorf("Reading helm chart auth info: %s", err)
+		}
+		req.SetBasicAuth(username, password)
+	}
+
+	tlsOpts, err := t.tlsOpts()
+	if err != nil {
+		return index, err
+	}
+
+	client := t.proxy.HTTPClient()
+
+	if tlsOpts.IsPresent() {
+		tlsConfig, err := tlsOpts.Config()
+		if err != nil {
+			return index, err
+		}
+		client = t.proxy.HTTPClientWithTLS(tlsConfig)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return index, ctlfetch.ExplainTLSError(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return index, ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf("Expected 200 OK, but was '%s'", resp.Status))
+	}
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return index, fmt.Errorf("Reading index: %s", err)
+	}
+
+	err = yaml.Unmarshal(bs, &index)
+	if err != nil {
+		return index, fmt.Errorf("Unmarshaling index: %s", err)
+	}
+
+	return index, nil
+}
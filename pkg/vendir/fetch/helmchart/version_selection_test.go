@@ -0,0 +1,57 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package helmchart
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlver "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/versions"
+)
+
+func TestSyncSelectVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`
+apiVersion: v1
+entries:
+  redis:
+  - version: 2.1.0
+  - version: 3.0.0-rc.1
+  - version: 2.10.1
+  - version: 1.5.0
+`))
+	}))
+	defer server.Close()
+
+	newSync := func(constraints string) *Sync {
+		opts := ctlconf.DirectoryContentsHelmChart{
+			Name:             "redis",
+			VersionSelection: &ctlver.VersionSelection{Semver: &ctlver.VersionSelectionSemver{Constraints: constraints}},
+			Repository:       &ctlconf.DirectoryContentsHelmChartRepo{URL: server.URL},
+		}
+		return NewSync(opts, "", ctlfetch.NoopRefFetcher{}, ctlfetch.Cache{}, ctlfetch.ProxyOpts{})
+	}
+
+	version, err := newSync("2.x").selectVersion(context.Background())
+	if err != nil {
+		t.Fatalf("Expected version selection to succeed: %s", err)
+	}
+	if version != "2.10.1" {
+		t.Fatalf("Expected highest matching version, but was '%s'", version)
+	}
+
+	_, err = newSync(">=4.0.0").selectVersion(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "available versions: 1.5.0, 2.1.0, 2.10.1, 3.0.0-rc.1") {
+		t.Fatalf("Expected error listing available versions, but was: %v", err)
+	}
+}
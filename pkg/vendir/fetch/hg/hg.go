@@ -0,0 +1,209 @@
+package hg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type Hg struct {
+	opts       ctlconf.DirectoryContentsHg
+	hgBinary   string
+	infoLog    io.Writer
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewHg(opts ctlconf.DirectoryContentsHg, hgBinary string,
+	infoLog io.Writer, refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) *Hg {
+
+	return &Hg{opts, hgBinary, infoLog, refFetcher, proxy}
+}
+
+type HgInfo struct {
+	SHA            string
+	ChangesetTitle string
+}
+
+func (t *Hg) Retrieve(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (HgInfo, error) {
+	if len(t.opts.URL) == 0 {
+		return HgInfo{}, fmt.Errorf("Expected non-empty URL")
+	}
+	if len(t.opts.Ref) == 0 {
+		return HgInfo{}, fmt.Errorf("Expected non-empty ref")
+	}
+
+	err := t.fetch(ctx, dstPath, tempArea)
+	if err != nil {
+		return HgInfo{}, err
+	}
+
+	out, err := t.run(ctx, []string{"log", "-r", ".", "--template", "{node}"}, nil, dstPath)
+	if err != nil {
+		return HgInfo{}, err
+	}
+
+	info := HgInfo{SHA: strings.TrimSpace(out)}
+
+	out, err = t.run(ctx, []string{"log", "-r", ".", "--template", "{desc}"}, nil, dstPath)
+	if err != nil {
+		return HgInfo{}, err
+	}
+
+	info.ChangesetTitle = strings.TrimSpace(out)
+
+	return info, nil
+}
+
+func (t *Hg) fetch(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) error {
+	authOpts, err := t.getAuthOpts()
+	if err != nil {
+		return err
+	}
+
+	authDir, err := tempArea.NewTempDir("hg-auth")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(authDir)
+
+	// Avoid picking up user's hgrc settings (e.g. extensions, aliases)
+	env := append(os.Environ(), "HGPLAIN=1", "HGRCPATH="+filepath.Join(authDir, "hgrc"))
+	env = append(env, t.proxy.Env()...)
+
+	var hgrc []string
+
+	if authOpts.PrivateKey != nil {
+		sshCmd := []string{"ssh", "-o", "ServerAliveInterval=30", "-o", "ForwardAgent=no", "-F", "/dev/null"}
+
+		path := filepath.Join(authDir, "private-key")
+
+		err = ioutil.WriteFile(path, []byte(*authOpts.PrivateKey), 0600)
+		if err != nil {
+			return fmt.Errorf("Writing private key: %s", err)
+		}
+
+		sshCmd = append(sshCmd, "-i", path, "-o", "IdentitiesOnly=yes")
+
+		if authOpts.KnownHosts != nil {
+			path := filepath.Join(authDir, "known-hosts")
+
+			err = ioutil.WriteFile(path, []byte(*authOpts.KnownHosts), 0600)
+			if err != nil {
+				return fmt.Errorf("Writing known hosts: %s", err)
+			}
+
+			sshCmd = append(sshCmd, "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile="+path)
+		} else {
+			sshCmd = append(sshCmd, "-o", "StrictHostKeyChecking=no")
+		}
+
+		hgrc = append(hgrc, "[ui]", "ssh = "+strings.Join(sshCmd, " "))
+	}
+
+	if authOpts.Username != nil && authOpts.Password != nil {
+		if !strings.HasPrefix(t.opts.URL, "https://") {
+			return fmt.Errorf("Username/password authentication is only supported for https remotes")
+		}
+
+		hgURL, err := url.Parse(t.opts.URL)
+		if err != nil {
+			return fmt.Errorf("Parsing hg remote url: %s", err)
+		}
+
+		hgrc = append(hgrc, "[auth]",
+			"vendir.prefix = "+hgURL.Host,
+			"vendir.schemes = https",
+			"vendir.username = "+*authOpts.Username,
+			"vendir.password = "+*authOpts.Password)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(authDir, "hgrc"), []byte(strings.Join(hgrc, "\n")+"\n"), 0600)
+	if err != nil {
+		return fmt.Errorf("Writing hgrc: %s", err)
+	}
+
+	argss := [][]string{
+		{"init"},
+		{"pull", t.opts.URL},
+		{"update", "--clean", "--rev", t.opts.Ref},
+	}
+
+	for _, args := range argss {
+		_, err := t.run(ctx, args, env, dstPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Hg) run(ctx context.Context, args []string, env []string, dstPath string) (string, error) {
+	var stdoutBs, stderrBs bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, t.hgBinary, args...)
+	cmd.Env = env
+	cmd.Dir = dstPath
+	cmd.Stdout = io.MultiWriter(t.infoLog, &stdoutBs)
+	cmd.Stderr = io.MultiWriter(t.infoLog, &stderrBs)
+
+	t.infoLog.Write([]byte(fmt.Sprintf("--> hg %s\n", strings.Join(args, " "))))
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("Hg %s: %s (stderr: %s)", args, err, stderrBs.String())
+	}
+
+	return stdoutBs.String(), nil
+}
+
+type hgAuthOpts struct {
+	PrivateKey *string
+	KnownHosts *string
+	Username   *string
+	Password   *string
+}
+
+func (t *Hg) getAuthOpts() (hgAuthOpts, error) {
+	var opts hgAuthOpts
+
+	if t.opts.SecretRef != nil {
+		secret, err := t.refFetcher.GetSecret(t.opts.SecretRef.Name)
+		if err != nil {
+			return opts, err
+		}
+
+		for name, val := range secret.Data {
+			switch name {
+			case ctlconf.SecretK8sCoreV1SSHAuthPrivateKey:
+				key := string(val)
+				opts.PrivateKey = &key
+			case ctlconf.SecretSSHAuthKnownHosts:
+				hosts := string(val)
+				opts.KnownHosts = &hosts
+			case ctlconf.SecretK8sCorev1BasicAuthUsernameKey:
+				username := string(val)
+				opts.Username = &username
+			case ctlconf.SecretK8sCorev1BasicAuthPasswordKey:
+				password := string(val)
+				opts.Password = &password
+			default:
+				return opts, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, t.opts.SecretRef.Name)
+			}
+		}
+	}
+
+	return opts, nil
+}
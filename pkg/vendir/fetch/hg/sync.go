@@ -0,0 +1,79 @@
+package hg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type Sync struct {
+	opts       ctlconf.DirectoryContentsHg
+	hgBinary   string
+	log        io.Writer
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewSync(opts ctlconf.DirectoryContentsHg, hgBinary string,
+	log io.Writer, refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) Sync {
+
+	if len(hgBinary) == 0 {
+		hgBinary = "hg"
+	}
+
+	return Sync{opts, hgBinary, log, refFetcher, proxy}
+}
+
+func (d Sync) Desc() string {
+	ref := "?"
+	if len(d.opts.Ref) > 0 {
+		ref = d.opts.Ref
+	}
+	return fmt.Sprintf("%s@%s", d.opts.URL, ref)
+}
+
+func (d Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsHg, error) {
+	hgLockConf := ctlconf.LockDirectoryContentsHg{}
+
+	incomingTmpPath, err := tempArea.NewTempDir("hg")
+	if err != nil {
+		return hgLockConf, err
+	}
+
+	defer os.RemoveAll(incomingTmpPath)
+
+	hg := NewHg(d.opts, d.hgBinary, d.log, d.refFetcher, d.proxy)
+
+	info, err := hg.Retrieve(ctx, incomingTmpPath, tempArea)
+	if err != nil {
+		return hgLockConf, fmt.Errorf("Fetching hg repository: %w", err)
+	}
+
+	hgLockConf.SHA = info.SHA
+	hgLockConf.ChangesetTitle = d.singleLineChangesetTitle(info.ChangesetTitle)
+
+	err = os.RemoveAll(dstPath)
+	if err != nil {
+		return hgLockConf, fmt.Errorf("Deleting dir %s: %s", dstPath, err)
+	}
+
+	err = os.Rename(incomingTmpPath, dstPath)
+	if err != nil {
+		return hgLockConf, fmt.Errorf("Moving directory '%s' to staging dir: %s", incomingTmpPath, err)
+	}
+
+	return hgLockConf, nil
+}
+
+func (Sync) singleLineChangesetTitle(in string) string {
+	pieces := strings.SplitN(in, "\n", 2)
+	if len(pieces) > 1 {
+		return pieces[0] + "..."
+	}
+	return pieces[0]
+}
@@ -0,0 +1,100 @@
+package hg_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlhg "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/hg"
+)
+
+func TestSyncFromLocalRepo(t *testing.T) {
+	_, err := exec.LookPath("hg")
+	if err != nil {
+		t.Skip("Skipping since hg is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "vendir-hg-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoPath := filepath.Join(dir, "repo")
+
+	runHg := func(args ...string) string {
+		cmd := exec.Command("hg", args...)
+		cmd.Dir = repoPath
+		cmd.Env = append(os.Environ(), "HGPLAIN=1", "HGRCPATH=", "HGUSER=vendir <vendir@example.com>")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Running hg %s: %s (output: %s)", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	err = os.MkdirAll(repoPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating repo dir: %s", err)
+	}
+
+	runHg("init")
+
+	for _, content := range []string{"v1", "v2"} {
+		err = ioutil.WriteFile(filepath.Join(repoPath, "file.txt"), []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+		runHg("commit", "--addremove", "-m", "commit "+content+"\n\nwith description")
+		runHg("tag", content)
+	}
+
+	tests := []struct {
+		ref             string
+		expectedContent string
+		expectedLock    ctlconf.LockDirectoryContentsHg
+	}{
+		{"v1", "v1", ctlconf.LockDirectoryContentsHg{SHA: runHg("log", "-r", "v1", "--template", "{node}"), ChangesetTitle: "commit v1..."}},
+		// Branch resolves to its head (changeset that added v2 tag)
+		{"default", "v2", ctlconf.LockDirectoryContentsHg{SHA: runHg("log", "-r", "default", "--template", "{node}"), ChangesetTitle: "Added tag v2 for changeset " +
+			runHg("log", "-r", "v2", "--template", "{node|short}")}},
+	}
+
+	for _, test := range tests {
+		dstPath := filepath.Join(dir, "dst-"+test.ref)
+
+		lockConf, err := ctlhg.NewSync(ctlconf.DirectoryContentsHg{URL: repoPath, Ref: test.ref}, "",
+			ioutil.Discard, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).Sync(context.Background(), dstPath, testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected syncing '%s' to succeed: %s", test.ref, err)
+		}
+
+		if !reflect.DeepEqual(lockConf, test.expectedLock) {
+			t.Fatalf("Expected lock for '%s' to be %#v, but was %#v", test.ref, test.expectedLock, lockConf)
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(dstPath, "file.txt"))
+		if err != nil || string(bs) != test.expectedContent {
+			t.Fatalf("Expected '%s' to check out '%s', but was '%s' (err: %v)", test.ref, test.expectedContent, bs, err)
+		}
+	}
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+// syncFiles downloads each configured file into its path (files are
+// not unpacked); recorded sha256 is a digest of all file paths and digests
+func (t *Sync) syncFiles(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsHTTP, error) {
+	lockConf := ctlconf.LockDirectoryContentsHTTP{}
+
+	incomingTmpPath, err := tempArea.NewTempDir("http")
+	if err != nil {
+		return lockConf, err
+	}
+
+	defer os.RemoveAll(incomingTmpPath)
+
+	combinedSHA256 := sha256.New()
+
+	for _, file := range t.opts.Files {
+		fileSHA256, err := t.syncFile(ctx, file, incomingTmpPath, tempArea)
+		if err != nil {
+			return lockConf, fmt.Errorf("Syncing file '%s': %s", file.Path, err)
+		}
+
+		lockConf.Files = append(lockConf.Files, ctlconf.LockDirectoryContentsHTTPFile{Path: file.Path, SHA256: fileSHA256})
+
+		fmt.Fprintf(combinedSHA256, "%s:%s\n", file.Path, fileSHA256)
+	}
+
+	lockConf.SHA256 = fmt.Sprintf("%x", combinedSHA256.Sum(nil))
+
+	err = ctlfetch.MoveDir(incomingTmpPath, dstPath)
+	if err != nil {
+		return lockConf, err
+	}
+
+	return lockConf, nil
+}
+
+func (t *Sync) syncFile(ctx context.Context, file ctlconf.DirectoryContentsHTTPFile,
+	dstPath string, tempArea ctlfetch.TempArea) (string, error) {
+
+	fileOpts := t.opts
+	fileOpts.Files = nil
+	fileOpts.URL = file.URL
+	fileOpts.SHA256 = file.SHA256
+	fileOpts.SHA512 = file.SHA512
+
+	tmpFile, err := tempArea.NewTempFile("vendir-http")
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	fileSHA256, err := NewSync(fileOpts, t.refFetcher, t.cache, t.proxy).fetchFile(ctx, tmpFile)
+	if err != nil {
+		return "", err
+	}
+
+	dstFilePath, err := ctlfetch.ScopedPath(dstPath, file.Path)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(dstFilePath), 0755)
+	if err != nil {
+		return "", fmt.Errorf("Making intermediate dir: %s", err)
+	}
+
+	dstFile, err := os.Create(dstFilePath)
+	if err != nil {
+		return "", fmt.Errorf("Creating dst file: %s", err)
+	}
+
+	defer dstFile.Close()
+
+	// Cached content is copied to path of tmp file, hence reopened
+	srcFile, err := os.Open(tmpFile.Name())
+	if err != nil {
+		return "", fmt.Errorf("Opening downloaded file: %s", err)
+	}
+
+	defer srcFile.Close()
+
+	// Cannot just move since it may be on a different device
+	_, err = io.Copy(dstFile, srcFile)
+	if err != nil {
+		return "", fmt.Errorf("Copying into dst file: %s", err)
+	}
+
+	return fileSHA256, nil
+}
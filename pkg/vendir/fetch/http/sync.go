@@ -4,12 +4,16 @@
 package http
 
 import (
+	"context"
 	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
 	"hash"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
 	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
@@ -18,15 +22,27 @@ import (
 type Sync struct {
 	opts       ctlconf.DirectoryContentsHTTP
 	refFetcher ctlfetch.RefFetcher
+	cache      ctlfetch.Cache
+	proxy      ctlfetch.ProxyOpts
+
+	// Validators of last downloaded response
+	etag         string
+	lastModified string
 }
 
-func NewSync(opts ctlconf.DirectoryContentsHTTP, refFetcher ctlfetch.RefFetcher) *Sync {
-	return &Sync{opts, refFetcher}
+func NewSync(opts ctlconf.DirectoryContentsHTTP, refFetcher ctlfetch.RefFetcher,
+	cache ctlfetch.Cache, proxy ctlfetch.ProxyOpts) *Sync {
+
+	return &Sync{opts: opts, refFetcher: refFetcher, cache: cache, proxy: proxy}
 }
 
-func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsHTTP, error) {
+func (t *Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsHTTP, error) {
 	lockConf := ctlconf.LockDirectoryContentsHTTP{}
 
+	if len(t.opts.Files) > 0 {
+		return t.syncFiles(ctx, dstPath, tempArea)
+	}
+
 	if len(t.opts.URL) == 0 {
 		return lockConf, fmt.Errorf("Expected non-empty URL")
 	}
@@ -38,11 +54,14 @@ func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDir
 
 	defer os.Remove(tmpFile.Name())
 
-	err = t.downloadFileAndChecksum(tmpFile)
+	lockConf.SHA256, err = t.fetchFile(ctx, tmpFile)
 	if err != nil {
-		return lockConf, fmt.Errorf("Downloading URL: %s", err)
+		return lockConf, err
 	}
 
+	lockConf.ETag = t.etag
+	lockConf.LastModified = t.lastModified
+
 	incomingTmpPath, err := tempArea.NewTempDir("http")
 	if err != nil {
 		return lockConf, err
@@ -50,12 +69,12 @@ func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDir
 
 	defer os.RemoveAll(incomingTmpPath)
 
-	_, err = ctlfetch.NewArchive(tmpFile.Name(), true, t.opts.URL).Unpack(incomingTmpPath)
+	_, err = ctlfetch.NewArchive(tmpFile.Name(), true, t.opts.URL, t.opts.StripComponents).Unpack(incomingTmpPath)
 	if err != nil {
 		return lockConf, fmt.Errorf("Unpacking archive: %s", err)
 	}
 
-	err = ctlfetch.MoveDir(incomingTmpPath, dstPath)
+	err = ctlfetch.MoveSubDir(incomingTmpPath, t.opts.SubPath, dstPath)
 	if err != nil {
 		return lockConf, err
 	}
@@ -63,63 +82,269 @@ func (t *Sync) Sync(dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDir
 	return lockConf, nil
 }
 
-func (t *Sync) downloadFile(dst io.Writer) error {
-	req, err := http.NewRequest("GET", t.opts.URL, nil)
+// fetchFile downloads URL into given file (unless it is found in cache)
+// and returns sha256 digest of its content
+func (t *Sync) fetchFile(ctx context.Context, dst *os.File) (string, error) {
+	cached, err := t.cache.GetFile(t.opts.SHA256, dst.Name())
 	if err != nil {
-		return fmt.Errorf("Building request: %s", err)
+		return "", fmt.Errorf("Reading cached download: %s", err)
 	}
 
-	err = t.addAuth(req)
+	if cached {
+		return t.opts.SHA256, nil
+	}
+
+	sha256, err := t.downloadFileAndChecksum(ctx, dst)
+	if err != nil {
+		return "", fmt.Errorf("Downloading URL: %w", err)
+	}
+
+	err = t.cache.PutFile(sha256, dst.Name())
+	if err != nil {
+		return "", fmt.Errorf("Caching download: %s", err)
+	}
+
+	return sha256, nil
+}
+
+// NotModified checks via conditional request whether URL content
+// is unchanged since it was downloaded with given validators.
+// Servers that do not support conditional requests are treated as modified.
+func (t *Sync) NotModified(ctx context.Context, lockConf ctlconf.LockDirectoryContentsHTTP) (bool, error) {
+	if len(lockConf.ETag) == 0 && len(lockConf.LastModified) == 0 {
+		return false, nil
+	}
+
+	req, err := t.newRequest(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if len(lockConf.ETag) > 0 {
+		req.Header.Set("If-None-Match", lockConf.ETag)
+	}
+	if len(lockConf.LastModified) > 0 {
+		req.Header.Set("If-Modified-Since", lockConf.LastModified)
+	}
+
+	client, err := t.httpClient()
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("Adding auth to request: %s", err)
+		return false, fmt.Errorf("Checking if URL was modified: %s", ctlfetch.ExplainTLSError(err))
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	// Body of modified content is not read; it is downloaded separately
+	resp.Body.Close()
+
+	return resp.StatusCode == http.StatusNotModified, nil
+}
+
+const (
+	maxResumeAttempts = 3
+)
+
+// downloadFile resumes interrupted downloads via range requests
+// if server advertises support for them
+func (t *Sync) downloadFile(ctx context.Context, dst *os.File) error {
+	var written int64
+
+	for resumeAttempt := 0; ; resumeAttempt++ {
+		acceptsRanges, err := t.downloadFileFrom(ctx, dst, &written)
+		if err == nil {
+			return nil
+		}
+		if !acceptsRanges || written == 0 || resumeAttempt == maxResumeAttempts {
+			return err
+		}
+	}
+}
+
+// downloadFileFrom appends content starting at given offset
+// and returns whether server supports range requests
+func (t *Sync) downloadFileFrom(ctx context.Context, dst *os.File, written *int64) (bool, error) {
+	req, err := t.newRequest(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if *written > 0 {
+		// Server only honors range if content did not change since
+		// previous attempt (otherwise it responds with entire content)
+		ifRange := t.ifRangeValidator()
+		if len(ifRange) == 0 {
+			err = t.resetDownload(dst, written)
+			if err != nil {
+				return false, err
+			}
+		} else {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", *written))
+			req.Header.Set("If-Range", ifRange)
+		}
+	}
+
+	client, err := t.httpClient()
 	if err != nil {
-		return fmt.Errorf("Initiating URL download: %s", err)
+		return false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("Initiating URL download: %s", ctlfetch.ExplainTLSError(err))
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Expected 200 OK, but was '%s'", resp.Status)
+	switch {
+	case *written > 0 && resp.StatusCode == http.StatusPartialContent:
+		// Continue writing where previous attempt stopped
+		// unless server responded with a different range
+		if !t.startsAt(resp.Header.Get("Content-Range"), *written) {
+			resp.Body.Close()
+
+			err = t.resetDownload(dst, written)
+			if err != nil {
+				return false, err
+			}
+
+			return t.downloadFileFrom(ctx, dst, written)
+		}
+
+	case resp.StatusCode == http.StatusOK:
+		// Server may ignore range header (or content has changed), hence start from scratch
+		if *written > 0 {
+			err = t.resetDownload(dst, written)
+			if err != nil {
+				return false, err
+			}
+		}
+
+	default:
+		return false, ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf("Expected 200 OK, but was '%s'", resp.Status))
+	}
+
+	// Content length of partial response only includes remaining bytes
+	err = ctlfetch.CheckFreeSpace(filepath.Dir(dst.Name()), resp.ContentLength, "to download URL")
+	if err != nil {
+		return false, err
+	}
+
+	acceptsRanges := resp.Header.Get("Accept-Ranges") == "bytes" || resp.StatusCode == http.StatusPartialContent
+
+	t.etag = resp.Header.Get("ETag")
+	t.lastModified = resp.Header.Get("Last-Modified")
+
+	n, err := io.Copy(io.MultiWriter(dst, ctlfetch.NewBytesProgressWriter(ctx)), ctlfetch.NewRateLimitedReader(ctx, resp.Body))
+	*written += n
+	if err != nil {
+		return acceptsRanges, fmt.Errorf("Writing downloaded content: %s", err)
+	}
+
+	return acceptsRanges, nil
+}
+
+// ifRangeValidator returns validator of previously downloaded content
+// that can be used in If-Range header (weak ETags are not allowed)
+func (t *Sync) ifRangeValidator() string {
+	if len(t.etag) > 0 && !strings.HasPrefix(t.etag, "W/") {
+		return t.etag
+	}
+	return t.lastModified
+}
+
+// startsAt checks that Content-Range header (e.g. 'bytes 100-199/200')
+// describes content starting at given offset
+func (t *Sync) startsAt(contentRange string, offset int64) bool {
+	var start, end int64
+	var total string
+
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total)
+	return err == nil && start == offset
+}
+
+func (t *Sync) resetDownload(dst *os.File, written *int64) error {
+	_, err := dst.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("Resetting downloaded content: %s", err)
 	}
 
-	_, err = io.Copy(dst, resp.Body)
+	err = dst.Truncate(0)
 	if err != nil {
-		return fmt.Errorf("Writing downloaded content: %s", err)
+		return fmt.Errorf("Resetting downloaded content: %s", err)
 	}
 
+	*written = 0
+
 	return nil
 }
 
-func (t *Sync) downloadFileAndChecksum(dst io.Writer) error {
-	var digestName, expectedDigestVal string
-	var digestDst hash.Hash
+// downloadFileAndChecksum returns sha256 digest of downloaded content
+// regardless of whether expected digest was specified
+func (t *Sync) downloadFileAndChecksum(ctx context.Context, dst *os.File) (string, error) {
+	err := t.downloadFile(ctx, dst)
+	if err != nil {
+		return "", err
+	}
 
-	switch {
-	case len(t.opts.SHA256) > 0:
-		digestName = "sha256"
-		digestDst = sha256.New()
-		expectedDigestVal = t.opts.SHA256
-		dst = io.MultiWriter(dst, digestDst)
+	// Checksum is calculated over final file contents
+	// so that resumed downloads are verified as a whole
+	_, err = dst.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("Rewinding downloaded content: %s", err)
 	}
 
-	err := t.downloadFile(dst)
+	sha256Dst := sha256.New()
+	sha512Dst := sha512.New()
+
+	_, err = io.Copy(io.MultiWriter(sha256Dst, sha512Dst), dst)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("Reading downloaded content: %s", err)
 	}
 
-	if len(expectedDigestVal) > 0 {
-		actualDigestVal := fmt.Sprintf("%x", digestDst.Sum(nil))
+	digests := []struct {
+		Name     string
+		Expected string
+		Actual   hash.Hash
+	}{
+		{"sha256", t.opts.SHA256, sha256Dst},
+		{"sha512", t.opts.SHA512, sha512Dst},
+	}
 
-		if expectedDigestVal != actualDigestVal {
+	for _, digest := range digests {
+		if len(digest.Expected) == 0 {
+			continue
+		}
+
+		actualDigestVal := fmt.Sprintf("%x", digest.Actual.Sum(nil))
+
+		if digest.Expected != actualDigestVal {
 			errMsg := "Expected digest to match '%s:%s', but was '%s:%s'"
-			return fmt.Errorf(errMsg, digestName, expectedDigestVal, digestName, actualDigestVal)
+			return "", ctlfetch.NewNonRetryableError(fmt.Errorf(errMsg, digest.Name, digest.Expected, digest.Name, actualDigestVal))
 		}
 	}
 
-	return nil
+	return fmt.Sprintf("%x", sha256Dst.Sum(nil)), nil
+}
+
+func (t *Sync) newRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.opts.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Building request: %s", err)
+	}
+
+	for name, val := range t.opts.Headers {
+		req.Header.Set(name, val)
+	}
+
+	err = t.addAuth(req)
+	if err != nil {
+		return nil, fmt.Errorf("Adding auth to request: %s", err)
+	}
+
+	return req, nil
 }
 
 func (t *Sync) addAuth(req *http.Request) error {
@@ -136,15 +361,59 @@ func (t *Sync) addAuth(req *http.Request) error {
 		switch name {
 		case ctlconf.SecretK8sCorev1BasicAuthUsernameKey:
 		case ctlconf.SecretK8sCorev1BasicAuthPasswordKey:
+		case ctlconf.SecretToken:
 		default:
+			if ctlfetch.IsTLSSecretKey(name) {
+				continue // used by http client
+			}
 			return fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
 		}
 	}
 
-	if _, found := secret.Data[ctlconf.SecretK8sCorev1BasicAuthUsernameKey]; found {
+	_, hasUsername := secret.Data[ctlconf.SecretK8sCorev1BasicAuthUsernameKey]
+	_, hasToken := secret.Data[ctlconf.SecretToken]
+
+	switch {
+	case hasUsername && hasToken:
+		return fmt.Errorf("Expected either username or token in secret '%s', but found both", secret.Metadata.Name)
+
+	case hasUsername:
 		req.SetBasicAuth(string(secret.Data[ctlconf.SecretK8sCorev1BasicAuthUsernameKey]),
 			string(secret.Data[ctlconf.SecretK8sCorev1BasicAuthPasswordKey]))
+
+	case hasToken:
+		req.Header.Set("Authorization", "Bearer "+string(secret.Data[ctlconf.SecretToken]))
 	}
 
 	return nil
 }
+
+// httpClient configures client certificate and CA certificate
+// found in secret (if any) and whether TLS verification is skipped
+func (t *Sync) httpClient() (*http.Client, error) {
+	tlsOpts := ctlfetch.TLSOpts{InsecureSkipVerify: t.opts.InsecureSkipTLSVerify}
+
+	if t.opts.SecretRef != nil {
+		secret, err := t.refFetcher.GetSecret(t.opts.SecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsOpts = ctlfetch.NewTLSOptsFromSecret(secret)
+		tlsOpts.InsecureSkipVerify = t.opts.InsecureSkipTLSVerify
+	}
+
+	if !tlsOpts.IsPresent() {
+		return t.proxy.HTTPClient(), nil
+	}
+
+	tlsConfig, err := tlsOpts.Config()
+	if err != nil {
+		if t.opts.SecretRef == nil {
+			return nil, ctlfetch.NewNonRetryableError(fmt.Errorf("Configuring TLS: %s", err))
+		}
+		return nil, ctlfetch.NewNonRetryableError(fmt.Errorf("Configuring TLS with secret '%s': %s", t.opts.SecretRef.Name, err))
+	}
+
+	return t.proxy.HTTPClientWithTLS(tlsConfig), nil
+}
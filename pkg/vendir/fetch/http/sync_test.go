@@ -0,0 +1,346 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlhttp "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/http"
+)
+
+func TestSyncResumesInterruptedDownload(t *testing.T) {
+	oldContent := strings.Repeat("content", 1000)
+	newContent := strings.Repeat("changed", 1000)
+
+	for _, changed := range []bool{false, true} {
+		var requests []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Header.Get("Range")+";"+r.Header.Get("If-Range"))
+
+			if len(requests) == 1 {
+				// Advertise full length but drop connection half way
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("ETag", `"old"`)
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(oldContent)))
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(oldContent[:len(oldContent)/2]))
+
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+
+			// Range is ignored when If-Range does not match current ETag
+			if changed {
+				w.Header().Set("ETag", `"new"`)
+				http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(newContent))
+			} else {
+				w.Header().Set("ETag", `"old"`)
+				http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(oldContent))
+			}
+		}))
+		defer server.Close()
+
+		dir, err := ioutil.TempDir("", "vendir-http-test")
+		if err != nil {
+			t.Fatalf("Creating tmp dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		expectedContent := oldContent
+		if changed {
+			expectedContent = newContent
+		}
+
+		opts := ctlconf.DirectoryContentsHTTP{URL: server.URL + "/file.txt"}
+		dstPath := filepath.Join(dir, "dst")
+
+		_, err = ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).Sync(context.Background(), dstPath, testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected sync to succeed: %s", err)
+		}
+
+		expectedRequest := fmt.Sprintf(`bytes=%d-;"old"`, len(oldContent)/2)
+
+		if len(requests) != 2 || requests[1] != expectedRequest {
+			t.Fatalf("Expected download to be resumed if unchanged, but requests were: %#v", requests)
+		}
+
+		bs, err := ioutil.ReadFile(filepath.Join(dstPath, "file.txt"))
+		if err != nil || string(bs) != expectedContent {
+			t.Fatalf("Expected downloaded content to match (changed: %t): %v", changed, err)
+		}
+	}
+}
+
+func TestSyncNotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vendir-http-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := ctlconf.DirectoryContentsHTTP{URL: server.URL + "/file.txt"}
+
+	lockConf, err := ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).Sync(context.Background(), filepath.Join(dir, "dst"), testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if lockConf.ETag != `"v1"` {
+		t.Fatalf("Expected ETag to be recorded, but was: %#v", lockConf)
+	}
+
+	notModified, err := ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).NotModified(context.Background(), lockConf)
+	if err != nil || !notModified {
+		t.Fatalf("Expected content to not be modified: %v", err)
+	}
+
+	notModified, err = ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).NotModified(
+		context.Background(), ctlconf.LockDirectoryContentsHTTP{ETag: `"v0"`})
+	if err != nil || notModified {
+		t.Fatalf("Expected content to be modified: %v", err)
+	}
+}
+
+func TestSyncWithClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-http-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	clientCert, clientKey := generateTestCert(t)
+	_, otherKey := generateTestCert(t)
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	opts := ctlconf.DirectoryContentsHTTP{
+		URL:       server.URL + "/file.txt",
+		SecretRef: &ctlconf.DirectoryContentsLocalRef{Name: "tls"},
+	}
+
+	for i, data := range []map[string][]byte{
+		{"tls.crt": clientCert, "tls.key": clientKey, "ca.crt": caCert},
+		{"ca.crt": caCert},
+		{"tls.crt": clientCert, "tls.key": otherKey, "ca.crt": caCert},
+		{"tls.crt": clientCert, "tls.key": clientKey},
+	} {
+		refFetcher := testRefFetcher{ctlconf.Secret{Metadata: ctlconf.GenericMetadata{Name: "tls"}, Data: data}}
+
+		_, err = ctlhttp.NewSync(opts, refFetcher, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).Sync(
+			context.Background(), filepath.Join(dir, fmt.Sprintf("dst%d", i)), testTempArea{dir})
+
+		switch i {
+		case 0:
+			if err != nil {
+				t.Fatalf("Expected sync with client certificate to succeed: %s", err)
+			}
+		case 1:
+			if err == nil {
+				t.Fatalf("Expected sync without client certificate to fail")
+			}
+		case 2:
+			if err == nil || !strings.Contains(err.Error(), "Expected client certificate and key to be a matching PEM encoded pair") {
+				t.Fatalf("Expected mismatched key to be reported, but was: %v", err)
+			}
+		case 3:
+			if err == nil || !strings.Contains(err.Error(), "server certificate is not trusted") {
+				t.Fatalf("Expected untrusted server to be reported, but was: %v", err)
+			}
+		}
+	}
+}
+
+func TestSyncInsecureSkipTLSVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-http-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	for i, insecure := range []bool{false, true} {
+		opts := ctlconf.DirectoryContentsHTTP{URL: server.URL + "/file.txt", InsecureSkipTLSVerify: insecure}
+
+		_, err = ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).Sync(
+			context.Background(), filepath.Join(dir, fmt.Sprintf("dst%d", i)), testTempArea{dir})
+		if (err == nil) != insecure {
+			t.Fatalf("Expected self-signed certificate to only be accepted when verification is skipped (insecure: %t): %v", insecure, err)
+		}
+	}
+}
+
+func TestSyncWithCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-http-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	serverCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	proxy, err := ctlfetch.NewCABundle(string(serverCert), ctlfetch.ProxyOpts{}, testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Creating CA bundle: %s", err)
+	}
+
+	opts := ctlconf.DirectoryContentsHTTP{URL: server.URL + "/file.txt"}
+
+	_, err = ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, proxy).Sync(
+		context.Background(), filepath.Join(dir, "dst"), testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected server certificate to be trusted via CA bundle: %s", err)
+	}
+
+	_, err = ctlfetch.NewCABundle("not-pem", ctlfetch.ProxyOpts{}, testTempArea{dir})
+	if err == nil {
+		t.Fatalf("Expected missing CA bundle file to be rejected")
+	}
+}
+
+func TestSyncFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-http-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("content of " + req.URL.Path))
+	}))
+	defer server.Close()
+
+	aSHA256 := fmt.Sprintf("%x", sha256.Sum256([]byte("content of /a.txt")))
+
+	opts := ctlconf.DirectoryContentsHTTP{
+		Files: []ctlconf.DirectoryContentsHTTPFile{
+			{URL: server.URL + "/a.txt", Path: "a.txt", SHA256: aSHA256},
+			{URL: server.URL + "/b.txt", Path: "sub/b.txt"},
+		},
+	}
+
+	dstPath := filepath.Join(dir, "dst")
+
+	lockConf, err := ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).Sync(
+		context.Background(), dstPath, testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	for path, expectedContent := range map[string]string{"a.txt": "content of /a.txt", "sub/b.txt": "content of /b.txt"} {
+		content, err := ioutil.ReadFile(filepath.Join(dstPath, path))
+		if err != nil {
+			t.Fatalf("Reading file: %s", err)
+		}
+		if string(content) != expectedContent {
+			t.Fatalf("Expected content of '%s' to be '%s', but was '%s'", path, expectedContent, content)
+		}
+	}
+
+	if len(lockConf.Files) != 2 || lockConf.Files[0].SHA256 != aSHA256 || len(lockConf.SHA256) == 0 {
+		t.Fatalf("Expected file digests to be recorded, but was: %#v", lockConf)
+	}
+
+	opts.Files[1].SHA256 = aSHA256
+
+	_, err = ctlhttp.NewSync(opts, nil, ctlfetch.Cache{}, ctlfetch.ProxyOpts{}).Sync(
+		context.Background(), filepath.Join(dir, "dst2"), testTempArea{dir})
+	if err == nil || !strings.Contains(err.Error(), "Syncing file 'sub/b.txt': Downloading URL: Expected digest to match") {
+		t.Fatalf("Expected per file checksum to be verified, but was: %v", err)
+	}
+}
+
+func generateTestCert(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generating key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vendir"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certBs, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Creating certificate: %s", err)
+	}
+
+	keyBs, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Marshaling key: %s", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBs}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBs})
+}
+
+type testRefFetcher struct {
+	secret ctlconf.Secret
+}
+
+func (f testRefFetcher) GetSecret(string) (ctlconf.Secret, error) { return f.secret, nil }
+
+func (f testRefFetcher) GetConfigMap(string) (ctlconf.ConfigMap, error) {
+	return ctlconf.ConfigMap{}, fmt.Errorf("Not found")
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
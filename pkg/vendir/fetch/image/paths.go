@@ -0,0 +1,378 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// PathsExtractor extracts only given paths (files or directories) out of
+// flattened image filesystem by reading image layers directly from registry
+type PathsExtractor struct {
+	resolver PlatformResolver
+	paths    []string
+}
+
+func NewPathsExtractor(resolver PlatformResolver, paths []string) PathsExtractor {
+	var cleanPaths []string
+	for _, p := range paths {
+		cleanPaths = append(cleanPaths, path.Clean(strings.Trim(filepath.ToSlash(p), "/")))
+	}
+	return PathsExtractor{resolver, cleanPaths}
+}
+
+type imageManifest struct {
+	Layers []imageManifestLayer
+}
+
+type imageManifestLayer struct {
+	MediaType string
+	Digest    string
+}
+
+// Extract applies layers of image referenced by digest in order
+// (including whiteouts) keeping only entries within configured paths
+func (e PathsExtractor) Extract(ctx context.Context, digestRef, dstPath string) error {
+	registry, repo, digest := e.resolver.parseRef(digestRef)
+
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repo, digest)
+
+	bs, mediaType, err := e.resolver.fetchManifest(ctx, manifestURL, repo)
+	if err != nil {
+		return fmt.Errorf("Fetching manifest for '%s': %s", digestRef, err)
+	}
+
+	if mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerList {
+		return fmt.Errorf("Expected image '%s' to not be an image index (select image via platform)", digestRef)
+	}
+
+	var manifest imageManifest
+
+	err = json.Unmarshal(bs, &manifest)
+	if err != nil {
+		return fmt.Errorf("Unmarshaling image manifest: %s", err)
+	}
+
+	err = os.MkdirAll(dstPath, 0755)
+	if err != nil {
+		return fmt.Errorf("Creating dst dir: %s", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		blobURL := fmt.Sprintf("https://%s/v2/%s/blobs/%s", registry, repo, layer.Digest)
+
+		err := e.extractLayer(ctx, blobURL, repo, layer.Digest, dstPath)
+		if err != nil {
+			return fmt.Errorf("Extracting layer '%s': %s", layer.Digest, err)
+		}
+	}
+
+	return e.checkPresent(dstPath)
+}
+
+func (e PathsExtractor) extractLayer(ctx context.Context, blobURL, repo, digest, dstPath string) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("Unsupported digest algorithm")
+	}
+
+	resp, err := e.resolver.get(ctx, blobURL, "", repo)
+	if err != nil {
+		return fmt.Errorf("Fetching blob: %s", err)
+	}
+
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+	blobReader := bufio.NewReader(io.TeeReader(ctlfetch.NewRateLimitedReader(ctx, resp.Body), hash))
+
+	var layerReader io.Reader = blobReader
+
+	magic, err := blobReader.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(blobReader)
+		if err != nil {
+			return fmt.Errorf("Opening gzip layer: %s", err)
+		}
+		layerReader = gzipReader
+	}
+
+	err = e.extractTar(tar.NewReader(layerReader), dstPath)
+	if err != nil {
+		return err
+	}
+
+	// Tar reader may stop before reading trailing padding
+	_, err = io.Copy(ioutil.Discard, blobReader)
+	if err != nil {
+		return fmt.Errorf("Reading blob: %s", err)
+	}
+
+	if actualDigest := "sha256:" + hex.EncodeToString(hash.Sum(nil)); actualDigest != digest {
+		return fmt.Errorf("Expected blob digest to be '%s', but was '%s'", digest, actualDigest)
+	}
+
+	return nil
+}
+
+func (e PathsExtractor) extractTar(tarReader *tar.Reader, dstPath string) error {
+	// Opaque whiteouts only hide entries of lower layers
+	layerPaths := map[string]struct{}{}
+
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("Reading next tar header: %s", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(strings.TrimPrefix(header.Name, "./"), "/"))
+		dir, base := path.Split(name)
+
+		switch {
+		case base == whiteoutOpaque:
+			err = e.removeLowerChildren(dstPath, path.Clean(dir), layerPaths)
+			if err != nil {
+				return err
+			}
+			continue
+
+		case strings.HasPrefix(base, whiteoutPrefix):
+			// Removing a parent of selected paths removes them as well
+			err = e.remove(dstPath, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			if err != nil {
+				return err
+			}
+			continue
+
+		case !e.isSelected(name):
+			continue
+		}
+
+		layerPaths[name] = struct{}{}
+
+		err = e.writeEntry(tarReader, header, name, dstPath)
+		if err != nil {
+			return fmt.Errorf("Writing '%s': %s", name, err)
+		}
+	}
+}
+
+func (e PathsExtractor) writeEntry(tarReader *tar.Reader, header *tar.Header, name, dstPath string) error {
+	entryPath, err := e.scopedPath(dstPath, name)
+	if err != nil {
+		return err
+	}
+
+	if header.Typeflag == tar.TypeDir {
+		err := os.MkdirAll(entryPath, 0755)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(entryPath, header.FileInfo().Mode()&ctlfetch.PreservedModeBits|0700)
+	}
+
+	// Entry from upper layer replaces existing one
+	err = os.RemoveAll(entryPath)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(entryPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		return e.writeFile(tarReader, entryPath, header.FileInfo().Mode())
+
+	case tar.TypeSymlink:
+		return os.Symlink(header.Linkname, entryPath)
+
+	case tar.TypeLink:
+		targetName := path.Clean(strings.TrimPrefix(strings.TrimPrefix(header.Linkname, "./"), "/"))
+		if !e.isSelected(targetName) {
+			return fmt.Errorf("Expected hard link target '%s' to be within extracted paths", targetName)
+		}
+		targetPath, err := e.scopedPath(dstPath, targetName)
+		if err != nil {
+			return err
+		}
+		return os.Link(targetPath, entryPath)
+
+	default:
+		// Devices, fifos, etc. are not meaningful as vendored files
+		return nil
+	}
+}
+
+func (PathsExtractor) writeFile(src io.Reader, dstPath string, mode os.FileMode) error {
+	dstFile, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, src)
+	if err != nil {
+		return err
+	}
+
+	return dstFile.Chmod(mode & ctlfetch.PreservedModeBits)
+}
+
+func (e PathsExtractor) removeLowerChildren(dstPath, dir string, layerPaths map[string]struct{}) error {
+	dirPath, err := e.scopedPath(dstPath, dir)
+	if err != nil {
+		return err
+	}
+
+	infos, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, info := range infos {
+		if e.inLayer(path.Join(dir, info.Name()), layerPaths) {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(dirPath, info.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (PathsExtractor) inLayer(name string, layerPaths map[string]struct{}) bool {
+	for layerPath := range layerPaths {
+		if layerPath == name || strings.HasPrefix(layerPath, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (e PathsExtractor) remove(dstPath, name string) error {
+	entryPath, err := e.scopedPath(dstPath, name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(entryPath)
+}
+
+// scopedPath disallows entries escaping destination either
+// directly or via previously extracted symlinks
+func (PathsExtractor) scopedPath(dstPath, name string) (string, error) {
+	entryPath, err := ctlfetch.ScopedPath(dstPath, filepath.FromSlash(name))
+	if err != nil {
+		return "", err
+	}
+
+	parentPath := filepath.Dir(entryPath)
+
+	for parentPath != filepath.Dir(parentPath) && len(parentPath) > len(filepath.Clean(dstPath)) {
+		info, err := os.Lstat(parentPath)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("Expected '%s' to not be within symlinked directory", name)
+		}
+		parentPath = filepath.Dir(parentPath)
+	}
+
+	return entryPath, nil
+}
+
+func (e PathsExtractor) isSelected(name string) bool {
+	for _, p := range e.paths {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Prune removes everything except configured paths from already
+// extracted image (used when layers cannot be read directly)
+func (e PathsExtractor) Prune(dstPath string) error {
+	err := filepath.Walk(dstPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dstPath, filePath)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(relPath)
+
+		switch {
+		case e.isSelected(name):
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+
+		case info.IsDir() && (name == "." || e.isAncestor(name)):
+			return nil
+		}
+
+		err = os.RemoveAll(filePath)
+		if err == nil && info.IsDir() {
+			return filepath.SkipDir
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Pruning image files: %s", err)
+	}
+
+	return e.checkPresent(dstPath)
+}
+
+func (e PathsExtractor) isAncestor(name string) bool {
+	for _, p := range e.paths {
+		if strings.HasPrefix(p, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (e PathsExtractor) checkPresent(dstPath string) error {
+	for _, p := range e.paths {
+		_, err := os.Lstat(filepath.Join(dstPath, filepath.FromSlash(p)))
+		if err != nil {
+			return ctlfetch.NewNonRetryableError(fmt.Errorf("Expected image to include path '%s', but did not", p))
+		}
+	}
+	return nil
+}
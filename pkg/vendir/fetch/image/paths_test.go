@@ -0,0 +1,143 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestPathsExtractorExtract(t *testing.T) {
+	blobs := map[string][]byte{}
+
+	addLayer := func(files map[string]string, gzipped bool) string {
+		var buf bytes.Buffer
+
+		tarWriter := tar.NewWriter(&buf)
+		for _, name := range sortedKeys(files) {
+			tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+			tarWriter.Write([]byte(files[name]))
+		}
+		tarWriter.Close()
+
+		bs := buf.Bytes()
+		if gzipped {
+			var gzipBuf bytes.Buffer
+			gzipWriter := gzip.NewWriter(&gzipBuf)
+			gzipWriter.Write(bs)
+			gzipWriter.Close()
+			bs = gzipBuf.Bytes()
+		}
+
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(bs))
+		blobs[digest] = bs
+		return digest
+	}
+
+	layer1 := addLayer(map[string]string{
+		"config/app.yml":      "app-v1",
+		"config/removed.yml":  "removed",
+		"config/old/a.yml":    "old",
+		"bin/tool":            "tool",
+		"README.md":           "readme",
+		"docs/ignored/doc.md": "doc",
+	}, true)
+
+	layer2 := addLayer(map[string]string{
+		"config/app.yml":            "app-v2",
+		"config/.wh.removed.yml":    "",
+		"config/old/.wh..wh..opq":   "",
+		"config/old/b.yml":          "new",
+		"bin/.wh.tool":              "",
+		"docs/ignored/.wh..wh..opq": "",
+	}, false)
+
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"layers":[{"digest":"%s"},{"digest":"%s"}]}`, layer1, layer2))
+	manifestDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v2/app/manifests/"+manifestDigest:
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			w.Write(manifest)
+		case strings.HasPrefix(req.URL.Path, "/v2/app/blobs/") && blobs[strings.TrimPrefix(req.URL.Path, "/v2/app/blobs/")] != nil:
+			w.Write(blobs[strings.TrimPrefix(req.URL.Path, "/v2/app/blobs/")])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vendir-image-paths-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	resolver := NewPlatformResolver(RegistryAuth{}, ctlfetch.ProxyOpts{CACerts: serverCert}, ctlfetch.TLSOpts{})
+	ref := strings.TrimPrefix(server.URL, "https://") + "/app@" + manifestDigest
+
+	dstPath := filepath.Join(dir, "dst")
+
+	err = NewPathsExtractor(resolver, []string{"config", "README.md"}).Extract(context.Background(), ref, dstPath)
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	expectedFiles := map[string]string{
+		"README.md":        "readme",
+		"config/app.yml":   "app-v2",
+		"config/old/b.yml": "new",
+	}
+
+	files := map[string]string{}
+
+	err = filepath.Walk(dstPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		bs, err := ioutil.ReadFile(path)
+		relPath, _ := filepath.Rel(dstPath, path)
+		files[filepath.ToSlash(relPath)] = string(bs)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Walking dir: %s", err)
+	}
+
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected files %#v, but was %#v", expectedFiles, files)
+	}
+
+	err = NewPathsExtractor(resolver, []string{"bin/tool"}).Extract(context.Background(), ref, filepath.Join(dir, "dst2"))
+	if err == nil || !strings.Contains(err.Error(), "Expected image to include path 'bin/tool'") {
+		t.Fatalf("Expected extraction of removed path to fail, but was: %v", err)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// PinnedRef describes image reference that includes digest
+// (e.g. repo:v1.0.0@sha256:...); tag is optional
+type PinnedRef struct {
+	Name   string
+	Tag    string
+	Digest string
+}
+
+// NewPinnedRef parses reference and returns false if it does not include digest
+func NewPinnedRef(ref string) (PinnedRef, bool) {
+	pieces := strings.SplitN(ref, "@", 2)
+	if len(pieces) != 2 {
+		return PinnedRef{}, false
+	}
+
+	result := PinnedRef{Name: pieces[0], Digest: pieces[1]}
+
+	// Colon after last slash separates tag (as opposed to registry port)
+	if idx := strings.LastIndex(result.Name, ":"); idx != -1 && !strings.Contains(result.Name[idx:], "/") {
+		result.Tag = result.Name[idx+1:]
+		result.Name = result.Name[:idx]
+	}
+
+	return result, true
+}
+
+// DigestRef returns reference without tag since tag is ignored when digest is present
+func (r PinnedRef) DigestRef() string {
+	return r.Name + "@" + r.Digest
+}
+
+// VerifyTag checks that tag (if present) currently points to pinned digest
+func (r PinnedRef) VerifyTag(ctx context.Context, resolver PlatformResolver) error {
+	if len(r.Tag) == 0 {
+		return nil
+	}
+
+	registry, repo, _ := resolver.parseRef(r.Name)
+
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repo, r.Tag)
+
+	bs, _, err := resolver.fetchManifest(ctx, manifestURL, repo)
+	if err != nil {
+		return fmt.Errorf("Fetching manifest for tag '%s': %s", r.Tag, err)
+	}
+
+	var digestHash hash.Hash = sha256.New()
+	if strings.HasPrefix(r.Digest, "sha512:") {
+		digestHash = sha512.New()
+	}
+
+	digestHash.Write(bs)
+
+	tagDigest := strings.SplitN(r.Digest, ":", 2)[0] + ":" + hex.EncodeToString(digestHash.Sum(nil))
+
+	if tagDigest != r.Digest {
+		return fmt.Errorf("Expected tag '%s' to point to pinned digest '%s', but it points to '%s'",
+			r.Tag, r.Digest, tagDigest)
+	}
+
+	return nil
+}
+
+// ResolveDigest returns digest reference of image currently
+// referenced by given tag (or ref as is if it already includes digest)
+func (r PlatformResolver) ResolveDigest(ctx context.Context, ref string) (string, error) {
+	if pinnedRef, pinned := NewPinnedRef(ref); pinned {
+		return pinnedRef.DigestRef(), nil
+	}
+
+	registry, repo, tag := r.parseRef(ref)
+
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repo, tag)
+
+	bs, _, err := r.fetchManifest(ctx, manifestURL, repo)
+	if err != nil {
+		return "", fmt.Errorf("Fetching manifest for '%s': %s", ref, err)
+	}
+
+	return fmt.Sprintf("%s/%s@sha256:%x", registry, repo, sha256.Sum256(bs)), nil
+}
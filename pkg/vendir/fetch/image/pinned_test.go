@@ -0,0 +1,76 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestNewPinnedRef(t *testing.T) {
+	examples := []struct {
+		Ref       string
+		Pinned    bool
+		Tag       string
+		DigestRef string
+	}{
+		{"nginx:1.19", false, "", ""},
+		{"nginx@sha256:abc", true, "", "nginx@sha256:abc"},
+		{"nginx:1.19@sha256:abc", true, "1.19", "nginx@sha256:abc"},
+		{"localhost:5000/image@sha256:abc", true, "", "localhost:5000/image@sha256:abc"},
+		{"localhost:5000/image:v1@sha256:abc", true, "v1", "localhost:5000/image@sha256:abc"},
+	}
+
+	for _, ex := range examples {
+		ref, pinned := NewPinnedRef(ex.Ref)
+		if pinned != ex.Pinned || ref.Tag != ex.Tag || (pinned && ref.DigestRef() != ex.DigestRef) {
+			t.Fatalf("Expected ref '%s' to parse as pinned=%t tag='%s' '%s', but was pinned=%t tag='%s' '%s'",
+				ex.Ref, ex.Pinned, ex.Tag, ex.DigestRef, pinned, ref.Tag, ref.DigestRef())
+		}
+	}
+}
+
+func TestPlatformResolverResolveDigest(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+	tagRequests := 0
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/app/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		tagRequests++
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write(manifest)
+	}))
+	defer server.Close()
+
+	serverCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	resolver := NewPlatformResolver(RegistryAuth{}, ctlfetch.ProxyOpts{CACerts: serverCert}, ctlfetch.TLSOpts{})
+
+	registry := strings.TrimPrefix(server.URL, "https://")
+	expectedRef := fmt.Sprintf("%s/app@sha256:%x", registry, sha256.Sum256(manifest))
+
+	ref, err := resolver.ResolveDigest(context.Background(), registry+"/app:v1")
+	if err != nil {
+		t.Fatalf("Expected tag to be resolved: %s", err)
+	}
+	if ref != expectedRef {
+		t.Fatalf("Expected ref '%s', but was '%s'", expectedRef, ref)
+	}
+
+	// Digest reference is returned without contacting registry
+	ref, err = resolver.ResolveDigest(context.Background(), registry+"/app:v1@sha256:abc")
+	if err != nil || ref != registry+"/app@sha256:abc" || tagRequests != 1 {
+		t.Fatalf("Expected digest ref to be returned as is, but was '%s' (requests: %d): %v", ref, tagRequests, err)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const (
+	dockerHubRegistry = "index.docker.io"
+
+	mediaTypeOCIIndex          = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList        = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest       = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifestV2  = "application/vnd.docker.distribution.manifest.v2+json"
+	registryManifestAcceptList = mediaTypeOCIIndex + "," + mediaTypeDockerList + "," +
+		mediaTypeOCIManifest + "," + mediaTypeDockerManifestV2
+)
+
+type RegistryAuth struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// PlatformResolver selects platform specific image out of multi-platform image index
+type PlatformResolver struct {
+	auth    RegistryAuth
+	proxy   ctlfetch.ProxyOpts
+	tlsOpts ctlfetch.TLSOpts
+}
+
+func NewPlatformResolver(auth RegistryAuth, proxy ctlfetch.ProxyOpts, tlsOpts ctlfetch.TLSOpts) PlatformResolver {
+	return PlatformResolver{auth, proxy, tlsOpts}
+}
+
+type imageIndex struct {
+	MediaType string
+	Manifests []imageIndexManifest
+}
+
+type imageIndexManifest struct {
+	Digest   string
+	Platform *imageIndexPlatform
+}
+
+type imageIndexPlatform struct {
+	OS           string
+	Architecture string
+	Variant      string
+}
+
+func (p imageIndexPlatform) String() string {
+	result := p.OS + "/" + p.Architecture
+	if len(p.Variant) > 0 {
+		result += "/" + p.Variant
+	}
+	return result
+}
+
+// Resolve returns digest reference for a given platform (e.g. linux/amd64).
+// Image that is not an index is returned as is.
+func (r PlatformResolver) Resolve(ctx context.Context, ref, platform string) (string, error) {
+	registry, repo, tagOrDigest := r.parseRef(ref)
+
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", registry, repo, tagOrDigest)
+
+	bs, mediaType, err := r.fetchManifest(ctx, manifestURL, repo)
+	if err != nil {
+		return "", fmt.Errorf("Fetching manifest for '%s': %w", ref, err)
+	}
+
+	if mediaType != mediaTypeOCIIndex && mediaType != mediaTypeDockerList {
+		return ref, nil
+	}
+
+	var index imageIndex
+
+	err = json.Unmarshal(bs, &index)
+	if err != nil {
+		return "", fmt.Errorf("Unmarshaling image index: %s", err)
+	}
+
+	var availablePlatforms []string
+
+	for _, manifest := range index.Manifests {
+		if manifest.Platform == nil {
+			continue
+		}
+		if manifest.Platform.String() == platform ||
+			(len(manifest.Platform.Variant) > 0 && manifest.Platform.OS+"/"+manifest.Platform.Architecture == platform) {
+			return fmt.Sprintf("%s/%s@%s", registry, repo, manifest.Digest), nil
+		}
+		availablePlatforms = append(availablePlatforms, manifest.Platform.String())
+	}
+
+	return "", fmt.Errorf("Expected image '%s' to include platform '%s', but did not (available: %s)",
+		ref, platform, strings.Join(availablePlatforms, ", "))
+}
+
+func (PlatformResolver) parseRef(ref string) (string, string, string) {
+	tagOrDigest := "latest"
+
+	if idx := strings.Index(ref, "@"); idx != -1 {
+		tagOrDigest = ref[idx+1:]
+		ref = ref[:idx]
+	} else if idx := strings.LastIndex(ref, ":"); idx != -1 && !strings.Contains(ref[idx:], "/") {
+		tagOrDigest = ref[idx+1:]
+		ref = ref[:idx]
+	}
+
+	registry := dockerHubRegistry
+	repo := ref
+
+	pieces := strings.SplitN(ref, "/", 2)
+	if len(pieces) == 2 && (strings.ContainsAny(pieces[0], ".:") || pieces[0] == "localhost") {
+		registry = pieces[0]
+		repo = pieces[1]
+	}
+
+	if registry == "docker.io" {
+		registry = dockerHubRegistry
+	}
+	if registry == dockerHubRegistry && !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+
+	return registry, repo, tagOrDigest
+}
+
+func (r PlatformResolver) fetchManifest(ctx context.Context, manifestURL, repo string) ([]byte, string, error) {
+	resp, err := r.get(ctx, manifestURL, registryManifestAcceptList, repo)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("Reading manifest: %s", err)
+	}
+
+	mediaType := strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+
+	return bs, mediaType, nil
+}
+
+// get performs authenticated registry request; successful
+// response body has to be closed by the caller
+func (r PlatformResolver) get(ctx context.Context, reqURL, accept, repo string) (*http.Response, error) {
+	resp, err := r.doRequest(ctx, reqURL, accept, r.authHeader(""))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && len(r.auth.Token) == 0 {
+		resp.Body.Close()
+
+		// Registries commonly require bearer token obtained from auth service
+		token, err := r.fetchBearerToken(ctx, resp.Header.Get("WWW-Authenticate"), repo)
+		if err != nil {
+			return nil, fmt.Errorf("Obtaining registry token: %s", err)
+		}
+
+		resp, err = r.doRequest(ctx, reqURL, accept, r.authHeader(token))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf("Expected 200 OK, but was '%s'", resp.Status))
+	}
+
+	return resp, nil
+}
+
+func (r PlatformResolver) doRequest(ctx context.Context, reqURL, accept, authHeader string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Building request: %s", err)
+	}
+
+	if len(accept) > 0 {
+		req.Header.Set("Accept", accept)
+	}
+
+	if len(authHeader) > 0 {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	client, err := r.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+func (r PlatformResolver) authHeader(bearerToken string) string {
+	switch {
+	case len(bearerToken) > 0:
+		return "Bearer " + bearerToken
+	case len(r.auth.Token) > 0:
+		return "Bearer " + r.auth.Token
+	default:
+		return ""
+	}
+}
+
+func (r PlatformResolver) fetchBearerToken(ctx context.Context, challenge, repo string) (string, error) {
+	const bearerPrefix = "Bearer "
+
+	if !strings.HasPrefix(challenge, bearerPrefix) {
+		return "", fmt.Errorf("Unsupported auth challenge '%s'", challenge)
+	}
+
+	params := map[string]string{}
+
+	for _, param := range strings.Split(strings.TrimPrefix(challenge, bearerPrefix), ",") {
+		pieces := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(pieces) == 2 {
+			params[pieces[0]] = strings.Trim(pieces[1], `"`)
+		}
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return "", fmt.Errorf("Expected valid realm in auth challenge '%s'", challenge)
+	}
+
+	query := tokenURL.Query()
+	if len(params["service"]) > 0 {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", repo))
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("Building request: %s", err)
+	}
+
+	if len(r.auth.Username) > 0 {
+		req.SetBasicAuth(r.auth.Username, r.auth.Password)
+	}
+
+	client, err := r.httpClient()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", ctlfetch.NewHTTPStatusError(resp.StatusCode, fmt.Errorf("Expected 200 OK, but was '%s'", resp.Status))
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	if err != nil {
+		return "", fmt.Errorf("Unmarshaling token response: %s", err)
+	}
+
+	if len(tokenResp.Token) > 0 {
+		return tokenResp.Token, nil
+	}
+	return tokenResp.AccessToken, nil
+}
+
+func (r PlatformResolver) httpClient() (*http.Client, error) {
+	if !r.tlsOpts.IsPresent() {
+		return r.proxy.HTTPClient(), nil
+	}
+
+	tlsConfig, err := r.tlsOpts.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.proxy.HTTPClientWithTLS(tlsConfig), nil
+}
@@ -0,0 +1,28 @@
+package image
+
+import (
+	"testing"
+)
+
+func TestPlatformResolverParseRef(t *testing.T) {
+	examples := []struct {
+		Ref         string
+		Registry    string
+		Repo        string
+		TagOrDigest string
+	}{
+		{"nginx", "index.docker.io", "library/nginx", "latest"},
+		{"docker.io/dkalinin/app:v1", "index.docker.io", "dkalinin/app", "v1"},
+		{"gcr.io/repo/image:v1.0.0", "gcr.io", "repo/image", "v1.0.0"},
+		{"localhost:5000/image", "localhost:5000", "image", "latest"},
+		{"registry.io/image@sha256:abc", "registry.io", "image", "sha256:abc"},
+	}
+
+	for _, ex := range examples {
+		registry, repo, tagOrDigest := PlatformResolver{}.parseRef(ex.Ref)
+		if registry != ex.Registry || repo != ex.Repo || tagOrDigest != ex.TagOrDigest {
+			t.Fatalf("Expected ref '%s' to parse as '%s' '%s' '%s', but was '%s' '%s' '%s'",
+				ex.Ref, ex.Registry, ex.Repo, ex.TagOrDigest, registry, repo, tagOrDigest)
+		}
+	}
+}
@@ -5,8 +5,11 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -17,10 +20,14 @@ import (
 type Sync struct {
 	opts       ctlconf.DirectoryContentsImage
 	refFetcher ctlfetch.RefFetcher
+	cache      ctlfetch.Cache
+	proxy      ctlfetch.ProxyOpts
 }
 
-func NewSync(opts ctlconf.DirectoryContentsImage, refFetcher ctlfetch.RefFetcher) *Sync {
-	return &Sync{opts, refFetcher}
+func NewSync(opts ctlconf.DirectoryContentsImage, refFetcher ctlfetch.RefFetcher,
+	cache ctlfetch.Cache, proxy ctlfetch.ProxyOpts) *Sync {
+
+	return &Sync{opts, refFetcher, cache, proxy}
 }
 
 var (
@@ -29,23 +36,126 @@ var (
 	imgpkgPulledImageRef = regexp.MustCompile("(?m)^Pulling image '(.+)'$")
 )
 
-func (t *Sync) Sync(dstPath string) (ctlconf.LockDirectoryContentsImage, error) {
+// Resolve returns lock config with digest reference of configured image
+// without pulling it; returns false when digest cannot be resolved up front
+// (e.g. credentials are only available to imgpkg via docker config)
+func (t *Sync) Resolve(ctx context.Context) (ctlconf.LockDirectoryContentsImage, bool, error) {
+	lockConf := ctlconf.LockDirectoryContentsImage{}
+
+	auth, err := t.registryAuth()
+	if err != nil {
+		return lockConf, false, err
+	}
+
+	resolver := NewPlatformResolver(auth, t.proxy, t.tlsOpts())
+
+	url, err := resolver.ResolveDigest(ctx, t.opts.URL)
+	if err != nil {
+		return lockConf, false, nil
+	}
+
+	if len(t.opts.Platform) > 0 {
+		url, err = resolver.Resolve(ctx, url, t.opts.Platform)
+		if err != nil {
+			return lockConf, false, nil
+		}
+		lockConf.Platform = t.opts.Platform
+	}
+
+	lockConf.URL = url
+
+	return lockConf, true, nil
+}
+
+func (t *Sync) Sync(ctx context.Context, dstPath string) (ctlconf.LockDirectoryContentsImage, error) {
 	lockConf := ctlconf.LockDirectoryContentsImage{}
 
 	if len(t.opts.URL) == 0 {
 		return lockConf, fmt.Errorf("Expected non-empty URL")
 	}
 
-	args := []string{"pull", "-i", t.opts.URL, "-o", dstPath, "--tty=true"}
-
-	args, err := t.addAuthArgs(args)
+	auth, err := t.registryAuth()
 	if err != nil {
 		return lockConf, err
 	}
 
+	url := t.opts.URL
+
+	// Digest pinned reference does not need to be resolved
+	pinnedRef, pinned := NewPinnedRef(url)
+	if pinned {
+		err = pinnedRef.VerifyTag(ctx, NewPlatformResolver(auth, t.proxy, t.tlsOpts()))
+		if err != nil {
+			return lockConf, ctlfetch.NewNonRetryableError(err)
+		}
+		url = pinnedRef.DigestRef()
+	} else {
+		// Tag is resolved up front so that pulled contents match recorded digest
+		// even if tag is re-pushed in between; if manifest cannot be fetched
+		// directly (e.g. credentials are only available to imgpkg via docker
+		// config) digest reported by imgpkg is recorded instead
+		digestURL, err := NewPlatformResolver(auth, t.proxy, t.tlsOpts()).ResolveDigest(ctx, url)
+		if err == nil {
+			url = digestURL
+		}
+	}
+
+	if t.opts.Verification != nil {
+		// Verified digest is pulled so that tag cannot move in between
+		url, err = NewPlatformResolver(auth, t.proxy, t.tlsOpts()).ResolveDigest(ctx, url)
+		if err != nil {
+			return lockConf, fmt.Errorf("Resolving image digest: %w", err)
+		}
+
+		lockConf.VerifiedIdentity, err = NewVerification(*t.opts.Verification, t.refFetcher, t.proxy).Verify(ctx, url)
+		if err != nil {
+			return lockConf, ctlfetch.NewNonRetryableError(err)
+		}
+	}
+
+	if len(t.opts.Platform) > 0 {
+		url, err = NewPlatformResolver(auth, t.proxy, t.tlsOpts()).Resolve(ctx, url, t.opts.Platform)
+		if err != nil {
+			return lockConf, fmt.Errorf("Resolving image platform: %w", err)
+		}
+		lockConf.Platform = t.opts.Platform
+	}
+
+	// Selected paths are read directly from layers; cache only holds
+	// entire images so it's not used in that case
+	if len(t.opts.Paths) > 0 && strings.Contains(url, "@") {
+		err = NewPathsExtractor(NewPlatformResolver(auth, t.proxy, t.tlsOpts()), t.opts.Paths).Extract(ctx, url, dstPath)
+		if err != nil {
+			return lockConf, fmt.Errorf("Extracting image paths: %s", err)
+		}
+		lockConf.URL = url
+		return lockConf, nil
+	}
+
+	// Only images referenced by digest are cached since tags may move
+	cached, err := t.cache.GetDir(t.digestCacheKey(url), dstPath)
+	if err != nil {
+		return lockConf, fmt.Errorf("Reading cached image: %s", err)
+	}
+	if cached {
+		lockConf.URL = url
+		return lockConf, nil
+	}
+
+	args := []string{"pull", "-i", url, "-o", dstPath, "--tty=true"}
+	args = append(args, t.authArgs(auth)...)
+
+	if t.opts.InsecureSkipTLSVerify {
+		args = append(args, "--registry-verify-certs=false")
+	}
+	if len(t.proxy.CACertsPath) > 0 {
+		args = append(args, "--registry-ca-cert-path", t.proxy.CACertsPath)
+	}
+
 	var stdoutBs, stderrBs bytes.Buffer
 
-	cmd := exec.Command("imgpkg", args...)
+	cmd := exec.CommandContext(ctx, "imgpkg", args...)
+	cmd.Env = append(os.Environ(), t.proxy.Env()...)
 	cmd.Stdout = &stdoutBs
 	cmd.Stderr = &stderrBs
 
@@ -64,37 +174,99 @@ func (t *Sync) Sync(dstPath string) (ctlconf.LockDirectoryContentsImage, error)
 		return lockConf, fmt.Errorf("Expected ref '%s' to be in digest form, but was not", matches[1])
 	}
 
+	// Platform specific image has its own digest
+	if pinned && len(t.opts.Platform) == 0 && !strings.HasSuffix(matches[1], "@"+pinnedRef.Digest) {
+		return lockConf, fmt.Errorf("Expected pulled image ref '%s' to have pinned digest '%s'", matches[1], pinnedRef.Digest)
+	}
+
 	lockConf.URL = matches[1]
 
+	// Tag could not be resolved up front hence entire image was pulled
+	if len(t.opts.Paths) > 0 {
+		err = NewPathsExtractor(NewPlatformResolver(auth, t.proxy, t.tlsOpts()), t.opts.Paths).Prune(dstPath)
+		if err != nil {
+			return lockConf, err
+		}
+		return lockConf, nil
+	}
+
+	err = t.cache.PutDir(t.digestCacheKey(lockConf.URL), dstPath)
+	if err != nil {
+		return lockConf, fmt.Errorf("Caching image: %s", err)
+	}
+
 	return lockConf, nil
 }
 
-func (t *Sync) addAuthArgs(args []string) ([]string, error) {
-	var authArgs []string
+func (t *Sync) digestCacheKey(url string) string {
+	pieces := strings.SplitN(url, "@", 2)
+	if len(pieces) != 2 {
+		return ""
+	}
+	return "image:" + pieces[1]
+}
+
+func (t *Sync) registryAuth() (RegistryAuth, error) {
+	var auth RegistryAuth
 
 	if t.opts.SecretRef != nil {
 		secret, err := t.refFetcher.GetSecret(t.opts.SecretRef.Name)
 		if err != nil {
-			return nil, err
+			return auth, err
 		}
 
 		for name, val := range secret.Data {
 			switch name {
 			case ctlconf.SecretK8sCorev1BasicAuthUsernameKey:
-				authArgs = append(authArgs, []string{"--registry-username", string(val)}...)
+				auth.Username = string(val)
 			case ctlconf.SecretK8sCorev1BasicAuthPasswordKey:
-				authArgs = append(authArgs, []string{"--registry-password", string(val)}...)
+				auth.Password = string(val)
 			case ctlconf.SecretToken:
-				authArgs = append(authArgs, []string{"--registry-token", string(val)}...)
+				auth.Token = string(val)
 			default:
-				return nil, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
+				return auth, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
 			}
 		}
 	}
 
-	if len(authArgs) == 0 {
+	return auth, nil
+}
+
+func (t *Sync) tlsOpts() ctlfetch.TLSOpts {
+	return ctlfetch.TLSOpts{InsecureSkipVerify: t.opts.InsecureSkipTLSVerify}
+}
+
+func (t *Sync) authArgs(auth RegistryAuth) []string {
+	var authArgs []string
+
+	if len(auth.Username) > 0 {
+		authArgs = append(authArgs, "--registry-username", auth.Username)
+	}
+	if len(auth.Password) > 0 {
+		authArgs = append(authArgs, "--registry-password", auth.Password)
+	}
+	if len(auth.Token) > 0 {
+		authArgs = append(authArgs, "--registry-token", auth.Token)
+	}
+
+	// Without explicit auth flags imgpkg uses credentials from docker config
+	if len(authArgs) == 0 && !t.hasDockerConfig() {
 		authArgs = []string{"--registry-anon"}
 	}
 
-	return append(args, authArgs...), nil
+	return authArgs
+}
+
+func (t *Sync) hasDockerConfig() bool {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if len(configDir) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return false
+		}
+		configDir = filepath.Join(homeDir, ".docker")
+	}
+
+	_, err := os.Stat(filepath.Join(configDir, "config.json"))
+	return err == nil
 }
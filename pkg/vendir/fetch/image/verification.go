@@ -0,0 +1,103 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+const (
+	cosignPublicKeyEnv = "VENDIR_COSIGN_PUBLIC_KEY"
+)
+
+// Verification checks image signature via cosign
+type Verification struct {
+	opts       ctlconf.DirectoryContentsImageVerification
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewVerification(opts ctlconf.DirectoryContentsImageVerification,
+	refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) Verification {
+
+	return Verification{opts, refFetcher, proxy}
+}
+
+// Verify checks that image (referenced by digest) is signed by configured key
+// or identity and returns public key fingerprint or identity that verified it
+func (v Verification) Verify(ctx context.Context, digestRef string) (string, error) {
+	_, err := exec.LookPath("cosign")
+	if err != nil {
+		return "", fmt.Errorf("Expected cosign to be installed to verify image signature: %s", err)
+	}
+
+	args := []string{"verify"}
+	env := append(os.Environ(), v.proxy.Env()...)
+
+	var identity string
+
+	if v.opts.PublicKeySecretRef != nil {
+		publicKey, err := v.publicKey()
+		if err != nil {
+			return "", err
+		}
+
+		block, _ := pem.Decode(publicKey)
+		if block == nil {
+			return "", fmt.Errorf("Expected cosign public key (%s) to be PEM encoded", ctlconf.SecretCosignPublicKey)
+		}
+
+		identity = fmt.Sprintf("sha256:%x", sha256.Sum256(block.Bytes))
+
+		// Key is passed via environment instead of temporary file
+		args = append(args, "--key", "env://"+cosignPublicKeyEnv)
+		env = append(env, cosignPublicKeyEnv+"="+string(publicKey))
+	} else {
+		identity = fmt.Sprintf("%s (issuer: %s)", v.opts.CertificateIdentity, v.opts.CertificateOIDCIssuer)
+
+		args = append(args, "--certificate-identity", v.opts.CertificateIdentity,
+			"--certificate-oidc-issuer", v.opts.CertificateOIDCIssuer)
+	}
+
+	args = append(args, digestRef)
+
+	var stderrBs bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	cmd.Env = env
+	cmd.Stderr = &stderrBs
+
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("Verifying signature of image '%s': %s (stderr: %s)", digestRef, err, stderrBs.String())
+	}
+
+	return identity, nil
+}
+
+func (v Verification) publicKey() ([]byte, error) {
+	secret, err := v.refFetcher.GetSecret(v.opts.PublicKeySecretRef.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range secret.Data {
+		if name != ctlconf.SecretCosignPublicKey {
+			return nil, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
+		}
+	}
+
+	publicKey, found := secret.Data[ctlconf.SecretCosignPublicKey]
+	if !found {
+		return nil, fmt.Errorf("Expected to find '%s' key in secret '%s'", ctlconf.SecretCosignPublicKey, secret.Metadata.Name)
+	}
+
+	return publicKey, nil
+}
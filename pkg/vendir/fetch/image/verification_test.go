@@ -0,0 +1,71 @@
+package image
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestVerificationVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-image-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Fake cosign only accepts signed image with expected key
+	fakeCosign := "#!/bin/sh\n" +
+		"case \"$VENDIR_COSIGN_PUBLIC_KEY\" in *PUBLIC*) ;; *) exit 1;; esac\n" +
+		"case \"$*\" in *unsigned*) echo 'no signatures found' >&2; exit 1;; esac\n"
+
+	err = ioutil.WriteFile(filepath.Join(dir, "cosign"), []byte(fakeCosign), 0700)
+	if err != nil {
+		t.Fatalf("Writing fake cosign: %s", err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+
+	refFetcher := testRefFetcher{ctlconf.Secret{
+		Metadata: ctlconf.GenericMetadata{Name: "cosign-key"},
+		Data: map[string][]byte{
+			ctlconf.SecretCosignPublicKey: []byte("-----BEGIN PUBLIC KEY-----\nYWJj\n-----END PUBLIC KEY-----\n"),
+		},
+	}}
+
+	opts := ctlconf.DirectoryContentsImageVerification{
+		PublicKeySecretRef: &ctlconf.DirectoryContentsLocalRef{Name: "cosign-key"},
+	}
+
+	verification := NewVerification(opts, refFetcher, ctlfetch.ProxyOpts{})
+
+	identity, err := verification.Verify(context.Background(), "registry.io/signed@sha256:abc")
+	if err != nil {
+		t.Fatalf("Expected signed image to be verified: %s", err)
+	}
+	if !strings.HasPrefix(identity, "sha256:") {
+		t.Fatalf("Expected public key fingerprint to be returned, but was '%s'", identity)
+	}
+
+	_, err = verification.Verify(context.Background(), "registry.io/unsigned@sha256:abc")
+	if err == nil || !strings.Contains(err.Error(), "no signatures found") {
+		t.Fatalf("Expected unsigned image to be rejected, but was: %v", err)
+	}
+}
+
+type testRefFetcher struct {
+	secret ctlconf.Secret
+}
+
+func (f testRefFetcher) GetSecret(string) (ctlconf.Secret, error) { return f.secret, nil }
+
+func (f testRefFetcher) GetConfigMap(string) (ctlconf.ConfigMap, error) {
+	return ctlconf.ConfigMap{}, nil
+}
@@ -21,6 +21,26 @@ func MoveDir(path, dstPath string) error {
 	return nil
 }
 
+// MoveSubDir moves only given directory within path
+// (e.g. nested directory of unpacked archive) to destination
+func MoveSubDir(path, subPath, dstPath string) error {
+	if len(subPath) == 0 {
+		return MoveDir(path, dstPath)
+	}
+
+	newPath, err := ScopedPath(path, subPath)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(newPath)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("Expected sub path '%s' to be a directory within fetched contents", subPath)
+	}
+
+	return MoveDir(newPath, dstPath)
+}
+
 func ScopedPath(path, subPath string) (string, error) {
 	path, err := filepath.Abs(path)
 	if err != nil {
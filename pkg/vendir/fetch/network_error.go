@@ -0,0 +1,59 @@
+package fetch
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// Errors of external tools (git, hg, helm, etc.) are only available as text
+var networkErrorMsgs = []string{
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"no such host",
+	"connection refused",
+	"connection reset",
+	"connection timed out",
+	"operation timed out",
+	"i/o timeout",
+	"network is unreachable",
+	"no route to host",
+	"failed to connect",
+	"could not connect",
+	"tls handshake timeout",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// IsNetworkError returns true when error indicates that remote
+// source could not be reached (as opposed to e.g. missing ref
+// or checksum mismatch)
+func IsNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+
+	// Not every net.Error is a connectivity error (e.g. url.Error
+	// wrapping certificate verification failure)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	for _, networkErrorMsg := range networkErrorMsgs {
+		if strings.Contains(msg, networkErrorMsg) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+type bytesProgressKey struct{}
+
+// BytesProgressFunc is called with number of bytes
+// downloaded since previous call
+type BytesProgressFunc func(n int64)
+
+// WithBytesProgress returns context that carries function
+// notified about downloaded bytes by fetchers
+func WithBytesProgress(ctx context.Context, progressFunc BytesProgressFunc) context.Context {
+	return context.WithValue(ctx, bytesProgressKey{}, progressFunc)
+}
+
+// NewBytesProgressWriter returns writer that reports number of written bytes
+// to progress function carried by given context (if any)
+func NewBytesProgressWriter(ctx context.Context) io.Writer {
+	progressFunc, ok := ctx.Value(bytesProgressKey{}).(BytesProgressFunc)
+	if !ok || progressFunc == nil {
+		return ioutil.Discard
+	}
+	return bytesProgressWriter{progressFunc}
+}
+
+type bytesProgressWriter struct {
+	progressFunc BytesProgressFunc
+}
+
+func (w bytesProgressWriter) Write(p []byte) (int, error) {
+	w.progressFunc(int64(len(p)))
+	return len(p), nil
+}
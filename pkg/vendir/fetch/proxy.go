@@ -0,0 +1,145 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyOpts explicitly configures proxy used for network fetches.
+// When present it takes precedence over proxy environment variables.
+type ProxyOpts struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	// Comma separated list of hosts, domains (e.g. .example.com),
+	// IPs or CIDRs that should be accessed directly; '*' disables proxy
+	NoProxy string
+
+	// PEM encoded CA certificates trusted by all HTTPS requests in addition
+	// to system roots (populated by NewCABundle)
+	CACerts []byte
+	// File with above CA certificates combined with system CA certificates
+	// for tools that only trust given CA file (e.g. helm)
+	CACertsPath string
+}
+
+func (o ProxyOpts) IsPresent() bool {
+	return len(o.HTTPProxy) > 0 || len(o.HTTPSProxy) > 0 || len(o.NoProxy) > 0
+}
+
+// Env returns environment variables (in both upper and lower case forms
+// understood by git, helm, etc.) that override ones inherited from parent process
+func (o ProxyOpts) Env() []string {
+	var env []string
+
+	if len(o.CACertsPath) > 0 {
+		// Respected by Go based tools (helm, imgpkg) and OpenSSL
+		env = append(env, "SSL_CERT_FILE="+o.CACertsPath)
+	}
+
+	if !o.IsPresent() {
+		return env
+	}
+
+	for _, kv := range [][]string{
+		{"HTTP_PROXY", o.HTTPProxy},
+		{"HTTPS_PROXY", o.HTTPSProxy},
+		{"NO_PROXY", o.NoProxy},
+	} {
+		env = append(env, kv[0]+"="+kv[1], strings.ToLower(kv[0])+"="+kv[1])
+	}
+
+	return env
+}
+
+// HTTPClient returns client that uses configured proxy and CA certificates
+// (or default client if neither is configured)
+func (o ProxyOpts) HTTPClient() *http.Client {
+	if !o.IsPresent() && len(o.CACerts) == 0 {
+		return http.DefaultClient
+	}
+
+	return o.HTTPClientWithTLS(&tls.Config{})
+}
+
+// ProxyURL returns explicitly configured proxy for a given URL
+// (nil if proxy is not configured or URL bypasses it)
+func (o ProxyOpts) ProxyURL(reqURL *url.URL) (*url.URL, error) {
+	return o.proxyURL(&http.Request{URL: reqURL})
+}
+
+func (o ProxyOpts) proxyURL(req *http.Request) (*url.URL, error) {
+	proxy := o.HTTPProxy
+	if req.URL.Scheme == "https" {
+		proxy = o.HTTPSProxy
+	}
+
+	if len(proxy) == 0 || o.bypassesProxy(req.URL) {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || len(proxyURL.Host) == 0 {
+		// Allow proxy to be specified without scheme (e.g. proxy.corp:3128)
+		return url.Parse("http://" + proxy)
+	}
+
+	return proxyURL, nil
+}
+
+func (o ProxyOpts) bypassesProxy(reqURL *url.URL) bool {
+	host := reqURL.Hostname()
+	port := reqURL.Port()
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	for _, entry := range strings.Split(o.NoProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+
+		switch {
+		case len(entry) == 0:
+			continue
+
+		case entry == "*":
+			return true
+		}
+
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort, err := net.SplitHostPort(entry)
+		if err == nil {
+			if entryPort != port {
+				continue
+			}
+			entry = entryHost
+		}
+
+		entry = strings.TrimPrefix(entry, "*")
+		host = strings.ToLower(host)
+
+		if strings.HasPrefix(entry, ".") {
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return true
+			}
+		} else if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+
+	return false
+}
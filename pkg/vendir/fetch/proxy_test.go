@@ -0,0 +1,50 @@
+package fetch_test
+
+import (
+	"net/http"
+	"testing"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestProxyOptsHonorsNoProxy(t *testing.T) {
+	opts := ctlfetch.ProxyOpts{
+		HTTPProxy:  "proxy.corp:3128",
+		HTTPSProxy: "https://secure-proxy.corp:3129",
+		NoProxy:    "internal.corp, 10.0.0.0/8, .example.com",
+	}
+
+	proxyFunc := opts.HTTPClient().Transport.(*http.Transport).Proxy
+
+	cases := map[string]string{
+		"http://github.com/file":         "http://proxy.corp:3128",
+		"https://github.com/file":        "https://secure-proxy.corp:3129",
+		"https://internal.corp/file":     "",
+		"https://git.internal.corp/file": "",
+		"http://10.1.2.3/file":           "",
+		"https://example.com/file":       "",
+		"https://www.example.com/file":   "",
+		"https://notexample.com/file":    "https://secure-proxy.corp:3129",
+	}
+
+	for reqURL, expectedProxy := range cases {
+		req, err := http.NewRequest("GET", reqURL, nil)
+		if err != nil {
+			t.Fatalf("Building request: %s", err)
+		}
+
+		proxyURL, err := proxyFunc(req)
+		if err != nil {
+			t.Fatalf("Expected proxy to be resolved: %s", err)
+		}
+
+		var actualProxy string
+		if proxyURL != nil {
+			actualProxy = proxyURL.String()
+		}
+
+		if actualProxy != expectedProxy {
+			t.Fatalf("Expected proxy for '%s' to be '%s', but was '%s'", reqURL, expectedProxy, actualProxy)
+		}
+	}
+}
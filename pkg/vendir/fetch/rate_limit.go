@@ -0,0 +1,105 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type rateLimitersKey struct{}
+
+// RateLimiter limits number of bytes transferred per second;
+// it's safe to share it between concurrent downloads
+type RateLimiter struct {
+	bytesPerSec int64
+
+	lock sync.Mutex
+	// Time when previously reserved bytes are considered transferred
+	next time.Time
+}
+
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{bytesPerSec: bytesPerSec}
+}
+
+// WithRateLimiter returns context that carries rate limiter applied to downloads
+// by fetchers in addition to rate limiters already carried by given context
+func WithRateLimiter(ctx context.Context, limiter *RateLimiter) context.Context {
+	limiters, _ := ctx.Value(rateLimitersKey{}).([]*RateLimiter)
+	newLimiters := append(append([]*RateLimiter{}, limiters...), limiter)
+	return context.WithValue(ctx, rateLimitersKey{}, newLimiters)
+}
+
+// NewRateLimitedReader returns reader that is throttled by rate limiters
+// carried by given context (or given reader if there are none)
+func NewRateLimitedReader(ctx context.Context, reader io.Reader) io.Reader {
+	limiters, _ := ctx.Value(rateLimitersKey{}).([]*RateLimiter)
+	if len(limiters) == 0 {
+		return reader
+	}
+	return rateLimitedReader{ctx, reader, limiters}
+}
+
+// wait blocks until given number of bytes may be transferred
+func (l *RateLimiter) wait(ctx context.Context, n int) error {
+	l.lock.Lock()
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSec))
+
+	l.lock.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// chunkSize keeps individual reads small enough so that
+// transfer is spread out evenly within each second
+func (l *RateLimiter) chunkSize() int {
+	size := l.bytesPerSec / 10
+	if size < 1 {
+		size = 1
+	}
+	return int(size)
+}
+
+type rateLimitedReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	limiters []*RateLimiter
+}
+
+func (r rateLimitedReader) Read(p []byte) (int, error) {
+	for _, limiter := range r.limiters {
+		if chunkSize := limiter.chunkSize(); len(p) > chunkSize {
+			p = p[:chunkSize]
+		}
+	}
+
+	n, err := r.reader.Read(p)
+
+	for _, limiter := range r.limiters {
+		if n > 0 {
+			waitErr := limiter.wait(r.ctx, n)
+			if waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,31 @@
+package fetch_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestRateLimitedReaderUsesLowestLimit(t *testing.T) {
+	ctx := ctlfetch.WithRateLimiter(context.Background(), ctlfetch.NewRateLimiter(1000*1000))
+	ctx = ctlfetch.WithRateLimiter(ctx, ctlfetch.NewRateLimiter(1000))
+
+	start := time.Now()
+
+	bs, err := ioutil.ReadAll(ctlfetch.NewRateLimitedReader(ctx, bytes.NewReader(make([]byte, 500))))
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+	if len(bs) != 500 {
+		t.Fatalf("Expected to read all bytes, but read %d", len(bs))
+	}
+
+	// First chunk is not delayed, rest of 500 bytes take ~0.4s at 1000 bytes/sec
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("Expected read to be throttled, but took %s", elapsed)
+	}
+}
@@ -0,0 +1,112 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type RetryOpts struct {
+	Retries int
+	Backoff time.Duration
+}
+
+// NonRetryableError indicates failure that would not go away
+// when retried (e.g. checksum mismatch)
+type NonRetryableError struct {
+	Err error
+}
+
+func NewNonRetryableError(err error) NonRetryableError {
+	return NonRetryableError{err}
+}
+
+func (e NonRetryableError) Error() string { return e.Err.Error() }
+func (e NonRetryableError) Unwrap() error { return e.Err }
+
+// Server failures reported by external tools (git, helm, imgpkg, etc.)
+// are only available as text
+var retryableErrorMsgs = []string{
+	"500 internal server error",
+	"429 too many requests",
+	"the requested url returned error: 5",
+	"the requested url returned error: 429",
+}
+
+// HTTPStatusError indicates that server responded with unexpected status
+type HTTPStatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func NewHTTPStatusError(statusCode int, err error) HTTPStatusError {
+	return HTTPStatusError{statusCode, err}
+}
+
+func (e HTTPStatusError) Error() string { return e.Err.Error() }
+func (e HTTPStatusError) Unwrap() error { return e.Err }
+
+// IsRetryableError returns true when error is likely transient:
+// remote source could not be reached, server failed or rate limited request
+func IsRetryableError(err error) bool {
+	var nonRetryableErr NonRetryableError
+	if errors.As(err, &nonRetryableErr) {
+		return false
+	}
+
+	var statusErr HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	if IsNetworkError(err) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	for _, retryableErrorMsg := range retryableErrorMsgs {
+		if strings.Contains(msg, retryableErrorMsg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run calls given function until it succeeds or retries are exhausted.
+// Only retryable errors (see IsRetryableError) are retried.
+// Backoff is doubled after each attempt with added random jitter;
+// waiting for next attempt stops once context is done.
+func (o RetryOpts) Run(ctx context.Context, fn func() error) error {
+	backoff := o.Backoff
+	attempts := 0
+
+	for {
+		attempts++
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if !IsRetryableError(err) || attempts > o.Retries {
+			if attempts > 1 {
+				return fmt.Errorf("%s (attempts: %d)", err, attempts)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s (attempts: %d)", err, attempts)
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))):
+		}
+
+		backoff *= 2
+	}
+}
@@ -0,0 +1,90 @@
+package fetch_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+func TestRetryOptsRetriesUntilExhausted(t *testing.T) {
+	var calls int
+
+	err := ctlfetch.RetryOpts{Retries: 2}.Run(context.Background(), func() error {
+		calls++
+		return fmt.Errorf("connection reset")
+	})
+	if err == nil || !strings.Contains(err.Error(), "(attempts: 3)") {
+		t.Fatalf("Expected error to include attempts, but was: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 calls, but was %d", calls)
+	}
+}
+
+func TestRetryOptsDoesNotRetryNonRetryableErrors(t *testing.T) {
+	var calls int
+
+	err := ctlfetch.RetryOpts{Retries: 2}.Run(context.Background(), func() error {
+		calls++
+		return fmt.Errorf("Downloading URL: %w", ctlfetch.NewNonRetryableError(fmt.Errorf("digest mismatch")))
+	})
+	if err == nil || err.Error() != "Downloading URL: digest mismatch" {
+		t.Fatalf("Expected error to be returned as is, but was: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected 1 call, but was %d", calls)
+	}
+}
+
+func TestRetryOptsOnlyRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		err           error
+		expectedCalls int
+	}{
+		{fmt.Errorf("Downloading URL: %w", ctlfetch.NewHTTPStatusError(404, fmt.Errorf("Expected 200 OK, but was '404 Not Found'"))), 1},
+		{fmt.Errorf("Downloading URL: %w", ctlfetch.NewHTTPStatusError(401, fmt.Errorf("Expected 200 OK, but was '401 Unauthorized'"))), 1},
+		{fmt.Errorf("Downloading URL: %w", ctlfetch.NewHTTPStatusError(500, fmt.Errorf("Expected 200 OK, but was '500 Internal Server Error'"))), 3},
+		{fmt.Errorf("Downloading URL: %w", ctlfetch.NewHTTPStatusError(429, fmt.Errorf("Expected 200 OK, but was '429 Too Many Requests'"))), 3},
+		{fmt.Errorf("fatal: unable to access 'https://host/repo/': The requested URL returned error: 503"), 3},
+		{fmt.Errorf("fatal: couldn't find remote ref refs/heads/missing"), 1},
+	}
+
+	for _, test := range tests {
+		var calls int
+
+		_ = ctlfetch.RetryOpts{Retries: 2}.Run(context.Background(), func() error {
+			calls++
+			return test.err
+		})
+		if calls != test.expectedCalls {
+			t.Fatalf("Expected %d calls for error '%s', but was %d", test.expectedCalls, test.err, calls)
+		}
+	}
+}
+
+func TestRetryOptsStopsWaitingWhenContextIsDone(t *testing.T) {
+	var calls int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+
+	err := ctlfetch.RetryOpts{Retries: 2, Backoff: time.Minute}.Run(ctx, func() error {
+		calls++
+		return fmt.Errorf("connection reset")
+	})
+	if err == nil || err.Error() != "connection reset (attempts: 1)" {
+		t.Fatalf("Expected last error to be returned, but was: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected 1 call, but was %d", calls)
+	}
+	if duration := time.Since(startTime); duration > 10*time.Second {
+		t.Fatalf("Expected backoff to be interrupted, but run took %s", duration)
+	}
+}
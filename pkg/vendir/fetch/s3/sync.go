@@ -0,0 +1,263 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type Sync struct {
+	opts       ctlconf.DirectoryContentsS3
+	awsBinary  string
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewSync(opts ctlconf.DirectoryContentsS3, awsBinary string,
+	refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) *Sync {
+
+	if len(awsBinary) == 0 {
+		awsBinary = "aws"
+	}
+
+	return &Sync{opts, awsBinary, refFetcher, proxy}
+}
+
+func (t *Sync) Desc() string {
+	return fmt.Sprintf("s3://%s/%s", t.opts.Bucket, t.opts.Prefix)
+}
+
+func (t *Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsS3, error) {
+	lockConf := ctlconf.LockDirectoryContentsS3{}
+
+	if len(t.opts.Bucket) == 0 {
+		return lockConf, fmt.Errorf("Expected non-empty bucket")
+	}
+
+	env, err := t.env()
+	if err != nil {
+		return lockConf, err
+	}
+
+	var objects []s3Object
+
+	if len(t.opts.LockedObjects) > 0 {
+		for _, obj := range t.opts.LockedObjects {
+			objects = append(objects, s3Object{Key: obj.Key, ETag: `"` + obj.ETag + `"`, VersionID: obj.VersionID})
+		}
+	} else {
+		objects, err = t.listObjects(ctx, env)
+		if err != nil {
+			return lockConf, fmt.Errorf("Listing objects: %s", err)
+		}
+	}
+
+	incomingTmpPath, err := tempArea.NewTempDir("s3")
+	if err != nil {
+		return lockConf, err
+	}
+
+	defer os.RemoveAll(incomingTmpPath)
+
+	for _, obj := range objects {
+		relPath, found := t.relPath(obj.Key)
+
+		// Skip "directory" placeholder objects
+		if !found || len(relPath) == 0 || strings.HasSuffix(relPath, "/") {
+			continue
+		}
+
+		path, err := ctlfetch.ScopedPath(incomingTmpPath, relPath)
+		if err != nil {
+			return lockConf, fmt.Errorf("Placing object '%s': %s", obj.Key, err)
+		}
+
+		lockObj, err := t.downloadObject(ctx, obj, path, env)
+		if err != nil {
+			return lockConf, fmt.Errorf("Downloading object '%s': %s", obj.Key, err)
+		}
+
+		lockConf.Objects = append(lockConf.Objects, lockObj)
+	}
+
+	if len(lockConf.Objects) == 0 {
+		return lockConf, fmt.Errorf("Expected to find at least one object under '%s', but found none", t.Desc())
+	}
+
+	err = ctlfetch.MoveDir(incomingTmpPath, dstPath)
+	if err != nil {
+		return lockConf, err
+	}
+
+	return lockConf, nil
+}
+
+// relPath returns object path relative to prefix; prefix is matched
+// at path separator (e.g. prefix "dir" includes "dir/file" but not
+// "dir-other/file") or as a whole key (e.g. "dir/file")
+func (t *Sync) relPath(key string) (string, bool) {
+	prefix := t.opts.Prefix
+
+	switch {
+	case len(prefix) == 0:
+		return key, true
+	case strings.HasSuffix(prefix, "/"):
+	case key == prefix:
+		return path.Base(key), true
+	default:
+		prefix += "/"
+	}
+
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(key, prefix), true
+}
+
+type s3ListObjectsOutput struct {
+	Contents []s3Object
+}
+
+type s3Object struct {
+	Key  string
+	ETag string
+	// Only known for objects recorded in lock configuration
+	VersionID string `json:"-"`
+}
+
+type s3GetObjectOutput struct {
+	ETag      string
+	VersionId string
+}
+
+func (t *Sync) listObjects(ctx context.Context, env []string) ([]s3Object, error) {
+	args := []string{"s3api", "list-objects-v2", "--bucket", t.opts.Bucket, "--output", "json"}
+
+	if len(t.opts.Prefix) > 0 {
+		args = append(args, "--prefix", t.opts.Prefix)
+	}
+
+	out, err := t.run(ctx, args, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty listing produces no output at all
+	if len(strings.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+
+	var listOut s3ListObjectsOutput
+
+	err = json.Unmarshal([]byte(out), &listOut)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshaling objects list: %s", err)
+	}
+
+	return listOut.Contents, nil
+}
+
+func (t *Sync) downloadObject(ctx context.Context, obj s3Object, dstPath string, env []string) (ctlconf.LockDirectoryContentsS3Object, error) {
+	lockObj := ctlconf.LockDirectoryContentsS3Object{Key: obj.Key}
+
+	err := os.MkdirAll(filepath.Dir(dstPath), 0700)
+	if err != nil {
+		return lockObj, fmt.Errorf("Making intermediate dir: %s", err)
+	}
+
+	// Make sure object did not change since it was listed (or locked)
+	args := []string{"s3api", "get-object", "--bucket", t.opts.Bucket,
+		"--key", obj.Key, "--if-match", obj.ETag, "--output", "json"}
+
+	// Fetch exact version recorded in lock configuration (if bucket is versioned)
+	if len(obj.VersionID) > 0 {
+		args = append(args, "--version-id", obj.VersionID)
+	}
+
+	args = append(args, dstPath)
+
+	out, err := t.run(ctx, args, env)
+	if err != nil {
+		return lockObj, err
+	}
+
+	var getOut s3GetObjectOutput
+
+	err = json.Unmarshal([]byte(out), &getOut)
+	if err != nil {
+		return lockObj, fmt.Errorf("Unmarshaling object metadata: %s", err)
+	}
+
+	lockObj.ETag = strings.Trim(getOut.ETag, `"`)
+	lockObj.VersionID = getOut.VersionId
+
+	if len(obj.VersionID) > 0 && lockObj.VersionID != obj.VersionID {
+		return lockObj, fmt.Errorf("Expected version ID '%s' but was '%s'", obj.VersionID, lockObj.VersionID)
+	}
+
+	return lockObj, nil
+}
+
+func (t *Sync) run(ctx context.Context, args []string, env []string) (string, error) {
+	if len(t.opts.Region) > 0 {
+		args = append(args, "--region", t.opts.Region)
+	}
+	if len(t.opts.Endpoint) > 0 {
+		args = append(args, "--endpoint-url", t.opts.Endpoint)
+	}
+
+	var stdoutBs, stderrBs bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, t.awsBinary, args...)
+	cmd.Env = env
+	cmd.Stdout = &stdoutBs
+	cmd.Stderr = &stderrBs
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("AWS CLI %s: %s (stderr: %s)", args[1], err, stderrBs.String())
+	}
+
+	return stdoutBs.String(), nil
+}
+
+func (t *Sync) env() ([]string, error) {
+	env := append(os.Environ(), t.proxy.Env()...)
+
+	if t.opts.SecretRef == nil {
+		return env, nil
+	}
+
+	secret, err := t.refFetcher.GetSecret(t.opts.SecretRef.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, val := range secret.Data {
+		switch name {
+		case ctlconf.SecretS3AccessKeyID:
+			env = append(env, "AWS_ACCESS_KEY_ID="+string(val))
+		case ctlconf.SecretS3SecretAccessKey:
+			env = append(env, "AWS_SECRET_ACCESS_KEY="+string(val))
+		case ctlconf.SecretS3SessionToken:
+			env = append(env, "AWS_SESSION_TOKEN="+string(val))
+		default:
+			return nil, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, secret.Metadata.Name)
+		}
+	}
+
+	return env, nil
+}
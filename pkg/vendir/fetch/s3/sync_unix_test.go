@@ -0,0 +1,181 @@
+//go:build !windows
+// +build !windows
+
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package s3_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctls3 "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/s3"
+)
+
+// fakeAws serves a bucket with a single object (ETag "etag1", version "v1")
+// next to a sibling object that shares key prefix (listed when given prefix
+// matches it) and records its invocations; get-object preconditions are enforced
+const fakeAws = `#!/bin/sh
+echo "$@" >> %s
+case "$2" in
+  list-objects-v2)
+    while [ $# -gt 1 ]; do
+      [ "$1" = "--prefix" ] && prefix="$2"
+      shift
+    done
+    case "prefix-sibling/file.txt" in
+      "$prefix"*) sibling=', {"Key": "prefix-sibling/file.txt", "ETag": "\"etag1\""}' ;;
+    esac
+    echo '{"Contents": [{"Key": "prefix/", "ETag": "\"dir\""}, {"Key": "prefix/file.txt", "ETag": "\"etag1\""}'"$sibling"']}' ;;
+  get-object)
+    while [ $# -gt 1 ]; do
+      case "$1" in
+        --if-match) [ "$2" = '"etag1"' ] || { echo "An error occurred (PreconditionFailed)" >&2; exit 254; } ;;
+        --version-id) [ "$2" = "v1" ] || { echo "An error occurred (NoSuchVersion)" >&2; exit 254; } ;;
+      esac
+      shift
+    done
+    printf content > "$1"
+    echo '{"ETag": "\"etag1\"", "VersionId": "v1"}' ;;
+esac
+`
+
+func TestSyncWithLockedObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-s3-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "aws.log")
+	awsPath := filepath.Join(dir, "aws")
+
+	err = ioutil.WriteFile(awsPath, []byte(fmt.Sprintf(fakeAws, logPath)), 0700)
+	if err != nil {
+		t.Fatalf("Writing fake aws: %s", err)
+	}
+
+	sync := func(opts ctlconf.DirectoryContentsS3, dstName string) (ctlconf.LockDirectoryContentsS3, []string, error) {
+		os.Remove(logPath)
+
+		dstPath := filepath.Join(dir, dstName)
+
+		lockConf, err := ctls3.NewSync(opts, awsPath, ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).
+			Sync(context.Background(), dstPath, testTempArea{dir})
+
+		logBs, _ := ioutil.ReadFile(logPath)
+		calls := strings.Split(strings.TrimSpace(string(logBs)), "\n")
+
+		if err == nil {
+			bs, err := ioutil.ReadFile(filepath.Join(dstPath, "file.txt"))
+			if err != nil || string(bs) != "content" {
+				t.Fatalf("Expected downloaded content to match: %v", err)
+			}
+		}
+
+		return lockConf, calls, err
+	}
+
+	opts := ctlconf.DirectoryContentsS3{Bucket: "bucket", Prefix: "prefix/"}
+
+	lockConf, calls, err := sync(opts, "unlocked")
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	expectedLockConf := ctlconf.LockDirectoryContentsS3{
+		Objects: []ctlconf.LockDirectoryContentsS3Object{{Key: "prefix/file.txt", ETag: "etag1", VersionID: "v1"}},
+	}
+	if !reflect.DeepEqual(lockConf, expectedLockConf) {
+		t.Fatalf("Expected ETag and version to be recorded, but was: %#v", lockConf)
+	}
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "s3api list-objects-v2") {
+		t.Fatalf("Expected bucket to be listed, but calls were: %#v", calls)
+	}
+
+	err = opts.Lock(&lockConf)
+	if err != nil {
+		t.Fatalf("Expected locking to succeed: %s", err)
+	}
+
+	_, calls, err = sync(opts, "locked")
+	if err != nil {
+		t.Fatalf("Expected locked sync to succeed: %s", err)
+	}
+	if len(calls) != 1 || !strings.Contains(calls[0], `--if-match "etag1" --output json --version-id v1 `) {
+		t.Fatalf("Expected locked version to be fetched without listing, but calls were: %#v", calls)
+	}
+
+	changedOpts := ctlconf.DirectoryContentsS3{Bucket: "bucket", Prefix: "prefix/"}
+
+	err = changedOpts.Lock(&ctlconf.LockDirectoryContentsS3{
+		Objects: []ctlconf.LockDirectoryContentsS3Object{{Key: "prefix/file.txt", ETag: "etag0"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected locking to succeed: %s", err)
+	}
+
+	_, _, err = sync(changedOpts, "changed")
+	if err == nil || !strings.Contains(err.Error(), "PreconditionFailed") {
+		t.Fatalf("Expected changed object to fail locked sync, but was: %v", err)
+	}
+}
+
+func TestSyncMatchesPrefixAtPathSeparator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-s3-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	awsPath := filepath.Join(dir, "aws")
+
+	err = ioutil.WriteFile(awsPath, []byte(fmt.Sprintf(fakeAws, filepath.Join(dir, "aws.log"))), 0700)
+	if err != nil {
+		t.Fatalf("Writing fake aws: %s", err)
+	}
+
+	// Prefix may name a "directory" (with or without trailing slash) or a single object
+	for i, prefix := range []string{"prefix", "prefix/file.txt"} {
+		dstPath := filepath.Join(dir, fmt.Sprintf("dst%d", i))
+
+		lockConf, err := ctls3.NewSync(ctlconf.DirectoryContentsS3{Bucket: "bucket", Prefix: prefix}, awsPath,
+			ctlfetch.NoopRefFetcher{}, ctlfetch.ProxyOpts{}).Sync(context.Background(), dstPath, testTempArea{dir})
+		if err != nil {
+			t.Fatalf("Expected sync of prefix '%s' to succeed: %s", prefix, err)
+		}
+
+		expectedLockConf := ctlconf.LockDirectoryContentsS3{
+			Objects: []ctlconf.LockDirectoryContentsS3Object{{Key: "prefix/file.txt", ETag: "etag1", VersionID: "v1"}},
+		}
+		if !reflect.DeepEqual(lockConf, expectedLockConf) {
+			t.Fatalf("Expected sibling object to not be fetched for prefix '%s', but was: %#v", prefix, lockConf)
+		}
+
+		files, err := ioutil.ReadDir(dstPath)
+		if err != nil || len(files) != 1 || files[0].Name() != "file.txt" {
+			t.Fatalf("Expected only object under prefix '%s' to be placed, but was: %v (err: %v)", prefix, files, err)
+		}
+	}
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
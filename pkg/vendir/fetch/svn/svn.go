@@ -0,0 +1,204 @@
+package svn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type Svn struct {
+	opts       ctlconf.DirectoryContentsSvn
+	svnBinary  string
+	infoLog    io.Writer
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewSvn(opts ctlconf.DirectoryContentsSvn, svnBinary string,
+	infoLog io.Writer, refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) *Svn {
+
+	return &Svn{opts, svnBinary, infoLog, refFetcher, proxy}
+}
+
+type SvnInfo struct {
+	Revision int64
+}
+
+// Retrieve exports repository tree (without .svn metadata) at
+// configured revision into dstPath which must not exist yet
+func (t *Svn) Retrieve(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (SvnInfo, error) {
+	if len(t.opts.URL) == 0 {
+		return SvnInfo{}, fmt.Errorf("Expected non-empty URL")
+	}
+
+	configDir, err := tempArea.NewTempDir("svn-config")
+	if err != nil {
+		return SvnInfo{}, err
+	}
+
+	defer os.RemoveAll(configDir)
+
+	globalArgs, password, err := t.globalArgs(configDir)
+	if err != nil {
+		return SvnInfo{}, err
+	}
+
+	// Resolve revision first so that exported tree matches recorded revision
+	// even if repository changes in the meantime (e.g. when exporting HEAD)
+	out, err := t.run(ctx, append(globalArgs, "info", "--show-item", "revision",
+		"--revision", t.revision(), t.opts.URL), password)
+	if err != nil {
+		return SvnInfo{}, err
+	}
+
+	rev, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return SvnInfo{}, fmt.Errorf("Parsing svn revision '%s': %s", strings.TrimSpace(out), err)
+	}
+
+	_, err = t.run(ctx, append(globalArgs, "export", "--quiet", "--revision",
+		strconv.FormatInt(rev, 10), t.opts.URL, dstPath), password)
+	if err != nil {
+		return SvnInfo{}, err
+	}
+
+	return SvnInfo{Revision: rev}, nil
+}
+
+func (t *Svn) revision() string {
+	if len(t.opts.Revision) > 0 {
+		return t.opts.Revision
+	}
+	return "HEAD"
+}
+
+func (t *Svn) globalArgs(configDir string) ([]string, *string, error) {
+	authOpts, err := t.getAuthOpts()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Avoid picking up user's svn settings and cached credentials
+	args := []string{"--non-interactive", "--no-auth-cache", "--config-dir", configDir}
+
+	if authOpts.Username != nil {
+		args = append(args, "--username", *authOpts.Username)
+	}
+	if authOpts.Password != nil {
+		args = append(args, "--password-from-stdin")
+	}
+
+	proxyArgs, err := t.proxyArgs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append(args, proxyArgs...), authOpts.Password, nil
+}
+
+// proxyArgs configures proxy and CA certificates via config options
+// since svn does not respect proxy environment variables
+func (t *Svn) proxyArgs() ([]string, error) {
+	var args []string
+
+	if len(t.proxy.CACertsPath) > 0 {
+		args = append(args, "--config-option", "servers:global:ssl-authority-files="+t.proxy.CACertsPath)
+	}
+
+	svnURL, err := url.Parse(t.opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing svn url: %s", err)
+	}
+
+	proxyURL, err := t.proxy.ProxyURL(svnURL)
+	if err != nil || proxyURL == nil {
+		return args, err
+	}
+
+	args = append(args, "--config-option", "servers:global:http-proxy-host="+proxyURL.Hostname())
+
+	if len(proxyURL.Port()) > 0 {
+		args = append(args, "--config-option", "servers:global:http-proxy-port="+proxyURL.Port())
+	}
+
+	if proxyURL.User != nil {
+		args = append(args, "--config-option", "servers:global:http-proxy-username="+proxyURL.User.Username())
+		if password, ok := proxyURL.User.Password(); ok {
+			args = append(args, "--config-option", "servers:global:http-proxy-password="+password)
+		}
+	}
+
+	return args, nil
+}
+
+func (t *Svn) run(ctx context.Context, args []string, password *string) (string, error) {
+	var stdoutBs, stderrBs bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, t.svnBinary, args...)
+	cmd.Stdout = &stdoutBs
+	cmd.Stderr = io.MultiWriter(t.infoLog, &stderrBs)
+
+	if password != nil {
+		cmd.Stdin = strings.NewReader(*password)
+	}
+
+	t.infoLog.Write([]byte(fmt.Sprintf("--> svn %s\n", strings.Join(t.redactArgs(args), " "))))
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("Svn %s: %s (stderr: %s)", t.redactArgs(args), err, stderrBs.String())
+	}
+
+	return stdoutBs.String(), nil
+}
+
+func (t *Svn) redactArgs(args []string) []string {
+	var result []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "servers:global:http-proxy-password=") {
+			arg = "servers:global:http-proxy-password=<redacted>"
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+type svnAuthOpts struct {
+	Username *string
+	Password *string
+}
+
+func (t *Svn) getAuthOpts() (svnAuthOpts, error) {
+	var opts svnAuthOpts
+
+	if t.opts.SecretRef != nil {
+		secret, err := t.refFetcher.GetSecret(t.opts.SecretRef.Name)
+		if err != nil {
+			return opts, err
+		}
+
+		for name, val := range secret.Data {
+			switch name {
+			case ctlconf.SecretK8sCorev1BasicAuthUsernameKey:
+				username := string(val)
+				opts.Username = &username
+			case ctlconf.SecretK8sCorev1BasicAuthPasswordKey:
+				password := string(val)
+				opts.Password = &password
+			default:
+				return opts, fmt.Errorf("Unknown secret field '%s' in secret '%s'", name, t.opts.SecretRef.Name)
+			}
+		}
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,73 @@
+package svn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+)
+
+type Sync struct {
+	opts       ctlconf.DirectoryContentsSvn
+	svnBinary  string
+	log        io.Writer
+	refFetcher ctlfetch.RefFetcher
+	proxy      ctlfetch.ProxyOpts
+}
+
+func NewSync(opts ctlconf.DirectoryContentsSvn, svnBinary string,
+	log io.Writer, refFetcher ctlfetch.RefFetcher, proxy ctlfetch.ProxyOpts) Sync {
+
+	if len(svnBinary) == 0 {
+		svnBinary = "svn"
+	}
+
+	return Sync{opts, svnBinary, log, refFetcher, proxy}
+}
+
+func (d Sync) Desc() string {
+	rev := "HEAD"
+	if len(d.opts.Revision) > 0 {
+		rev = d.opts.Revision
+	}
+	return fmt.Sprintf("%s@%s", d.opts.URL, rev)
+}
+
+func (d Sync) Sync(ctx context.Context, dstPath string, tempArea ctlfetch.TempArea) (ctlconf.LockDirectoryContentsSvn, error) {
+	svnLockConf := ctlconf.LockDirectoryContentsSvn{}
+
+	incomingTmpPath, err := tempArea.NewTempDir("svn")
+	if err != nil {
+		return svnLockConf, err
+	}
+
+	defer os.RemoveAll(incomingTmpPath)
+
+	// svn export expects destination to not exist
+	exportPath := filepath.Join(incomingTmpPath, "export")
+
+	svn := NewSvn(d.opts, d.svnBinary, d.log, d.refFetcher, d.proxy)
+
+	info, err := svn.Retrieve(ctx, exportPath, tempArea)
+	if err != nil {
+		return svnLockConf, fmt.Errorf("Fetching svn repository: %w", err)
+	}
+
+	svnLockConf.Revision = info.Revision
+
+	err = os.RemoveAll(dstPath)
+	if err != nil {
+		return svnLockConf, fmt.Errorf("Deleting dir %s: %s", dstPath, err)
+	}
+
+	err = os.Rename(exportPath, dstPath)
+	if err != nil {
+		return svnLockConf, fmt.Errorf("Moving directory '%s' to staging dir: %s", exportPath, err)
+	}
+
+	return svnLockConf, nil
+}
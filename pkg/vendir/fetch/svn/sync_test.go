@@ -0,0 +1,82 @@
+package svn_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+	ctlfetch "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch"
+	ctlsvn "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/fetch/svn"
+)
+
+// fakeSvn resolves any revision to 42 and exports a single file
+const fakeSvn = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/args"
+for last; do true; done
+case " $* " in
+  *" info "*) echo 42 ;;
+  *" export "*) mkdir -p "$last" && echo content > "$last/file.txt" ;;
+esac
+`
+
+func TestSyncExportsResolvedRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vendir-svn-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	svnPath := filepath.Join(dir, "svn")
+
+	err = ioutil.WriteFile(svnPath, []byte(fakeSvn), 0700)
+	if err != nil {
+		t.Fatalf("Writing fake svn: %s", err)
+	}
+
+	dstPath := filepath.Join(dir, "dst")
+
+	opts := ctlconf.DirectoryContentsSvn{URL: "https://svn.example.com/repo/trunk"}
+
+	lock, err := ctlsvn.NewSync(opts, svnPath, ioutil.Discard, nil, ctlfetch.ProxyOpts{}).
+		Sync(context.Background(), dstPath, testTempArea{dir})
+	if err != nil {
+		t.Fatalf("Expected sync to succeed: %s", err)
+	}
+
+	if lock.Revision != 42 {
+		t.Fatalf("Expected resolved revision to be locked, but was: %d", lock.Revision)
+	}
+
+	_, err = os.Stat(filepath.Join(dstPath, "file.txt"))
+	if err != nil {
+		t.Fatalf("Expected exported file: %s", err)
+	}
+
+	argsBs, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatalf("Reading fake svn args: %s", err)
+	}
+
+	args := strings.Split(strings.TrimSpace(string(argsBs)), "\n")
+
+	if len(args) != 2 || !strings.Contains(args[0], "info --show-item revision --revision HEAD") ||
+		!strings.Contains(args[1], "export --quiet --revision 42 https://svn.example.com/repo/trunk") {
+		t.Fatalf("Expected HEAD to be resolved before export, but was: %s", argsBs)
+	}
+}
+
+type testTempArea struct {
+	path string
+}
+
+func (a testTempArea) NewTempDir(name string) (string, error) {
+	return ioutil.TempDir(a.path, name)
+}
+
+func (a testTempArea) NewTempFile(pattern string) (*os.File, error) {
+	return ioutil.TempFile(a.path, pattern)
+}
@@ -0,0 +1,118 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+
+	ctlconf "github.com/vmware-tanzu/carvel-vendir/pkg/vendir/config"
+)
+
+// TLSOpts configures client certificate (for mutual TLS) and
+// CA certificates trusted in addition to system roots
+type TLSOpts struct {
+	ClientCert []byte
+	ClientKey  []byte
+	CACert     []byte
+	// Only meant for development against servers with self-signed certificates
+	InsecureSkipVerify bool
+}
+
+// NewTLSOptsFromSecret reads tls.crt, tls.key and ca.crt keys of given secret
+func NewTLSOptsFromSecret(secret ctlconf.Secret) TLSOpts {
+	return TLSOpts{
+		ClientCert: secret.Data[ctlconf.SecretK8sCorev1TLSCertKey],
+		ClientKey:  secret.Data[ctlconf.SecretK8sCorev1TLSPrivateKeyKey],
+		CACert:     secret.Data[ctlconf.SecretCACert],
+	}
+}
+
+// IsTLSSecretKey returns true for secret keys read by NewTLSOptsFromSecret
+func IsTLSSecretKey(name string) bool {
+	switch name {
+	case ctlconf.SecretK8sCorev1TLSCertKey, ctlconf.SecretK8sCorev1TLSPrivateKeyKey, ctlconf.SecretCACert:
+		return true
+	default:
+		return false
+	}
+}
+
+func (o TLSOpts) IsPresent() bool {
+	return len(o.ClientCert) > 0 || len(o.ClientKey) > 0 || len(o.CACert) > 0 || o.InsecureSkipVerify
+}
+
+func (o TLSOpts) Config() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+
+	if len(o.ClientCert) > 0 || len(o.ClientKey) > 0 {
+		if len(o.ClientCert) == 0 || len(o.ClientKey) == 0 {
+			return nil, fmt.Errorf("Expected both client certificate (%s) and key (%s) to be specified",
+				ctlconf.SecretK8sCorev1TLSCertKey, ctlconf.SecretK8sCorev1TLSPrivateKeyKey)
+		}
+
+		cert, err := tls.X509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Expected client certificate and key to be a matching PEM encoded pair: %s", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(o.CACert) > 0 {
+		pool := systemCertPool()
+
+		if !pool.AppendCertsFromPEM(o.CACert) {
+			return nil, fmt.Errorf("Expected CA certificate (%s) to be PEM encoded", ctlconf.SecretCACert)
+		}
+
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// HTTPClientWithTLS returns client that uses configured proxy and given TLS config
+// (configured CA certificates are trusted in addition to ones specified by TLS config)
+func (o ProxyOpts) HTTPClientWithTLS(tlsConfig *tls.Config) *http.Client {
+	if tlsConfig == nil {
+		return o.HTTPClient()
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.IsPresent() {
+		transport.Proxy = o.proxyURL
+	}
+
+	if len(o.CACerts) > 0 {
+		tlsConfig = tlsConfig.Clone()
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = systemCertPool()
+		}
+		// Certificates were validated by NewCABundle
+		tlsConfig.RootCAs.AppendCertsFromPEM(o.CACerts)
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}
+}
+
+// ExplainTLSError adds hint to errors caused by untrusted server certificates
+func ExplainTLSError(err error) error {
+	var unknownAuthErr x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthErr) {
+		return fmt.Errorf("%s (hint: server certificate is not trusted by system roots "+
+			"or CA certificate (%s) specified in secret)", err, ctlconf.SecretCACert)
+	}
+	return err
+}
+
+func systemCertPool() *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return x509.NewCertPool()
+	}
+	return pool
+}
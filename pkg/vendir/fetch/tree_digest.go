@@ -0,0 +1,123 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TreeDigest calculates sha256 digest over relative paths, types
+// and contents of all files within a directory. Walk order is lexical,
+// paths use forward slashes and file modes (e.g. executable bits which
+// are not available on Windows) are not included so that digest
+// does not depend on the platform.
+func TreeDigest(path string) (string, error) {
+	return TreeDigestExcluding(path, nil)
+}
+
+// TreeDigestExcluding calculates TreeDigest without given relative
+// (forward slash) paths, including everything within excluded directories
+func TreeDigestExcluding(path string, excludedPaths []string) (string, error) {
+	hash := sha256.New()
+
+	excluded := map[string]struct{}{}
+	for _, excludedPath := range excludedPaths {
+		excluded[excludedPath] = struct{}{}
+	}
+
+	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+
+		relPath = filepath.ToSlash(relPath)
+
+		if _, found := excluded[relPath]; found {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "symlink %s %s\n", relPath, filepath.ToSlash(target))
+
+		case info.IsDir():
+			fmt.Fprintf(hash, "dir %s\n", relPath)
+
+		default:
+			fileHash, err := FileSHA256(filePath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "file %s %s\n", relPath, fileHash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Calculating digest of directory '%s': %s", path, err)
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// FileSHA256s returns hex encoded sha256 digests of regular files
+// within a directory keyed by their relative (forward slash) paths
+func FileSHA256s(path string) (map[string]string, error) {
+	result := map[string]string{}
+
+	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+
+		result[filepath.ToSlash(relPath)], err = FileSHA256(filePath)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Calculating file digests of directory '%s': %s", path, err)
+	}
+
+	return result, nil
+}
+
+// FileSHA256 returns hex encoded sha256 digest of file contents
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -122,3 +122,25 @@ func (v Semvers) All() []string {
 	}
 	return verStrs
 }
+
+// SortedWithOthers orders versions from highest to lowest semver
+// followed by remaining (non-semver) versions in given order
+func SortedWithOthers(versions []string) []string {
+	semvers := NewSemvers(versions).Sorted().All()
+
+	isSemver := map[string]bool{}
+	var result []string
+
+	for i := len(semvers) - 1; i >= 0; i-- {
+		isSemver[semvers[i]] = true
+		result = append(result, semvers[i])
+	}
+
+	for _, ver := range versions {
+		if !isSemver[ver] {
+			result = append(result, ver)
+		}
+	}
+
+	return result
+}
@@ -5,11 +5,15 @@ import (
 	"crypto/subtle"
 	"net"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestExampleSecrets(t *testing.T) {
-	server := &http.Server{Addr: ":8100", Handler: HTTPBasicAuth(http.FileServer(http.Dir("./../..")))}
+	server := &http.Server{Addr: ":8100", Handler: HTTPBasicAuth(FileHandlerWithoutValidators("./../.."))}
 	errCh := make(chan error)
 
 	go func() {
@@ -29,6 +33,21 @@ func TestExampleSecrets(t *testing.T) {
 	server.Shutdown(context.TODO())
 }
 
+// FileHandlerWithoutValidators serves files without Last-Modified
+// header (based on checkout time) so that lock file is reproducible
+func FileHandlerWithoutValidators(rootPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file, err := os.Open(filepath.Join(rootPath, filepath.FromSlash(path.Clean("/"+r.URL.Path))))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, file)
+	}
+}
+
 func HTTPBasicAuth(handler http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, pass, ok := r.BasicAuth()
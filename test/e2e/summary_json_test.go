@@ -0,0 +1,87 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyncSummaryJSON(t *testing.T) {
+	env := BuildEnv(t)
+	vendir := Vendir{t, env.BinaryPath, Logger{}}
+
+	dir, err := ioutil.TempDir("", "vendir-summary-json-test")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := `
+apiVersion: vendir.k14s.io/v1alpha1
+kind: Config
+directories:
+- path: vendor
+  contents:
+  - path: inline
+    inline:
+      paths:
+        file.txt: content
+`
+
+	err = ioutil.WriteFile(filepath.Join(dir, "vendir.yml"), []byte(config), 0600)
+	if err != nil {
+		t.Fatalf("Writing config: %s", err)
+	}
+
+	out, err := vendir.RunWithOpts([]string{"sync"}, RunOpts{Dir: dir})
+	if err != nil {
+		t.Fatalf("Expected no err: %s", err)
+	}
+	if !strings.Contains(out, "vendor/inline\tinline") {
+		t.Fatalf("Expected summary table by default, but was: %s", out)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	_, err = vendir.RunWithOpts([]string{"sync", "--summary-json", "--diff"},
+		RunOpts{Dir: dir, StdoutWriter: &stdout, StderrWriter: &stderr})
+	if err != nil {
+		t.Fatalf("Expected no err: %s", err)
+	}
+
+	var summaries []map[string]interface{}
+
+	err = json.Unmarshal(stdout.Bytes(), &summaries)
+	if err != nil {
+		t.Fatalf("Expected stdout to only contain JSON summary: %s (stdout: %s)", err, stdout.String())
+	}
+
+	if len(summaries) != 1 || summaries[0]["path"] != "vendor" {
+		t.Fatalf("Expected single directory summary, but was: %#v", summaries)
+	}
+
+	contents, ok := summaries[0]["contents"].([]interface{})
+	if !ok || len(contents) != 1 {
+		t.Fatalf("Expected single contents summary, but was: %#v", summaries[0]["contents"])
+	}
+
+	con := contents[0].(map[string]interface{})
+	delete(con, "duration")
+
+	expectedCon := map[string]interface{}{"path": "inline", "type": "inline", "bytes": float64(len("content"))}
+	if !reflect.DeepEqual(con, expectedCon) {
+		t.Fatalf("Expected contents summary to match, but was: %#v", con)
+	}
+
+	if _, found := summaries[0]["diff"]; !found {
+		t.Fatalf("Expected diff to be included in summary, but was: %#v", summaries[0])
+	}
+	if !strings.Contains(stderr.String(), "Succeeded") {
+		t.Fatalf("Expected other output to be written to stderr, but was: %s", stderr.String())
+	}
+}